@@ -76,6 +76,17 @@ func checkConfigs(c *configs.Config) error {
 			return fmt.Errorf("configuration '%s' is empty", c.name)
 		}
 	}
+
+	if backend := c.Runner.GetBackend(); !utils.StrInArray(backend,
+		iac_common.RunnerBackendDocker, iac_common.RunnerBackendKubernetes) {
+		return fmt.Errorf("invalid configuration 'runner.backend': %s", backend)
+	}
+	// hostPath 方式挂载任务目录时必须将任务 pod 调度到 runner 所在节点
+	if k8s := c.Runner.Kubernetes; c.Runner.GetBackend() == iac_common.RunnerBackendKubernetes &&
+		k8s.WorkspacePVC == "" && k8s.GetNodeName() == "" {
+		return fmt.Errorf("configuration 'runner.kubernetes.node_name' is empty, " +
+			"set it (or the NODE_NAME environment variable) when 'runner.kubernetes.workspace_pvc' is not set")
+	}
 	return nil
 }
 
@@ -90,6 +101,7 @@ func ensureDirs() error {
 		c.PluginCachePath,
 		c.ProviderPath(),
 		c.AbsTfenvVersionsCachePath(),
+		c.AbsTofuenvVersionsCachePath(),
 	} {
 		if path == "" {
 			continue
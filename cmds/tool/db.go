@@ -6,6 +6,7 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
 	"fmt"
 	"os"
 	"strings"
@@ -49,9 +50,8 @@ func UpdateResourceData(data *UpdateDb) error {
 	sess, t := db.Get(), time.Now()
 
 	fmt.Println("start to search all tfstate.json")
-	var tfstateRecords []models.DBStorage
-	if err := sess.Model(&models.DBStorage{}).Where("path LIKE ?", "%tfstate.json").
-		Select("path", "content").Find(&tfstateRecords); err != nil {
+	tfstateRecords, err := loadTaskStateJsons(sess)
+	if err != nil {
 		return err
 	}
 
@@ -88,6 +88,31 @@ func UpdateResourceData(data *UpdateDb) error {
 	return nil
 }
 
+// loadTaskStateJsons 读取部署类任务的 tfstate.json，
+// 日志存储不是数据库(或者已通过 migrate-log 迁移)时文件不在 iac_storage 表中，所以需要通过 logstorage 读取
+func loadTaskStateJsons(sess *db.Session) ([]models.DBStorage, error) {
+	tasks := make([]*models.Task, 0)
+	if err := sess.Model(&models.Task{}).Where("type IN (?)", []string{models.TaskTypeApply, models.TaskTypeDestroy,
+		models.TaskTypeStateRestore, models.TaskTypeImport, models.TaskTypeStateOperation}).
+		Select("id", "project_id", "env_id").Find(&tasks); err != nil {
+		return nil, err
+	}
+
+	records := make([]models.DBStorage, 0, len(tasks))
+	for _, task := range tasks {
+		path := task.StateJsonPath()
+		content, err := logstorage.Get().Read(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("read %s error: %v", path, err)
+		}
+		records = append(records, models.DBStorage{Path: path, Content: content})
+	}
+	return records, nil
+}
+
 func addDependenciesByStateJSON(tfstateRecords []models.DBStorage) {
 	sess := db.Get()
 	size := len(tfstateRecords)
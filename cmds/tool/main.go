@@ -18,11 +18,13 @@ type Option struct {
 	Version         common.VersionCommand `command:"version" description:"show version"`
 	Scan            ScanCmd               `command:"scan" description:"scan template with policy"`
 	Parse           ParseCmd              `command:"parse" description:"parse rego"`
+	Policy          PolicyCmd             `command:"policy" description:"policy group tools"`
 	Upgrade2v0dot10 Update2v0dot10Cmd     `command:"upgrade2v0.10" description:"update data to v0.10"`
 	Bill            BillCmd               `command:"bill-collect" description:"bill collect"`
 	DumpDb          DumpDb                `command:"dumpdb" description:"dump db to yaml"`
 	InitDB          InitDB                `command:"initdb" description:"init database structure"`
 	UpdateDb        UpdateDb              `command:"updateDB" description:"update database data"`
+	MigrateLog      MigrateLogCmd         `command:"migrate-log" description:"migrate logs from database to log storage"`
 
 	// 初始化演示项目。
 	// 旧版本中通过这个命令来创建一个共用的演示项目，但在 0.12 版本演示项目改为了为每个用户单独创建，所以废弃该命令
@@ -0,0 +1,79 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+package main
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"fmt"
+	"time"
+)
+
+// ./iac-tool migrate-log [--batch-size 100] [--delete]
+// 将保存在数据库 iac_storage 表中的日志迁移到配置文件中 log_storage 指定的存储中
+
+type MigrateLogCmd struct {
+	BatchSize int  `long:"batch-size" default:"100" description:"number of records read from db per batch"`
+	Delete    bool `long:"delete" description:"delete the db records after migrated"`
+}
+
+func (*MigrateLogCmd) Usage() string {
+	return `<migrate-log [--batch-size 100] [--delete]>`
+}
+
+func (c *MigrateLogCmd) Execute(args []string) error {
+	dbInit()
+
+	conf := configs.Get().LogStorage
+	if conf.GetType() == consts.LogStorageTypeDB {
+		return fmt.Errorf("log_storage.type is '%s', nothing to migrate", consts.LogStorageTypeDB)
+	}
+	if c.BatchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d", c.BatchSize)
+	}
+
+	storage, err := logstorage.New(conf)
+	if err != nil {
+		return err
+	}
+
+	var (
+		sess   = db.Get()
+		t      = time.Now()
+		lastId uint
+		count  int
+	)
+	for {
+		records := make([]models.DBStorage, 0, c.BatchSize)
+		if err := sess.Model(&models.DBStorage{}).Where("id > ?", lastId).
+			Order("id").Limit(c.BatchSize).Find(&records); err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		ids := make([]uint, 0, len(records))
+		for _, r := range records {
+			if err := storage.Write(r.Path, r.Content); err != nil {
+				return fmt.Errorf("migrate '%s' error: %v", r.Path, err)
+			}
+			ids = append(ids, r.Id)
+		}
+
+		if c.Delete {
+			if _, err := sess.Where("id IN (?)", ids).Delete(&models.DBStorage{}); err != nil {
+				return err
+			}
+		}
+
+		count += len(records)
+		lastId = records[len(records)-1].Id
+		logger.Infof("migrated %d records, last id: %d", count, lastId)
+	}
+
+	logger.Infof("migrate log done, total: %d, timeCost: %s", count, time.Since(t).String())
+	return nil
+}
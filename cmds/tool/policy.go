@@ -0,0 +1,59 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package main
+
+import (
+	"cloudiac/policy"
+	"fmt"
+)
+
+// iac-tool policy test 离线执行策略组 tests 目录下的测试用例
+//
+// Example:
+//    iac-tool policy test policy/example/policy_group_example
+
+type PolicyCmd struct {
+	Test PolicyTestCmd `command:"test" description:"run policy group tests"`
+}
+
+type PolicyTestCmd struct {
+	Verbose bool `long:"verbose" short:"v" description:"show passed test cases" required:"false"`
+}
+
+func (*PolicyTestCmd) Usage() string {
+	return "<policy group dir>"
+}
+
+func (c *PolicyTestCmd) Execute(args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	policies, er := policy.ParsePolicyGroup(dir)
+	if er != nil {
+		return er
+	}
+	results, err := policy.RunPolicyGroupTests(dir, policies)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Printf("no test cases found in %s/%s\n", dir, policy.PolicyGroupTestsDir)
+		return nil
+	}
+
+	failures := policy.PolicyTestFailures(results)
+	for _, r := range results {
+		if !r.Passed() {
+			fmt.Printf("FAIL  %s\n", r)
+		} else if c.Verbose {
+			fmt.Printf("PASS  %s\n", r)
+		}
+	}
+	fmt.Printf("%d passed, %d failed\n", len(results)-len(failures), len(failures))
+	if len(failures) > 0 {
+		return fmt.Errorf("policy tests failed")
+	}
+	return nil
+}
@@ -43,6 +43,10 @@ import (
 //    iac-tool scan --debug xxx.tf xxx.rego
 // 5. 内置引擎扫描
 //    iac-tool scan --internal -p policies -f tfscan.json -o tfscan.json
+// 6. 内置引擎扫描，同时使用 plan 结果执行 plan 策略
+//    iac-tool scan --internal -p policies -i tfscan.json --plan tfplan.json -o scan_result.json
+// 7. 扫描并导出 sarif/junit 格式报告
+//    iac-tool scan --internal -p policies -i tfscan.json -m tfmap.json --format sarif --report scan_result.sarif
 
 type ScanCmd struct {
 	Debug          bool   `long:"debug" description:"run raw rego script \nuse \"--debug -d code xxx.rego\" or \"--debug xxx.tf xxx.rego\"" required:"false"`
@@ -57,11 +61,14 @@ type ScanCmd struct {
 	RemoteScan    bool   `long:"remote-scan" short:"r" description:"scan environment/template remotely" required:"false"`
 	Verbose       bool   `long:"verbose" short:"v" description:"write verbose scan log message" required:"false"`
 	ParsePlan     bool   `long:"parse-plan" description:"parse tfplan to input.json" required:"false"`
-	PlanFile      string `long:"plan" description:"the tfplan json file path" required:"false"`
+	PlanFile      string `long:"plan" description:"the tfplan json file path, used by plan policies when scan with internal engine" required:"false"`
 	JsonFile      string `long:"json" short:"o" description:"the json file path to output, default: output to stdout" required:"false"`
 	Internal      bool   `long:"internal" description:"use internal scan engine to execute scan" required:"false"`
 	InputFile     string `long:"input" short:"i" description:"the input json file path" required:"false"`
 	SourceMapFile string `long:"map" short:"m" description:"the source map json file path" required:"false"`
+
+	Format     string `long:"format" description:"export scan result as sarif or junit report" choice:"sarif" choice:"junit" required:"false"`
+	ReportFile string `long:"report" description:"the report file path to output when --format is set, default: output to stdout" required:"false"`
 }
 
 var ErrMissingIacFileOrRego = errors.New("missing iac file or rego script")
@@ -166,6 +173,7 @@ func (c *ScanCmd) Execute(args []string) error { //nolint:cyclop
 	}
 	if c.Internal {
 		scanner.Internal = true
+		scanner.PlanFile = c.PlanFile
 	}
 	if c.JsonFile != "" {
 		scanner.ResultFile = c.JsonFile
@@ -173,8 +181,18 @@ func (c *ScanCmd) Execute(args []string) error { //nolint:cyclop
 	if c.SourceMapFile != "" {
 		scanner.MapFile = c.SourceMapFile
 	}
+	if c.Format != "" && scanner.ResultFile == "" {
+		// 导出报告时扫描结果写入默认结果文件，不再输出到 stdout
+		scanner.ResultFile = runner.ScanResultFile
+	}
 
 	err := scanner.Run()
+	if c.Format != "" && (err == nil || errors.Is(err, policy.ErrScanExitViolated)) {
+		if er := c.exportReport(scanner); er != nil {
+			logger.Errorf("export %s report: %v", c.Format, er)
+			os.Exit(1)
+		}
+	}
 	if err != nil {
 		if errors.Is(err, policy.ErrScanExitViolated) {
 			os.Exit(3)
@@ -186,6 +204,23 @@ func (c *ScanCmd) Execute(args []string) error { //nolint:cyclop
 	return nil
 }
 
+// exportReport 将扫描结果导出为 --format 指定格式的报告
+func (c *ScanCmd) exportReport(scanner *policy.Scanner) error {
+	result, err := policy.ReadTfResultJson(scanner.GetResultPath(policy.Resource{}))
+	if err != nil {
+		return err
+	}
+	report, err := policy.ExportScanResult(c.Format, &result.Results, policy.ReadTfMapFile(c.SourceMapFile))
+	if err != nil {
+		return err
+	}
+	if c.ReportFile == "" {
+		fmt.Printf("%s\n", report)
+		return nil
+	}
+	return os.WriteFile(c.ReportFile, report, 0644) //nolint:gosec
+}
+
 func (c *ScanCmd) Parse(filePath string) error {
 	cmdString := utils.SprintTemplate("terrascan scan --parse-only -d . -o json > {{.ScanResultFile}}", map[string]interface{}{
 		"TFScanJsonFilePath": filepath.Join("./", runner.ScanInputFile),
@@ -19,6 +19,11 @@ const (
 	TaskTypeTplScan  = "tplScan"  // 云模板策略扫描，只执行策略扫描，不修改资源或配置
 	TaskTypeTplParse = "tplParse" // 云模板策略扫描，只执行策略扫描，不修改资源或配置
 
+	TaskTypeStateRestore = "stateRestore" // 将环境 state 恢复到指定的历史版本
+	TaskTypeImport       = "import"       // 将已存在的云资源导入到环境 state 中
+
+	TaskTypeStateOperation = "stateOperation" // 修改环境 state(state mv/rm、taint/untaint)
+
 	// TODO 与 taskTypexxx 重复，需要替换
 	TaskJobPlan     = "plan"
 	TaskJobApply    = "apply"
@@ -56,6 +61,9 @@ const (
 	TaskStepCommand         = "command"     // run command
 	TaskStepCollect         = "collect"     // 任务结束后的信息采集
 	TaskStepScanInit        = "scaninit"
+	TaskStepStateRestore    = "stateRestore"           // 推送历史版本 state(terraform state push)
+	TaskStepTfImport        = "terraformImport"        // 导入已存在的资源(terraform import)
+	TaskStepStateOperation  = "stateOperation"         // 执行 state 操作(terraform state mv/rm、taint/untaint)
 	CronDriftTaskName       = "Drift Detection"        // 漂移检测任务名称
 	CronManualDriftTaskName = "Manual Drift Detection" // 手动漂移检测任务名称
 
@@ -72,6 +80,7 @@ const (
 	TaskStepComplete  = "complete"
 	TaskStepTimeout   = "timeout"
 	TaskStepAborted   = "aborted"
+	TaskStepSkipped   = "skipped" // 步骤执行条件(when)不满足，跳过执行
 
 	TaskStepPolicyViolationExitCode = 3 // 合规检查不通过时的退出码
 
@@ -84,6 +93,11 @@ const (
 	TaskTypeTplScanName  = "tplScan"
 	TaskTypeTplParseName = "tplParse"
 
+	TaskTypeStateRestoreName = "stateRestore"
+	TaskTypeImportName       = "import"
+
+	TaskTypeStateOperationName = "stateOperation"
+
 	ProjectStatusEnable  = "enable"
 	ProjectStatusDisable = "disable"
 
@@ -95,6 +109,10 @@ const (
 	VcsGitee  = "gitee"
 	VcsGithub = "github"
 
+	VcsBitbucket = "bitbucket"
+	VcsAzure     = "azure"
+	VcsGit       = "git"
+
 	// PolicyStatusPending 检测中
 	PolicyStatusPending = "pending"
 	// PolicyStatusPassed 通过
@@ -116,6 +134,21 @@ const (
 	PolicySuppressTypeSource = "source"
 	PolicySuppressTypePolicy = "policy"
 
+	// 策略屏蔽的审批状态，只有审批通过且未过期的屏蔽记录生效
+	PolicySuppressStatusPending  = "pending"
+	PolicySuppressStatusApproved = "approved"
+	PolicySuppressStatusRejected = "rejected"
+	PolicySuppressStatusExpired  = "expired"
+
+	// 策略的输入类型，config 策略检查解析后的模板配置，plan 策略检查 terraform plan 的结果
+	PolicyInputConfig = "config"
+	PolicyInputPlan   = "plan"
+
+	// 合规检测分级处理方式: block 中止部署，approve 部署需要审批，warn 仅告警
+	PolicyEnforceBlock   = "block"
+	PolicyEnforceApprove = "approve"
+	PolicyEnforceWarn    = "warn"
+
 	RunnerServiceName    = "CT-Runner"
 	IacPortalServiceName = "IaC-Portal"
 
@@ -128,6 +161,18 @@ const (
 	ProviderCacheModCommon  = "common"   // COMMON(公共缓存，所有容器公用)
 	ProviderCacheModOnlyEnv = "only_env" // ONLY_ENV(每个环境一个缓存目录)
 	ProviderCacheModNoCache = "no"       // NO(不使用外部缓存)
+
+	RunnerBackendDocker     = "docker"     // 通过 docker 启动任务容器(默认)
+	RunnerBackendKubernetes = "kubernetes" // 每个任务在 kubernetes 中启动一个 pod
+
+	StateBackendConsul = "consul" // terraform state 保存在 consul(默认)
+	StateBackendHttp   = "http"   // terraform state 由 portal 通过 http backend 协议提供
+
+	IacEngineTerraform = "terraform" // 使用 terraform 执行部署(默认)
+	IacEngineOpenTofu  = "opentofu"  // 使用 opentofu 执行部署
+
+	StackTypeMulti      = "multi"      // 多工作目录模板，每个包含 .tf 文件的目录为一个根目录
+	StackTypeTerragrunt = "terragrunt" // terragrunt 模板，每个包含 terragrunt.hcl 的目录为一个根目录
 )
 
 var (
@@ -148,4 +193,11 @@ var (
 		"1.5.5",
 		"1.5.6",
 	}
+
+	// OpenTofuVersions worker 镜像中通过 tofuenv 预装的 opentofu 版本(见 docker/base/worker/Dockerfile)
+	OpenTofuVersions = []string{
+		"1.6.2",
+		"1.7.3",
+		"1.8.5",
+	}
 )
@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -57,12 +58,80 @@ type RunnerConfig struct {
 	ProviderCachePath string `yaml:"provider_cache_path"`
 	Privileged        bool   `yaml:"privileged"`
 	ProviderCacheMod  string `yaml:"provider_cache_mod"` // provider plugin cache 缓存模式
+
+	Backend    string           `yaml:"backend"` // 任务容器运行后端: docker(默认) 或 kubernetes
+	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+}
+
+// KubernetesConfig runner 使用 kubernetes 后端时的配置
+type KubernetesConfig struct {
+	Kubeconfig string `yaml:"kubeconfig"` // kubeconfig 文件路径，为空则使用 in-cluster 配置
+	Namespace  string `yaml:"namespace"`  // 任务 pod 所在的 namespace，默认为 default
+
+	// 任务目录默认以 hostPath 方式挂载到 pod，此时需要将 pod 调度到 runner 所在节点，
+	// 未配置时使用 NODE_NAME 环境变量(一般通过 downward api 注入 runner 所在节点名称)
+	NodeName string `yaml:"node_name"`
+	// storage_path 所在的 pvc(需支持 ReadWriteMany)，配置后任务目录通过 pvc 的 subPath 挂载，不再使用 hostPath
+	WorkspacePVC string `yaml:"workspace_pvc"`
+
+	ServiceAccount   string `yaml:"service_account"`
+	ImagePullPolicy  string `yaml:"image_pull_policy"`  // 默认为 IfNotPresent
+	ImagePullSecrets string `yaml:"image_pull_secrets"` // 多个使用逗号间隔
+	PodStartTimeout  int    `yaml:"pod_start_timeout"`  // 等待 pod 启动的超时时间(秒)，默认 300
+}
+
+// GetNodeName 任务 pod 调度的节点，未配置 node_name 时使用 NODE_NAME 环境变量
+func (c *KubernetesConfig) GetNodeName() string {
+	if c.NodeName == "" {
+		return os.Getenv("NODE_NAME")
+	}
+	return c.NodeName
 }
 
 type PortalConfig struct {
 	Address       string `yaml:"address"` // portal 对外提供服务的 url
 	SSHPrivateKey string `yaml:"ssh_private_key"`
 	SSHPublicKey  string `yaml:"ssh_public_key"`
+
+	// 通用 git 类型 vcs 的仓库镜像缓存目录及刷新间隔(秒)
+	GitMirrorPath     string `yaml:"git_mirror_path"`
+	GitMirrorInterval int    `yaml:"git_mirror_interval"`
+	// 是否允许通用 git 类型 vcs 使用 file:// 地址(读取 portal 本地的仓库)，默认不允许
+	GitAllowFileScheme bool `yaml:"git_allow_file_scheme"`
+}
+
+func (c *PortalConfig) GetGitMirrorPath() string {
+	if c.GitMirrorPath == "" {
+		return consts.GitMirrorPath
+	}
+	return c.GitMirrorPath
+}
+
+func (c *PortalConfig) GetGitMirrorInterval() time.Duration {
+	if c.GitMirrorInterval <= 0 {
+		return consts.GitMirrorInterval
+	}
+	return time.Duration(c.GitMirrorInterval) * time.Second
+}
+
+// StateBackendConfig terraform state 存储后端配置
+type StateBackendConfig struct {
+	Type    string `yaml:"type"`    // 存储类型: consul(默认), http
+	Address string `yaml:"address"` // 任务访问 portal http backend 的地址，默认使用 portal.address
+}
+
+func (c *StateBackendConfig) GetType() string {
+	if c.Type == "" {
+		return common.StateBackendConsul
+	}
+	return c.Type
+}
+
+func (c *StateBackendConfig) GetAddress() string {
+	if c.Address == "" {
+		return Get().Portal.Address
+	}
+	return c.Address
 }
 
 type LdapConfig struct {
@@ -141,10 +210,21 @@ func (c *RunnerConfig) AbsTfenvVersionsCachePath() string {
 	return c.mustAbs(filepath.Join(c.PluginCachePath, ".tfenv-versions"))
 }
 
+func (c *RunnerConfig) AbsTofuenvVersionsCachePath() string {
+	return c.mustAbs(filepath.Join(c.PluginCachePath, ".tofuenv-versions"))
+}
+
 func (c *RunnerConfig) AbsProviderCachePath() string {
 	return c.mustAbs(c.ProviderCachePath)
 }
 
+func (c *RunnerConfig) GetBackend() string {
+	if c.Backend == "" {
+		return common.RunnerBackendDocker
+	}
+	return c.Backend
+}
+
 type LogConfig struct {
 	LogLevel   string `yaml:"log_level"`
 	LogPath    string `yaml:"log_path"`
@@ -164,26 +244,53 @@ type PolicyConfig struct {
 	Enabled bool `yaml:"enabled"`
 }
 
+// LogStorageConfig 任务日志及 state、plan 等 json 文件的存储配置
+type LogStorageConfig struct {
+	Type string   `yaml:"type"` // 存储类型: db(默认), fs, s3
+	Path string   `yaml:"path"` // fs 类型的存储目录
+	S3   S3Config `yaml:"s3"`
+}
+
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"` // 使用 minio 等 s3 兼容存储时需要配置
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	Prefix          string `yaml:"prefix"` // 对象 key 前缀
+	AccessKeyId     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	DisableSSL      bool   `yaml:"disable_ssl"`
+	ForcePathStyle  bool   `yaml:"force_path_style"` // minio 需要开启
+}
+
+func (c *LogStorageConfig) GetType() string {
+	if c.Type == "" {
+		return consts.LogStorageTypeDB
+	}
+	return c.Type
+}
+
 type Config struct {
-	DbType             string           `yaml:"dbType"`
-	Mysql              string           `yaml:"mysql"`
-	Dameng             string           `yaml:"dameng"`
-	Gauss              string           `yaml:"gauss"`
-	Listen             string           `yaml:"listen"`
-	Consul             ConsulConfig     `yaml:"consul"`
-	Portal             PortalConfig     `yaml:"portal"`
-	Runner             RunnerConfig     `yaml:"runner"`
-	Log                LogConfig        `yaml:"log"`
-	Kafka              KafkaConfig      `yaml:"kafka"`
-	SMTPServer         SMTPServerConfig `yaml:"smtpServer"`
-	SecretKey          string           `yaml:"secretKey"`
-	JwtSecretKey       string           `yaml:"jwtSecretKey"`
-	RegistryAddr       string           `yaml:"registryAddr"`
-	ExportSecretKey    string           `yaml:"exportSecretKey"`
-	HttpClientInsecure bool             `yaml:"httpClientInsecure"`
-	Policy             PolicyConfig     `yaml:"policy"`
-	Ldap               LdapConfig       `yaml:"ldap"`
-	CostServe          string           `yaml:"cost_serve"`
+	DbType             string             `yaml:"dbType"`
+	Mysql              string             `yaml:"mysql"`
+	Dameng             string             `yaml:"dameng"`
+	Gauss              string             `yaml:"gauss"`
+	Listen             string             `yaml:"listen"`
+	Consul             ConsulConfig       `yaml:"consul"`
+	Portal             PortalConfig       `yaml:"portal"`
+	Runner             RunnerConfig       `yaml:"runner"`
+	Log                LogConfig          `yaml:"log"`
+	Kafka              KafkaConfig        `yaml:"kafka"`
+	SMTPServer         SMTPServerConfig   `yaml:"smtpServer"`
+	SecretKey          string             `yaml:"secretKey"`
+	JwtSecretKey       string             `yaml:"jwtSecretKey"`
+	RegistryAddr       string             `yaml:"registryAddr"`
+	ExportSecretKey    string             `yaml:"exportSecretKey"`
+	HttpClientInsecure bool               `yaml:"httpClientInsecure"`
+	Policy             PolicyConfig       `yaml:"policy"`
+	Ldap               LdapConfig         `yaml:"ldap"`
+	CostServe          string             `yaml:"cost_serve"`
+	LogStorage         LogStorageConfig   `yaml:"log_storage"`
+	StateBackend       StateBackendConfig `yaml:"state_backend"`
 
 	SwaggerEnable   bool `yaml:"swaggerEnable"`
 	EnableTaskAbort bool `yaml:"enableTaskAbort"` // 启用任务中止功能
@@ -194,8 +301,10 @@ type Config struct {
 	AlicloudResSyncApi string `yaml:"alicloud_res_sync_api"`
 
 	// 开放terraform版本配置，未指定的配置时，以const里的定义为准，当修改terraform版本需保证worker镜像中存在版本
-	DefaultTerraformVersion string `yaml:"default_tf_version"` // 默认的terraform版本
-	TerraformVersions       string `yaml:"tf_versions"`        // 支持的terraform版本,多个使用逗号间隔
+	DefaultTerraformVersion string `yaml:"default_tf_version"`   // 默认的terraform版本
+	TerraformVersions       string `yaml:"tf_versions"`          // 支持的terraform版本,多个使用逗号间隔
+	DefaultOpenTofuVersion  string `yaml:"default_tofu_version"` // 默认的opentofu版本
+	OpenTofuVersions        string `yaml:"tofu_versions"`        // 支持的opentofu版本,多个使用逗号间隔
 }
 
 func (c *Config) GetDefaultTerraformVersion() string {
@@ -212,6 +321,36 @@ func (c *Config) GetTerraformVersions() []string {
 	return common.TerraformVersions
 }
 
+func (c *Config) GetDefaultOpenTofuVersion() string {
+	if c.DefaultOpenTofuVersion != "" {
+		return c.DefaultOpenTofuVersion
+	}
+	return consts.DefaultOpenTofuVersion
+}
+
+func (c *Config) GetOpenTofuVersions() []string {
+	if c.OpenTofuVersions != "" {
+		return strings.Split(c.OpenTofuVersions, ",")
+	}
+	return common.OpenTofuVersions
+}
+
+// GetIacEngineVersions 获取 IaC 引擎支持的版本列表，engine 为空时为 terraform
+func (c *Config) GetIacEngineVersions(engine string) []string {
+	if engine == common.IacEngineOpenTofu {
+		return c.GetOpenTofuVersions()
+	}
+	return c.GetTerraformVersions()
+}
+
+// GetDefaultIacEngineVersion 获取 IaC 引擎的默认版本，engine 为空时为 terraform
+func (c *Config) GetDefaultIacEngineVersion(engine string) string {
+	if engine == common.IacEngineOpenTofu {
+		return c.GetDefaultOpenTofuVersion()
+	}
+	return c.GetDefaultTerraformVersion()
+}
+
 func (c *Config) GetDbType() string {
 	if c.DbType == "" {
 		return "mysql"
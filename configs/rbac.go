@@ -91,6 +91,8 @@ var Polices = []Policy{
 	{"manager", "policies", "suppress/enablescan/scan"},
 	{"approver", "policies", "suppress/enablescan/scan"},
 	{"operator", "policies", "suppress/scan"},
+	{"manager", "policies", "approvesuppress"},
+	{"approver", "policies", "approvesuppress"},
 	{"manager", "policies", "read"},
 	{"approver", "policies", "read"},
 	{"operator", "policies", "read"},
@@ -0,0 +1,349 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 扫描结果导出格式，sarif 用于接入代码扫描平台，junit 用于 CI 展示测试报告
+const (
+	ExportFormatSarif = "sarif"
+	ExportFormatJUnit = "junit"
+)
+
+const (
+	sarifVersion    = "2.1.0"
+	sarifSchema     = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName   = "CloudIaC"
+	sarifToolUri    = "https://www.cloudiac.org"
+	junitSuitesName = "CloudIaC policy scan"
+	junitSuiteName  = "default" // 没有策略组信息时的 testsuite 名称
+)
+
+// ExportScanResult 将扫描结果导出为指定格式。
+// tfmap 为模板解析生成的资源位置映射，用于补全违规结果的文件及行号，可以为 nil
+func ExportScanResult(format string, result *TsResult, tfmap *models.TfParse) ([]byte, error) {
+	switch format {
+	case ExportFormatSarif:
+		return ExportSarif(result, tfmap)
+	case ExportFormatJUnit:
+		return ExportJUnit(result)
+	default:
+		return nil, fmt.Errorf("unsupported export format '%s'", format)
+	}
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	Id                   string                 `json:"id"`
+	Name                 string                 `json:"name"`
+	ShortDescription     sarifMessage           `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration     `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleId       string             `json:"ruleId"`
+	RuleIndex    int                `json:"ruleIndex"`
+	Level        string             `json:"level"`
+	Message      sarifMessage       `json:"message"`
+	Locations    []sarifLocation    `json:"locations,omitempty"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifSuppression struct {
+	Kind string `json:"kind"`
+}
+
+// sarifLevel 策略严重程度转换为 sarif 的结果级别
+func sarifLevel(severity string) string {
+	switch strings.ToLower(severity) {
+	case common.PolicySeverityHigh:
+		return "error"
+	case common.PolicySeverityLow:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// violationResource 违规资源的标识，plan 策略使用完整地址
+func violationResource(v Violation) string {
+	if v.Address != "" {
+		return v.Address
+	}
+	res := fmt.Sprintf("%s.%s", v.ResourceType, v.ResourceName)
+	if v.ModuleName != "" {
+		res = fmt.Sprintf("%s.%s", v.ModuleName, res)
+	}
+	return res
+}
+
+// ExportSarif 将扫描结果导出为 SARIF 2.1.0 格式，违规结果为 result，被屏蔽的违规结果标记为 suppressed
+func ExportSarif(result *TsResult, tfmap *models.TfParse) ([]byte, error) {
+	rules := make([]sarifRule, 0)
+	ruleIndex := make(map[string]int)
+	addRule := func(r Rule) int {
+		if idx, ok := ruleIndex[r.RuleId]; ok {
+			return idx
+		}
+		rule := sarifRule{
+			Id:                   r.RuleId,
+			Name:                 r.RuleName,
+			ShortDescription:     sarifMessage{Text: r.Description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(r.Severity)},
+			Properties:           map[string]interface{}{"severity": r.Severity},
+		}
+		if rule.ShortDescription.Text == "" {
+			rule.ShortDescription.Text = r.RuleName
+		}
+		if r.Category != "" {
+			rule.Properties["category"] = r.Category
+		}
+		rules = append(rules, rule)
+		ruleIndex[r.RuleId] = len(rules) - 1
+		return len(rules) - 1
+	}
+	for _, r := range result.PassedRules {
+		addRule(r)
+	}
+
+	results := make([]sarifResult, 0)
+	addResult := func(v Violation, suppressed bool) {
+		idx := addRule(Rule{
+			RuleName:    v.RuleName,
+			Description: v.Description,
+			RuleId:      v.RuleId,
+			Severity:    v.Severity,
+			Category:    v.Category,
+		})
+		resource := violationResource(v)
+		line, file := v.Line, v.File
+		if (line == 0 || file == "") && tfmap != nil {
+			line, file = findLineNoFromMap(*tfmap, fmt.Sprintf("%s.%s", v.ResourceType, v.ResourceName))
+		}
+
+		location := sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: resource, Kind: "resource"}},
+		}
+		if file != "" {
+			location.PhysicalLocation = &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{Uri: filepath.ToSlash(file)},
+			}
+			if line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: line}
+			}
+		}
+
+		sr := sarifResult{
+			RuleId:    v.RuleId,
+			RuleIndex: idx,
+			Level:     sarifLevel(v.Severity),
+			Message:   sarifMessage{Text: fmt.Sprintf("%s: %s", v.RuleName, resource)},
+			Locations: []sarifLocation{location},
+		}
+		if suppressed {
+			sr.Suppressions = []sarifSuppression{{Kind: "external"}}
+		}
+		results = append(results, sr)
+	}
+	for _, v := range result.Violations {
+		addResult(v, false)
+	}
+	for _, v := range result.SkippedViolations {
+		addResult(v, true)
+	}
+
+	return json.MarshalIndent(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           sarifToolName,
+				InformationUri: sarifToolUri,
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}, "", "  ")
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// ExportJUnit 将扫描结果导出为 JUnit XML 格式，每个策略组为一个 testsuite，每个策略为一个 testcase。
+// 违规的策略为 failure，执行出错的策略为 error，被屏蔽的策略为 skipped
+func ExportJUnit(result *TsResult) ([]byte, error) {
+	suites := make(map[string]*junitTestSuite)
+	cases := make(map[string]*junitTestCase)
+	caseOrder := make([]string, 0)
+	getCase := func(ruleId, ruleName, category string) *junitTestCase {
+		if tc, ok := cases[ruleId]; ok {
+			return tc
+		}
+		if category == "" {
+			category = junitSuiteName
+		}
+		tc := &junitTestCase{Name: ruleName, ClassName: category}
+		cases[ruleId] = tc
+		caseOrder = append(caseOrder, ruleId)
+		return tc
+	}
+
+	for _, r := range result.PassedRules {
+		getCase(r.RuleId, r.RuleName, r.Category)
+	}
+	for _, v := range result.Violations {
+		tc := getCase(v.RuleId, v.RuleName, v.Category)
+		if tc.Failure == nil {
+			tc.Failure = &junitMessage{Message: v.Description, Type: v.Severity}
+		}
+		location := ""
+		if v.File != "" {
+			location = fmt.Sprintf(" (%s:%d)", filepath.ToSlash(v.File), v.Line)
+		}
+		tc.Failure.Text += fmt.Sprintf("%s%s\n", violationResource(v), location)
+	}
+	for _, r := range result.ScanErrors {
+		tc := getCase(r.RuleId, r.RuleName, r.Category)
+		tc.Error = &junitMessage{Message: r.ErrMsg, Text: r.ErrMsg}
+	}
+	for _, r := range result.SuppressedRules {
+		tc := getCase(r.RuleId, r.RuleName, r.Category)
+		if tc.Failure == nil && tc.Error == nil {
+			tc.Skipped = &junitMessage{Message: "suppressed"}
+		}
+	}
+
+	ret := junitTestSuites{Name: junitSuitesName}
+	for _, ruleId := range caseOrder {
+		tc := cases[ruleId]
+		suite, ok := suites[tc.ClassName]
+		if !ok {
+			suite = &junitTestSuite{Name: tc.ClassName}
+			suites[tc.ClassName] = suite
+		}
+		suite.Tests++
+		switch {
+		case tc.Error != nil:
+			suite.Errors++
+		case tc.Failure != nil:
+			suite.Failures++
+		case tc.Skipped != nil:
+			suite.Skipped++
+		}
+		if tc.Failure != nil {
+			tc.Failure.Text = strings.TrimSuffix(tc.Failure.Text, "\n")
+		}
+		suite.TestCases = append(suite.TestCases, *tc)
+	}
+
+	names := make([]string, 0, len(suites))
+	for name := range suites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := suites[name]
+		ret.Tests += s.Tests
+		ret.Failures += s.Failures
+		ret.Errors += s.Errors
+		ret.Skipped += s.Skipped
+		ret.Suites = append(ret.Suites, *s)
+	}
+
+	bs, err := xml.MarshalIndent(ret, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), bs...), nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"cloudiac/portal/models"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testExportResult = TsResult{
+	PassedRules: []Rule{
+		{RuleName: "ossEncrypted", RuleId: "po-2", Severity: "low", Category: "oss"},
+	},
+	Violations: []Violation{
+		{RuleName: "instanceWithNoVpc", RuleId: "po-1", Severity: "high", Category: "ecs",
+			ResourceType: "alicloud_instance", ResourceName: "web"},
+		{RuleName: "publicInstance", RuleId: "po-3", Severity: "medium", Category: "ecs",
+			ResourceType: "alicloud_instance", ResourceName: "db", Address: "module.app.alicloud_instance.db[0]"},
+	},
+	ScanErrors: []ScanError{
+		{RuleName: "invalidRule", RuleId: "po-4", Category: "ecs", ErrMsg: "evaluating policy: error"},
+	},
+	SuppressedRules: []Rule{
+		{RuleName: "ossPublic", RuleId: "po-5", Category: "oss"},
+	},
+}
+
+func TestExportSarif(t *testing.T) {
+	tfmap := models.TfParse{
+		"alicloud_instance": {
+			{Id: "alicloud_instance.web", Source: "main.tf", Line: 12},
+		},
+	}
+	bs, err := ExportSarif(&testExportResult, &tfmap)
+	assert.NoError(t, err)
+
+	log := sarifLog{}
+	assert.NoError(t, json.Unmarshal(bs, &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	assert.Len(t, log.Runs, 1)
+	assert.Len(t, log.Runs[0].Tool.Driver.Rules, 3)
+
+	results := log.Runs[0].Results
+	assert.Len(t, results, 2)
+	assert.Equal(t, "error", results[0].Level)
+	assert.Equal(t, "po-1", log.Runs[0].Tool.Driver.Rules[results[0].RuleIndex].Id)
+	// 文件及行号从 map 文件中获取
+	assert.Equal(t, "main.tf", results[0].Locations[0].PhysicalLocation.ArtifactLocation.Uri)
+	assert.Equal(t, 12, results[0].Locations[0].PhysicalLocation.Region.StartLine)
+
+	assert.Equal(t, "warning", results[1].Level)
+	assert.Nil(t, results[1].Locations[0].PhysicalLocation)
+	assert.Equal(t, "module.app.alicloud_instance.db[0]", results[1].Locations[0].LogicalLocations[0].FullyQualifiedName)
+}
+
+func TestExportJUnit(t *testing.T) {
+	bs, err := ExportJUnit(&testExportResult)
+	assert.NoError(t, err)
+
+	suites := junitTestSuites{}
+	assert.NoError(t, xml.Unmarshal(bs, &suites))
+	assert.Equal(t, 5, suites.Tests)
+	assert.Equal(t, 2, suites.Failures)
+	assert.Equal(t, 1, suites.Errors)
+	assert.Equal(t, 1, suites.Skipped)
+
+	assert.Len(t, suites.Suites, 2)
+	assert.Equal(t, "ecs", suites.Suites[0].Name)
+	assert.Equal(t, 3, suites.Suites[0].Tests)
+	assert.Equal(t, "alicloud_instance.web", suites.Suites[0].TestCases[0].Failure.Text)
+	assert.Equal(t, "oss", suites.Suites[1].Name)
+	assert.NotNil(t, suites.Suites[1].TestCases[1].Skipped)
+
+	_, err = ExportScanResult("html", &testExportResult, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// PlanInput plan 策略(input_type 为 plan)的输入，由 runner 在 plan 步骤生成的 plan json
+// (terraform show -json tfplan，即 FetchPlanJson 返回的内容)转换而来。
+// 相比解析模板得到的配置，plan 中包含了变量、计算属性及输出在 plan 之后的值。
+//
+// 输入结构如下:
+//
+//	{
+//	  "terraform_version": "1.5.7",
+//	  "variables": {"<name>": <value>},
+//	  "outputs": {"<name>": {"value": <value>, "sensitive": false, "unknown": false}},
+//	  "resources": [
+//	    {
+//	      "address": "module.app.aws_instance.web[0]",   // 资源完整地址
+//	      "module_address": "module.app",                // 所在模块，根模块为空
+//	      "mode": "managed",                             // managed 或 data
+//	      "type": "aws_instance",
+//	      "name": "web",
+//	      "index": 0,                                    // count/for_each 的索引，没有时为 null
+//	      "provider_name": "registry.terraform.io/hashicorp/aws",
+//	      "actions": ["create"],                         // no-op, create, read, update, delete
+//	      "before": {...},                               // 变更前的属性，新建资源为 null
+//	      "after": {...},                                // 变更后的属性，删除资源为 null
+//	      "after_unknown": {...}                         // apply 后才能确定值的属性
+//	    }
+//	  ]
+//	}
+//
+// 策略规则返回违规资源的 address 列表，元素可以是字符串或包含 Id 字段的对象，例如:
+//
+//	# @input_type: plan
+//	# @resource_type: aws_instance
+//	publicInstance[res.address] {
+//	    res := input.resources[_]
+//	    res.type == "aws_instance"
+//	    res.after.associate_public_ip_address == true
+//	}
+type PlanInput struct {
+	TerraformVersion string                     `json:"terraform_version"`
+	Variables        map[string]interface{}     `json:"variables"`
+	Outputs          map[string]PlanInputOutput `json:"outputs"`
+	Resources        []PlanInputResource        `json:"resources"`
+}
+
+type PlanInputOutput struct {
+	Value     interface{} `json:"value"`
+	Sensitive bool        `json:"sensitive"`
+	Unknown   bool        `json:"unknown"`
+}
+
+type PlanInputResource struct {
+	Address       string      `json:"address"`
+	ModuleAddress string      `json:"module_address"`
+	Mode          string      `json:"mode"`
+	Type          string      `json:"type"`
+	Name          string      `json:"name"`
+	Index         interface{} `json:"index"`
+	ProviderName  string      `json:"provider_name"`
+	Actions       []string    `json:"actions"`
+	Before        interface{} `json:"before"`
+	After         interface{} `json:"after"`
+	AfterUnknown  interface{} `json:"after_unknown"`
+}
+
+// tfPlanJson terraform show -json 输出的 plan 中生成 PlanInput 需要的字段
+type tfPlanJson struct {
+	TerraformVersion string `json:"terraform_version"`
+	Variables        map[string]struct {
+		Value interface{} `json:"value"`
+	} `json:"variables"`
+	PlannedValues struct {
+		Outputs map[string]struct {
+			Value     interface{} `json:"value"`
+			Sensitive bool        `json:"sensitive"`
+		} `json:"outputs"`
+	} `json:"planned_values"`
+	OutputChanges map[string]struct {
+		AfterUnknown interface{} `json:"after_unknown"`
+	} `json:"output_changes"`
+	ResourceChanges []struct {
+		Address       string      `json:"address"`
+		ModuleAddress string      `json:"module_address"`
+		Mode          string      `json:"mode"`
+		Type          string      `json:"type"`
+		Name          string      `json:"name"`
+		Index         interface{} `json:"index"`
+		ProviderName  string      `json:"provider_name"`
+		Change        struct {
+			Actions      []string    `json:"actions"`
+			Before       interface{} `json:"before"`
+			After        interface{} `json:"after"`
+			AfterUnknown interface{} `json:"after_unknown"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// ParsePlanInput 将 plan json 转换为 plan 策略的输入
+func ParsePlanInput(planJson []byte) (*PlanInput, error) {
+	plan := tfPlanJson{}
+	if err := json.Unmarshal(planJson, &plan); err != nil {
+		return nil, fmt.Errorf("unmarshal plan json: %w", err)
+	}
+
+	input := PlanInput{
+		TerraformVersion: plan.TerraformVersion,
+		Variables:        make(map[string]interface{}),
+		Outputs:          make(map[string]PlanInputOutput),
+		Resources:        make([]PlanInputResource, 0, len(plan.ResourceChanges)),
+	}
+	for name, v := range plan.Variables {
+		input.Variables[name] = v.Value
+	}
+	for name, o := range plan.PlannedValues.Outputs {
+		input.Outputs[name] = PlanInputOutput{Value: o.Value, Sensitive: o.Sensitive}
+	}
+	// 值未知的输出不会出现在 planned_values 中
+	for name, c := range plan.OutputChanges {
+		if unknown, _ := c.AfterUnknown.(bool); unknown {
+			o := input.Outputs[name]
+			o.Unknown = true
+			input.Outputs[name] = o
+		}
+	}
+	for _, rc := range plan.ResourceChanges {
+		input.Resources = append(input.Resources, PlanInputResource{
+			Address:       rc.Address,
+			ModuleAddress: rc.ModuleAddress,
+			Mode:          rc.Mode,
+			Type:          rc.Type,
+			Name:          rc.Name,
+			Index:         rc.Index,
+			ProviderName:  rc.ProviderName,
+			Actions:       rc.Change.Actions,
+			Before:        rc.Change.Before,
+			After:         rc.Change.After,
+			AfterUnknown:  rc.Change.AfterUnknown,
+		})
+	}
+	return &input, nil
+}
+
+// WritePlanInput 读取 plan json 文件，生成 plan 策略的输入文件
+func WritePlanInput(planJsonFile string, inputFile string) (*PlanInput, error) {
+	bs, err := os.ReadFile(planJsonFile)
+	if err != nil {
+		return nil, err
+	}
+	input, err := ParsePlanInput(bs)
+	if err != nil {
+		return nil, err
+	}
+	bs, err = json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(inputFile, bs, 0644); err != nil { //nolint:gosec
+		return nil, err
+	}
+	return input, nil
+}
+
+// planViolations 将 plan 策略返回的资源地址映射为违规结果，每个违规资源生成一条结果
+func planViolations(input *PlanInput, result []interface{}, meta Meta) []Violation {
+	resources := make(map[string]PlanInputResource, len(input.Resources))
+	for _, r := range input.Resources {
+		resources[r.Address] = r
+	}
+
+	violations := make([]Violation, 0)
+	seen := make(map[string]bool)
+	for _, v := range result {
+		var addr string
+		switch res := v.(type) {
+		case map[string]interface{}:
+			addr, _ = res["Id"].(string)
+		case string:
+			addr = res
+		}
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		violation := Violation{
+			RuleName:    meta.Name,
+			Description: meta.Description,
+			RuleId:      meta.Id,
+			Severity:    meta.Severity,
+			Category:    meta.Category,
+			Address:     addr,
+		}
+		if r, ok := resources[addr]; ok {
+			violation.ResourceType = r.Type
+			violation.ResourceName = r.Name
+			violation.ModuleName = r.ModuleAddress
+		} else {
+			violation.ResourceType = "unknown"
+			violation.ResourceName = addr
+		}
+		violations = append(violations, violation)
+	}
+	return violations
+}
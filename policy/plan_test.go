@@ -0,0 +1,90 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testPlanJson = `{
+  "format_version": "1.1",
+  "terraform_version": "1.5.7",
+  "variables": {"region": {"value": "us-east-1"}},
+  "planned_values": {"outputs": {"ip": {"sensitive": false}, "name": {"sensitive": true, "value": "web"}}},
+  "output_changes": {"ip": {"after_unknown": true}, "name": {"after_unknown": false}},
+  "resource_changes": [
+    {
+      "address": "module.app.aws_instance.web[0]",
+      "module_address": "module.app",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "index": 0,
+      "provider_name": "registry.terraform.io/hashicorp/aws",
+      "change": {
+        "actions": ["create"],
+        "before": null,
+        "after": {"associate_public_ip_address": true},
+        "after_unknown": {"public_ip": true}
+      }
+    },
+    {
+      "address": "aws_instance.db",
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "db",
+      "provider_name": "registry.terraform.io/hashicorp/aws",
+      "change": {"actions": ["no-op"], "before": {}, "after": {"associate_public_ip_address": false}}
+    }
+  ]
+}`
+
+func TestParsePlanInput(t *testing.T) {
+	input, err := ParsePlanInput([]byte(testPlanJson))
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5.7", input.TerraformVersion)
+	assert.Equal(t, "us-east-1", input.Variables["region"])
+	assert.True(t, input.Outputs["ip"].Unknown)
+	assert.Equal(t, PlanInputOutput{Value: "web", Sensitive: true}, input.Outputs["name"])
+	assert.Len(t, input.Resources, 2)
+	assert.Equal(t, "module.app", input.Resources[0].ModuleAddress)
+	assert.Equal(t, []string{"create"}, input.Resources[0].Actions)
+	assert.Nil(t, input.Resources[0].Before)
+
+	_, err = ParsePlanInput([]byte("invalid"))
+	assert.Error(t, err)
+}
+
+func TestPlanPolicyViolations(t *testing.T) {
+	dir := t.TempDir()
+	planFile := filepath.Join(dir, "tfplan.json")
+	inputFile := filepath.Join(dir, "tfplan_input.json")
+	regoFile := filepath.Join(dir, "public_instance.rego")
+	writeFile(testPlanJson, planFile)
+	writeFile(`package idcos
+
+# @input_type: plan
+# @resource_type: aws_instance
+public_instance[res.address] {
+	res := input.resources[_]
+	res.type == "aws_instance"
+	res.after.associate_public_ip_address == true
+}
+`, regoFile)
+
+	input, err := WritePlanInput(planFile, inputFile)
+	assert.NoError(t, err)
+	result, err := RegoParse(regoFile, inputFile, "public_instance")
+	assert.NoError(t, err)
+
+	violations := planViolations(input, result, Meta{Id: "po-1", Name: "public_instance", Severity: "high"})
+	assert.Len(t, violations, 1)
+	assert.Equal(t, "module.app.aws_instance.web[0]", violations[0].Address)
+	assert.Equal(t, "aws_instance", violations[0].ResourceType)
+	assert.Equal(t, "web", violations[0].ResourceName)
+	assert.Equal(t, "module.app", violations[0].ModuleName)
+	assert.Equal(t, "po-1", violations[0].RuleId)
+}
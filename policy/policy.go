@@ -43,6 +43,7 @@ var (
 	MSG_TEMPLATE_PASSED    = green("Passed: \t") + "group: {{.Category}}, name: {{.RuleName}}, id: {{.RuleId}}, severity: {{.Severity}}"
 	MSG_TEMPLATE_VIOLATED  = red("Violated: \t") + "group: {{.Category}}, name: {{.RuleName}}, id: {{.RuleId}}, resource_id : {{.ResourceName}}, severity: {{.Severity}}"
 	MSG_TEMPLATE_SUPRESSED = yellow("Suppressed: \t") + "group: {{.Category}}, name: {{.RuleName}}, id: {{.RuleId}}, severity: {{.Severity}}"
+	MSG_TEMPLATE_SKIPPED   = yellow("Skipped: \t") + "group: {{.Category}}, name: {{.RuleName}}, id: {{.RuleId}}, severity: {{.Severity}}, reason: no plan input"
 )
 
 type Parser struct {
@@ -68,6 +69,8 @@ type Meta struct {
 	Version       int    `json:"version"`                                            // 策略版本
 	FixSuggestion string `json:"fix_suggestion"`                                     // 修复建议
 	Description   string `json:"description"`                                        // 描述
+
+	InputType string `json:"input_type" validate:"omitempty,oneof=config plan"` // 策略输入类型，为空时为 config
 }
 
 type Resource struct {
@@ -116,6 +119,8 @@ type Violation struct {
 	ModuleName   string `json:"module_name,omitempty"`
 	PlanRoot     string `json:"plan_root,omitempty"`
 	Source       string `json:"source,omitempty"`
+
+	Address string `json:"address,omitempty"` // 违规资源的完整地址，只有 plan 策略的扫描结果有该字段
 }
 
 type TsCount struct {
@@ -785,6 +790,7 @@ func ParseMeta(regoFilePath string, metaFilePath string) (*PolicyWithMeta, e.Err
 		meta.Severity = consts.PolicySeverityMedium
 	}
 	meta.Severity = strings.ToLower(meta.Severity)
+	meta.InputType = strings.ToLower(meta.InputType)
 
 	if err := ValidateMeta(meta); err != nil {
 		return nil, err
@@ -830,6 +836,9 @@ func ParseMetaFromRego(regoFilePath string, regoContent string) (*Meta, error) {
 	//	## 策略分类(或者叫标签)，多个分类使用逗号分隔
 	//	# @label: cat1,cat2
 	//
+	//	## 策略输入类型: config(默认，检查解析后的模板配置)或 plan(检查 terraform plan 的结果，见 PlanInput)
+	//	# @input_type: plan
+	//
 	//	## 策略修复建议（支持多行）
 	//	# @fix_suggestion:
 	//	Terraform 代码去掉`associate_public_ip_address`配置
@@ -853,6 +862,7 @@ func ParseMetaFromRego(regoFilePath string, regoContent string) (*Meta, error) {
 		Category:     ExtractStr("category", regoContent),
 		ReferenceId:  ExtractStr("reference_id", regoContent),
 		Severity:     ExtractStr("severity", regoContent),
+		InputType:    ExtractStr("input_type", regoContent),
 	}
 	ver := ExtractStr("version", regoContent)
 	meta.Version, _ = strconv.Atoi(ver)
@@ -39,6 +39,7 @@ type Scanner struct {
 	InputFile  string // 资源输入文件
 	ResultFile string // 扫描结果输出，默认输出到 stdout
 	MapFile    string // 源码映射文件
+	PlanFile   string // plan json 文件，设置后执行 plan 策略
 	WorkingDir string
 	PolicyDir  string
 
@@ -367,9 +368,34 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 		return err
 	}
 
+	var planInput *PlanInput
+	planInputFile := filepath.Join(s.WorkingDir, runner.ScanPlanInputFile)
+	if s.PlanFile != "" {
+		if planInput, err = WritePlanInput(s.PlanFile, planInputFile); err != nil {
+			return errors.Wrap(err, "parse plan input")
+		}
+	}
+
 	violated := false
 	for _, p := range policies {
-		result, err := RegoParse(filepath.Join(p.Meta.Root, p.Meta.File), s.GetConfigPath(code), p.Meta.Name)
+		rule := Rule{
+			RuleName:    p.Meta.Name,
+			Description: p.Meta.Description,
+			RuleId:      p.Meta.Id,
+			Severity:    p.Meta.Severity,
+			Category:    p.Meta.Category,
+		}
+		inputFile := s.GetConfigPath(code)
+		if p.Meta.InputType == common.PolicyInputPlan {
+			// 没有 plan 结果时(如云模板扫描)不执行 plan 策略
+			if planInput == nil {
+				s.Console(s.GetMessage(MSG_TEMPLATE_SKIPPED, rule))
+				continue
+			}
+			inputFile = planInputFile
+		}
+
+		result, err := RegoParse(filepath.Join(p.Meta.Root, p.Meta.File), inputFile, p.Meta.Name)
 		if err != nil {
 			scanError := ScanError{
 				RuleName:    p.Meta.Name,
@@ -388,10 +414,11 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 			s.Console(s.GetMessage(MSG_TEMPLATE_ERROR, scanError))
 			continue
 		}
-		// parse result
-		res := (&Rego{}).ParseResource(result)
-		// generate result
-		if len(res) > 0 {
+		var violations []Violation
+		if p.Meta.InputType == common.PolicyInputPlan {
+			// plan 策略返回完整的资源地址，每个违规资源生成一条结果
+			violations = planViolations(planInput, result, p.Meta)
+		} else if res := (&Rego{}).ParseResource(result); len(res) > 0 {
 			// {resType}.{resName}, example: alicloud_instance.web
 			resName := res[0]
 			resType := "unknown"
@@ -411,18 +438,17 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 			if len(inputResource) > 0 {
 				violation.Line, violation.File = findLineNoFromMap(inputResource, res[0])
 			}
-			output.Results.Violations = append(output.Results.Violations, violation)
+			violations = append(violations, violation)
+		}
+		// generate result
+		if len(violations) > 0 {
+			for _, violation := range violations {
+				s.Console(s.GetMessage(MSG_TEMPLATE_VIOLATED, violation))
+			}
+			output.Results.Violations = append(output.Results.Violations, violations...)
 			output.Results.ScanSummary.ViolatedPolicies++
-			s.Console(s.GetMessage(MSG_TEMPLATE_VIOLATED, violation))
 			violated = true
 		} else {
-			rule := Rule{
-				RuleName:    p.Meta.Name,
-				Description: p.Meta.Description,
-				RuleId:      p.Meta.Id,
-				Severity:    p.Meta.Severity,
-				Category:    p.Meta.Category,
-			}
 			output.Results.PassedRules = append(output.Results.PassedRules, rule)
 			output.Results.ScanSummary.PoliciesValidated++
 			s.Console(s.GetMessage(MSG_TEMPLATE_PASSED, rule))
@@ -0,0 +1,195 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 策略组的测试用例放在策略组目录下的 tests 目录中，每个 json 文件为一个测试用例:
+//
+//	policy_group
+//	├── instanceWithNoVpc.rego
+//	└── tests
+//	    ├── instance_without_vpc.json
+//	    └── fixtures
+//	        └── instance_without_vpc_input.json
+//
+// 测试用例文件格式如下，input 为策略的输入(config 策略为模板解析结果，plan 策略为 PlanInput)，
+// 也可以通过 input_file 指定 tests 目录下的输入文件；expect 指定各策略(策略 id 或名称)的期望结果:
+//
+//	{
+//	  "description": "实例未配置 vswitch",
+//	  "input_file": "fixtures/instance_without_vpc_input.json",
+//	  "expect": {
+//	    "cloudiac_alicloud_security_p001": "violate",
+//	    "cloudiac_alicloud_security_p002": "pass"
+//	  }
+//	}
+const PolicyGroupTestsDir = "tests"
+
+const (
+	PolicyTestExpectPass    = "pass"
+	PolicyTestExpectViolate = "violate"
+	PolicyTestResultFailed  = "failed" // 策略执行出错
+)
+
+type PolicyTestCase struct {
+	Description string            `json:"description"`
+	Input       json.RawMessage   `json:"input"`
+	InputFile   string            `json:"input_file"`
+	Expect      map[string]string `json:"expect"`
+}
+
+type PolicyTestResult struct {
+	File        string `json:"file"`   // 测试用例文件，相对于 tests 目录
+	Policy      string `json:"policy"` // 策略 id 或名称
+	Description string `json:"description"`
+	Expect      string `json:"expect"`
+	Actual      string `json:"actual"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (r PolicyTestResult) Passed() bool {
+	return r.Error == "" && r.Actual == r.Expect
+}
+
+func (r PolicyTestResult) String() string {
+	if r.Error != "" {
+		return fmt.Sprintf("%s: policy %s: %s", r.File, r.Policy, r.Error)
+	}
+	return fmt.Sprintf("%s: policy %s: expect %s, got %s", r.File, r.Policy, r.Expect, r.Actual)
+}
+
+// RunPolicyGroupTests 执行策略组 tests 目录下的测试用例，策略组没有 tests 目录时返回空结果。
+// 测试用例文件格式错误时返回 error，策略执行结果与期望不一致不返回 error，通过 PolicyTestResult.Passed() 判断
+func RunPolicyGroupTests(dirname string, policies []*PolicyWithMeta) ([]PolicyTestResult, error) {
+	testsDir := filepath.Join(dirname, PolicyGroupTestsDir)
+	if fi, err := os.Stat(testsDir); err != nil || !fi.IsDir() {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(testsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	policyMap := make(map[string]*PolicyWithMeta)
+	for _, p := range policies {
+		policyMap[p.Meta.Id] = p
+		if _, ok := policyMap[p.Meta.Name]; !ok {
+			policyMap[p.Meta.Name] = p
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "policy-test-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	results := make([]PolicyTestResult, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		tc, inputFile, err := readPolicyTestCase(testsDir, entry.Name(), tmpDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(PolicyGroupTestsDir, entry.Name()), err)
+		}
+
+		names := make([]string, 0, len(tc.Expect))
+		for name := range tc.Expect {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			r := PolicyTestResult{
+				File:        entry.Name(),
+				Policy:      name,
+				Description: tc.Description,
+				Expect:      tc.Expect[name],
+			}
+			p, ok := policyMap[name]
+			if !ok {
+				r.Error = "policy not found"
+				results = append(results, r)
+				continue
+			}
+
+			res, err := RegoParse(filepath.Join(p.Meta.Root, p.Meta.File), inputFile, p.Meta.Name)
+			if err != nil {
+				r.Actual = PolicyTestResultFailed
+				r.Error = err.Error()
+			} else if len((&Rego{}).ParseResource(res)) > 0 {
+				r.Actual = PolicyTestExpectViolate
+			} else {
+				r.Actual = PolicyTestExpectPass
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+// PolicyTestFailures 返回未通过的测试结果
+func PolicyTestFailures(results []PolicyTestResult) []PolicyTestResult {
+	failures := make([]PolicyTestResult, 0)
+	for _, r := range results {
+		if !r.Passed() {
+			failures = append(failures, r)
+		}
+	}
+	return failures
+}
+
+// readPolicyTestCase 读取测试用例，返回用例及其输入文件路径。内联的 input 会写入 tmpDir 下的临时文件
+func readPolicyTestCase(testsDir string, name string, tmpDir string) (*PolicyTestCase, string, error) {
+	bs, err := os.ReadFile(filepath.Join(testsDir, name))
+	if err != nil {
+		return nil, "", err
+	}
+	tc := PolicyTestCase{}
+	if err := json.Unmarshal(bs, &tc); err != nil {
+		return nil, "", err
+	}
+
+	if len(tc.Expect) == 0 {
+		return nil, "", fmt.Errorf("missing expect")
+	}
+	for policyName, expect := range tc.Expect {
+		if expect != PolicyTestExpectPass && expect != PolicyTestExpectViolate {
+			return nil, "", fmt.Errorf("invalid expect '%s' of policy %s, must be %s or %s",
+				expect, policyName, PolicyTestExpectPass, PolicyTestExpectViolate)
+		}
+	}
+
+	if tc.InputFile != "" {
+		if len(tc.Input) > 0 {
+			return nil, "", fmt.Errorf("input and input_file are mutually exclusive")
+		}
+		// 输入文件只允许引用 tests 目录下的文件
+		inputFile := filepath.Join(testsDir, tc.InputFile)
+		if rel, err := filepath.Rel(testsDir, inputFile); err != nil || rel == ".." ||
+			strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, "", fmt.Errorf("input_file '%s' out of tests directory", tc.InputFile)
+		}
+		return &tc, inputFile, nil
+	}
+
+	if len(tc.Input) == 0 {
+		return nil, "", fmt.Errorf("missing input or input_file")
+	}
+	inputFile := filepath.Join(tmpDir, name)
+	if err := os.WriteFile(inputFile, tc.Input, 0644); err != nil { //nolint:gosec
+		return nil, "", err
+	}
+	return &tc, inputFile, nil
+}
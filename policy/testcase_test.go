@@ -0,0 +1,65 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPolicyGroupTests(t *testing.T) {
+	dir := "example/policy_group_example"
+	policies, er := ParsePolicyGroup(dir)
+	assert.Nil(t, er)
+
+	results, err := RunPolicyGroupTests(dir, policies)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Empty(t, PolicyTestFailures(results))
+
+	// 没有 tests 目录
+	results, err = RunPolicyGroupTests("example/fomer_policy_group_example", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestRunPolicyGroupTestsFailed(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, PolicyGroupTestsDir), 0755))
+	writeFile(`package cloudiac
+
+# @id: p001
+# @resource_type: alicloud_instance
+instanceWithNoVpc[instance.id] {
+	instance := input.alicloud_instance[_]
+	not instance.config.vswitch_id
+}
+`, filepath.Join(dir, "instanceWithNoVpc.rego"))
+	writeFile(`{
+  "input": {"alicloud_instance": [{"id": "alicloud_instance.web", "config": {}}]},
+  "expect": {"p001": "pass", "p002": "pass"}
+}`, filepath.Join(dir, PolicyGroupTestsDir, "case.json"))
+
+	policies, er := ParsePolicyGroup(dir)
+	assert.Nil(t, er)
+	results, err := RunPolicyGroupTests(dir, policies)
+	assert.NoError(t, err)
+
+	failures := PolicyTestFailures(results)
+	assert.Len(t, failures, 2)
+	assert.Equal(t, PolicyTestExpectViolate, failures[0].Actual)
+	assert.Equal(t, "policy not found", failures[1].Error)
+
+	// 用例格式错误
+	writeFile(`{"input_file": "../instanceWithNoVpc.rego", "expect": {"p001": "pass"}}`,
+		filepath.Join(dir, PolicyGroupTestsDir, "case.json"))
+	_, err = RunPolicyGroupTests(dir, policies)
+	assert.Error(t, err)
+
+	writeFile(`{"input": {}, "expect": {"p001": "violated"}}`, filepath.Join(dir, PolicyGroupTestsDir, "case.json"))
+	_, err = RunPolicyGroupTests(dir, policies)
+	assert.Error(t, err)
+}
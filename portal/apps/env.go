@@ -127,6 +127,10 @@ func createEnvCheck(c *ctx.ServiceContext, form *forms.CreateEnvForm) e.Error {
 		return er
 	}
 
+	if er := services.CheckPolicyEnforcement(c.DB(), c.OrgId, form.PolicyEnforcement); er != nil {
+		return er
+	}
+
 	return nil
 }
 
@@ -434,16 +438,20 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		Revision:     form.Revision,
 		KeyId:        form.KeyId,
 		Workdir:      form.Workdir,
+		IacEngine:    form.IacEngine,
 
 		TTL:             form.TTL,
 		AutoDestroyAt:   &destroyAt,
 		AutoApproval:    form.AutoApproval,
 		StopOnViolation: form.StopOnViolation,
 
-		Triggers:    form.Triggers,
-		RetryAble:   form.RetryAble,
-		RetryDelay:  form.RetryDelay,
-		RetryNumber: form.RetryNumber,
+		PolicyEnforcement: form.PolicyEnforcement,
+
+		Triggers:      form.Triggers,
+		TriggerFilter: form.TriggerFilter,
+		RetryAble:     form.RetryAble,
+		RetryDelay:    form.RetryDelay,
+		RetryNumber:   form.RetryNumber,
 
 		ExtraData:        models.JSON(form.ExtraData),
 		Callback:         form.Callback,
@@ -474,6 +482,9 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 	if err != nil {
 		return nil, err
 	}
+	if err := checkEnvRequiredPolicyGroups(tx, env); err != nil {
+		return nil, err
+	}
 
 	// 来源：手动触发、外部调用
 	taskSource, taskSourceSys := getEnvSource(form.Source)
@@ -861,6 +872,9 @@ func setAndCheckUpdateEnvDestroy(tx *db.Session, attrs models.Attrs, env *models
 }
 
 func setAndCheckUpdateEnvTriggers(c *ctx.ServiceContext, tx *db.Session, attrs models.Attrs, env *models.Env, form *forms.UpdateEnvForm) e.Error {
+	if form.HasKey("triggerFilter") {
+		attrs["trigger_filter"] = form.TriggerFilter
+	}
 	if form.HasKey("triggers") {
 		attrs["triggers"] = models.StringArray(form.Triggers)
 		// triggers有变更时，需要检测webhook的配置
@@ -915,6 +929,13 @@ func setAndCheckUpdateEnvByForm(c *ctx.ServiceContext, tx *db.Session, attrs mod
 		return err
 	}
 
+	if form.HasKey("policyEnforcement") {
+		if err := services.CheckPolicyEnforcement(tx, c.OrgId, form.PolicyEnforcement); err != nil {
+			return err
+		}
+		attrs["policy_enforcement"] = form.PolicyEnforcement
+	}
+
 	if form.HasKey("archived") {
 		envResCount := int64(0)
 		if env.LastResTaskId != "" {
@@ -936,6 +957,12 @@ func setAndCheckUpdateEnvByForm(c *ctx.ServiceContext, tx *db.Session, attrs mod
 		if form.Name != "" {
 			attrs["name"] = form.Name
 		}
+		if form.Archived {
+			// 归档的环境不再参与环境依赖
+			if err := services.DeleteEnvDependencies(tx, env.Id); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -1024,6 +1051,12 @@ func UpdateEnv(c *ctx.ServiceContext, form *forms.UpdateEnvForm) (*models.EnvDet
 		c.Logger().Errorf("error update env, err %s", err)
 		return nil, err
 	}
+	if form.HasKey("policyEnforcement") || form.HasKey("policyEnable") || form.HasKey("policyGroup") {
+		if err := checkEnvRequiredPolicyGroups(tx, env); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
 
 	env.MergeTaskStatus()
 	detail := &models.EnvDetail{Env: *env}
@@ -1250,6 +1283,9 @@ func setEnvByForm(env *models.Env, form *forms.DeployEnvForm) {
 	if form.HasKey("triggers") {
 		env.Triggers = form.Triggers
 	}
+	if form.HasKey("triggerFilter") {
+		env.TriggerFilter = form.TriggerFilter
+	}
 
 	if form.HasKey("keyId") {
 		env.KeyId = form.KeyId
@@ -1287,6 +1323,9 @@ func setEnvByForm(env *models.Env, form *forms.DeployEnvForm) {
 	if form.HasKey("workdir") {
 		env.Workdir = form.Workdir
 	}
+	if form.HasKey("iacEngine") {
+		env.IacEngine = form.IacEngine
+	}
 
 	setEnvRunnerInfoByForm(env, form)
 }
@@ -1445,6 +1484,13 @@ func setAndCheckEnvByForm(c *ctx.ServiceContext, tx *db.Session, env *models.Env
 	if err := setAndCheckEnvDriftCron(env, form); err != nil {
 		return err
 	}
+
+	if form.HasKey("policyEnforcement") {
+		if err := services.CheckPolicyEnforcement(tx, c.OrgId, form.PolicyEnforcement); err != nil {
+			return err
+		}
+		env.PolicyEnforcement = form.PolicyEnforcement
+	}
 	if form.HasKey("extraData") {
 		env.ExtraData = form.ExtraData
 	}
@@ -1551,6 +1597,11 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	if err != nil {
 		return nil, err
 	}
+	if form.HasKey("policyEnforcement") || form.HasKey("policyEnable") || form.HasKey("policyGroup") {
+		if err := checkEnvRequiredPolicyGroups(tx, env); err != nil {
+			return nil, err
+		}
+	}
 	lg.Debugln("envDeploy -> setAndCheckEnvByForm finish")
 
 	if env.IsDemo && env.Status == models.EnvStatusDestroyed {
@@ -1572,6 +1623,25 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	}
 	lg.Debugln("envDeploy -> GetValidVarsAndVgVars finish")
 
+	pt := models.Task{
+		Targets:   targets,
+		Variables: vars,
+		Revision:  env.Revision,
+	}
+	if form.PlanTaskId != "" {
+		planTask, err := deployPlanTaskCheck(tx, env, form)
+		if err != nil {
+			return nil, err
+		}
+		// 基于 plan 任务部署时使用 plan 任务的配置，保证部署的内容与 plan 一致
+		pt.Targets = planTask.Targets
+		pt.Variables = planTask.Variables
+		pt.Revision = planTask.Revision
+		pt.CommitId = planTask.CommitId
+		pt.Workdir = planTask.Workdir
+		pt.Extra.PlanTaskId = planTask.Id
+	}
+
 	// 获取实际执行任务的runnerID
 	rId, err := services.GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
 	if err != nil {
@@ -1606,13 +1676,16 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	// 创建任务
 	task, err := services.CreateTask(tx, tpl, env, models.Task{
 		Name:            models.Task{}.GetTaskNameByType(form.TaskType),
-		Targets:         targets,
+		Targets:         pt.Targets,
 		CreatorId:       c.UserId,
 		TokenId:         c.ApiTokenId,
 		KeyId:           env.KeyId,
-		Variables:       vars,
+		Variables:       pt.Variables,
 		AutoApprove:     env.AutoApproval,
-		Revision:        env.Revision,
+		Revision:        pt.Revision,
+		CommitId:        pt.CommitId,
+		Workdir:         pt.Workdir,
+		Extra:           pt.Extra,
 		StopOnViolation: env.StopOnViolation,
 		ExtraData:       env.ExtraData,
 		BaseTask: models.BaseTask{
@@ -1659,6 +1732,58 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	return envDetail, nil
 }
 
+// checkEnvRequiredPolicyGroups 检查环境生效的分级处理配置中必须通过的策略组已绑定到环境，且环境开启了合规检测
+func checkEnvRequiredPolicyGroups(tx *db.Session, env *models.Env) e.Error {
+	pe, err := services.GetEnvPolicyEnforcement(tx, env)
+	if err != nil {
+		return err
+	}
+	return services.CheckEnvRequiredPolicyGroups(tx, env, pe.RequiredGroups)
+}
+
+// deployPlanTaskCheck 检查部署指定的 plan 任务是否可以直接用于部署
+func deployPlanTaskCheck(tx *db.Session, env *models.Env, form *forms.DeployEnvForm) (*models.Task, e.Error) {
+	if form.TaskType != common.TaskTypeApply {
+		return nil, e.New(e.BadParam, fmt.Errorf("'planTaskId' is only valid for apply task"), http.StatusBadRequest)
+	}
+
+	planTask, er := services.GetTaskById(tx, form.PlanTaskId)
+	if er != nil {
+		if er.Code() == e.TaskNotExists {
+			return nil, e.New(er.Code(), er, http.StatusNotFound)
+		}
+		return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	}
+	if planTask.EnvId != env.Id || planTask.Type != common.TaskTypePlan || planTask.Status != models.TaskComplete {
+		return nil, e.New(e.TaskPlanNotApplicable,
+			fmt.Errorf("task '%s' is not a completed plan task of the env", planTask.Id), http.StatusBadRequest)
+	}
+	if planTask.Extra.StateSerial == nil {
+		return nil, e.New(e.TaskPlanNotApplicable,
+			fmt.Errorf("plan task '%s' does not have a saved plan", planTask.Id), http.StatusBadRequest)
+	}
+
+	// plan 之后 state 发生变化(有其他部署任务执行过)时 plan 文件已经过期，环境没有 state 时 serial 为 0
+	var content []byte
+	latest, er := services.GetLatestStateVersion(tx, env.StatePath)
+	if er != nil && er.Code() != e.StateNotExists {
+		return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	} else if latest != nil {
+		if content, er = services.GetStateVersionContent(latest); er != nil {
+			return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+		}
+	}
+	serial, err := services.GetStateSerial(content)
+	if err != nil {
+		return nil, e.New(e.StateInvalid, err, http.StatusInternalServerError)
+	}
+	if serial != *planTask.Extra.StateSerial {
+		return nil, e.New(e.StateChanged, fmt.Errorf("state serial changed from %d to %d since the plan",
+			*planTask.Extra.StateSerial, serial), http.StatusConflict)
+	}
+	return planTask, nil
+}
+
 // SearchEnvResources 查询环境资源列表
 func SearchEnvResources(c *ctx.ServiceContext, form *forms.SearchEnvResourceForm) (interface{}, e.Error) {
 	if c.OrgId == "" || c.ProjectId == "" || form.Id == "" {
@@ -0,0 +1,316 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// checkEnvTargetProject 检查目标项目是否存在，以及用户是否有权限在目标项目中管理环境
+func checkEnvTargetProject(c *ctx.ServiceContext, projectId models.Id, tplId models.Id) e.Error {
+	project := models.Project{}
+	if err := services.QueryWithOrgId(c.DB(), c.OrgId).Where("id = ?", projectId).First(&project); err != nil {
+		if e.IsRecordNotFound(err) {
+			return e.New(e.ProjectNotExists, err, http.StatusBadRequest)
+		}
+		return e.New(e.DBError, err)
+	}
+
+	if !c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) &&
+		!services.UserHasProjectRole(c.UserId, c.OrgId, projectId, consts.ProjectRoleManager) &&
+		!services.UserHasProjectRole(c.UserId, c.OrgId, projectId, consts.ProjectRoleApprover) {
+		return e.New(e.PermissionDeny, fmt.Errorf("no permission to manage environments in project %s", projectId),
+			http.StatusForbidden)
+	}
+
+	if _, err := services.GetBindTemplate(c.DB(), projectId, tplId); err != nil {
+		if err.Code() == e.TemplateNotBind {
+			return e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return err
+	}
+	return nil
+}
+
+// setEnvSchedule 根据复制的 cron 表达式及 ttl 计算环境下次自动部署、销毁及偏移检测的时间
+func setEnvSchedule(env *models.Env) e.Error {
+	env.AutoDeployAt, env.AutoDestroyAt, env.NextDriftTaskTime = nil, nil, nil
+
+	if env.AutoDeployCron != "" {
+		at, err := GetNextCronTime(env.AutoDeployCron)
+		if err != nil {
+			return err
+		}
+		mt := models.Time(*at)
+		env.AutoDeployAt = &mt
+	}
+
+	if env.AutoDestroyCron != "" {
+		at, err := GetNextCronTime(env.AutoDestroyCron)
+		if err != nil {
+			return err
+		}
+		mt := models.Time(*at)
+		env.AutoDestroyAt = &mt
+	} else if env.Status != models.EnvStatusInactive && env.Status != models.EnvStatusDestroyed {
+		// 活跃环境同步修改 destroyAt，未部署的环境在部署时计算
+		ttl, err := services.ParseTTL(env.TTL)
+		if err != nil {
+			return e.New(e.BadParam, err, http.StatusBadRequest)
+		}
+		if ttl > 0 {
+			mt := models.Time(time.Now().Add(ttl))
+			env.AutoDestroyAt = &mt
+		}
+	}
+
+	if env.OpenCronDrift && env.CronDriftExpress != "" {
+		at, err := ParseCronpress(env.CronDriftExpress)
+		if err != nil {
+			return err
+		}
+		mt := models.Time(*at)
+		env.NextDriftTaskTime = &mt
+	}
+	return nil
+}
+
+// copyEnvRelations 复制环境的变量、变量组及策略组
+func copyEnvRelations(tx *db.Session, dst *models.Env, src *models.Env) e.Error {
+	if err := services.CopyEnvVars(tx, dst, src); err != nil {
+		return err
+	}
+	if err := services.CopyEnvVarGroupRels(tx, dst, src); err != nil {
+		if err.Code() == e.VariableGroupPermDeny {
+			return e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return err
+	}
+	return services.CopyEnvPolicyRels(tx, dst, src)
+}
+
+// getPinnedTask 查询源环境最后一次部署成功的任务，用于固定目标环境部署的分支/标签及 commit
+func getPinnedTask(c *ctx.ServiceContext, src *models.Env, pinRevision bool) (*models.Task, e.Error) {
+	if !pinRevision {
+		return nil, nil
+	}
+	task, err := services.GetEnvLastSuccessApplyTask(c.DB(), src.Id)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, e.New(e.TaskNotExists,
+			fmt.Errorf("environment '%s' has no successful apply task", src.Name), http.StatusBadRequest)
+	}
+	return task, nil
+}
+
+// createCopiedEnvTask 为克隆或推广后的环境创建任务，pinned 不为空时使用其 commit
+func createCopiedEnvTask(c *ctx.ServiceContext, tx *db.Session, env *models.Env, taskType string, pinned *models.Task) (*models.Task, e.Error) {
+	tpl, err := services.GetTemplateById(tx, env.TplId)
+	if err != nil {
+		return nil, err
+	}
+	vars, er := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if er != nil {
+		return nil, e.AutoNew(er, e.InternalError)
+	}
+
+	pt := models.Task{
+		Name:            models.Task{}.GetTaskNameByType(taskType),
+		Targets:         env.Targets,
+		CreatorId:       c.UserId,
+		TokenId:         c.ApiTokenId,
+		KeyId:           env.KeyId,
+		Variables:       vars,
+		AutoApprove:     env.AutoApproval,
+		Revision:        env.Revision,
+		StopOnViolation: env.StopOnViolation,
+		BaseTask: models.BaseTask{
+			Type:        taskType,
+			StepTimeout: env.StepTimeout,
+			RunnerId:    env.RunnerId,
+		},
+		Source: consts.TaskSourceManual,
+	}
+	if pinned != nil {
+		pt.Revision = pinned.Revision
+		pt.CommitId = pinned.CommitId
+	}
+	task, err := services.CreateTask(tx, tpl, env, pt)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return task, nil
+}
+
+// CloneEnv 克隆环境的配置、变量、变量组及策略组到当前项目或其他项目的新环境
+func CloneEnv(c *ctx.ServiceContext, form *forms.CloneEnvForm) (*models.EnvDetail, e.Error) {
+	src, err := getStateEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	projectId := form.TargetProjectId
+	if projectId == "" {
+		projectId = c.ProjectId
+	}
+	if err := checkEnvTargetProject(c, projectId, src.TplId); err != nil {
+		return nil, err
+	}
+	pinned, err := getPinnedTask(c, src, form.PinRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := models.Env{
+		OrgId:     src.OrgId,
+		ProjectId: projectId,
+		TplId:     src.TplId,
+		CreatorId: c.UserId,
+		TokenId:   c.ApiTokenId,
+		Name:      form.Name,
+		Status:    models.EnvStatusInactive,
+	}
+	services.CopyEnvSettings(&dst, src)
+	if pinned != nil {
+		dst.Revision = pinned.Revision
+	}
+	if err := setEnvSchedule(&dst); err != nil {
+		return nil, err
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if env, _ := services.GetEnvByName(tx, dst.OrgId, dst.ProjectId, dst.Name); env != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.EnvAlreadyExists, http.StatusBadRequest)
+	}
+	env, err := services.CreateEnv(tx, dst)
+	if err != nil {
+		_ = tx.Rollback()
+		if err.Code() == e.EnvNameDuplicated {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	if err := copyEnvRelations(tx, env, src); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	detail := models.EnvDetail{Env: *env, Operator: c.Username, OperatorId: c.UserId}
+	if form.TaskType != "" {
+		task, err := createCopiedEnvTask(c, tx, env, form.TaskType, pinned)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		detail.TaskId = task.Id
+		detail.CommitId = task.CommitId
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "clone", env.Name,
+		models.ResAttrs{"sourceEnvId": src.Id})
+	return &detail, nil
+}
+
+// PromoteEnv 将环境的配置、变量、变量组及策略组推广到已存在的目标环境(通常属于其他项目)
+func PromoteEnv(c *ctx.ServiceContext, form *forms.PromoteEnvForm) (*models.EnvDetail, e.Error) {
+	src, err := getStateEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if form.TargetEnvId == src.Id {
+		return nil, e.New(e.BadParam, fmt.Errorf("target environment is the source environment"), http.StatusBadRequest)
+	}
+
+	dst, err := services.GetEnvById(services.QueryWithOrgId(c.DB(), c.OrgId), form.TargetEnvId)
+	if err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	if dst.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+	if dst.Locked {
+		return nil, e.New(e.EnvLocked, http.StatusBadRequest)
+	}
+	if dst.TplId != src.TplId {
+		return nil, e.New(e.BadParam, fmt.Errorf("target environment uses a different template"), http.StatusBadRequest)
+	}
+	if err := checkEnvTargetProject(c, dst.ProjectId, dst.TplId); err != nil {
+		return nil, err
+	}
+	pinned, err := getPinnedTask(c, src, form.PinRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	services.CopyEnvSettings(dst, src)
+	if pinned != nil {
+		dst.Revision = pinned.Revision
+	}
+	if err := setEnvSchedule(dst); err != nil {
+		return nil, err
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	env, err := services.UpdateEnv(tx, dst.Id, services.EnvSettingsAttrs(dst))
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := copyEnvRelations(tx, env, src); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	detail := models.EnvDetail{Env: *env, Operator: c.Username, OperatorId: c.UserId}
+	if form.TaskType != "" {
+		task, err := createCopiedEnvTask(c, tx, env, form.TaskType, pinned)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		detail.TaskId = task.Id
+		detail.CommitId = task.CommitId
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv, "promote", env.Name,
+		models.ResAttrs{"sourceEnvId": src.Id})
+	return &detail, nil
+}
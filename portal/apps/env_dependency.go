@@ -0,0 +1,80 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"net/http"
+)
+
+// SearchEnvDependencies 查询环境依赖的上游环境
+func SearchEnvDependencies(c *ctx.ServiceContext, form *forms.DetailEnvForm) ([]resps.EnvDependencyResp, e.Error) {
+	env, er := getStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	deps := make([]resps.EnvDependencyResp, 0)
+	if err := services.QueryEnvDependency(c.DB(), env.Id).Scan(&deps); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return deps, nil
+}
+
+// UpdateEnvDependencies 设置环境依赖的上游环境及输出映射
+func UpdateEnvDependencies(c *ctx.ServiceContext, form *forms.UpdateEnvDependencyForm) ([]resps.EnvDependencyResp, e.Error) {
+	env, er := getStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+
+	deps := make([]models.EnvDependency, 0, len(form.Dependencies))
+	for _, d := range form.Dependencies {
+		if d.DependsOnEnvId == env.Id {
+			return nil, e.New(e.EnvDependencyCycle, http.StatusBadRequest)
+		}
+		deps = append(deps, models.EnvDependency{
+			DependsOnEnvId: d.DependsOnEnvId,
+			Outputs:        d.Outputs,
+			TriggerType:    d.TriggerType,
+		})
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	if err := services.ReplaceEnvDependencies(tx, env, deps); err != nil {
+		_ = tx.Rollback()
+		if err.Code() == e.EnvNotExists || err.Code() == e.EnvDependencyCycle {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	return SearchEnvDependencies(c, &forms.DetailEnvForm{BaseForm: form.BaseForm, Id: form.Id})
+}
+
+// EnvDependencyGraph 环境依赖关系图
+func EnvDependencyGraph(c *ctx.ServiceContext, form *forms.DetailEnvForm) (*resps.EnvDependencyGraphResp, e.Error) {
+	env, er := getStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	return services.GetEnvDependencyGraph(c.DB(), env)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// ImportEnvResources 创建资源导入任务，将已存在的云资源导入到环境的 state 中，导入后执行 plan 展示剩余的差异
+func ImportEnvResources(c *ctx.ServiceContext, form *forms.ImportEnvResourcesForm) (ret *models.Task, er e.Error) {
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		ret, er = importEnvResources(c, tx, form)
+		return er
+	})
+
+	if er == nil {
+		addrs := make([]string, 0, len(form.Resources))
+		for _, r := range form.Resources {
+			addrs = append(addrs, r.Address)
+		}
+		services.InsertUserOperateLog(c.UserId, c.OrgId, form.Id, consts.OperatorObjectTypeEnv,
+			models.TaskTypeImport, "", models.ResAttrs{"resources": addrs})
+	}
+	return ret, er
+}
+
+func importEnvResources(c *ctx.ServiceContext, tx *db.Session, form *forms.ImportEnvResourcesForm) (*models.Task, e.Error) {
+	env, er := envCheck(tx, c.OrgId, c.ProjectId, form.Id, c.Logger())
+	if er != nil {
+		return nil, er
+	}
+	if env.Locked {
+		return nil, e.New(e.EnvLocked, http.StatusBadRequest)
+	}
+	if tasks, er := services.GetActiveTaskByEnvId(tx, env.Id); er != nil {
+		return nil, er
+	} else if len(tasks) > 0 {
+		return nil, e.New(e.EnvDeploying, fmt.Errorf("env has active task"), http.StatusBadRequest)
+	}
+
+	tpl, er := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
+	if er != nil {
+		return nil, er
+	}
+	if tpl.StackType != "" {
+		return nil, e.New(e.BadParam, fmt.Errorf("stack template does not support import"), http.StatusBadRequest)
+	}
+
+	imports := make(models.TaskImports, 0, len(form.Resources))
+	seen := make(map[string]bool)
+	for _, r := range form.Resources {
+		if seen[r.Address] {
+			return nil, e.New(e.BadParam, fmt.Errorf("duplicate resource address '%s'", r.Address), http.StatusBadRequest)
+		}
+		seen[r.Address] = true
+		imports = append(imports, models.TaskImport{Address: r.Address, Id: r.Id})
+	}
+
+	vars, err := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+	runnerId, er := services.GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+	if er != nil {
+		return nil, er
+	}
+
+	task, er := services.CreateTask(tx, tpl, env, models.Task{
+		Name:        models.Task{}.GetTaskNameByType(models.TaskTypeImport),
+		CreatorId:   c.UserId,
+		TokenId:     c.ApiTokenId,
+		KeyId:       env.KeyId,
+		Variables:   vars,
+		AutoApprove: env.AutoApproval,
+		Revision:    env.Revision,
+		ExtraData:   env.ExtraData,
+		Imports:     imports,
+		BaseTask: models.BaseTask{
+			Type:        models.TaskTypeImport,
+			StepTimeout: env.StepTimeout,
+			RunnerId:    runnerId,
+		},
+		Source:   consts.TaskSourceManual,
+		Callback: env.Callback,
+	})
+	if er != nil {
+		c.Logger().Errorf("error creating task, err %s", er)
+		return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	}
+
+	// 锁定环境，导入资源执行期间不允许创建其他任务
+	if er := services.EnvLockByTask(tx, env.Id, task.Id); er != nil {
+		return nil, e.New(er.Code(), er, http.StatusBadRequest)
+	}
+	return task, nil
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -690,6 +691,33 @@ func PolicyScanResult(c *ctx.ServiceContext, scope string, form *forms.PolicySca
 	}, nil
 }
 
+// ExportScanResult 导出扫描任务的检测结果为 sarif/junit 报告
+func ExportScanResult(c *ctx.ServiceContext, form *forms.ExportScanResultForm) ([]byte, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("export scan result %s as %s", form.Id, form.Format))
+
+	query := services.QueryWithOrgId(c.DB(), c.OrgId)
+	scanTask, err := services.GetScanTaskById(query, form.Id)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if scanTask.PolicyStatus == common.TaskPending {
+		return nil, e.New(e.BadRequest, fmt.Errorf("scan task %s is pending", scanTask.Id), http.StatusBadRequest)
+	}
+
+	result, err := services.GetScanTaskResult(services.QueryWithOrgId(c.DB(), c.OrgId, models.PolicyResult{}.TableName()), scanTask.Id)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	report, er := policy.ExportScanResult(form.Format, result, nil)
+	if er != nil {
+		return nil, e.New(e.InternalError, er, http.StatusInternalServerError)
+	}
+	return report, nil
+}
+
 func PolicyScanReport(c *ctx.ServiceContext, form *forms.PolicyScanReportForm) (*resps.PolicyScanReportResp, e.Error) { //nolint:cyclop
 	if !form.HasKey("showCount") {
 		// 默认展示最近五个
@@ -1065,7 +1093,25 @@ func PolicyGroupRepoDownloadAndParse(g *models.PolicyGroup) ([]*policy.PolicyWit
 	}
 
 	// 3. 遍历策略组目录，解析策略文件
-	return policy.ParsePolicyGroup(filepath.Join(tmpDir, "code", g.Dir))
+	groupDir := filepath.Join(tmpDir, "code", g.Dir)
+	policies, err := policy.ParsePolicyGroup(groupDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 执行策略组 tests 目录下的测试用例，测试未通过的版本不允许导入
+	results, er := policy.RunPolicyGroupTests(groupDir, policies)
+	if er != nil {
+		return nil, e.New(e.PolicyGroupTestFailed, er, http.StatusBadRequest)
+	}
+	if failures := policy.PolicyTestFailures(results); len(failures) > 0 {
+		msgs := make([]string, 0, len(failures))
+		for _, f := range failures {
+			msgs = append(msgs, f.String())
+		}
+		return nil, e.New(e.PolicyGroupTestFailed, fmt.Errorf("%s", strings.Join(msgs, "; ")), http.StatusBadRequest)
+	}
+	return policies, nil
 }
 
 // policiesUpsert 策略文件同步
@@ -1107,6 +1153,7 @@ func policiesUpsert(tx *db.Session, userId models.Id, orgId models.Id, policyGro
 			ResourceType:  pm.Meta.ResourceType,
 			PolicyType:    pm.Meta.PolicyType,
 			Tags:          pm.Meta.Category,
+			InputType:     pm.Meta.InputType,
 
 			Rego: models.Text(pm.Rego),
 		}
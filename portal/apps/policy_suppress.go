@@ -15,6 +15,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 func SearchPolicySuppress(c *ctx.ServiceContext, form *forms.SearchPolicySuppressForm) (interface{}, e.Error) {
@@ -31,6 +32,14 @@ func UpdatePolicySuppress(c *ctx.ServiceContext, form *forms.UpdatePolicySuppres
 		sups []models.PolicySuppress
 		err e.Error
 	)
+	// 屏蔽申请需要指定过期时间，审批通过后生效
+	expiresAt, er := models.Time{}.Parse(form.ExpiresAt)
+	if er != nil {
+		return nil, e.New(e.BadParam, er, http.StatusBadRequest)
+	}
+	if !time.Time(expiresAt).After(time.Now()) {
+		return nil, e.New(e.BadParam, fmt.Errorf("expiresAt must be in the future"), http.StatusBadRequest)
+	}
 	_ = c.DB().Transaction(func(tx *db.Session) error {
 		tx = services.QueryWithOrgId(tx, c.OrgId)
 		for _, id := range form.AddSourceIds {
@@ -39,6 +48,10 @@ func UpdatePolicySuppress(c *ctx.ServiceContext, form *forms.UpdatePolicySuppres
 				return  err
 			}
 		}
+		// 已拒绝或已过期的屏蔽记录不再生效，重新申请时替换为新的记录
+		if err := services.DeleteInactivePolicySuppress(tx, form.Id, form.AddSourceIds); err != nil {
+			return err
+		}
 		// 创新新的屏蔽记录
 		for _, id := range form.AddSourceIds {
 			if strings.HasPrefix(string(id), "env-") {
@@ -56,6 +69,8 @@ func UpdatePolicySuppress(c *ctx.ServiceContext, form *forms.UpdatePolicySuppres
 					PolicyId:   form.Id,
 					Type:       common.PolicySuppressTypeSource,
 					Reason:     form.Reason,
+					Status:     common.PolicySuppressStatusPending,
+					ExpiresAt:  &expiresAt,
 				})
 			} else if strings.HasPrefix(string(id), "tpl-") {
 				tpl, _ := services.GetTemplateById(tx, id)
@@ -71,6 +86,8 @@ func UpdatePolicySuppress(c *ctx.ServiceContext, form *forms.UpdatePolicySuppres
 					PolicyId:   form.Id,
 					Type:       common.PolicySuppressTypeSource,
 					Reason:     form.Reason,
+					Status:     common.PolicySuppressStatusPending,
+					ExpiresAt:  &expiresAt,
 				})
 			} else if strings.HasPrefix(string(id), "po-") {
 				// 一次只能提交一个策略禁用
@@ -80,7 +97,7 @@ func UpdatePolicySuppress(c *ctx.ServiceContext, form *forms.UpdatePolicySuppres
 				if form.Id != id {
 					return e.New(e.BadParam, fmt.Errorf("invalid policy id to disable"), http.StatusBadRequest)
 				}
-				po, _ := services.GetPolicyById(tx, id, c.OrgId)
+				// 策略屏蔽审批通过后才会设置策略状态为禁用
 				sups = append(sups, models.PolicySuppress{
 					CreatorId:  c.UserId,
 					TargetId:   id,
@@ -89,13 +106,9 @@ func UpdatePolicySuppress(c *ctx.ServiceContext, form *forms.UpdatePolicySuppres
 					Type:       common.PolicySuppressTypePolicy,
 					Reason:     form.Reason,
 					OrgId:      c.OrgId,
+					Status:     common.PolicySuppressStatusPending,
+					ExpiresAt:  &expiresAt,
 				})
-				// 禁用此策略在添加屏蔽的同时设置策略状态为禁用
-				po.Enabled = false
-				if _, err := tx.Save(po); err != nil {
-					_ = tx.Rollback()
-					return  e.New(e.DBError, err)
-				}
 			}
 		}
 
@@ -131,7 +144,7 @@ func DeletePolicySuppress(c *ctx.ServiceContext, form *forms.DeletePolicySuppres
 		}
 		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
-	if sup.TargetType == consts.ScopePolicy {
+	if sup.TargetType == consts.ScopePolicy && sup.Status == common.PolicySuppressStatusApproved {
 		_, err := services.PolicyEnable(tx, sup.TargetId, true, c.OrgId)
 		if err != nil {
 			_ = tx.Rollback()
@@ -210,3 +223,51 @@ func SearchPolicySuppressSource(c *ctx.ServiceContext, form *forms.SearchPolicyS
 	query := services.SearchPolicySuppressSource(c.DB(), form, c.UserId, form.Id, policy.GroupId, c.OrgId)
 	return getPage(query, form, resps.PolicySuppressSourceResp{})
 }
+
+func ApprovePolicySuppress(c *ctx.ServiceContext, form *forms.ApprovePolicySuppressForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("approve policy suppress %s", form.SuppressId))
+
+	var sup *models.PolicySuppress
+	err := c.DB().Transaction(func(tx *db.Session) error {
+		var err e.Error
+		tx = services.QueryWithOrgId(tx, c.OrgId)
+		sup, err = services.GetPolicySuppressById(tx, form.SuppressId)
+		if err != nil {
+			if err.Code() == e.PolicySuppressNotExist {
+				return e.New(err.Code(), err, http.StatusNotFound)
+			}
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		if sup.PolicyId != form.Id {
+			return e.New(e.PolicySuppressNotExist, http.StatusNotFound)
+		}
+		if err := services.CheckPolicySuppressApprovable(sup, c.UserId, time.Now()); err != nil {
+			if err.Code() == e.PolicySuppressSelfApprove {
+				return e.New(err.Code(), err, http.StatusForbidden)
+			}
+			return e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		if err := services.ApprovePolicySuppress(tx, sup, c.UserId, form.Action == forms.TaskActionApproved); err != nil {
+			if err.Code() == e.PolicySuppressNotPending {
+				return e.New(err.Code(), err, http.StatusConflict)
+			}
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, e.AutoNew(err, e.DBError)
+	}
+
+	services.InsertUserOperateLog(c.UserId, c.OrgId, sup.Id, consts.OperatorObjectTypePolicySuppress,
+		form.Action, "", models.ResAttrs{"policyId": sup.PolicyId, "targetId": sup.TargetId})
+	return sup, nil
+}
+
+func SearchPolicySuppressReport(c *ctx.ServiceContext, form *forms.SearchPolicySuppressReportForm) (interface{}, e.Error) {
+	query := services.SearchPolicySuppressReport(c.DB(), c.OrgId, form.Status, time.Now())
+	if form.SortField() == "" {
+		query = query.Order("s.expires_at DESC")
+	}
+	return getPage(query, form, resps.PolicySuppressReportResp{})
+}
@@ -29,11 +29,18 @@ func CreateProject(c *ctx.ServiceContext, form *forms.CreateProjectForm) (interf
 		}
 	}()
 
+	if err := services.CheckPolicyEnforcement(tx, c.OrgId, form.PolicyEnforcement); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
 	project, err := services.CreateProject(tx, &models.Project{
 		Name:        form.Name,
 		OrgId:       c.OrgId,
 		Description: models.Text(form.Description),
 		CreatorId:   c.UserId,
+
+		PolicyEnforcement: form.PolicyEnforcement,
 	})
 
 	if err != nil && err.Code() == e.ProjectAlreadyExists {
@@ -242,6 +249,18 @@ func UpdateProject(c *ctx.ServiceContext, form *forms.UpdateProjectForm) (interf
 		attrs["status"] = form.Status
 	}
 
+	if form.HasKey("policyEnforcement") {
+		if err := services.CheckPolicyEnforcement(tx, c.OrgId, form.PolicyEnforcement); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		if err := services.CheckProjectRequiredPolicyGroups(tx, form.Id, form.PolicyEnforcement.RequiredGroups); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		attrs["policy_enforcement"] = form.PolicyEnforcement
+	}
+
 	project := &models.Project{}
 	project.Id = form.Id
 	err := services.UpdateProject(tx, project, attrs)
@@ -0,0 +1,114 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"encoding/json"
+	"fmt"
+)
+
+/*
+terraform http state backend 协议实现，
+GET/POST 读取、更新 state，LOCK/UNLOCK 加锁、解锁，
+任务通过 basic auth 传入 portal 下发的 state token 进行认证
+*/
+
+// TfStateLockInfo terraform 提交的 lock 信息，这里只解析需要的字段，完整内容原样保存
+type TfStateLockInfo struct {
+	ID        string `json:"ID"`
+	Operation string `json:"Operation"`
+	Who       string `json:"Who"`
+}
+
+func authStateBackend(c *ctx.ServiceContext, envId models.Id, token string) (*models.Env, *services.StateTokenClaims, e.Error) {
+	claims, er := services.VerifyStateToken(token, envId)
+	if er != nil {
+		return nil, nil, er
+	}
+
+	env, er := services.GetEnvById(c.DB(), envId)
+	if er != nil {
+		return nil, nil, er
+	}
+	return env, claims, nil
+}
+
+// GetTfState 获取环境当前的 state 内容，state 不存在时返回 nil
+func GetTfState(c *ctx.ServiceContext, envId models.Id, token string) ([]byte, e.Error) {
+	env, _, er := authStateBackend(c, envId, token)
+	if er != nil {
+		return nil, er
+	}
+
+	version, er := services.GetLatestStateVersion(c.DB(), env.StatePath)
+	if er != nil {
+		if er.Code() == e.StateNotExists {
+			return nil, nil
+		}
+		return nil, er
+	}
+	return services.GetStateVersionContent(version)
+}
+
+// UpdateTfState 更新环境的 state 内容，lockId 为 terraform 持有的锁 id
+func UpdateTfState(c *ctx.ServiceContext, envId models.Id, token string, lockId string, content []byte) (
+	*models.StateLock, e.Error) {
+	env, claims, er := authStateBackend(c, envId, token)
+	if er != nil {
+		return nil, er
+	}
+
+	lock, er := services.GetStateLock(c.DB(), env.StatePath)
+	if er != nil {
+		return nil, er
+	} else if lock != nil && lock.LockId != lockId {
+		return lock, e.New(e.StateLocked, fmt.Errorf("state locked by '%s'", lock.LockId))
+	}
+
+	if _, er := services.CreateStateVersion(c.DB(), env, claims.TaskId, content); er != nil {
+		return nil, er
+	}
+	return nil, nil
+}
+
+// LockTfState 锁定环境的 state，已被其他人锁定时返回 StateLocked 错误及当前的锁
+func LockTfState(c *ctx.ServiceContext, envId models.Id, token string, info []byte) (*models.StateLock, e.Error) {
+	env, claims, er := authStateBackend(c, envId, token)
+	if er != nil {
+		return nil, er
+	}
+
+	lockInfo := TfStateLockInfo{}
+	if err := json.Unmarshal(info, &lockInfo); err != nil || lockInfo.ID == "" {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid lock info: %v", err))
+	}
+
+	c.Logger().Infof("lock state %s, lock id: %s, operation: %s", env.StatePath, lockInfo.ID, lockInfo.Operation)
+	return services.LockState(c.DB(), &models.StateLock{
+		StatePath: env.StatePath,
+		EnvId:     env.Id,
+		TaskId:    claims.TaskId,
+		LockId:    lockInfo.ID,
+		Info:      models.Text(info),
+	})
+}
+
+// UnlockTfState 解锁环境的 state，lock id 不匹配时返回 StateLocked 错误及当前的锁
+func UnlockTfState(c *ctx.ServiceContext, envId models.Id, token string, info []byte) (*models.StateLock, e.Error) {
+	env, _, er := authStateBackend(c, envId, token)
+	if er != nil {
+		return nil, er
+	}
+
+	lockInfo := TfStateLockInfo{}
+	if err := json.Unmarshal(info, &lockInfo); err != nil {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid lock info: %v", err))
+	}
+
+	c.Logger().Infof("unlock state %s, lock id: %s", env.StatePath, lockInfo.ID)
+	return services.UnlockState(c.DB(), env.StatePath, lockInfo.ID)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// CreateStateOperationTask 创建 state 操作任务，任务需要审批后才会执行，
+// 任务创建时锁定环境，任务结束后解锁
+func CreateStateOperationTask(c *ctx.ServiceContext, form *forms.StateOperationForm) (ret *models.Task, er e.Error) {
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		ret, er = createStateOperationTask(c, tx, form)
+		return er
+	})
+
+	if er == nil {
+		services.InsertUserOperateLog(c.UserId, c.OrgId, form.Id, consts.OperatorObjectTypeEnv,
+			models.TaskTypeStateOperation, "", models.ResAttrs{"taskId": ret.Id, "operations": ret.StateOps})
+	}
+	return ret, er
+}
+
+func getTaskStateOps(form *forms.StateOperationForm) (models.TaskStateOps, e.Error) {
+	ops := make(models.TaskStateOps, 0, len(form.Operations))
+	for _, op := range form.Operations {
+		if op.Type == models.StateOpMv && op.Destination == "" {
+			return nil, e.New(e.BadParam, fmt.Errorf("destination of '%s' is required", op.Address), http.StatusBadRequest)
+		} else if op.Type != models.StateOpMv && op.Destination != "" {
+			return nil, e.New(e.BadParam, fmt.Errorf("destination is only allowed for mv"), http.StatusBadRequest)
+		}
+		ops = append(ops, models.TaskStateOp{Type: op.Type, Address: op.Address, Destination: op.Destination})
+	}
+	return ops, nil
+}
+
+func createStateOperationTask(c *ctx.ServiceContext, tx *db.Session, form *forms.StateOperationForm) (*models.Task, e.Error) {
+	ops, er := getTaskStateOps(form)
+	if er != nil {
+		return nil, er
+	}
+
+	env, er := envCheck(tx, c.OrgId, c.ProjectId, form.Id, c.Logger())
+	if er != nil {
+		return nil, er
+	}
+	if env.Locked {
+		return nil, e.New(e.EnvLocked, http.StatusBadRequest)
+	}
+	if tasks, er := services.GetActiveTaskByEnvId(tx, env.Id); er != nil {
+		return nil, er
+	} else if len(tasks) > 0 {
+		return nil, e.New(e.EnvDeploying, fmt.Errorf("env has active task"), http.StatusBadRequest)
+	}
+
+	tpl, er := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
+	if er != nil {
+		return nil, er
+	}
+	if tpl.StackType != "" {
+		return nil, e.New(e.BadParam, fmt.Errorf("stack template does not support state operation"), http.StatusBadRequest)
+	}
+	vars, err := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+	runnerId, er := services.GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+	if er != nil {
+		return nil, er
+	}
+
+	task, er := services.CreateTask(tx, tpl, env, models.Task{
+		Name:      models.Task{}.GetTaskNameByType(models.TaskTypeStateOperation),
+		CreatorId: c.UserId,
+		TokenId:   c.ApiTokenId,
+		KeyId:     env.KeyId,
+		Variables: vars,
+		Revision:  env.Revision,
+		ExtraData: env.ExtraData,
+		StateOps:  ops,
+		BaseTask: models.BaseTask{
+			Type:        models.TaskTypeStateOperation,
+			StepTimeout: env.StepTimeout,
+			RunnerId:    runnerId,
+		},
+		Source:   consts.TaskSourceManual,
+		Callback: env.Callback,
+	})
+	if er != nil {
+		c.Logger().Errorf("error creating task, err %s", er)
+		return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	}
+
+	// 锁定环境，state 操作执行期间不允许创建其他任务
+	if er := services.EnvLockByTask(tx, env.Id, task.Id); er != nil {
+		return nil, e.New(er.Code(), er, http.StatusBadRequest)
+	}
+	return task, nil
+}
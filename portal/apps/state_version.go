@@ -0,0 +1,189 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+func getStateEnv(c *ctx.ServiceContext, envId models.Id) (*models.Env, e.Error) {
+	query := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	env, er := services.GetEnvById(query, envId)
+	if er != nil {
+		if er.Code() == e.EnvNotExists {
+			return nil, e.New(er.Code(), er, http.StatusNotFound)
+		}
+		return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	}
+	return env, nil
+}
+
+func getStateVersion(c *ctx.ServiceContext, envId models.Id, versionId models.Id) (*models.StateVersion, e.Error) {
+	version, er := services.GetStateVersionById(c.DB(), envId, versionId)
+	if er != nil {
+		if er.Code() == e.StateVersionNotExists {
+			return nil, e.New(er.Code(), er, http.StatusNotFound)
+		}
+		return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	}
+	return version, nil
+}
+
+// SearchEnvStateVersions 查询环境的 state 版本列表
+func SearchEnvStateVersions(c *ctx.ServiceContext, form *forms.SearchStateVersionForm) (*page.PageResp, e.Error) {
+	env, er := getStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	query := services.QueryStateVersion(c.DB()).
+		Where("iac_state_version.env_id = ? AND iac_state_version.state_path = ?", env.Id, env.StatePath).
+		Order("iac_state_version.created_at DESC, iac_state_version.serial DESC")
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	versions := make([]*resps.StateVersionResp, 0)
+	if err := p.Scan(&versions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     versions,
+	}, nil
+}
+
+// DiffEnvStateVersions 对比环境的两个 state 版本，返回资源级别的差异
+func DiffEnvStateVersions(c *ctx.ServiceContext, form *forms.DiffStateVersionForm) (*resps.StateVersionDiffResp, e.Error) {
+	env, er := getStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	contents := make([][]byte, 0, 2)
+	versions := make([]*models.StateVersion, 0, 2)
+	for _, id := range []models.Id{form.From, form.To} {
+		version, er := getStateVersion(c, env.Id, id)
+		if er != nil {
+			return nil, er
+		}
+		content, er := services.GetStateVersionContent(version)
+		if er != nil {
+			return nil, er
+		}
+		versions = append(versions, version)
+		contents = append(contents, content)
+	}
+
+	resources, outputs, err := services.DiffStateContent(contents[0], contents[1])
+	if err != nil {
+		return nil, e.New(e.StateInvalid, err, http.StatusBadRequest)
+	}
+	return &resps.StateVersionDiffResp{
+		From:      versions[0],
+		To:        versions[1],
+		Resources: resources,
+		Outputs:   outputs,
+	}, nil
+}
+
+// DownloadEnvStateVersion 下载环境的 state 版本内容
+func DownloadEnvStateVersion(c *ctx.ServiceContext, form *forms.StateVersionForm) ([]byte, e.Error) {
+	env, er := getStateEnv(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+	version, er := getStateVersion(c, env.Id, form.VersionId)
+	if er != nil {
+		return nil, er
+	}
+
+	// state 中包含敏感信息，记录下载操作
+	services.InsertUserOperateLog(c.UserId, c.OrgId, env.Id, consts.OperatorObjectTypeEnv,
+		"downloadState", env.Name, models.ResAttrs{"stateVersionId": version.Id.String()})
+	return services.GetStateVersionContent(version)
+}
+
+// RestoreEnvStateVersion 创建 state 恢复任务，将环境的 state 恢复到指定版本，任务需要审批后才会执行
+func RestoreEnvStateVersion(c *ctx.ServiceContext, form *forms.StateVersionForm) (ret *models.Task, er e.Error) {
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		ret, er = restoreEnvStateVersion(c, tx, form)
+		return er
+	})
+
+	if er == nil {
+		services.InsertUserOperateLog(c.UserId, c.OrgId, form.Id, consts.OperatorObjectTypeEnv,
+			models.TaskTypeStateRestore, "", models.ResAttrs{"stateVersionId": form.VersionId.String()})
+	}
+	return ret, er
+}
+
+func restoreEnvStateVersion(c *ctx.ServiceContext, tx *db.Session, form *forms.StateVersionForm) (*models.Task, e.Error) {
+	env, er := envCheck(tx, c.OrgId, c.ProjectId, form.Id, c.Logger())
+	if er != nil {
+		return nil, er
+	}
+	if env.Locked {
+		return nil, e.New(e.EnvLocked, http.StatusBadRequest)
+	}
+	// 有任务在执行时不允许恢复 state
+	if tasks, er := services.GetActiveTaskByEnvId(tx, env.Id); er != nil {
+		return nil, er
+	} else if len(tasks) > 0 {
+		return nil, e.New(e.EnvDeploying, fmt.Errorf("env has active task"), http.StatusBadRequest)
+	}
+
+	version, er := services.GetStateVersionById(tx, env.Id, form.VersionId)
+	if er != nil {
+		return nil, e.New(er.Code(), er, http.StatusNotFound)
+	}
+
+	tpl, er := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
+	if er != nil {
+		return nil, er
+	}
+	vars, err := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
+	runnerId, er := services.GetAvailableRunnerIdByStr(env.RunnerId, env.RunnerTags)
+	if er != nil {
+		return nil, er
+	}
+
+	task, er := services.CreateTask(tx, tpl, env, models.Task{
+		Name:           models.Task{}.GetTaskNameByType(models.TaskTypeStateRestore),
+		CreatorId:      c.UserId,
+		TokenId:        c.ApiTokenId,
+		KeyId:          env.KeyId,
+		Variables:      vars,
+		Revision:       env.Revision,
+		ExtraData:      env.ExtraData,
+		StateVersionId: version.Id,
+		BaseTask: models.BaseTask{
+			Type:        models.TaskTypeStateRestore,
+			StepTimeout: env.StepTimeout,
+			RunnerId:    runnerId,
+		},
+		Source:   consts.TaskSourceManual,
+		Callback: env.Callback,
+	})
+	if er != nil {
+		c.Logger().Errorf("error creating task, err %s", er)
+		return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	}
+
+	// 锁定环境，state 恢复执行期间不允许创建其他任务
+	if er := services.EnvLockByTask(tx, env.Id, task.Id); er != nil {
+		return nil, e.New(er.Code(), er, http.StatusBadRequest)
+	}
+	return task, nil
+}
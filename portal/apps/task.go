@@ -159,6 +159,19 @@ func TaskDetail(c *ctx.ServiceContext, form forms.DetailTaskForm) (*resps.TaskDe
 // 	return u.Redacted(), nil
 // }
 
+// TaskQueue 任务排队信息
+func TaskQueue(c *ctx.ServiceContext, form forms.DetailTaskForm) (*resps.TaskQueueResp, e.Error) {
+	task, err := services.GetTaskById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+	if err != nil && err.Code() == e.TaskNotExists {
+		return nil, e.New(e.TaskNotExists, err, http.StatusNotFound)
+	} else if err != nil {
+		c.Logger().Errorf("error get task by id, err %s", err)
+		return nil, e.New(e.DBError, err)
+	}
+	// runner 为所有组织共享，排队位置需要基于所有组织的任务计算
+	return services.GetTaskQueuePosition(c.DB(), task)
+}
+
 // LastTask 最新任务信息
 func LastTask(c *ctx.ServiceContext, form *forms.LastTaskForm) (*resps.TaskDetailResp, e.Error) {
 	if c.OrgId == "" || c.ProjectId == "" {
@@ -416,7 +429,15 @@ func SearchTaskSteps(c *ctx.ServiceContext, form *forms.DetailTaskStepForm) (int
 }
 
 func GetTaskStepLog(c *ctx.ServiceContext, form *forms.GetTaskStepLogForm) (interface{}, e.Error) {
-	content, err := services.GetTaskStepLogById(c.DB(), form.StepId)
+	var (
+		content []byte
+		err     e.Error
+	)
+	if form.StackRoot != "" {
+		content, err = services.GetTaskStepStackLogById(c.DB(), form.StepId, form.StackRoot)
+	} else {
+		content, err = services.GetTaskStepLogById(c.DB(), form.StepId)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -919,6 +940,10 @@ func AbortTask(c *ctx.ServiceContext, form *forms.AbortTaskForm) (interface{}, e
 			if _, err := models.UpdateModel(tx, task); err != nil {
 				return e.AutoNew(err, e.DBError)
 			}
+			// 任务未执行，不会进入修改环境状态的流程，需要在这里解除任务对环境的锁定
+			if er := services.EnvUnlockByTask(tx, task.EnvId, task.Id); er != nil {
+				return er
+			}
 		} else if step.Status == models.TaskStepApproving {
 			task.Aborting = true
 			if _, err := models.UpdateModel(tx, task); err != nil {
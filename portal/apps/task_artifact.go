@@ -0,0 +1,63 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"net/http"
+)
+
+func getArtifactTask(c *ctx.ServiceContext, taskId models.Id) (*models.Task, e.Error) {
+	task, er := services.GetTaskById(services.QueryWithOrgId(c.DB(), c.OrgId), taskId)
+	if er != nil {
+		if er.Code() == e.TaskNotExists {
+			return nil, e.New(er.Code(), er, http.StatusNotFound)
+		}
+		return nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	}
+	return task, nil
+}
+
+// SearchTaskArtifacts 查询任务步骤收集的文件列表
+func SearchTaskArtifacts(c *ctx.ServiceContext, form *forms.SearchTaskArtifactForm) (*page.PageResp, e.Error) {
+	task, er := getArtifactTask(c, form.Id)
+	if er != nil {
+		return nil, er
+	}
+
+	p := page.New(form.CurrentPage(), form.PageSize(), services.QueryTaskArtifacts(c.DB(), task.Id))
+	artifacts := make([]*models.TaskArtifact, 0)
+	if err := p.Scan(&artifacts); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     artifacts,
+	}, nil
+}
+
+// DownloadTaskArtifact 下载任务步骤收集的文件
+func DownloadTaskArtifact(c *ctx.ServiceContext, form *forms.TaskArtifactForm) (*models.TaskArtifact, []byte, e.Error) {
+	task, er := getArtifactTask(c, form.Id)
+	if er != nil {
+		return nil, nil, er
+	}
+	artifact, er := services.GetTaskArtifactById(c.DB(), task.Id, form.ArtifactId)
+	if er != nil {
+		if er.Code() == e.TaskArtifactNotExists {
+			return nil, nil, e.New(er.Code(), er, http.StatusNotFound)
+		}
+		return nil, nil, e.New(er.Code(), er, http.StatusInternalServerError)
+	}
+	content, er := services.GetTaskArtifactContent(artifact)
+	if er != nil {
+		return nil, nil, er
+	}
+	return artifact, content, nil
+}
@@ -69,10 +69,15 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 		PlayVarsFile: form.PlayVarsFile,
 		TfVarsFile:   form.TfVarsFile,
 		TfVersion:    form.TfVersion,
+		IacEngine:    form.IacEngine,
+		StackType:    form.StackType,
+		StackRoots:   form.StackRoots,
 		PolicyEnable: form.PolicyEnable,
 		Triggers:     form.TplTriggers,
 		KeyId:        form.KeyId,
 		Source:       form.Source,
+
+		TriggerFilter: form.TplTriggerFilter,
 	})
 
 	if err != nil {
@@ -173,6 +178,15 @@ func setAttrsByFormKeys(attrs models.Attrs, form *forms.UpdateTemplateForm) {
 	if form.HasKey("tfVersion") {
 		attrs["tfVersion"] = form.TfVersion
 	}
+	if form.HasKey("iacEngine") {
+		attrs["iacEngine"] = form.IacEngine
+	}
+	if form.HasKey("stackType") {
+		attrs["stackType"] = form.StackType
+	}
+	if form.HasKey("stackRoots") {
+		attrs["stackRoots"] = models.StrSlice(form.StackRoots)
+	}
 	if form.HasKey("repoRevision") {
 		attrs["repoRevision"] = form.RepoRevision
 	}
@@ -182,6 +196,9 @@ func setAttrsByFormKeys(attrs models.Attrs, form *forms.UpdateTemplateForm) {
 	if form.HasKey("tplTriggers") {
 		attrs["triggers"] = models.StringArray(form.TplTriggers)
 	}
+	if form.HasKey("tplTriggerFilter") {
+		attrs["trigger_filter"] = form.TplTriggerFilter
+	}
 	if form.HasKey("keyId") {
 		attrs["keyId"] = form.KeyId
 	}
@@ -520,7 +537,8 @@ func TemplateChecks(c *ctx.ServiceContext, form *forms.TemplateChecksForm) (inte
 			return nil, err
 		}
 	}
-	if form.Workdir != "" {
+	// 多工作目录模板的 .tf 文件在各根目录中(terragrunt 模板可以没有 .tf 文件)，任务执行时再检查
+	if form.Workdir != "" && form.StackType == "" {
 		// 检查工作目录下.tf 文件是否存在
 		searchForm := &forms.RepoFileSearchForm{
 			RepoId:       form.RepoId,
@@ -3,6 +3,7 @@
 package apps
 
 import (
+	"cloudiac/common"
 	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
@@ -47,20 +48,23 @@ func AutoGetTfVersion(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearch
 	content, er := repoDetail.ReadFileContent(form.VcsBranch, filepath.Join(form.Workdir, "versions.tf"))
 	// 没有找到versions.tf 文件，使用默认版本，不报错
 	if er != nil {
-		return configs.Get().GetDefaultTerraformVersion(), nil
+		return configs.Get().GetDefaultIacEngineVersion(form.IacEngine), nil
 	}
 	tfconstraint := GetUserTfVersion(content)
 	// 如果用户versions.tf 中没有制定terraform 版本，使用我们默认版本
 	if tfconstraint == "" {
-		return configs.Get().GetDefaultTerraformVersion(), nil
+		return configs.Get().GetDefaultIacEngineVersion(form.IacEngine), nil
 	}
 	// 查看内置版本中有无满足用户约束条件的版本
-	tfVersion, tferr := GetDetailTfVersion(configs.Get().GetTerraformVersions(), tfconstraint)
+	tfVersion, tferr := GetDetailTfVersion(configs.Get().GetIacEngineVersions(form.IacEngine), tfconstraint)
 	if tferr != nil {
 		return nil, e.New(e.InvalidTfVersion, tferr)
 	}
 	if tfVersion != "" {
 		return tfVersion, nil
+	} else if form.IacEngine == common.IacEngineOpenTofu {
+		// opentofu 只从内置版本中查找
+		return nil, e.New(e.InvalidTfVersion, fmt.Errorf("no opentofu version matches '%s'", tfconstraint))
 	} else {
 		// 如果内置版本中没有满足用户版本，则从官方提供所有版本中查找
 		tflist := getTfVersions()
@@ -194,6 +194,23 @@ func ListRepos(c *ctx.ServiceContext, form *forms.GetGitProjectsForm) (interface
 	}, nil
 }
 
+// AddRepo 添加仓库，通用 git vcs 没有仓库列表接口，需要添加仓库(clone 镜像)后才能使用
+func AddRepo(c *ctx.ServiceContext, form *forms.AddVcsRepoForm) (interface{}, e.Error) {
+	vcs, err := checkOrgVcsAuth(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if vcs.VcsType != consts.GitTypeGit {
+		return nil, e.New(e.BadParam, fmt.Errorf("vcs type '%s' does not support adding repository", vcs.VcsType),
+			http.StatusBadRequest)
+	}
+	repo, er := vcsrv.AddGitRepo(vcs, form.RepoId)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+	return repo.FormatRepoSearch()
+}
+
 func listRepoRevision(c *ctx.ServiceContext, form *forms.GetGitRevisionForm, revisionType string) (revision []*resps.Revision, err e.Error) {
 	vcs, err := checkOrgVcsAuth(c, form.Id)
 	if err != nil {
@@ -366,3 +383,34 @@ func GetRegistryVcs(c *ctx.ServiceContext) (interface{}, e.Error) {
 	}
 	return vcs, nil
 }
+
+func SearchVcsUser(c *ctx.ServiceContext, form *forms.SearchVcsUserForm) (interface{}, e.Error) {
+	if _, err := checkOrgVcsAuth(c, form.Id); err != nil {
+		return nil, err
+	}
+	return getPage(services.QueryVcsUser(c.DB(), form.Id), form, resps.VcsUserResp{})
+}
+
+// CreateVcsUser 添加 vcs 用户与组织用户的映射
+func CreateVcsUser(c *ctx.ServiceContext, form *forms.CreateVcsUserForm) (interface{}, e.Error) {
+	vcs, err := checkOrgVcsAuth(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !services.UserHasOrgRole(form.UserId, c.OrgId, "") {
+		return nil, e.New(e.UserNotExists, http.StatusBadRequest)
+	}
+	return services.CreateVcsUser(c.DB(), models.VcsUser{
+		OrgId:   c.OrgId,
+		VcsId:   vcs.Id,
+		VcsUser: strings.TrimSpace(form.VcsUser),
+		UserId:  form.UserId,
+	})
+}
+
+func DeleteVcsUser(c *ctx.ServiceContext, form *forms.DeleteVcsUserForm) (interface{}, e.Error) {
+	if _, err := checkOrgVcsAuth(c, form.Id); err != nil {
+		return nil, err
+	}
+	return nil, services.DeleteVcsUser(c.DB(), form.Id, form.VcsUserId)
+}
@@ -11,7 +11,10 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -23,6 +26,11 @@ const (
 	GitlabPrMerged       = "merged"
 	RefHeads             = "refs/heads/"
 	GiteePrOpen          = "open"
+
+	GitlabObjectKindNote = "note"
+	PrClosed             = "closed" // gitlab、github、gitea PR/MR 关闭
+	GiteePrMerge         = "merge"
+	GiteePrClose         = "close"
 )
 
 type webhookOptions struct {
@@ -35,26 +43,143 @@ type webhookOptions struct {
 	PrId         int
 }
 
-func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOptions) {
+// isPr 是否为 PR/MR 事件
+func (o webhookOptions) isPr() bool {
+	return o.PushRef == "" && o.HeadRef != ""
+}
 
-	for tIndex, tpl := range tplList {
-		sysUserId := models.Id(consts.SysUserId)
+// isPrFinished PR/MR 是否已合并或关闭
+func (o webhookOptions) isPrFinished() bool {
+	if o.PrId == 0 {
+		return false
+	}
+	switch o.PrStatus {
+	case GitlabPrMerged, PrClosed, GiteePrMerge, GiteePrClose:
+		return true
+	}
+	return false
+}
 
-		if len(tpl.Triggers) > 0 {
-			createTplScan(sysUserId, &tplList[tIndex], options)
-		}
+// webhookChanges 本次推送(或 PR/MR)的变更，用于判断是否满足触发器的过滤条件
+type webhookChanges struct {
+	options webhookOptions
+	files   []string // nil 表示无法获取变更文件，此时视为所有文件都有变更
+}
+
+// getWebhookChangedFiles 通过 vcs 接口查询本次推送(或 PR/MR)变更的文件列表，无法获取时返回 nil。
+// 该函数会发起网络请求，需要在开启数据库事务前调用
+func getWebhookChangedFiles(vcs *models.Vcs, repoId string, options webhookOptions) []string {
+	from, to := options.BeforeCommit, options.AfterCommit
+	if options.isPr() {
+		from, to = options.BaseRef, options.HeadRef
+	}
+	// 新建分支时 before 为空或者全 0，无法比较
+	if strings.Trim(from, "0") == "" || to == "" || from == to {
+		return nil
+	}
+
+	logger := logs.Get().WithField("webhook", "changedFiles")
+	vcsInstance, err := vcsrv.GetVcsInstance(vcs)
+	if err != nil {
+		logger.Warnf("get vcs instance err: %v", err)
+		return nil
+	}
+	repo, err := vcsInstance.GetRepo(repoId)
+	if err != nil {
+		logger.Warnf("get repo %s err: %v", repoId, err)
+		return nil
+	}
+	files, err := repo.CompareCommits(from, to)
+	if err != nil {
+		logger.Warnf("compare %s...%s err: %v", from, to, err)
+		return nil
+	}
+	return files
+}
+
+// match 判断本次回调是否满足触发器的过滤条件，workdir 为云模板或者环境的工作目录
+func (w *webhookChanges) match(filter models.TriggerFilter, workdir string) bool {
+	branch := strings.TrimPrefix(w.options.PushRef, RefHeads)
+	if w.options.isPr() {
+		branch = w.options.HeadRef
+	}
+	if !filter.MatchBranch(branch) {
+		return false
+	}
+	if !filter.FilterPaths() {
+		return true
+	}
+
+	if w.files == nil {
+		return true
+	}
+	return filter.MatchFiles(workdir, w.files)
+}
 
-		envs, err := services.GetEnvByTplId(tx, tpl.Id)
+// getWebhookTplEnvs 查询云模板对应的环境(跳过已归档环境)，返回云模板 id 到环境列表的映射
+func getWebhookTplEnvs(query *db.Session, tplList []models.Template) map[models.Id][]models.Env {
+	tplEnvs := make(map[models.Id][]models.Env, len(tplList))
+	for _, tpl := range tplList {
+		envs, err := services.GetEnvByTplId(query, tpl.Id)
 		if err != nil {
 			logs.Get().WithField("webhook", "searchEnv").
 				Errorf("search env err: %v, tplId: %s", err, tpl.Id)
 			// 记录个日志就行
 			continue
 		}
+		for _, env := range envs {
+			if !env.Archived {
+				tplEnvs[tpl.Id] = append(tplEnvs[tpl.Id], env)
+			}
+		}
+	}
+	return tplEnvs
+}
+
+// envTriggerFilter 环境的触发器过滤条件，环境未设置时使用云模板的设置
+func envTriggerFilter(env *models.Env, tpl *models.Template) models.TriggerFilter {
+	if env.TriggerFilter.IsEmpty() {
+		return tpl.TriggerFilter
+	}
+	return env.TriggerFilter
+}
 
+// needChangedFiles 是否有云模板或者环境的触发器设置了路径过滤，只有这时才需要查询变更文件
+func needChangedFiles(tplList []models.Template, tplEnvs map[models.Id][]models.Env) bool {
+	for tIndex := range tplList {
+		tpl := &tplList[tIndex]
+		if len(tpl.Triggers) > 0 && tpl.TriggerFilter.FilterPaths() {
+			return true
+		}
+		envs := tplEnvs[tpl.Id]
+		for eIndex := range envs {
+			if len(envs[eIndex].Triggers) > 0 && envTriggerFilter(&envs[eIndex], tpl).FilterPaths() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func searchTplEnv(tx *db.Session, tplList []models.Template, tplEnvs map[models.Id][]models.Env, changes *webhookChanges) {
+	options := changes.options
+	for tIndex, tpl := range tplList {
+		sysUserId := models.Id(consts.SysUserId)
+
+		if len(tpl.Triggers) > 0 {
+			if changes.match(tpl.TriggerFilter, tpl.Workdir) {
+				createTplScan(sysUserId, &tplList[tIndex], options)
+			} else {
+				logs.Get().WithField("webhook", "searchEnv").
+					Infof("tplId: %s, changes don't match the trigger filter", tpl.Id)
+			}
+		}
+
+		envs := tplEnvs[tpl.Id]
 		for eIndex, env := range envs {
-			// 跳过已归档环境
-			if env.Archived {
+			if !changes.match(envTriggerFilter(&envs[eIndex], &tplList[tIndex]), env.Workdir) {
+				logs.Get().WithField("webhook", "searchEnv").
+					Infof("tplId: %s, envId: %s, changes don't match the trigger filter", tpl.Id, env.Id)
 				continue
 			}
 			for _, v := range env.Triggers {
@@ -68,6 +193,48 @@ func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOpti
 }
 
 func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (interface{}, e.Error) {
+	// 查询vcs
+	vcs, err := services.GetVcsById(c.DB(), models.Id(form.VcsId))
+	if err != nil {
+		c.Logger().Errorf("webhook get vcs err: %s", err)
+		return nil, e.New(e.DBError, err)
+	}
+
+	repoId := getVcsRepoId(vcs.VcsType, form)
+	if vcs.VcsType == consts.GitTypeGit {
+		// 通用 git vcs 先同步仓库镜像，保证后续任务能读取到最新的提交。
+		// 同步需要执行 git fetch，在开启事务前进行，避免网络请求期间占用数据库事务
+		if er := vcsrv.RefreshGitMirror(vcs, repoId); er != nil {
+			c.Logger().Errorf("webhook refresh git mirror err: %s", er)
+		}
+	}
+
+	options := getWebhookOptions(vcs.VcsType, form)
+	event, isPrComment := getPrCommentEvent(vcs.VcsType, form)
+
+	// 根据VcsId & 仓库Id查询对应的云模板
+	tplList, err := services.QueryTemplateByVcsIdAndRepoId(c.DB(), form.VcsId, repoId)
+	if err != nil {
+		c.Logger().Errorf("webhook get tpl err: %s", err)
+		return nil, e.New(e.DBError, err)
+	}
+
+	var (
+		tplEnvs map[models.Id][]models.Env
+		changes = &webhookChanges{options: options}
+	)
+	if isPrComment {
+		// PR 评论命令需要调用 vcs 接口查询 PR 及回复评论，异步执行以免 webhook 请求超时
+		go runPrCommand(vcs, repoId, tplList, event)
+	} else {
+		// 查询云模板对应的环境，有触发器设置了路径过滤时才查询变更文件。
+		// 查询变更文件需要调用 vcs 接口，同样在开启事务前进行
+		tplEnvs = getWebhookTplEnvs(c.DB(), tplList)
+		if needChangedFiles(tplList, tplEnvs) {
+			changes.files = getWebhookChangedFiles(vcs, repoId, options)
+		}
+	}
+
 	tx := c.Tx()
 	defer func() {
 		if r := recover(); r != nil {
@@ -76,21 +243,34 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 		}
 	}()
 
-	// 查询vcs
-	vcs, err := services.GetVcsById(tx, models.Id(form.VcsId))
-	if err != nil {
-		_ = tx.Rollback()
-		c.Logger().Errorf("webhook get vcs err: %s", err)
-		return nil, e.New(e.DBError, err)
+	if !isPrComment {
+		searchTplEnv(tx, tplList, tplEnvs, changes)
 	}
 
-	// 根据VcsId & 仓库Id查询对应的云模板
-	tplList, err := services.QueryTemplateByVcsIdAndRepoId(tx, form.VcsId, getVcsRepoId(vcs.VcsType, form))
-	if err != nil {
+	// PR 合并或关闭后释放 PR 评论命令对环境的锁定
+	if options.isPrFinished() {
+		tplIds := make([]models.Id, 0, len(tplList))
+		for _, tpl := range tplList {
+			tplIds = append(tplIds, tpl.Id)
+		}
+		if n, er := services.EnvUnlockByPr(tx, tplIds, options.PrId); er != nil {
+			c.Logger().Errorf("webhook unlock pr %d envs err: %s", options.PrId, er)
+		} else if n > 0 {
+			c.Logger().Infof("pr %d %s, %d envs unlocked", options.PrId, options.PrStatus, n)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
-		c.Logger().Errorf("webhook get tpl err: %s", err)
+		c.Logger().Errorf("error create task, err %s", err)
 		return nil, e.New(e.DBError, err)
 	}
+
+	return nil, err
+}
+
+// getWebhookOptions 将不同 vcs 的回调内容转换为统一的 webhookOptions
+func getWebhookOptions(vcsType string, form forms.WebhooksApiHandler) webhookOptions {
 	options := webhookOptions{
 		PushRef:      form.Ref,
 		BaseRef:      form.PullRequest.Base.Ref,
@@ -101,23 +281,77 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 		PrId:         form.PullRequest.Number,
 	}
 
-	if vcs.VcsType == consts.GitTypeGitLab {
+	switch vcsType {
+	case consts.GitTypeGitLab:
 		options.BaseRef = form.ObjectAttributes.TargetBranch
 		options.HeadRef = form.ObjectAttributes.SourceBranch
 		options.PrStatus = form.ObjectAttributes.State
 		options.PrId = form.ObjectAttributes.Iid
+	case consts.GitTypeGit:
+		// 通用 git webhook 只有 push 事件，请求中可以只传 ref 及 after(commit id)
+		options = webhookOptions{
+			PushRef:      form.Ref,
+			AfterCommit:  form.After,
+			BeforeCommit: utils.FirstValueStr(form.Before, form.After),
+		}
+	case consts.GitTypeBitbucket:
+		options = webhookOptions{}
+		switch form.EventKey {
+		case vcsrv.BitbucketEventPush:
+			// 一次 push 可能包含多个 ref 的变更，只处理第一个更新或者新建的分支
+			for _, change := range form.Changes {
+				if change.Type == "DELETE" || !strings.HasPrefix(change.RefId, RefHeads) {
+					continue
+				}
+				options.PushRef = change.RefId
+				options.BeforeCommit = change.FromHash
+				options.AfterCommit = change.ToHash
+				break
+			}
+		case vcsrv.BitbucketEventPrOpened:
+			pr := form.BitbucketPullRequest
+			options.BaseRef = pr.ToRef.DisplayId
+			options.HeadRef = pr.FromRef.DisplayId
+			options.PrStatus = GitlabPrOpened
+			options.PrId = pr.Id
+		case vcsrv.BitbucketEventPrMerged:
+			options.PrStatus = GitlabPrMerged
+			options.PrId = form.BitbucketPullRequest.Id
+		case vcsrv.BitbucketEventPrDeclined, vcsrv.BitbucketEventPrDeleted:
+			options.PrStatus = PrClosed
+			options.PrId = form.BitbucketPullRequest.Id
+		}
+	case consts.GitTypeAzure:
+		options = webhookOptions{}
+		res := form.Resource
+		switch form.EventType {
+		case vcsrv.AzureEventPush:
+			for _, update := range res.RefUpdates {
+				if !strings.HasPrefix(update.Name, RefHeads) || strings.Trim(update.NewObjectId, "0") == "" {
+					continue
+				}
+				options.PushRef = update.Name
+				options.BeforeCommit = update.OldObjectId
+				options.AfterCommit = update.NewObjectId
+				break
+			}
+		case vcsrv.AzureEventPrCreated:
+			options.BaseRef = strings.TrimPrefix(res.TargetRefName, RefHeads)
+			options.HeadRef = strings.TrimPrefix(res.SourceRefName, RefHeads)
+			options.PrStatus = GitlabPrOpened
+			options.PrId = res.PullRequestId
+		case vcsrv.AzureEventPrMerged, vcsrv.AzureEventPrUpdated:
+			// 合并事件在合并失败(如存在冲突)时也会触发，以 pr 状态为准
+			switch res.Status {
+			case "completed":
+				options.PrStatus = GitlabPrMerged
+			case "abandoned":
+				options.PrStatus = PrClosed
+			}
+			options.PrId = res.PullRequestId
+		}
 	}
-
-	// 查询云模板对应的环境
-	searchTplEnv(tx, tplList, options)
-
-	if err := tx.Commit(); err != nil {
-		_ = tx.Rollback()
-		c.Logger().Errorf("error create task, err %s", err)
-		return nil, e.New(e.DBError, err)
-	}
-
-	return nil, err
+	return options
 }
 
 type CreateWebhookTaskParam struct {
@@ -131,14 +365,19 @@ type CreateWebhookTaskParam struct {
 	Source   string
 }
 
-//nolint
 func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
+	_, err := createWebhookTask(tx, param)
+	return err
+}
+
+//nolint
+func createWebhookTask(tx *db.Session, param CreateWebhookTaskParam) (*models.Task, error) {
 	env := param.Env
 	// 计算变量列表
 	vars, er := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
 	if er != nil {
 		_ = tx.Rollback()
-		return e.New(e.DBError, er, http.StatusInternalServerError)
+		return nil, e.New(e.DBError, er, http.StatusInternalServerError)
 	}
 	task := &models.Task{
 		Name:        models.Task{}.GetTaskNameByType(param.TaskType),
@@ -161,10 +400,11 @@ func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
 	if err != nil {
 		_ = tx.Rollback()
 		logs.Get().Errorf("error creating task, err %s", err)
-		return e.New(err.Code(), err, http.StatusInternalServerError)
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
 
-	if param.PrId != 0 && param.TaskType == models.TaskTypePlan {
+	// PR 触发的 plan 及 PR 评论命令触发的 apply 任务，执行结果写入 PR 评论
+	if param.PrId != 0 {
 		// 创建pr与作业的关系
 		if err := services.CreateVcsPr(tx, models.VcsPr{
 			PrId:   param.PrId,
@@ -173,11 +413,12 @@ func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
 			VcsId:  param.Tpl.VcsId,
 		}); err != nil {
 			logs.Get().Errorf("error creating vcs pr, err %s", err)
-			return e.New(err.Code(), err, http.StatusInternalServerError)
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 		}
 	}
 	logs.Get().Infof("create webhook task success. envId:%s, task type: %s", env.Id, param.TaskType)
-	return nil
+	services.ReportTaskCommitStatus(*task)
+	return task, nil
 }
 
 func checkVcsCallbackMessage(revision, pushRef, baseRef string) bool {
@@ -247,8 +488,17 @@ func getVcsRepoId(vcsType string, form forms.WebhooksApiHandler) string {
 		return strconv.Itoa(form.Repository.Id)
 	case consts.GitTypeGithub:
 		return form.Repository.FullName
-	case consts.GitTypeGitee:
+	case consts.GitTypeGitee, consts.GitTypeGit:
 		return form.Repository.FullName
+	case consts.GitTypeBitbucket:
+		repo := form.Repository
+		if repo.Slug == "" {
+			repo = form.BitbucketPullRequest.ToRef.Repository
+		}
+		return fmt.Sprintf("%s/%s", repo.Project.Key, repo.Slug)
+	case consts.GitTypeAzure:
+		// 评论事件的仓库信息在 pullRequest 中
+		return utils.FirstValueStr(form.Resource.Repository.Id, form.Resource.PullRequest.Repository.Id)
 	default:
 		return ""
 	}
@@ -294,6 +544,7 @@ func createTplScan(userId models.Id, tpl *models.Template, options webhookOption
 		Name:      models.ScanTask{}.GetTaskNameByType(taskType),
 		CreatorId: userId,
 		TplId:     tpl.Id,
+		ExtraData: models.JSON(fmt.Sprintf(`{"source":"%s"}`, consts.TaskSourceWebhookScan)),
 		BaseTask: models.BaseTask{
 			Type:        taskType,
 			StepTimeout: common.DefaultTaskStepTimeout,
@@ -325,4 +576,5 @@ func createTplScan(userId models.Id, tpl *models.Template, options webhookOption
 		logger.Errorf("commit env, err %s", err)
 		return
 	}
+	services.ReportScanTaskCommitStatus(*task)
 }
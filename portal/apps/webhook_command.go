@@ -0,0 +1,311 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+	"strings"
+)
+
+// PR 评论命令，格式: cloudiac <plan|apply|unlock> [-env <name>]
+const (
+	prCommandName   = "cloudiac"
+	prCommandPlan   = "plan"
+	prCommandApply  = "apply"
+	prCommandUnlock = "unlock"
+
+	prCommandUsage = "Usage: `cloudiac <plan|apply|unlock> [-env <name>]`"
+)
+
+// 执行命令需要的项目角色，组织管理员及平台管理员不受限制
+var prCommandRoles = map[string][]string{
+	prCommandPlan:   {consts.ProjectRoleManager, consts.ProjectRoleApprover, consts.ProjectRoleOperator},
+	prCommandApply:  {consts.ProjectRoleManager, consts.ProjectRoleApprover},
+	prCommandUnlock: {consts.ProjectRoleManager, consts.ProjectRoleApprover},
+}
+
+type prCommentEvent struct {
+	PrId    int
+	Comment string
+	User    string // 评论者的 vcs 用户名
+}
+
+type prCommand struct {
+	Action  string
+	EnvName string // 为空时作用于部署 PR 目标分支的环境
+}
+
+// getPrCommentEvent 解析各 vcs 的 PR 评论事件，非 PR 评论事件返回 false
+func getPrCommentEvent(vcsType string, form forms.WebhooksApiHandler) (prCommentEvent, bool) {
+	event := prCommentEvent{}
+	switch vcsType {
+	case consts.GitTypeGitLab:
+		if form.ObjectKind == GitlabObjectKindNote && form.ObjectAttributes.NoteableType == "MergeRequest" {
+			event = prCommentEvent{
+				PrId:    form.MergeRequest.Iid,
+				Comment: form.ObjectAttributes.Note,
+				User:    form.User.Username,
+			}
+		}
+	case consts.GitTypeGithub, consts.GitTypeGitEA:
+		// pr 的评论通过 issue_comment 事件回调
+		if form.Action == "created" && form.Issue.PullRequest != nil {
+			event = prCommentEvent{
+				PrId:    form.Issue.Number,
+				Comment: form.Comment.Body,
+				User:    utils.FirstValueStr(form.Comment.User.Login, form.Sender.Login),
+			}
+		}
+	case consts.GitTypeGitee:
+		if form.NoteableType == "PullRequest" {
+			event = prCommentEvent{
+				PrId:    form.PullRequest.Number,
+				Comment: form.Comment.Body,
+				User:    utils.FirstValueStr(form.Comment.User.Login, form.Sender.Login),
+			}
+		}
+	case consts.GitTypeBitbucket:
+		if form.EventKey == vcsrv.BitbucketEventPrCommentAdded {
+			event = prCommentEvent{
+				PrId:    form.BitbucketPullRequest.Id,
+				Comment: form.Comment.Text,
+				User:    form.Comment.Author.Name,
+			}
+		}
+	case consts.GitTypeAzure:
+		if form.EventType == vcsrv.AzureEventPrCommented {
+			res := form.Resource
+			event = prCommentEvent{
+				PrId:    res.PullRequest.PullRequestId,
+				Comment: res.Comment.Content,
+				User:    res.Comment.Author.UniqueName,
+			}
+		}
+	}
+	return event, event.PrId > 0 && event.Comment != ""
+}
+
+// parsePrCommand 解析评论中的命令，只处理第一个以 "cloudiac" 开头的行，评论中没有命令时返回 nil
+func parsePrCommand(comment string) (*prCommand, error) {
+	for _, line := range strings.Split(comment, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != prCommandName {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("missing command")
+		}
+
+		cmd := &prCommand{Action: fields[1]}
+		if _, ok := prCommandRoles[cmd.Action]; !ok {
+			return nil, fmt.Errorf("unknown command '%s'", cmd.Action)
+		}
+		args := fields[2:]
+		for i := 0; i < len(args); i++ {
+			// 支持 -env name、--env name 及 -env=name
+			if !strings.HasPrefix(args[i], "-") {
+				return nil, fmt.Errorf("unexpected argument '%s'", args[i])
+			}
+			name, value := strings.TrimLeft(args[i], "-"), ""
+			if pos := strings.IndexByte(name, '='); pos >= 0 {
+				name, value = name[:pos], name[pos+1:]
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			if name != "env" {
+				return nil, fmt.Errorf("unknown flag '-%s'", name)
+			}
+			if value == "" {
+				return nil, fmt.Errorf("flag '-env' requires a value")
+			}
+			cmd.EnvName = value
+		}
+		return cmd, nil
+	}
+	return nil, nil
+}
+
+// matchPrCommandEnv 判断命令是否作用于该环境
+func matchPrCommandEnv(cmd *prCommand, env *models.Env, pr *vcsrv.PullRequest) bool {
+	if env.Archived {
+		return false
+	}
+	if cmd.EnvName != "" {
+		return env.Name == cmd.EnvName
+	}
+	if cmd.Action == prCommandUnlock {
+		return env.LockedPrId == pr.Id
+	}
+	return env.Revision == pr.BaseRef
+}
+
+// prCommandAllowed 判断 CloudIaC 用户是否有权限在环境上执行命令
+func prCommandAllowed(userId models.Id, env *models.Env, action string) bool {
+	if services.UserHasOrgRole(userId, env.OrgId, consts.OrgRoleAdmin) ||
+		services.UserIsSuperAdmin(db.Get(), userId) {
+		return true
+	}
+	for _, role := range prCommandRoles[action] {
+		if services.UserHasProjectRole(userId, env.OrgId, env.ProjectId, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// runPrCommand 执行 PR 评论中的命令，执行结果回复到 PR 评论中
+func runPrCommand(vcs *models.Vcs, repoId string, tplList []models.Template, event prCommentEvent) {
+	logger := logs.Get().WithField("webhook", "prCommand").WithField("prId", event.PrId)
+	cmd, err := parsePrCommand(event.Comment)
+	if cmd == nil && err == nil {
+		return
+	}
+
+	repo, err2 := vcsrv.GetRepo(vcs, repoId)
+	if err2 != nil {
+		logger.Errorf("get repo %s err: %v", repoId, err2)
+		return
+	}
+	reply := func(content string) {
+		if _, err := repo.CreatePrComment(event.PrId, content); err != nil {
+			logger.Errorf("reply pr comment err: %v", err)
+		}
+	}
+	if err != nil {
+		reply(fmt.Sprintf("❌ %s\n\n%s", err, prCommandUsage))
+		return
+	}
+
+	userId, er := services.GetUserIdByVcsUser(db.Get(), vcs.Id, event.User)
+	if er != nil {
+		if er.Code() == e.VcsUserNotExists {
+			reply(fmt.Sprintf("❌ unmapped user `%s`, please map the VCS user to a CloudIaC user first", event.User))
+		} else {
+			logger.Errorf("get vcs user %s err: %v", event.User, er)
+		}
+		return
+	}
+
+	pr, err := repo.GetPullRequest(event.PrId)
+	if err != nil {
+		logger.Errorf("get pull request err: %v", err)
+		reply(fmt.Sprintf("❌ get pull request #%d failed: %v", event.PrId, err))
+		return
+	}
+	if pr.State != vcsrv.PrStateOpen && cmd.Action != prCommandUnlock {
+		reply(fmt.Sprintf("❌ pull request #%d is %s", pr.Id, pr.State))
+		return
+	}
+
+	results := make([]string, 0)
+	for i := range tplList {
+		envs, err := services.GetEnvByTplId(db.Get(), tplList[i].Id)
+		if err != nil {
+			logger.Errorf("search env err: %v, tplId: %s", err, tplList[i].Id)
+			continue
+		}
+		for j := range envs {
+			if matchPrCommandEnv(cmd, &envs[j], pr) {
+				results = append(results, execPrCommand(cmd, userId, &envs[j], &tplList[i], pr))
+			}
+		}
+	}
+
+	if len(results) == 0 {
+		if cmd.EnvName != "" {
+			reply(fmt.Sprintf("❌ environment `%s` not found", cmd.EnvName))
+		} else if cmd.Action == prCommandUnlock {
+			reply("❌ no environment is locked by this pull request")
+		} else {
+			reply(fmt.Sprintf("❌ no environment deploys the target branch `%s`, please specify one with `-env <name>`", pr.BaseRef))
+		}
+		return
+	}
+	reply(fmt.Sprintf("`cloudiac %s`\n\n%s", cmd.Action, strings.Join(results, "\n")))
+}
+
+// execPrCommand 在单个环境上执行命令，返回执行结果描述
+func execPrCommand(cmd *prCommand, userId models.Id, env *models.Env, tpl *models.Template, pr *vcsrv.PullRequest) string {
+	logger := logs.Get().WithField("webhook", "prCommand").WithField("envId", env.Id)
+	name := fmt.Sprintf("**%s**", env.Name)
+	if !prCommandAllowed(userId, env, cmd.Action) {
+		return fmt.Sprintf("- ❌ %s: permission denied", name)
+	}
+
+	if cmd.Action == prCommandUnlock {
+		if env.LockedPrId != pr.Id {
+			return fmt.Sprintf("- ⚠️ %s: not locked by this pull request", name)
+		}
+		if err := services.EnvUnLocked(db.Get(), env.Id); err != nil {
+			logger.Errorf("unlock env err: %v", err)
+			return fmt.Sprintf("- ❌ %s: unlock failed", name)
+		}
+		return fmt.Sprintf("- 🔓 %s: unlocked", name)
+	}
+
+	if env.Locked && env.LockedPrId != pr.Id {
+		if env.LockedPrId != 0 {
+			return fmt.Sprintf("- 🔒 %s: locked by pull request #%d", name, env.LockedPrId)
+		}
+		return fmt.Sprintf("- 🔒 %s: environment is locked", name)
+	}
+
+	tx := db.Get().Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if env.LockedPrId != pr.Id {
+		if err := services.EnvLockByPr(tx, env.Id, pr.Id); err != nil {
+			_ = tx.Rollback()
+			if err.Code() == e.EnvLocked {
+				return fmt.Sprintf("- 🔒 %s: environment is locked", name)
+			}
+			logger.Errorf("lock env err: %v", err)
+			return fmt.Sprintf("- ❌ %s: lock environment failed", name)
+		}
+	}
+
+	taskType, source := models.TaskTypePlan, consts.TaskSourceWebhookPlan
+	if cmd.Action == prCommandApply {
+		taskType, source = models.TaskTypeApply, consts.TaskSourceWebhookApply
+	}
+	task, err := createWebhookTask(tx, CreateWebhookTaskParam{
+		TaskType: taskType,
+		Revision: pr.HeadRef,
+		CommitId: pr.HeadCommit,
+		UserId:   userId,
+		Env:      env,
+		Tpl:      tpl,
+		PrId:     pr.Id,
+		Source:   source,
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		logger.Errorf("create task err: %v", err)
+		return fmt.Sprintf("- ❌ %s: create %s task failed: %v", name, taskType, err)
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		logger.Errorf("commit err: %v", err)
+		return fmt.Sprintf("- ❌ %s: create %s task failed", name, taskType)
+	}
+
+	return fmt.Sprintf("- ✅ %s: [%s task](%s/org/%s/project/%s/m-project-env/detail/%s/task/%s) created, "+
+		"environment locked to this pull request until it is merged or closed", name, taskType,
+		configs.Get().Portal.Address, task.OrgId, task.ProjectId, task.EnvId, task.Id)
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services/vcsrv"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadWebhookPayload(t *testing.T, name string) forms.WebhooksApiHandler {
+	form := forms.WebhooksApiHandler{}
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "webhook", name))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(content, &form))
+	return form
+}
+
+func TestBitbucketWebhookOptions(t *testing.T) {
+	form := loadWebhookPayload(t, "bitbucket_push.json")
+	assert.Equal(t, "IAC/demo", getVcsRepoId(consts.GitTypeBitbucket, form))
+	// tag 的变更被忽略
+	assert.Equal(t, webhookOptions{
+		PushRef:      "refs/heads/master",
+		BeforeCommit: "2a8c2e8bfeb3e8a1f9a3c7e0c1d0f6cb3f40b6e7",
+		AfterCommit:  "8d51122def5632836d1cb1026e879069e10a1e13",
+	}, getWebhookOptions(consts.GitTypeBitbucket, form))
+
+	form = loadWebhookPayload(t, "bitbucket_pr_opened.json")
+	assert.Equal(t, "IAC/demo", getVcsRepoId(consts.GitTypeBitbucket, form))
+	assert.Equal(t, webhookOptions{
+		BaseRef:  "master",
+		HeadRef:  "feature/vpc",
+		PrStatus: GitlabPrOpened,
+		PrId:     5,
+	}, getWebhookOptions(consts.GitTypeBitbucket, form))
+}
+
+func TestAzureWebhookOptions(t *testing.T) {
+	form := loadWebhookPayload(t, "azure_push.json")
+	assert.Equal(t, "5febef5a-833d-4e14-b9c0-14cb638f91e6", getVcsRepoId(consts.GitTypeAzure, form))
+	assert.Equal(t, webhookOptions{
+		PushRef:      "refs/heads/main",
+		BeforeCommit: "aad331d8d3b131fa9ae03cf5e53965b51942618a",
+		AfterCommit:  "9b2c3d1e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c",
+	}, getWebhookOptions(consts.GitTypeAzure, form))
+
+	form = loadWebhookPayload(t, "azure_pr_created.json")
+	assert.Equal(t, "5febef5a-833d-4e14-b9c0-14cb638f91e6", getVcsRepoId(consts.GitTypeAzure, form))
+	assert.Equal(t, webhookOptions{
+		BaseRef:  "main",
+		HeadRef:  "feature/vpc",
+		PrStatus: GitlabPrOpened,
+		PrId:     21,
+	}, getWebhookOptions(consts.GitTypeAzure, form))
+}
+
+func TestGitWebhookOptions(t *testing.T) {
+	form := forms.WebhooksApiHandler{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"ref":"refs/heads/main","after":"9b2c3d1e",`+
+		`"repository":{"full_name":"team/infra"}}`), &form))
+	assert.Equal(t, "team/infra", getVcsRepoId(consts.GitTypeGit, form))
+	// 未传 before 时也作为 push 事件处理
+	assert.Equal(t, webhookOptions{
+		PushRef:      "refs/heads/main",
+		BeforeCommit: "9b2c3d1e",
+		AfterCommit:  "9b2c3d1e",
+	}, getWebhookOptions(consts.GitTypeGit, form))
+}
+
+func TestWebhookChangesMatch(t *testing.T) {
+	push := &webhookChanges{
+		options: webhookOptions{PushRef: "refs/heads/main", BeforeCommit: "2a8c2e8b", AfterCommit: "8d51122d"},
+		files:   []string{"README.md", "envs/prod/main.tf"},
+	}
+	assert.True(t, push.match(models.TriggerFilter{}, "envs/dev"))
+	assert.True(t, push.match(models.TriggerFilter{Branches: []string{"main"}}, "envs/dev"))
+	assert.False(t, push.match(models.TriggerFilter{Branches: []string{"release/*"}}, "envs/prod"))
+	// 只有工作目录外的文件变更时不触发
+	filter := models.TriggerFilter{ExcludePaths: []string{"*.md"}}
+	assert.True(t, push.match(filter, "envs/prod"))
+	assert.False(t, push.match(filter, "envs/dev"))
+
+	// PR 匹配源分支
+	pr := &webhookChanges{
+		options: webhookOptions{BaseRef: "main", HeadRef: "feature/vpc", PrStatus: GitlabPrOpened},
+		files:   []string{"envs/dev/main.tf"},
+	}
+	assert.True(t, pr.match(models.TriggerFilter{Branches: []string{"feature/*"}}, "envs/dev"))
+	assert.False(t, pr.match(models.TriggerFilter{Branches: []string{"main"}}, "envs/dev"))
+
+	// 新建分支无法比较变更，视为所有文件都有变更
+	created := &webhookChanges{options: webhookOptions{
+		PushRef:      "refs/heads/dev",
+		BeforeCommit: "0000000000000000000000000000000000000000",
+		AfterCommit:  "8d51122d",
+	}}
+	assert.Nil(t, getWebhookChangedFiles(nil, "", created.options))
+	assert.True(t, created.match(filter, "envs/dev"))
+}
+
+func TestNeedChangedFiles(t *testing.T) {
+	tpl := models.Template{Triggers: []string{consts.EnvTriggerCommit}}
+	tpl.Id = "tpl-1"
+	env := models.Env{Triggers: []string{consts.EnvTriggerCommit}}
+	tplEnvs := map[models.Id][]models.Env{tpl.Id: {env}}
+	assert.False(t, needChangedFiles([]models.Template{tpl}, tplEnvs))
+
+	// 环境未设置过滤条件时使用云模板的设置
+	tpl.TriggerFilter = models.TriggerFilter{Paths: []string{"modules/**"}}
+	assert.True(t, needChangedFiles([]models.Template{tpl}, tplEnvs))
+	tpl.Triggers = nil
+	assert.True(t, needChangedFiles([]models.Template{tpl}, tplEnvs))
+
+	// 只设置了分支过滤
+	tplEnvs[tpl.Id][0].TriggerFilter = models.TriggerFilter{Branches: []string{"main"}}
+	assert.False(t, needChangedFiles([]models.Template{tpl}, tplEnvs))
+	tplEnvs[tpl.Id][0].Triggers = nil
+	tplEnvs[tpl.Id][0].TriggerFilter = models.TriggerFilter{ExcludePaths: []string{"*.md"}}
+	assert.False(t, needChangedFiles([]models.Template{tpl}, tplEnvs))
+}
+
+func TestPrFinishedWebhookOptions(t *testing.T) {
+	form := loadWebhookPayload(t, "bitbucket_pr_opened.json")
+	form.EventKey = "pr:declined"
+	options := getWebhookOptions(consts.GitTypeBitbucket, form)
+	assert.Equal(t, webhookOptions{PrStatus: PrClosed, PrId: 5}, options)
+	assert.True(t, options.isPrFinished())
+
+	// 合并失败时 pr 仍为 active 状态
+	form = loadWebhookPayload(t, "azure_pr_created.json")
+	form.EventType = "git.pullrequest.merged"
+	assert.False(t, getWebhookOptions(consts.GitTypeAzure, form).isPrFinished())
+	form.Resource.Status = "completed"
+	assert.True(t, getWebhookOptions(consts.GitTypeAzure, form).isPrFinished())
+
+	assert.False(t, webhookOptions{PrStatus: GitlabPrOpened, PrId: 3}.isPrFinished())
+	assert.True(t, webhookOptions{PrStatus: GiteePrMerge, PrId: 3}.isPrFinished())
+}
+
+func TestGetPrCommentEvent(t *testing.T) {
+	form := loadWebhookPayload(t, "bitbucket_pr_comment.json")
+	assert.Equal(t, "IAC/demo", getVcsRepoId(consts.GitTypeBitbucket, form))
+	event, ok := getPrCommentEvent(consts.GitTypeBitbucket, form)
+	assert.True(t, ok)
+	assert.Equal(t, prCommentEvent{PrId: 5, Comment: "cloudiac apply -env staging", User: "admin"}, event)
+
+	form = loadWebhookPayload(t, "azure_pr_comment.json")
+	assert.Equal(t, "5febef5a-833d-4e14-b9c0-14cb638f91e6", getVcsRepoId(consts.GitTypeAzure, form))
+	event, ok = getPrCommentEvent(consts.GitTypeAzure, form)
+	assert.True(t, ok)
+	assert.Equal(t, prCommentEvent{PrId: 21, Comment: "cloudiac plan", User: "fabrikamfiber4@hotmail.com"}, event)
+
+	form = forms.WebhooksApiHandler{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"object_kind":"note","user":{"name":"Admin","username":"root"},`+
+		`"object_attributes":{"note":"cloudiac plan","noteable_type":"MergeRequest"},"merge_request":{"iid":3}}`), &form))
+	event, ok = getPrCommentEvent(consts.GitTypeGitLab, form)
+	assert.True(t, ok)
+	assert.Equal(t, prCommentEvent{PrId: 3, Comment: "cloudiac plan", User: "root"}, event)
+
+	// issue 的评论不是 pr 评论
+	form = forms.WebhooksApiHandler{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"action":"created","issue":{"number":7},`+
+		`"comment":{"body":"cloudiac plan","user":{"login":"octocat"}}}`), &form))
+	_, ok = getPrCommentEvent(consts.GitTypeGithub, form)
+	assert.False(t, ok)
+	form.Issue.PullRequest = &struct{}{}
+	event, ok = getPrCommentEvent(consts.GitTypeGithub, form)
+	assert.True(t, ok)
+	assert.Equal(t, prCommentEvent{PrId: 7, Comment: "cloudiac plan", User: "octocat"}, event)
+
+	_, ok = getPrCommentEvent(consts.GitTypeGithub, loadWebhookPayload(t, "bitbucket_pr_opened.json"))
+	assert.False(t, ok)
+}
+
+func TestParsePrCommand(t *testing.T) {
+	cases := []struct {
+		comment string
+		cmd     *prCommand
+		err     bool
+	}{
+		{comment: "LGTM"},
+		{comment: "please run `cloudiac plan`"},
+		{comment: "cloudiac plan", cmd: &prCommand{Action: "plan"}},
+		{comment: "looks good\r\n  cloudiac apply -env staging\r\n", cmd: &prCommand{Action: "apply", EnvName: "staging"}},
+		{comment: "cloudiac apply --env=prod", cmd: &prCommand{Action: "apply", EnvName: "prod"}},
+		{comment: "cloudiac unlock", cmd: &prCommand{Action: "unlock"}},
+		{comment: "cloudiac", err: true},
+		{comment: "cloudiac destroy", err: true},
+		{comment: "cloudiac apply staging", err: true},
+		{comment: "cloudiac apply -target aws_vpc.main", err: true},
+		{comment: "cloudiac apply -env", err: true},
+	}
+	for _, c := range cases {
+		cmd, err := parsePrCommand(c.comment)
+		assert.Equal(t, c.err, err != nil, c.comment)
+		assert.Equal(t, c.cmd, cmd, c.comment)
+	}
+}
+
+func TestMatchPrCommandEnv(t *testing.T) {
+	pr := &vcsrv.PullRequest{Id: 5, BaseRef: "master", HeadRef: "feature/vpc"}
+	staging := &models.Env{Name: "staging", Revision: "master"}
+	prod := &models.Env{Name: "prod", Revision: "release", Locked: true, LockedPrId: 5}
+
+	assert.True(t, matchPrCommandEnv(&prCommand{Action: "plan"}, staging, pr))
+	assert.False(t, matchPrCommandEnv(&prCommand{Action: "plan"}, prod, pr))
+	assert.True(t, matchPrCommandEnv(&prCommand{Action: "apply", EnvName: "prod"}, prod, pr))
+	assert.False(t, matchPrCommandEnv(&prCommand{Action: "unlock"}, staging, pr))
+	assert.True(t, matchPrCommandEnv(&prCommand{Action: "unlock"}, prod, pr))
+
+	staging.Archived = true
+	assert.False(t, matchPrCommandEnv(&prCommand{Action: "plan", EnvName: "staging"}, staging, pr))
+}
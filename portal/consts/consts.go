@@ -19,7 +19,12 @@ const (
 	DefaultPageSize = 15   // 默认分页大小
 	MaxPageSize     = 5000 // 最大单页数据条数
 
-	MaxLogContentSize = 1024 * 1024 // 最大日志文件大小，超限会被截断
+	MaxLogContentSize = 1024 * 1024 // 最大日志文件大小，超限会被截断(仅 db 存储)
+	LogReadChunkSize  = 1024 * 1024 // 读取已完成步骤日志时每次读取的大小
+
+	LogStorageTypeDB = "db" // 日志保存在数据库 iac_storage 表
+	LogStorageTypeFS = "fs" // 日志保存在本地文件系统
+	LogStorageTypeS3 = "s3" // 日志保存在 s3 兼容的对象存储
 
 	RunnerConnectTimeout = time.Second * 5
 	DbTaskPollInterval   = time.Second * 3 // 轮询 db 任务状态的间隔
@@ -38,13 +43,15 @@ const (
 	DefaultSysPassword = "zaq1@WSX"
 
 	DefaultTerraformVersion = "1.5.6"
+	DefaultOpenTofuVersion  = "1.8.5"
 
 	// token subject
-	JwtSubjectUserAuth  = "userAuth" // 用于用户认证
-	JwtSubjectSsoCode   = "ssoCode"  // 用于 sso 单点登录
-	JwtSubjectActivate  = "activate" // 用于账号激活
-	UserEmailINActivate = "inactive" // 用于账号激活
-	UserEmailActivate   = "active"   // 用于账号激活
+	JwtSubjectUserAuth  = "userAuth"  // 用于用户认证
+	JwtSubjectSsoCode   = "ssoCode"   // 用于 sso 单点登录
+	JwtSubjectActivate  = "activate"  // 用于账号激活
+	JwtSubjectTaskState = "taskState" // 用于任务访问 http state backend
+	UserEmailINActivate = "inactive"  // 用于账号激活
+	UserEmailActivate   = "active"    // 用于账号激活
 
 	DirRoot                          = "/"
 	PolicyGroupDownloadTimeoutSecond = 20 * time.Second
@@ -80,6 +87,10 @@ const (
 	GitTypeLocal    = "local"
 	GitTypeRegistry = "registry"
 
+	GitTypeBitbucket = "bitbucket" // Bitbucket Server/Data Center
+	GitTypeAzure     = "azure"     // Azure DevOps Repos
+	GitTypeGit       = "git"       // 不提供 api 的通用 git 服务
+
 	MetaYmlMatch   = "meta.y*ml"
 	VariablePrefix = "variables.tf"
 
@@ -96,6 +107,9 @@ const (
 	LocalGitReposLocalGitReposPathSubdirectories = "cloudiac" // 内置 http git server 服务子目录
 	ReposUrlPrefix                               = "/repos"   // 内置 http git server url prefix
 
+	GitMirrorPath     = "git-mirrors"   // 通用 git vcs 的仓库镜像缓存目录
+	GitMirrorInterval = 5 * time.Minute // 通用 git vcs 的仓库镜像默认刷新间隔
+
 	DefaultVcsName  = "默认仓库"
 	RegistryVcsName = "Registry"
 
@@ -108,6 +122,15 @@ const (
 	GraphDimensionType     = "type"
 )
 
+const (
+	// 策略屏蔽报表的查询状态：active 审批通过且未到期，expired 已到期
+	PolicySuppressReportActive  = "active"
+	PolicySuppressReportExpired = "expired"
+
+	PolicySuppressExpiredMailTitle = "CloudIaC策略屏蔽到期通知"
+	PolicySuppressExpireInterval   = time.Minute // 检查策略屏蔽是否到期的间隔
+)
+
 const (
 	SuperAdmin = "root"
 
@@ -169,10 +192,15 @@ const (
 	TaskSourceDriftApply   = "driftApply"
 	TaskSourceWebhookPlan  = "webhookPlan"
 	TaskSourceWebhookApply = "webhookApply"
+	TaskSourceWebhookScan  = "webhookScan"
 	TaskSourceAutoDestroy  = "autoDestroy"
 	TaskSourceAutoDeploy   = "autoDeploy"
 	TaskSourceApi          = "api"
 
+	// 上游环境部署成功后触发的下游环境任务
+	TaskSourceEnvDependency = "envDependency"
+	TaskEnvDependencyName   = "Upstream Deployed"
+
 	TagSourceApi  = "api"
 	TagSourceUser = "user"
 
@@ -197,6 +225,8 @@ const (
 	OperatorObjectTypeEnv     = "env"
 	OperatorObjectTypeProject = "project"
 
+	OperatorObjectTypePolicySuppress = "policySuppress"
+
 	// 发生漂移后，给 kafka 发送消息时 eventType 的固定值
 	DriftEventType = "drift_detection"
 	// 其他状态下，给 kafka 发送消息时 eventType 的固定值
@@ -161,6 +161,8 @@ const (
 	EnvTagNumLimited         = 30821
 	EnvTagLengthLimited      = 30822
 	TemplateNotBind          = 30823
+	EnvDependencyCycle       = 30824
+	EnvDependencyOutput      = 30825
 
 	//// task 309
 	TaskAlreadyExists     = 30910
@@ -172,6 +174,8 @@ const (
 	TaskAborting          = 30917
 	TaskAborted           = 30918
 	TaskCannotAbort       = 30919
+	TaskArtifactNotExists = 30920
+	TaskPlanNotApplicable = 30921
 
 	//// ssh key 310
 	KeyAlreadyExists  = 31010
@@ -183,6 +187,9 @@ const (
 	VcsNotExists   = 31110
 	VcsDeleteError = 31120
 
+	VcsUserAlreadyExists = 31121
+	VcsUserNotExists     = 31122
+
 	//// 317
 	RegistryServiceErr = 31710
 
@@ -198,12 +205,15 @@ const (
 	PolicyErrorParseTemplate     = 31250
 	PolicySuppressNotExist       = 31260
 	PolicySuppressAlreadyExist   = 31261
+	PolicySuppressNotPending     = 31262
+	PolicySuppressSelfApprove    = 31263
 	PolicyRelNotExist            = 31270
 	PolicyRelAlreadyExist        = 31271
 	PolicyScanNotEnabled         = 31280
 	PolicyMetaInvalid            = 31281
 	PolicyRegoInvalid            = 31282
 	PolicyGroupDirError          = 31283
+	PolicyGroupTestFailed        = 31284
 
 	/// terraform 313
 	InvalidTfVersion = 31300
@@ -234,4 +244,12 @@ const (
 	// tag 318
 	TagKeyAlreadyExisted = 31810 // key已经在
 	ObjectTagNumLimited  = 31820 // 单个对象 tag 数量超限
+
+	// state 319
+	StateLocked    = 31910
+	StateNotExists = 31911
+	StateInvalid   = 31912
+	StateChanged   = 31913
+
+	StateVersionNotExists = 31920
 )
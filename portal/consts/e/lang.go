@@ -286,6 +286,14 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "task cannot abort",
 		"zh-CN": "任务当前无法中止",
 	},
+	TaskArtifactNotExists: {
+		"en-US": "task artifact does not exist",
+		"zh-CN": "任务文件不存在",
+	},
+	TaskPlanNotApplicable: {
+		"en-US": "the plan task can not be applied",
+		"zh-CN": "该 plan 任务无法用于部署",
+	},
 	TemplateAlreadyExists: {
 		"en-US": "template already exists",
 		"zh-CN": "模板名称重复",
@@ -454,6 +462,14 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "VCS deletion failed",
 		"zh-CN": "VCS存在相关依赖云模版，无法删除",
 	},
+	VcsUserAlreadyExists: {
+		"en-US": "vcs user mapping already exists",
+		"zh-CN": "VCS用户映射已存在",
+	},
+	VcsUserNotExists: {
+		"en-US": "vcs user mapping does not exist",
+		"zh-CN": "VCS用户映射不存在",
+	},
 	ImportError: {
 		"en-US": "failed to import",
 		"zh-CN": "导入出错",
@@ -538,6 +554,14 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "suppress status already exist",
 		"zh-CN": "屏蔽记录已存在",
 	},
+	PolicySuppressNotPending: {
+		"en-US": "policy suppress is not pending approval",
+		"zh-CN": "屏蔽申请不是待审批状态",
+	},
+	PolicySuppressSelfApprove: {
+		"en-US": "cannot approve policy suppress requested by yourself",
+		"zh-CN": "不能审批自己提交的屏蔽申请",
+	},
 	PolicyRelNotExist: {
 		"en-US": "policy relation does not exist",
 		"zh-CN": "策略关联关系不存在",
@@ -578,6 +602,10 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "policy not found in the repository",
 		"zh-CN": "仓库在当前目录找不到策略文件",
 	},
+	PolicyGroupTestFailed: {
+		"en-US": "policy group tests failed",
+		"zh-CN": "策略组测试用例未通过",
+	},
 	LdapConnectFailed: {
 		"en-US": "ldap servers connect failed",
 		"zh-CN": "ldap 服务器连接 失败",
@@ -594,6 +622,14 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "template is not bound to the project",
 		"zh-CN": "云模板未绑定当前项目",
 	},
+	EnvDependencyCycle: {
+		"en-US": "environment dependency cycle detected",
+		"zh-CN": "环境依赖存在循环",
+	},
+	EnvDependencyOutput: {
+		"en-US": "upstream environment output not exists",
+		"zh-CN": "上游环境输出不存在",
+	},
 	TagKeyAlreadyExisted: {
 		"en-US": "tag key already exist",
 		"zh-CN": "标签键已经存在",
@@ -602,4 +638,24 @@ var errorMsgs = map[int]map[string]string{
 		"en-US": "the number of tags exceeds the limit",
 		"zh-CN": "标签数量超过限制",
 	},
+	StateLocked: {
+		"en-US": "state is locked",
+		"zh-CN": "State 已被锁定",
+	},
+	StateNotExists: {
+		"en-US": "state does not exist",
+		"zh-CN": "State 不存在",
+	},
+	StateInvalid: {
+		"en-US": "invalid state content",
+		"zh-CN": "无效的 State 内容",
+	},
+	StateChanged: {
+		"en-US": "state has changed since the plan",
+		"zh-CN": "State 在 plan 之后已发生变化",
+	},
+	StateVersionNotExists: {
+		"en-US": "state version does not exist",
+		"zh-CN": "State 版本不存在",
+	},
 }
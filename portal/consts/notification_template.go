@@ -148,6 +148,27 @@ var IacTaskApprovingTpl = `
 </html>
 `
 
+var IacPolicySuppressExpiredTpl = `
+<html>
+<body>
+<p>尊敬的CloudIaC用户：</p>
+<br />
+<p>	【{{.Creator}}】申请的策略屏蔽已到期，相关策略已重新启用检测，详情如下：</p>
+<br />
+<p>	所属组织：{{.OrgName}}</p>
+<p>	策略名称：{{.PolicyName}}</p>
+<p>	屏蔽目标：{{.TargetName}}</p>
+<p>	屏蔽原因：{{.Reason}}</p>
+<p>	审批人：{{.Approver}}</p>
+<p>	过期时间：{{.ExpiresAt}}</p>
+<br />
+<p>	如仍需屏蔽该策略，请重新提交屏蔽申请。</p>
+<br />
+<p>	-----该邮件由系统自动发出，请勿回复-----</p>
+</body>
+</html>
+`
+
 const (
 	IacTaskRunningMarkdown = `
 尊敬的CloudIaC用户：
@@ -3,10 +3,48 @@
 package consts
 
 var PrCommentTpl = `
-🤖&nbsp;&nbsp;PR Plan for CloudIac environment <a href="{{.Addr}}">{{.Name}}</a><br>
-` + "```Plan {{.Status}}```" + `
+🤖&nbsp;&nbsp;PR {{.Action}} for CloudIac environment <a href="{{.Addr}}">{{.Name}}</a><br>
+` + "```{{.Action}} {{.Status}}```" + `
+{{- if .HasChanges}}
+
+**Plan:** {{.ResAdded}} to add, {{.ResChanged}} to change, {{.ResDestroyed}} to destroy.
+{{- end}}
+{{- if .HasCost}}
+
+**Monthly cost:** {{.CostDelta}} (add {{.AddedCost}}, change {{.UpdatedCost}}, destroy {{.DestroyedCost}})
+{{- end}}
+{{- if .Resources}}
+
+<details>
+<summary>Resource Changes ({{.ResourceCount}})</summary>
+
+| Action | Resource |
+| :----: | -------- |
+{{- range .Resources}}
+| {{.Action}} | ` + "`{{.Address}}`" + ` |
+{{- end}}
+{{- if .ResourceOmitted}}
+| ... | {{.ResourceOmitted}} more |
+{{- end}}
+
+</details>
+{{- end}}
+{{- if .Violations}}
+
+<details open>
+<summary>Policy Violations ({{len .Violations}})</summary>
+
+| Severity | Policy | Resource | File |
+| -------- | ------ | -------- | ---- |
+{{- range .Violations}}
+| {{.Severity}} | {{.PolicyName}} | ` + "`{{.Resource}}`" + ` | {{.File}} |
+{{- end}}
+
+</details>
+{{- end}}
+
 <details>
-<summary>Plan Details</summary>
+<summary>{{.Action}} Details</summary>
 <pre><code>
 {{.Content}}
 </code></pre>
@@ -57,6 +57,9 @@ type Env struct {
 	KeyId      Id     `json:"keyId" gorm:"size:32"`               // 部署密钥ID
 	Workdir    string `json:"workdir" gorm:"size:32;default:''"`  // 工作目录
 
+	// IaC 引擎(terraform/opentofu)，为空时使用模板的配置
+	IacEngine string `json:"iacEngine" gorm:"size:32;default:''"`
+
 	LastTaskId    Id `json:"lastTaskId" gorm:"size:32"`          // 最后一次部署或销毁任务的 id(plan 任务不记录)
 	LastResTaskId Id `json:"lastResTaskId" gorm:"index;size:32"` // 最后一次进行了资源列表统计的部署任务的 id
 
@@ -65,6 +68,9 @@ type Env struct {
 	AutoApproval    bool `json:"autoApproval" gorm:"default:false"`    // 是否自动审批
 	StopOnViolation bool `json:"stopOnViolation" gorm:"default:false"` // 当合规不通过是否中止部署
 
+	// 合规检测分级处理配置，为空时使用项目的配置，项目也未配置时按 StopOnViolation 处理
+	PolicyEnforcement PolicyEnforcement `json:"policyEnforcement" gorm:"type:text"`
+
 	TTL           string `json:"ttl" gorm:"default:'0'" example:"1h/1d"` // 生命周期
 	AutoDestroyAt *Time  `json:"autoDestroyAt" gorm:""`                  // 自动销毁时间
 
@@ -74,6 +80,9 @@ type Env struct {
 	// 触发器设置
 	Triggers StringArray `json:"triggers" gorm:"type:text" swaggertype:"array,string"` // 触发器。commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 
+	// 触发器过滤条件，为空时使用云模板的设置
+	TriggerFilter TriggerFilter `json:"triggerFilter" gorm:"type:text"`
+
 	// 任务重试
 	RetryNumber int  `json:"retryNumber" gorm:"size:32;default:3"` // 任务重试次数
 	RetryDelay  int  `json:"retryDelay" gorm:"size:32;default:5"`  // 任务重试时间，单位为秒
@@ -94,6 +103,12 @@ type Env struct {
 	//环境锁定
 	Locked bool `json:"locked" gorm:"default:false"`
 
+	// 通过 PR 评论命令执行任务时环境被锁定到该 PR，PR 合并或关闭后自动解锁，0 表示未锁定到 PR
+	LockedPrId int `json:"lockedPrId" gorm:"default:0"`
+
+	// 执行期间独占环境的任务(如 state 操作)锁定环境时记录该任务 id，任务结束后只解除该任务的锁定
+	LockedTaskId Id `json:"lockedTaskId" gorm:"size:32;default:''"`
+
 	IsDemo bool `json:"isDemo" gorm:"default:false"` // 是否是演示环境
 
 	Targets StrSlice `json:"targets,omitempty" gorm:"type:text"` // 指定部署的资源
@@ -0,0 +1,54 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+)
+
+// 上游环境部署成功后对下游环境的触发方式
+const (
+	EnvDependencyTriggerNone  = ""
+	EnvDependencyTriggerPlan  = "plan"
+	EnvDependencyTriggerApply = "apply"
+)
+
+// EnvOutputMapping 上游环境输出到下游环境 terraform 变量的映射
+type EnvOutputMapping struct {
+	Output   string `json:"output" binding:"required"`   // 上游环境的 output 名称
+	Variable string `json:"variable" binding:"required"` // 下游环境的 terraform 变量名称
+}
+
+type EnvOutputMappings []EnvOutputMapping
+
+func (v EnvOutputMappings) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *EnvOutputMappings) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// EnvDependency 环境依赖关系，EnvId 依赖 DependsOnEnvId 的输出
+type EnvDependency struct {
+	BaseModel
+	OrgId          Id                `json:"orgId" gorm:"size:32;not null"`
+	ProjectId      Id                `json:"projectId" gorm:"size:32;not null"`
+	EnvId          Id                `json:"envId" gorm:"size:32;not null;comment:下游环境"`
+	DependsOnEnvId Id                `json:"dependsOnEnvId" gorm:"size:32;not null;index;comment:上游环境"`
+	Outputs        EnvOutputMappings `json:"outputs" gorm:"type:text"`
+	TriggerType    string            `json:"triggerType" gorm:"size:16;default:'';comment:上游部署成功后触发的任务类型"` // plan/apply，为空不触发
+}
+
+func (EnvDependency) TableName() string {
+	return "iac_env_dependency"
+}
+
+func (EnvDependency) NewId() Id {
+	return NewId("ed")
+}
+
+func (d EnvDependency) Migrate(sess *db.Session) (err error) {
+	return d.AddUniqueIndex(sess, "unique__env__depends_on", "env_id", "depends_on_env_id")
+}
@@ -26,6 +26,9 @@ type CreateEnvForm struct {
 	OneTime  bool      `form:"oneTime" json:"oneTime" binding:""`                                            // 一次性环境标识
 	Triggers []string  `form:"triggers" json:"triggers" binding:"omitempty,dive,required,oneof=commit prmr"` // 启用触发器，触发器：commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 
+	// 触发器过滤条件，按分支及变更文件路径过滤 webhook 事件，为空时使用云模板的设置
+	TriggerFilter models.TriggerFilter `form:"triggerFilter" json:"triggerFilter"`
+
 	Tags string `form:"tags" json:"tags" binding:"max=255"` // 环境的 tags，多个 tag 以 "," 分隔
 
 	AutoApproval    bool       `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
@@ -45,6 +48,12 @@ type CreateEnvForm struct {
 	KeyName      string    `form:"keyName" json:"keyName" binding:"omitempty,max=255"`          // 部署密钥名称
 	Workdir      string    `form:"workdir" json:"workdir" `                                     // 工作目录
 
+	// IaC 引擎(terraform/opentofu)，为空时使用模板的配置
+	IacEngine string `form:"iacEngine" json:"iacEngine" binding:"omitempty,oneof=terraform opentofu"`
+
+	// 合规检测分级处理配置，为空时使用项目的配置
+	PolicyEnforcement models.PolicyEnforcement `form:"policyEnforcement" json:"policyEnforcement"`
+
 	RetryNumber int         `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
 	RetryDelay  int         `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
 	RetryAble   bool        `form:"retryAble" json:"retryAble" binding:""`     // 是否允许任务进行重试
@@ -105,6 +114,9 @@ type UpdateEnvForm struct {
 	AutoApproval    bool `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
 	StopOnViolation bool `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`       // 合规不通过是否中止任务
 
+	// 合规检测分级处理配置，为空时使用项目的配置
+	PolicyEnforcement models.PolicyEnforcement `form:"policyEnforcement" json:"policyEnforcement"`
+
 	Triggers         []string `form:"triggers" json:"triggers" binding:"omitempty,dive,required,oneof=commit prmr"` // 启用触发器，触发器：commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 	RetryNumber      int      `form:"retryNumber" json:"retryNumber" binding:""`                                    // 重试总次数
 	RetryDelay       int      `form:"retryDelay" json:"retryDelay" binding:""`                                      // 重试时间间隔
@@ -113,6 +125,9 @@ type UpdateEnvForm struct {
 	AutoRepairDrift  bool     `json:"autoRepairDrift" form:"autoRepairDrift"`                                       // 是否进行自动纠偏
 	OpenCronDrift    bool     `json:"openCronDrift" form:"openCronDrift"`                                           // 是否开启偏移检测
 
+	// 触发器过滤条件，按分支及变更文件路径过滤 webhook 事件，为空时使用云模板的设置
+	TriggerFilter models.TriggerFilter `form:"triggerFilter" json:"triggerFilter"`
+
 	PolicyEnable bool        `json:"policyEnable" form:"policyEnable"`                                                        // 是否开启合规检测
 	PolicyGroup  []models.Id `json:"policyGroup" form:"policyGroup" binding:"omitempty,dive,required,startswith=pog-,max=32"` // 绑定策略组集合
 
@@ -132,6 +147,9 @@ type DeployEnvForm struct {
 	AutoApproval    bool     `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"`              // 是否自动审批
 	StopOnViolation bool     `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`                    // 合规不通过是否中止任务
 
+	// 触发器过滤条件，按分支及变更文件路径过滤 webhook 事件，为空时使用云模板的设置
+	TriggerFilter models.TriggerFilter `form:"triggerFilter" json:"triggerFilter"`
+
 	TaskType    string   `form:"taskType" json:"taskType" binding:"required,oneof=plan apply destroy" enums:"plan,apply,destroy"` // 环境创建后触发的任务步骤，plan计划,apply部署,destroy销毁资源
 	Targets     string   `form:"targets" json:"targets" binding:""`                                                               // Terraform target 参数列表
 	RunnerId    string   `form:"runnerId" json:"runnerId" binding:"max=32"`                                                       // 环境默认部署通道
@@ -139,6 +157,10 @@ type DeployEnvForm struct {
 	Revision    string   `form:"revision" json:"revision" binding:"max=64"`                                                       // 分支/标签
 	StepTimeout int      `form:"stepTimeout" json:"stepTimeout" binding:""`                                                       // 部署超时时间（单位：秒）
 
+	// 直接执行该 plan 任务生成的 plan 文件进行部署(仅 taskType 为 apply 时有效)，
+	// 部署使用 plan 任务的 commit 及变量，plan 之后环境 state 发生变化则不允许部署
+	PlanTaskId models.Id `form:"planTaskId" json:"planTaskId" binding:"omitempty,startswith=run-,max=32"`
+
 	RetryNumber int  `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
 	RetryDelay  int  `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
 	RetryAble   bool `form:"retryAble" json:"retryAble" binding:""`     // 是否允许任务进行重试
@@ -154,6 +176,12 @@ type DeployEnvForm struct {
 	KeyName      string    `form:"keyName" json:"keyName" binding:"omitempty,max=255"`          // 部署密钥名称
 	Workdir      string    `form:"workdir" json:"workdir" binding:"max=32"`                     // 工作目录
 
+	// IaC 引擎(terraform/opentofu)，为空时使用模板的配置
+	IacEngine string `form:"iacEngine" json:"iacEngine" binding:"omitempty,oneof=terraform opentofu"`
+
+	// 合规检测分级处理配置，为空时使用项目的配置
+	PolicyEnforcement models.PolicyEnforcement `form:"policyEnforcement" json:"policyEnforcement"`
+
 	VarGroupIds    []models.Id `json:"varGroupIds" form:"varGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
 	DelVarGroupIds []models.Id `json:"delVarGroupIds" form:"delVarGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
 
@@ -281,3 +309,34 @@ type EnvUnLockConfirmForm struct {
 
 	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
 }
+
+type CloneEnvForm struct {
+	BaseForm
+
+	Id              models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 源环境ID，swagger 参数通过 param path 指定，这里忽略
+	Name            string    `json:"name" binding:"required,gte=2,lte=64"`                                       // 新环境名称
+	TargetProjectId models.Id `json:"targetProjectId" binding:"omitempty,startswith=p-,max=32"`                   // 目标项目ID，为空时克隆到当前项目
+	PinRevision     bool      `json:"pinRevision"`                                                                // 使用源环境最后一次部署成功的分支/标签及 commit
+	TaskType        string    `json:"taskType" binding:"omitempty,oneof=plan apply"`                              // 克隆后执行的任务类型，为空不执行
+}
+
+type PromoteEnvForm struct {
+	BaseForm
+
+	Id          models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 源环境ID，swagger 参数通过 param path 指定，这里忽略
+	TargetEnvId models.Id `json:"targetEnvId" binding:"required,startswith=env-,max=32"`                      // 目标环境ID，可以属于其他项目
+	PinRevision bool      `json:"pinRevision"`                                                                // 使用源环境最后一次部署成功的分支/标签及 commit
+	TaskType    string    `json:"taskType" binding:"omitempty,oneof=plan apply"`                              // 推广后执行的任务类型，为空不执行
+}
+
+type ImportResource struct {
+	Address string `json:"address" binding:"required,max=512"` // 资源在配置中的地址，如 aws_instance.web
+	Id      string `json:"id" binding:"required,max=512"`      // 资源在云平台上的 id
+}
+
+type ImportEnvResourcesForm struct {
+	BaseForm
+
+	Id        models.Id        `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Resources []ImportResource `json:"resources" binding:"required,min=1,dive"`                                    // 要导入的资源
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type EnvDependencyParam struct {
+	DependsOnEnvId models.Id                 `json:"dependsOnEnvId" binding:"required,startswith=env-,max=32"` // 上游环境ID
+	Outputs        []models.EnvOutputMapping `json:"outputs" binding:"dive"`                                   // 上游环境输出到 terraform 变量的映射
+	TriggerType    string                    `json:"triggerType" binding:"omitempty,oneof=plan apply"`         // 上游环境部署成功后触发的任务类型，为空不触发
+}
+
+type UpdateEnvDependencyForm struct {
+	BaseForm
+
+	Id           models.Id            `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Dependencies []EnvDependencyParam `json:"dependencies" binding:"dive"`                                                // 依赖的上游环境，为空时清除环境依赖
+}
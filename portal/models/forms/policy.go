@@ -231,9 +231,31 @@ type UpdatePolicySuppressForm struct {
 	Id           models.Id   `uri:"id" swaggerignore:"true" binding:"required,startswith=po-,max=32"`                                       // 策略ID
 	Reason       string      `json:"reason" example:"测试环境无需检测" binding:"omitempty,max=255"`                                                 // 屏蔽原因
 	AddSourceIds []models.Id `json:"addTargetIds" example:"env-c3ek0co6n88ldvq1n6ag" binding:"required,dive,required,max=32"` // 添加屏蔽源ID列表
+	ExpiresAt    string      `json:"expiresAt" example:"2024-01-01T00:00:00+08:00" binding:"required"`                        // 屏蔽过期时间
 	//RmSourceIds  []models.Id `json:"rmTargetIds" example:"env-c3ek0co6n88ldvq1n6ag"`  // 删除屏蔽源ID列表
 }
 
+type ApprovePolicySuppressForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" swaggerignore:"true" binding:"required,startswith=po-,max=32"`             // 策略ID
+	SuppressId models.Id `uri:"suppressId" swaggerignore:"true" binding:"required,max=32"`                    // 屏蔽记录ID
+	Action     string    `json:"action" binding:"required,oneof=approved rejected" enums:"approved,rejected"` // 审批动作：approved通过, rejected驳回
+}
+
+type SearchPolicySuppressReportForm struct {
+	PageForm
+
+	Status string `form:"status" json:"status" binding:"omitempty,oneof=active expired pending rejected" enums:"active,expired,pending,rejected"` // 屏蔽状态：active生效中，expired已过期，pending待审批，rejected已拒绝，为空时返回全部
+}
+
+type ExportScanResultForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" binding:"required,startswith=run-,max=32" swaggerignore:"true"`                              // 扫描任务ID，环境部署任务的扫描结果使用部署任务ID
+	Format string    `form:"format" json:"format" binding:"required,oneof=sarif junit" enums:"sarif,junit" example:"sarif"` // 导出格式
+}
+
 type PolicyScanResultForm struct {
 	NoPageSizeForm
 	Id     models.Id `uri:"id" binding:"required" swaggerignore:"true"`                                                          // 环境ID或模版ID
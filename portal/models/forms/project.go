@@ -15,6 +15,8 @@ type CreateProjectForm struct {
 	Name              string              `json:"name" form:"name" binding:"required,gte=2,lte=64"` // 项目名称
 	Description       string              `json:"description" form:"description" binding:"max=255"` // 项目描述
 	UserAuthorization []UserAuthorization `json:"userAuthorization" form:"userAuthorization" `
+
+	PolicyEnforcement models.PolicyEnforcement `json:"policyEnforcement" form:"policyEnforcement"` // 合规检测分级处理的默认配置
 }
 
 type SearchProjectForm struct {
@@ -33,6 +35,8 @@ type UpdateProjectForm struct {
 	Status      string    `json:"status" form:"status" binding:"omitempty,oneof=enable disable"` // 项目状态 ('enable','disable')
 	Name        string    `json:"name" form:"name" binding:"omitempty,gte=2,lte=64" `            // 项目名称
 	Description string    `json:"description" form:"description" binding:"max=255"`              // 项目描述
+
+	PolicyEnforcement models.PolicyEnforcement `json:"policyEnforcement" form:"policyEnforcement"` // 合规检测分级处理的默认配置
 }
 
 type DeleteProjectForm struct {
@@ -0,0 +1,39 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchStateVersionForm struct {
+	NoPageSizeForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type DiffStateVersionForm struct {
+	BaseForm
+
+	Id   models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	From models.Id `form:"from" json:"from" binding:"required,startswith=sv-,max=32"`                  // 对比的源版本ID
+	To   models.Id `form:"to" json:"to" binding:"required,startswith=sv-,max=32"`                      // 对比的目标版本ID
+}
+
+type StateVersionForm struct {
+	BaseForm
+
+	Id        models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"`              // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	VersionId models.Id `uri:"versionId" json:"versionId" swaggerignore:"true" binding:"required,startswith=sv-,max=32"` // state 版本ID
+}
+
+type StateOperation struct {
+	Type        string `json:"type" binding:"required,oneof=mv rm taint untaint"` // 操作类型
+	Address     string `json:"address" binding:"required,max=512"`                // 资源地址
+	Destination string `json:"destination" binding:"omitempty,max=512"`           // 目标地址，mv 操作必填
+}
+
+type StateOperationForm struct {
+	BaseForm
+
+	Id         models.Id        `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=env-,max=32"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Operations []StateOperation `json:"operations" binding:"required,min=1,dive"`                                   // 按顺序执行的 state 操作
+}
@@ -112,6 +112,7 @@ type GetTaskStepLogForm struct {
 	ShowAll       bool      `json:"showAll" form:"showAll"`                                         // 是否展示所有
 	IsSimple      bool      `json:"isSimple" form:"isSimple"`                                       // 是否精简日志
 	IsTranslateZH bool      `json:"isTranslateZH" form:"isTranslateZH"`                             // 是否翻译为中文
+	StackRoot     string    `json:"stackRoot" form:"stackRoot"`                                     // 多工作目录模板的根目录名称，指定时返回步骤在该根目录的执行日志
 }
 
 type ErrorStepLogForm struct {
@@ -126,3 +127,16 @@ type SearchTaskResourceGraphForm struct {
 	Id        models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
 	Dimension string    `json:"dimension" form:"dimension" binding:"required"`                              // 资源名称，支持模糊查询
 }
+
+type SearchTaskArtifactForm struct {
+	NoPageSizeForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type TaskArtifactForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true" binding:"required,startswith=run-,max=32"`                 // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	ArtifactId models.Id `uri:"artifactId" json:"artifactId" swaggerignore:"true" binding:"required,startswith=art-,max=32"` // 文件ID
+}
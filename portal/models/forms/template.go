@@ -32,6 +32,16 @@ type CreateTemplateForm struct {
 	ProjectId    []models.Id `form:"projectId" json:"projectId" binding:"omitempty,dive,required,startswith=p-,max=32"` // 项目ID
 	TfVersion    string      `form:"tfVersion" json:"tfVersion" binding:"max=255"`                                      // 模版使用terraform版本号
 
+	// 模板使用的 IaC 引擎(terraform/opentofu)，默认为 terraform
+	IacEngine string `form:"iacEngine" json:"iacEngine" binding:"omitempty,oneof=terraform opentofu"`
+
+	// 多工作目录模板类型(multi/terragrunt)及根目录列表，根目录为空时自动发现
+	StackType  string   `form:"stackType" json:"stackType" binding:"omitempty,oneof=multi terragrunt"`
+	StackRoots []string `form:"stackRoots" json:"stackRoots" binding:"omitempty,dive,required,max=255"`
+
+	// 触发器过滤条件，按分支及变更文件路径过滤 webhook 事件
+	TplTriggerFilter models.TriggerFilter `form:"tplTriggerFilter" json:"tplTriggerFilter"`
+
 	Variables []Variable `json:"variables" form:"variables" binding:"omitempty,dive,required"`
 
 	VarGroupIds    []models.Id `json:"varGroupIds" form:"varGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
@@ -69,6 +79,7 @@ type UpdateTemplateForm struct {
 	RepoId         string      `form:"repoId" json:"repoId" binding:"max=255"`
 	RepoFullName   string      `form:"repoFullName" json:"repoFullName" binding:"max=255"`
 	TfVersion      string      `form:"tfVersion" json:"tfVersion" binding:"max=64"`
+	IacEngine      string      `form:"iacEngine" json:"iacEngine" binding:"omitempty,oneof=terraform opentofu"`
 	Variables      []Variable  `json:"variables" form:"variables" binding:"omitempty,dive,required"`
 	VarGroupIds    []models.Id `json:"varGroupIds" form:"varGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
 	DelVarGroupIds []models.Id `json:"delVarGroupIds" form:"delVarGroupIds" binding:"omitempty,dive,required,startswith=vg-,max=32"`
@@ -76,6 +87,13 @@ type UpdateTemplateForm struct {
 	PolicyGroup    []models.Id `json:"policyGroup" form:"policyGroup" binding:"omitempty,dive,required,startswith=pog-,max=32"` // 绑定的合规策略组
 	TplTriggers    []string    `json:"tplTriggers" form:"tplTriggers" binding:"omitempty,dive,required,max=255"`                // 分之推送自动触发合规 例如 ["commit"]
 	KeyId          models.Id   `form:"keyId" json:"keyId" binding:"omitempty,startswith=k-,max=32"`                             // 部署密钥ID
+
+	// 多工作目录模板类型(multi/terragrunt)及根目录列表，根目录为空时自动发现
+	StackType  string   `form:"stackType" json:"stackType" binding:"omitempty,oneof=multi terragrunt"`
+	StackRoots []string `form:"stackRoots" json:"stackRoots" binding:"omitempty,dive,required,max=255"`
+
+	// 触发器过滤条件，按分支及变更文件路径过滤 webhook 事件
+	TplTriggerFilter models.TriggerFilter `form:"tplTriggerFilter" json:"tplTriggerFilter"`
 }
 
 type DeleteTemplateForm struct {
@@ -121,6 +139,12 @@ type TemplateTfVersionSearchForm struct {
 	VcsBranch string    `json:"vcsBranch" form:"vcsBranch" binding:"max=64"`
 	RepoId    string    `json:"repoId" form:"repoId" binding:"max=255"`
 	Workdir   string    `json:"workdir" form:"workdir" binding:"max=255"`
+	IacEngine string    `json:"iacEngine" form:"iacEngine" binding:"omitempty,oneof=terraform opentofu"` // IaC 引擎，默认为 terraform
+}
+
+type TemplateTfVersionsForm struct {
+	BaseForm
+	IacEngine string `json:"iacEngine" form:"iacEngine" binding:"omitempty,oneof=terraform opentofu"` // IaC 引擎，默认为 terraform
 }
 
 type TemplateChecksForm struct {
@@ -133,4 +157,5 @@ type TemplateChecksForm struct {
 	TemplateId   models.Id `json:"templateId" form:"templateId" binding:"omitempty,startswith=tpl-,max=32"`
 	TfVarsFile   string    `json:"tfVarsFile" form:"tfVarsFile" binding:"max=255"`
 	Playbook     string    `json:"playbook" form:"playbook" binding:"omitempty,max=255"`
+	StackType    string    `json:"stackType" form:"stackType" binding:"omitempty,oneof=multi terragrunt"`
 }
@@ -41,6 +41,12 @@ type GetGitProjectsForm struct {
 	Q  string    `form:"q" json:"q"`
 }
 
+type AddVcsRepoForm struct {
+	BaseForm
+	Id     models.Id `uri:"id" json:"id" binding:"required,max=32" swaggerignore:"true"`
+	RepoId string    `form:"repoId" json:"repoId" binding:"required,max=255"` // 仓库路径(相对于 vcs 地址)
+}
+
 type GetGitRevisionForm struct {
 	BaseForm
 	Id     models.Id `uri:"id" json:"id" binding:"required,max=32" swaggerignore:"true"`
@@ -72,3 +78,21 @@ type GetFileFullPathForm struct {
 	Path         string    `json:"path" form:"path"` // 文件路径 如workdir/test.tfvars
 	CommitId     string    `json:"commitId" form:"commitId"`
 }
+
+type SearchVcsUserForm struct {
+	NoPageSizeForm
+	Id models.Id `uri:"id" json:"id" binding:"required,max=32" swaggerignore:"true"`
+}
+
+type CreateVcsUserForm struct {
+	BaseForm
+	Id      models.Id `uri:"id" json:"id" binding:"required,max=32" swaggerignore:"true"`
+	VcsUser string    `form:"vcsUser" json:"vcsUser" binding:"required,lte=255"` // vcs 用户名，azure 为用户的 uniqueName(邮箱)
+	UserId  models.Id `form:"userId" json:"userId" binding:"required,max=32"`    // CloudIaC 用户 id
+}
+
+type DeleteVcsUserForm struct {
+	BaseForm
+	Id        models.Id `uri:"id" json:"id" binding:"required,max=32" swaggerignore:"true"`
+	VcsUserId models.Id `uri:"vcsUserId" json:"vcsUserId" binding:"required,max=32" swaggerignore:"true"`
+}
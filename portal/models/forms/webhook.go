@@ -4,7 +4,7 @@ package forms
 
 type WebhooksApiHandler struct {
 	BaseForm
-	VcsType          string           `uri:"vcsType" binding:"required,oneof=gitlab github gitea gitee" swaggerignore:"true"` //url参数
+	VcsType          string           `uri:"vcsType" binding:"required,oneof=gitlab github gitea gitee bitbucket azure git" swaggerignore:"true"` //url参数
 	VcsId            string           `uri:"vcsId" binding:"required,max=32" swaggerignore:"true"`                            //url参数
 	ObjectKind       string           `json:"object_kind"`                                                                    // gitlab事件对象类型（push/merge_request）
 	Ref              string           `json:"ref"`                                                                            // push分支
@@ -18,6 +18,22 @@ type WebhooksApiHandler struct {
 	Before           string           `json:"before"`                                                                         //gitea push时回调的commitid
 	After            string           `json:"after"`                                                                          //gitea push时回调的commitid
 	Repository       Repository       `json:"repository"`                                                                     //gitea pr回调仓库信息
+
+	// bitbucket server
+	EventKey             string               `json:"eventKey"`    // 事件类型，示例：repo:refs_changed、pr:opened
+	Changes              []BitbucketChange    `json:"changes"`     // push 的分支变更
+	BitbucketPullRequest BitbucketPullRequest `json:"pullRequest"` // pr 信息
+
+	// azure devops
+	EventType string               `json:"eventType"` // 事件类型，示例：git.push、git.pullrequest.created
+	Resource  AzureWebhookResource `json:"resource"`  // 事件内容
+
+	// pr 评论事件
+	Comment      WebhookComment   `json:"comment"`       // github、gitea、gitee、bitbucket 的评论内容
+	Issue        WebhookIssue     `json:"issue"`         // github、gitea 的 pr 评论事件中 pr 以 issue 的形式返回
+	Sender       WebhookUser      `json:"sender"`        // github、gitea、gitee 触发事件的用户
+	MergeRequest ObjectAttributes `json:"merge_request"` // gitlab 评论事件中评论的 mr
+	NoteableType string           `json:"noteable_type"` // gitee 评论对象类型，示例：PullRequest
 }
 
 type Project struct {
@@ -30,10 +46,36 @@ type ObjectAttributes struct {
 	TargetBranch string `json:"target_branch"`   // 目标分支
 	State        string `json:"state"`           // mr/pr动作(open、close)
 	Iid          int    `json:"iid" form:"iid" ` // prId
+
+	// gitlab 评论事件
+	Note         string `json:"note"`          // 评论内容
+	NoteableType string `json:"noteable_type"` // 评论对象类型，示例：MergeRequest
 }
 
 type User struct {
 	Name string `json:"name"`
+
+	Username string `json:"username"` // gitlab 用户名
+}
+
+type WebhookUser struct {
+	Login string `json:"login"`
+}
+
+type WebhookComment struct {
+	Body string      `json:"body"` // github、gitea、gitee
+	User WebhookUser `json:"user"`
+
+	// bitbucket
+	Text   string `json:"text"`
+	Author struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+type WebhookIssue struct {
+	Number      int       `json:"number"`
+	PullRequest *struct{} `json:"pull_request"` // 不为空时表示评论的是 pr
 }
 
 //PullRequest gitea
@@ -57,4 +99,68 @@ type Head struct {
 type Repository struct {
 	Id       int    `json:"id"`
 	FullName string `json:"full_name"`
+
+	// bitbucket 仓库信息，仓库 id 为 {project.key}/{slug}
+	Slug    string           `json:"slug"`
+	Project BitbucketProject `json:"project"`
+}
+
+type BitbucketProject struct {
+	Key string `json:"key"`
+}
+
+type BitbucketRef struct {
+	Id           string     `json:"id"`        // refs/heads/master
+	DisplayId    string     `json:"displayId"` // master
+	LatestCommit string     `json:"latestCommit"`
+	Repository   Repository `json:"repository"` // pr 事件的仓库信息在 toRef 中
+}
+
+type BitbucketChange struct {
+	Ref      BitbucketRef `json:"ref"`
+	RefId    string       `json:"refId"`
+	FromHash string       `json:"fromHash"`
+	ToHash   string       `json:"toHash"`
+	Type     string       `json:"type"` // ADD、UPDATE、DELETE
+}
+
+type BitbucketPullRequest struct {
+	Id      int          `json:"id"`
+	State   string       `json:"state"` // OPEN、MERGED、DECLINED
+	FromRef BitbucketRef `json:"fromRef"`
+	ToRef   BitbucketRef `json:"toRef"`
+}
+
+type AzureRefUpdate struct {
+	Name        string `json:"name"` // refs/heads/master
+	OldObjectId string `json:"oldObjectId"`
+	NewObjectId string `json:"newObjectId"`
+}
+
+type AzureWebhookResource struct {
+	RefUpdates []AzureRefUpdate `json:"refUpdates"`
+	Repository struct {
+		Id string `json:"id"`
+	} `json:"repository"`
+	PullRequestId         int    `json:"pullRequestId"`
+	Status                string `json:"status"` // active、completed、abandoned
+	SourceRefName         string `json:"sourceRefName"`
+	TargetRefName         string `json:"targetRefName"`
+	LastMergeSourceCommit struct {
+		CommitId string `json:"commitId"`
+	} `json:"lastMergeSourceCommit"`
+
+	// pr 评论事件
+	Comment struct {
+		Content string `json:"content"`
+		Author  struct {
+			UniqueName string `json:"uniqueName"`
+		} `json:"author"`
+	} `json:"comment"`
+	PullRequest struct {
+		PullRequestId int `json:"pullRequestId"`
+		Repository    struct {
+			Id string `json:"id"`
+		} `json:"repository"`
+	} `json:"pullRequest"`
 }
@@ -232,8 +232,10 @@ func Init(migrate bool) {
 	autoMigrate(&Project{}, sess)
 	autoMigrate(&Vcs{}, sess)
 	autoMigrate(&VcsPr{}, sess)
+	autoMigrate(&VcsUser{}, sess)
 	autoMigrate(&Template{}, sess)
 	autoMigrate(&Env{}, sess)
+	autoMigrate(&EnvDependency{}, sess)
 	autoMigrate(&Resource{}, sess)
 	autoMigrate(&ResourceMapping{}, sess)
 
@@ -282,5 +284,10 @@ func Init(migrate bool) {
 	autoMigrate(&TagValue{}, sess)
 	autoMigrate(&TagRel{}, sess)
 
+	autoMigrate(&StateVersion{}, sess)
+	autoMigrate(&StateLock{}, sess)
+
+	autoMigrate(&TaskArtifact{}, sess)
+
 	dbMigrate(sess)
 }
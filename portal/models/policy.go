@@ -32,6 +32,8 @@ type Policy struct {
 	Tags         string `json:"tags" gorm:"comment:标签" example:"security,aliyun"`
 
 	Rego Text `json:"rego" gorm:"type:text;comment:rego脚本" example:"package idcos ..."`
+
+	InputType string `json:"inputType" gorm:"size:16;default:'';comment:策略输入类型" example:"plan"` // 为空或 config 时检查模板配置，plan 时检查 plan 结果
 }
 
 func (Policy) TableName() string {
@@ -0,0 +1,59 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/common"
+	"database/sql/driver"
+	"strings"
+)
+
+// PolicyEnforcement 合规检测的分级处理配置，按违规策略的严重程度决定部署的处理方式。
+// 项目的配置作为默认值，环境可以进行覆盖，任务创建时保存生效的配置
+type PolicyEnforcement struct {
+	High   string `json:"high,omitempty" enums:"block,approve,warn"`   // 高危违规的处理方式，为空时仅告警
+	Medium string `json:"medium,omitempty" enums:"block,approve,warn"` // 中危违规的处理方式，为空时仅告警
+	Low    string `json:"low,omitempty" enums:"block,approve,warn"`    // 低危违规的处理方式，为空时仅告警
+
+	RequiredGroups []Id `json:"requiredGroups,omitempty"` // 部署进入审批前必须检测通过的策略组
+}
+
+func (v PolicyEnforcement) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *PolicyEnforcement) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// IsEmpty 未配置分级处理时使用 StopOnViolation 的处理方式
+func (v PolicyEnforcement) IsEmpty() bool {
+	return v.High == "" && v.Medium == "" && v.Low == "" && len(v.RequiredGroups) == 0
+}
+
+// HasAction 是否有严重程度配置了指定的处理方式
+func (v PolicyEnforcement) HasAction(action string) bool {
+	return v.High == action || v.Medium == action || v.Low == action
+}
+
+// Action 返回指定严重程度违规的处理方式，未知的严重程度按中危处理
+func (v PolicyEnforcement) Action(severity string) string {
+	action := v.Medium
+	switch strings.ToLower(severity) {
+	case common.PolicySeverityHigh:
+		action = v.High
+	case common.PolicySeverityLow:
+		action = v.Low
+	}
+	if action == "" {
+		return common.PolicyEnforceWarn
+	}
+	return action
+}
+
+// PolicyEnforcementResult 合规检测分级处理的结果，保存在任务执行结果中
+type PolicyEnforcementResult struct {
+	Action       string  `json:"action"`                 // 最终处理方式(block/approve/warn)，为空表示没有违规
+	Violated     TsCount `json:"violated"`               // 各严重程度的违规策略数量
+	FailedGroups []Id    `json:"failedGroups,omitempty"` // 未检测通过的必须通过策略组
+}
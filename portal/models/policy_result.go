@@ -78,6 +78,8 @@ type Violation struct {
 	PlanRoot     string `json:"plan_root,omitempty" gorm:"comment:源码文件夹"`       // 文件夹路径
 	Line         int    `json:"line,omitempty" gorm:"comment:错误资源源码行号"`         // 错误源文件行号
 	Source       Text   `json:"source,omitempty" gorm:"type:text;comment:错误源码"` // 错误源码
+
+	Addresses StrSlice `json:"addresses,omitempty" gorm:"type:text;comment:违规资源地址"` // plan 策略检查出的违规资源完整地址
 }
 
 type TsCount struct {
@@ -15,6 +15,13 @@ type PolicySuppress struct {
 	PolicyId   Id     `json:"policyId" gorm:"uniqueIndex:unique__policy__target;size:32;not null;comment:策略ID" example:"po-c3lcrjxczjdywmk0go90"`  // 策略ID
 	Reason     string `json:"reason" gorm:"comment:屏蔽说明" example:"测试环境不检测此策略"`                                                                     // 屏蔽原因
 	Type       string `json:"type" gorm:"comment:屏蔽类型" enums:"policy,source" example:"source"`                                                     // 屏蔽类型：policy按策略屏蔽，source按来源屏蔽type:enum('policy','source');
+
+	// 屏蔽记录由 CreatorId 申请，经 ApproverId 审批通过后生效，到达 ExpiresAt 后自动失效。
+	// 历史记录没有过期时间，状态默认为已生效
+	Status     string `json:"status" gorm:"size:16;default:'approved';comment:审批状态" enums:"pending,approved,rejected,expired" example:"pending"` // 审批状态：pending待审批，approved已生效，rejected已拒绝，expired已过期
+	ApproverId Id     `json:"approverId" gorm:"size:32;default:'';comment:审批人" example:"u-c3lcrjxczjdywmk0go90"`                                 // 审批人
+	ApprovedAt *Time  `json:"approvedAt" gorm:"comment:审批时间"`                                                                                    // 审批时间
+	ExpiresAt  *Time  `json:"expiresAt" gorm:"index;comment:过期时间"`                                                                               // 过期时间
 }
 
 func (PolicySuppress) TableName() string {
@@ -14,6 +14,9 @@ type Project struct {
 	Status      string `json:"status" gorm:"default:'enable';comment:状态"` // type:enum('enable','disable');
 
 	IsDemo bool `json:"isDemo"`
+
+	// 合规检测分级处理的默认配置，环境未配置时使用
+	PolicyEnforcement PolicyEnforcement `json:"policyEnforcement" gorm:"type:text"`
 }
 
 func (Project) TableName() string {
@@ -37,6 +37,8 @@ type Resource struct {
 	SensitiveKeys StrSlice `json:"sensitiveKeys,omitempty" gorm:"type:text"`
 	Dependencies  StrSlice `json:"dependencies,omitempty" gorm:"type:text"`
 
+	StackRoot string `json:"stackRoot,omitempty" gorm:"not null;default:''"` // 多工作目录模板中资源所属的根目录
+
 	AppliedAt Time `json:"appliedAt" gorm:"column:applied_at;default:null"`
 }
 
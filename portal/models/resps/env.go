@@ -2,6 +2,8 @@
 
 package resps
 
+import "cloudiac/portal/models"
+
 type EnvUnLockConfirmResp struct {
 	AutoDestroyPass bool `json:"autoDestroyPass"`
 }
@@ -33,3 +35,27 @@ type EnvStatisticsResp struct {
 	CostTrendStat []EnvCostTrendStatResp `json:"costTrendStat"`
 	CostList      []EnvCostDetailResp    `json:"costList"`
 }
+
+type EnvDependencyResp struct {
+	models.EnvDependency
+	DependsOnEnvName string `json:"dependsOnEnvName"`
+}
+
+type EnvDependencyNode struct {
+	Id     models.Id `json:"id"`
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
+}
+
+// EnvDependencyEdge 依赖图的边，由上游环境指向下游环境
+type EnvDependencyEdge struct {
+	From        models.Id                `json:"from"`
+	To          models.Id                `json:"to"`
+	Outputs     models.EnvOutputMappings `json:"outputs"`
+	TriggerType string                   `json:"triggerType"`
+}
+
+type EnvDependencyGraphResp struct {
+	Nodes []EnvDependencyNode `json:"nodes"`
+	Edges []EnvDependencyEdge `json:"edges"`
+}
@@ -8,6 +8,7 @@ type PolicySuppressResp struct {
 	models.PolicySuppress
 	TargetName string `json:"targetName"` // 检查目标
 	Creator    string `json:"creator"`    // 操作人
+	Approver   string `json:"approver"`   // 审批人
 }
 
 func (PolicySuppressResp) TableName() string {
@@ -23,3 +24,13 @@ type PolicySuppressSourceResp struct {
 func (PolicySuppressSourceResp) TableName() string {
 	return "iac_policy_suppress"
 }
+
+type PolicySuppressReportResp struct {
+	PolicySuppressResp
+	PolicyName     string `json:"policyName" example:"VPC 安全组规则"` // 策略名称
+	PolicySeverity string `json:"policySeverity" example:"high"`  // 策略严重程度
+}
+
+func (PolicySuppressReportResp) TableName() string {
+	return "s"
+}
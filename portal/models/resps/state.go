@@ -0,0 +1,35 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package resps
+
+import "cloudiac/portal/models"
+
+type StateVersionResp struct {
+	models.StateVersion
+	TaskName  string    `json:"taskName"`
+	TaskType  string    `json:"taskType"`
+	CreatorId models.Id `json:"creatorId"`
+	Creator   string    `json:"creator"`
+}
+
+const (
+	StateDiffCreate = "create"
+	StateDiffDelete = "delete"
+	StateDiffUpdate = "update"
+)
+
+// StateResourceDiff 两个 state 版本间单个资源的差异，
+// 只返回发生变化的属性名，不返回属性值，避免泄露敏感信息
+type StateResourceDiff struct {
+	Address string   `json:"address" example:"module.vpc.aws_subnet.this[0]"`
+	Type    string   `json:"type"`
+	Action  string   `json:"action" enums:"create,delete,update"`
+	Attrs   []string `json:"attrs,omitempty"` // 发生变化的属性名
+}
+
+type StateVersionDiffResp struct {
+	From      *models.StateVersion `json:"from"`
+	To        *models.StateVersion `json:"to"`
+	Resources []StateResourceDiff  `json:"resources"`
+	Outputs   []string             `json:"outputs"` // 发生变化的 output 名称
+}
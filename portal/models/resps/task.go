@@ -52,3 +52,15 @@ type ErrorStepLog struct {
 	LogMessage   string `json:"message"`      // 全量日志信息
 	LogSummary   string `json:"logSummary"`   // 日志摘要
 }
+
+type TaskQueueResp struct {
+	TaskId        models.Id `json:"taskId"`
+	Status        string    `json:"status"`
+	Priority      int       `json:"priority"`      // 调度优先级，值越小越先执行(0: 手动, 1: webhook, 2: 偏移检测, 3: 扫描)
+	RunnerId      string    `json:"runnerId"`      // 任务所属 runner
+	RunnerMaxJobs int       `json:"runnerMaxJobs"` // runner 并发任务数量
+	RunnerRunning int       `json:"runnerRunning"` // runner 正在执行的任务数量
+	Position      int       `json:"position"`      // 在 runner 队列中的位置(从 1 开始)，任务不在等待状态时为 0
+	Total         int       `json:"total"`         // runner 队列中可调度的任务数量
+	EnvAhead      int       `json:"envAhead"`      // 同一环境中排在前面的等待任务数量
+}
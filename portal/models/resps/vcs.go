@@ -2,6 +2,14 @@
 
 package resps
 
+import "cloudiac/portal/models"
+
 type Revision struct {
 	Name string `json:"name"`
 }
+
+type VcsUserResp struct {
+	models.VcsUser
+	UserName  string `json:"userName"`
+	UserEmail string `json:"userEmail"`
+}
@@ -32,6 +32,8 @@ type BaseTask struct {
 
 	StartAt *Time `json:"startAt" gorm:"comment:任务开始时间"` // 任务开始时间
 	EndAt   *Time `json:"endAt" gorm:"comment:任务结束时间"`   // 任务结束时间
+
+	CommitStatusId int `json:"-" gorm:"default:0"` // 上报到 vcs 的 commit 状态 id(gitee 检查项)，状态变更时更新该状态
 }
 
 // ScanTask 合规扫描任务
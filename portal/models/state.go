@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+// StateVersion 环境 terraform state 的历史版本，
+// 使用 http state backend 时每次 state 写入都会记录，其他 backend 在部署任务结束后记录。
+// state 内容保存在 logstorage 中，每次 state 内容发生变化都会生成一个新版本
+type StateVersion struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id     `json:"envId" gorm:"index;size:32;not null"`
+	TaskId    Id     `json:"taskId" gorm:"index;size:32;default:''"` // 写入该版本的任务 id
+	StatePath string `json:"-" gorm:"index;not null"`                // 对应 Env.StatePath
+
+	Serial  int64  `json:"serial" gorm:"default:0"`           // state 文件中的 serial
+	Lineage string `json:"lineage" gorm:"size:64;default:''"` // state 文件中的 lineage
+	MD5     string `json:"md5" gorm:"size:32;default:''"`
+	Size    int    `json:"size" gorm:"default:0"`      // state 内容大小(字节)
+	Path    string `json:"-" gorm:"size:512;not null"` // state 内容在 logstorage 中的保存路径
+}
+
+func (StateVersion) TableName() string {
+	return "iac_state_version"
+}
+
+func (StateVersion) NewId() Id {
+	return NewId("sv")
+}
+
+// StateLock http state backend 的锁，同一个 state 同时只能有一个锁
+type StateLock struct {
+	AbstractModel
+
+	StatePath string `json:"statePath" gorm:"primaryKey;size:255"`
+	EnvId     Id     `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id     `json:"taskId" gorm:"size:32;default:''"` // 加锁的任务 id
+	LockId    string `json:"lockId" gorm:"size:64;not null"`   // terraform 生成的 lock id
+	Info      Text   `json:"info" gorm:"type:text"`            // terraform 提交的完整 lock 信息(json)
+	CreatedAt Time   `json:"createdAt" gorm:""`
+}
+
+func (StateLock) TableName() string {
+	return "iac_state_lock"
+}
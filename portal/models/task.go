@@ -43,6 +43,8 @@ type TaskResult struct {
 	ForecastFailed   []string `json:"forecastFailed"`   // 询价失败的resource
 
 	Outputs map[string]interface{} `json:"outputs"`
+
+	PolicyEnforcement *PolicyEnforcementResult `json:"policyEnforcement,omitempty"` // 合规检测分级处理结果
 }
 
 func (v TaskResult) Value() (driver.Value, error) {
@@ -56,6 +58,9 @@ func (v *TaskResult) Scan(value interface{}) error {
 type TaskExtra struct {
 	Source       string `json:"source,omitempty"`
 	TransitionId string `json:"transitionId,omitempty"`
+
+	PlanTaskId  Id     `json:"planTaskId,omitempty"`  // 部署任务直接使用该 plan 任务生成的 plan 文件执行
+	StateSerial *int64 `json:"stateSerial,omitempty"` // plan 任务执行时环境 state 的 serial
 }
 
 func (v TaskExtra) Value() (driver.Value, error) {
@@ -66,6 +71,46 @@ func (v *TaskExtra) Scan(value interface{}) error {
 	return UnmarshalValue(value, v)
 }
 
+// TaskImport 导入任务要导入的资源，Address 为资源在配置中的地址，Id 为资源在云平台上的 id
+type TaskImport struct {
+	Address string `json:"address"`
+	Id      string `json:"id"`
+}
+
+type TaskImports []TaskImport
+
+func (v TaskImports) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TaskImports) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+const (
+	StateOpMv      = "mv"      // 移动资源地址(terraform state mv)
+	StateOpRm      = "rm"      // 从 state 中移除资源，不删除实际资源(terraform state rm)
+	StateOpTaint   = "taint"   // 标记资源在下次部署时重建(terraform taint)
+	StateOpUntaint = "untaint" // 取消资源的重建标记(terraform untaint)
+)
+
+// TaskStateOp state 操作任务要执行的操作，Destination 只在 mv 操作时使用
+type TaskStateOp struct {
+	Type        string `json:"type"`
+	Address     string `json:"address"`
+	Destination string `json:"destination,omitempty"`
+}
+
+type TaskStateOps []TaskStateOp
+
+func (v TaskStateOps) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TaskStateOps) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
 const (
 	TaskTypePlan     = common.TaskTypePlan
 	TaskTypeApply    = common.TaskTypeApply
@@ -77,6 +122,11 @@ const (
 	TaskTypeTplScan  = common.TaskTypeTplScan
 	TaskTypeTplParse = common.TaskTypeTplParse
 
+	TaskTypeStateRestore = common.TaskTypeStateRestore
+	TaskTypeImport       = common.TaskTypeImport
+
+	TaskTypeStateOperation = common.TaskTypeStateOperation
+
 	TaskPending   = common.TaskPending
 	TaskRunning   = common.TaskRunning
 	TaskApproving = common.TaskApproving
@@ -124,20 +174,31 @@ type Task struct {
 	Playbook     string   `json:"playbook" gorm:"default:''"`
 	TfVarsFile   string   `json:"tfVarsFile" gorm:"default:''"`
 	TfVersion    string   `json:"tfVersion" gorm:"default:''"`
+	IacEngine    string   `json:"iacEngine" gorm:"size:32;default:''"` // 执行任务使用的 IaC 引擎
 	PlayVarsFile string   `json:"playVarsFile" gorm:"default:''"`
 	Targets      StrSlice `json:"targets" gorm:"type:text"` // 指定 terraform target 参数
 
+	StackType  string   `json:"stackType" gorm:"size:32;default:''"` // 多工作目录模板类型
+	StackRoots StrSlice `json:"stackRoots" gorm:"type:text"`         // 多工作目录模板指定的根目录
+
 	Variables TaskVariables `json:"variables" gorm:"type:text"` // 本次执行使用的所有变量(继承、覆盖计算之后的)
 
-	StatePath string `json:"statePath" gorm:"not null"`
+	StatePath      string `json:"statePath" gorm:"not null"`
+	StateVersionId Id     `json:"stateVersionId" gorm:"size:32;default:''"` // state 恢复任务要恢复到的 state 版本
+
+	Imports  TaskImports  `json:"imports" gorm:"type:text"`  // 导入任务要导入的资源
+	StateOps TaskStateOps `json:"stateOps" gorm:"type:text"` // state 操作任务要执行的操作
 
 	// 扩展属性，包括 source, transitionId 等
-	ExtraData JSON `json:"extraData" gorm:"type:text"` // 扩展字段，用于存储外部服务调用时的信息
+	ExtraData JSON      `json:"extraData" gorm:"type:text"` // 扩展字段，用于存储外部服务调用时的信息
+	Extra     TaskExtra `json:"extra" gorm:"type:text"`     // 任务扩展信息，如关联的 plan 任务
 
 	KeyId           Id   `json:"keyId" gorm:"size32"` // 部署密钥ID
 	AutoApprove     bool `json:"autoApproval" gorm:"default:false"`
 	StopOnViolation bool `json:"stopOnViolation" gorm:"default:false"`
 
+	PolicyEnforcement PolicyEnforcement `json:"policyEnforcement" gorm:"type:text"` // 任务创建时生效的合规检测分级处理配置
+
 	// 任务执行结果，如 add/change/delete 的资源数量、outputs 等
 	Result      TaskResult `json:"result" gorm:"type:text"`              // 任务执行结果
 	PlanResult  TaskResult `json:"planResult" gorm:"type:text"`          //plan的执行结果
@@ -210,7 +271,8 @@ func (t *BaseTask) IsEffectTask() bool {
 
 // IsEffectTaskType 是否产生实际数据变动的任务类型
 func (BaseTask) IsEffectTaskType(typ string) bool {
-	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy)
+	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy, TaskTypeStateRestore, TaskTypeImport,
+		TaskTypeStateOperation)
 }
 
 func (BaseTask) GetTaskNameByType(typ string) string {
@@ -233,6 +295,12 @@ func (BaseTask) GetTaskNameByType(typ string) string {
 		return common.TaskTypeTplScanName
 	case TaskTypeTplParse:
 		return common.TaskTypeTplParseName
+	case TaskTypeStateRestore:
+		return common.TaskTypeStateRestoreName
+	case TaskTypeImport:
+		return common.TaskTypeImportName
+	case TaskTypeStateOperation:
+		return common.TaskTypeStateOperationName
 	default:
 		panic("invalid task type")
 	}
@@ -242,6 +310,16 @@ func (t *Task) StateJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFStateJsonFile)
 }
 
+// StateFilePath 任务执行后的 state 文件(terraform state pull 的输出)
+func (t *Task) StateFilePath() string {
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFStateFile)
+}
+
+// PlanFilePath plan 步骤生成的 plan 文件(terraform plan -out)保存路径
+func (t *Task) PlanFilePath() string {
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFPlanFile)
+}
+
 func (t *Task) ProviderSchemaJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFProviderSchema)
 }
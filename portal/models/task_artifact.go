@@ -0,0 +1,26 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+// TaskArtifact 任务步骤收集的文件，文件内容保存在 logstorage 中
+type TaskArtifact struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id     `json:"envId" gorm:"index;size:32;not null"`
+	TaskId    Id     `json:"taskId" gorm:"index;size:32;not null"`
+	StepId    Id     `json:"stepId" gorm:"size:32;not null"`
+	StepIndex int    `json:"stepIndex" gorm:"default:0"`
+	Name      string `json:"name" gorm:"size:512;not null"` // 文件路径(相对 workdir)
+	Size      int    `json:"size" gorm:"default:0"`         // 文件大小(字节)
+	Path      string `json:"-" gorm:"size:1024;not null"`   // 文件在 logstorage 中的保存路径
+}
+
+func (TaskArtifact) TableName() string {
+	return "iac_task_artifact"
+}
+
+func (TaskArtifact) NewId() Id {
+	return NewId("art")
+}
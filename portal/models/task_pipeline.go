@@ -4,6 +4,7 @@ package models
 
 import (
 	"bytes"
+	"cloudiac/common"
 	"cloudiac/portal/consts/e"
 	"database/sql/driver"
 	"fmt"
@@ -47,6 +48,11 @@ type PipelineStep struct {
 	BeforeCmds StrSlice `json:"before,omitempty" yaml:"before" gorm:"type:text"`
 	AfterCmds  StrSlice `json:"after,omitempty" yaml:"after" gorm:"type:text"`
 	Args       StrSlice `json:"args,omitempty" yaml:"args" gorm:"type:text"`
+	Artifacts  StrSlice `json:"artifacts,omitempty" yaml:"artifacts" gorm:"type:text"` // 步骤结束后收集的文件(相对 workdir 的路径，支持通配符)
+
+	// 以下字段从 pipeline 0.6 版本开始支持
+	When     string         `json:"when,omitempty" yaml:"when" gorm:"size:512;default:''"` // 步骤执行条件，条件不满足时跳过该步骤
+	Parallel []PipelineStep `json:"parallel,omitempty" yaml:"parallel" gorm:"-"`           // 并行执行的步骤，任务创建时展开为同一并行组的多个步骤
 }
 
 func (v PipelineTaskFlow) Value() (driver.Value, error) {
@@ -64,10 +70,54 @@ var (
 		"0.3": pipelineV0dot3,
 		"0.4": pipelineV0dot4,
 		"0.5": pipelineV0dot5,
+		"0.6": pipelineV0dot6,
 	}
 	defaultPipelines = make(map[string]IPipeline)
 )
 
+// 内置任务的执行流程，这些任务不允许通过 pipeline 文件自定义步骤。
+// 修改 state 的任务需要在修改后执行 collect 步骤，以更新环境的资源、输出及 state 版本
+var builtinTaskFlows = map[string]PipelineTaskFlow{
+	common.TaskTypeStateRestore: {
+		Steps: []PipelineStep{
+			{Type: common.TaskStepCheckout, Name: "拉取配置"},
+			{Type: common.TaskStepTfInit, Name: "初始化配置"},
+			{Type: common.TaskStepStateRestore, Name: "恢复 State"},
+			{Type: common.TaskStepCollect, Name: "采集资源"},
+		},
+	},
+	// 导入资源后执行 plan，展示导入的资源与配置之间仍存在的差异
+	common.TaskTypeImport: {
+		Steps: []PipelineStep{
+			{Type: common.TaskStepCheckout, Name: "拉取配置"},
+			{Type: common.TaskStepTfInit, Name: "初始化配置"},
+			{Type: common.TaskStepTfImport, Name: "导入资源"},
+			{Type: common.TaskStepCollect, Name: "采集资源"},
+			{Type: common.TaskStepTfPlan, Name: "检查差异"},
+		},
+	},
+	common.TaskTypeStateOperation: {
+		Steps: []PipelineStep{
+			{Type: common.TaskStepCheckout, Name: "拉取配置"},
+			{Type: common.TaskStepTfInit, Name: "初始化配置"},
+			{Type: common.TaskStepStateOperation, Name: "执行 State 操作"},
+			{Type: common.TaskStepCollect, Name: "采集资源"},
+		},
+	},
+}
+
+// GetBuiltinTaskFlow 获取内置任务的执行流程，typ 不是内置任务时返回 false
+func GetBuiltinTaskFlow(typ string) (PipelineTaskFlow, bool) {
+	flow, ok := builtinTaskFlows[typ]
+	if !ok {
+		return PipelineTaskFlow{}, false
+	}
+	steps := make([]PipelineStep, len(flow.Steps))
+	copy(steps, flow.Steps)
+	flow.Steps = steps
+	return flow, true
+}
+
 func DefaultPipelineRaw() string {
 	return defaultPipelineTpls[DefaultPipelineVersion]
 }
@@ -102,6 +152,8 @@ func init() {
 			p, err = NewPipelineDot34(tpl)
 		case "0.5":
 			p, err = NewPipelineDot5(tpl)
+		case "0.6":
+			p, err = NewPipelineDot6(tpl)
 		default:
 			err = e.New(e.InvalidPipelineVersion)
 		}
@@ -0,0 +1,230 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"bytes"
+	"cloudiac/common"
+	"fmt"
+
+	"github.com/Knetic/govaluate"
+	"gopkg.in/yaml.v2"
+)
+
+// pipeline 0.6 版本，步骤定义格式与 0.4 相同，并增加了步骤的 when 和 parallel 配置:
+//   - when: 步骤执行条件，条件不满足时跳过该步骤，如 `when: planChanged && branch == "main"`
+//   - parallel: 同时执行的多个 command 步骤，如 `parallel: [{type: command, args: ["make lint"]}, ...]`
+const pipelineV0dot6 = `
+version: 0.6
+
+plan:
+  steps:
+    - type: checkout
+      name: 拉取配置
+
+    - type: terraformInit
+      name: 初始化配置
+
+    - type: terraformPlan
+      name: 检查配置
+
+    - type: envScan
+      name: 合规检测
+
+apply:
+  steps:
+    - type: checkout
+      name: 拉取配置
+
+    - type: terraformInit
+      name: 初始化配置
+
+    - type: terraformPlan
+      name: 检查配置
+
+    - type: envScan
+      name: 合规检测
+
+    - type: terraformApply
+      name: 执行配置
+
+    - type: ansiblePlay
+      name: 部署应用
+
+destroy:
+  steps:
+    - type: checkout
+      name: 拉取配置
+
+    - type: terraformInit
+      name: 初始化配置
+
+    - type: terraformPlan
+      name: 检查配置
+      args:
+        - "-destroy"
+
+    - type: terraformDestroy
+      name: 销毁环境
+
+envScan:
+  steps:
+    - type: checkout
+    - type: terraformInit
+    - type: terraformPlan
+    - type: envScan
+
+envParse:
+  steps:
+    - type: checkout
+    - type: terraformInit
+    - type: terraformPlan
+    - type: envParse
+
+tplScan:
+  steps:
+    - type: scaninit
+    - type: tplScan
+
+tplParse:
+  steps:
+    - type: scaninit
+    - type: tplParse
+`
+
+type PipelineDot6 struct {
+	PipelineDot34 `yaml:",inline"`
+}
+
+func NewPipelineDot6(content string) (PipelineDot6, error) {
+	buffer := bytes.NewBufferString(content)
+	pipeline := PipelineDot6{}
+	if err := yaml.NewDecoder(buffer).Decode(&pipeline); err != nil {
+		return pipeline, err
+	}
+
+	for typ, task := range map[string]PipelineTaskDot34{
+		common.TaskJobPlan:     pipeline.Plan,
+		common.TaskJobApply:    pipeline.Apply,
+		common.TaskJobDestroy:  pipeline.Destroy,
+		common.TaskJobEnvScan:  pipeline.EnvScan,
+		common.TaskJobEnvParse: pipeline.EnvParse,
+		common.TaskJobTplScan:  pipeline.TplScan,
+		common.TaskJobTplParse: pipeline.TplParse,
+	} {
+		if err := validatePipelineDot6Steps(task.Steps); err != nil {
+			return pipeline, fmt.Errorf("%s: %v", typ, err)
+		}
+	}
+	return pipeline, nil
+}
+
+func validatePipelineDot6Steps(steps []PipelineStep) error {
+	for i, step := range steps {
+		if step.When != "" {
+			if _, err := ParseStepWhen(step.When); err != nil {
+				return fmt.Errorf("step %d: %v", i, err)
+			}
+		}
+
+		if len(step.Parallel) == 0 {
+			if step.Type == "" {
+				return fmt.Errorf("step %d: type is required", i)
+			}
+			continue
+		}
+
+		// 任务容器由第一个步骤启动，所以第一个步骤不能是并行步骤
+		if i == 0 {
+			return fmt.Errorf("step %d: the first step can not be parallel", i)
+		}
+		if step.Type != "" {
+			return fmt.Errorf("step %d: type and parallel can not be set at the same time", i)
+		}
+		for j, s := range step.Parallel {
+			if s.Type != common.TaskStepCommand {
+				return fmt.Errorf("step %d.%d: only '%s' step can run in parallel", i, j, common.TaskStepCommand)
+			}
+			if len(s.Parallel) > 0 {
+				return fmt.Errorf("step %d.%d: parallel can not be nested", i, j)
+			}
+			if s.When != "" {
+				if _, err := ParseStepWhen(s.When); err != nil {
+					return fmt.Errorf("step %d.%d: %v", i, j, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 步骤 when 条件中可以使用的变量
+var stepWhenVariables = map[string]interface{}{
+	"taskType":     "",
+	"source":       "",
+	"branch":       "", // 任务执行的分支或 tag，同 revision
+	"revision":     "",
+	"commitId":     "",
+	"planChanged":  false, // plan 结果是否有资源变更
+	"resAdded":     0,
+	"resChanged":   0,
+	"resDestroyed": 0,
+}
+
+// ParseStepWhen 解析步骤的 when 条件，条件中只能使用 stepWhenVariables 中定义的变量
+func ParseStepWhen(when string) (*govaluate.EvaluableExpression, error) {
+	expr, err := govaluate.NewEvaluableExpression(when)
+	if err != nil {
+		return nil, fmt.Errorf("invalid when expression '%s': %v", when, err)
+	}
+	for _, v := range expr.Vars() {
+		if _, ok := stepWhenVariables[v]; !ok {
+			return nil, fmt.Errorf("invalid when expression '%s': unknown variable '%s'", when, v)
+		}
+	}
+	return expr, nil
+}
+
+// StepWhenParameters 基于任务信息生成步骤 when 条件的变量值
+func (t *Task) StepWhenParameters() map[string]interface{} {
+	// govaluate 中数值类型统一使用 float64
+	count := func(v *int) float64 {
+		if v == nil {
+			return 0
+		}
+		return float64(*v)
+	}
+	added, changed, destroyed := count(t.PlanResult.ResAdded), count(t.PlanResult.ResChanged), count(t.PlanResult.ResDestroyed)
+
+	return map[string]interface{}{
+		"taskType":     t.Type,
+		"source":       t.Source,
+		"branch":       t.Revision,
+		"revision":     t.Revision,
+		"commitId":     t.CommitId,
+		"planChanged":  added+changed+destroyed > 0,
+		"resAdded":     added,
+		"resChanged":   changed,
+		"resDestroyed": destroyed,
+	}
+}
+
+// EvalStepWhen 计算步骤的 when 条件，when 为空时返回 true
+func EvalStepWhen(when string, params map[string]interface{}) (bool, error) {
+	if when == "" {
+		return true, nil
+	}
+	expr, err := ParseStepWhen(when)
+	if err != nil {
+		return false, err
+	}
+	result, err := expr.Evaluate(params)
+	if err != nil {
+		return false, fmt.Errorf("evaluate when expression '%s': %v", when, err)
+	}
+	b, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("when expression '%s' result is not bool: %v", when, result)
+	}
+	return b, nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestNewPipelineDot6(t *testing.T) {
+	content := `
+version: 0.6
+
+apply:
+  steps:
+    - type: checkout
+    - type: terraformInit
+    - type: terraformPlan
+    - parallel:
+        - type: command
+          args: ["make lint"]
+        - type: command
+          args: ["tflint"]
+          when: resAdded > 0
+      when: planChanged
+    - type: terraformApply
+      when: planChanged && branch == "main"
+`
+	p, err := NewPipelineDot6(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := p.GetTaskFlowWithPipeline(TaskTypeApply).Steps
+	if len(steps) != 5 || len(steps[3].Parallel) != 2 || steps[4].When == "" {
+		t.Fatalf("unexpected steps: %+v", steps)
+	}
+
+	invalids := []string{
+		// 第一个步骤不能是并行步骤
+		"apply:\n  steps:\n    - parallel:\n        - type: command\n",
+		// 并行步骤只支持 command
+		"apply:\n  steps:\n    - type: checkout\n    - parallel:\n        - type: terraformPlan\n",
+		// 未知的变量
+		"apply:\n  steps:\n    - type: checkout\n      when: unknown == 1\n",
+		// 表达式语法错误
+		"apply:\n  steps:\n    - type: checkout\n      when: branch ==\n",
+	}
+	for _, c := range invalids {
+		if _, err := NewPipelineDot6("version: 0.6\n" + c); err == nil {
+			t.Errorf("expected error for pipeline: %s", c)
+		}
+	}
+}
+
+func TestEvalStepWhen(t *testing.T) {
+	added := 1
+	task := Task{Revision: "main"}
+	task.PlanResult.ResAdded = &added
+	params := task.StepWhenParameters()
+
+	cases := []struct {
+		when   string
+		expect bool
+	}{
+		{"", true},
+		{"planChanged", true},
+		{`branch == "main" && resAdded > 0`, true},
+		{`branch != "main"`, false},
+		{"resDestroyed > 0", false},
+	}
+	for _, c := range cases {
+		ok, err := EvalStepWhen(c.when, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.expect {
+			t.Errorf("when '%s': expect %v, got %v", c.when, c.expect, ok)
+		}
+	}
+
+	if _, err := EvalStepWhen("resAdded + 1", params); err == nil {
+		t.Errorf("expected error for non-bool expression")
+	}
+}
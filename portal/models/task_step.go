@@ -26,6 +26,11 @@ const (
 	TaskStepScanInit = common.TaskStepScanInit
 	TaskStepOpaScan  = common.TaskStepOpaScan
 
+	TaskStepStateRestore = common.TaskStepStateRestore
+	TaskStepImport       = common.TaskStepTfImport
+
+	TaskStepStateOperation = common.TaskStepStateOperation
+
 	TaskStepPending   = common.TaskStepPending
 	TaskStepApproving = common.TaskStepApproving
 	TaskStepRejected  = common.TaskStepRejected
@@ -34,6 +39,7 @@ const (
 	TaskStepComplete  = common.TaskStepComplete
 	TaskStepTimeout   = common.TaskStepTimeout
 	TaskStepAborted   = common.TaskStepAborted
+	TaskStepSkipped   = common.TaskStepSkipped
 )
 
 type TaskStep struct {
@@ -61,6 +67,10 @@ type TaskStep struct {
 	RetryNumber       int   `json:"retryNumber" gorm:"size:32;default:0"`       // 每个步骤可以重试的总次数
 
 	IsCallback bool `json:"isCallback" gorm:"default:0"` // 步骤是否为回调
+
+	ParallelGroup string `json:"parallelGroup" gorm:"size:32;default:''"` // 并行组，相邻的同一并行组的步骤会同时执行
+
+	StackRoots StrSlice `json:"stackRoots,omitempty" gorm:"type:text"` // 多工作目录模板中步骤执行的根目录，各根目录的日志单独保存
 }
 
 func (TaskStep) TableName() string {
@@ -95,12 +105,13 @@ func (TaskStep) IsExitedStatus(status string) bool {
 		TaskStepComplete,
 		TaskStepFailed,
 		TaskStepTimeout,
-		TaskStepAborted)
+		TaskStepAborted,
+		TaskStepSkipped)
 }
 
-// 执行成功
+// 执行成功(条件不满足被跳过的步骤也认为是成功)
 func (s *TaskStep) IsSuccess() bool {
-	return utils.StrInArray(s.Status, TaskStepComplete)
+	return utils.StrInArray(s.Status, TaskStepComplete, TaskStepSkipped)
 }
 
 // 执行失败
@@ -128,6 +139,11 @@ func (s *TaskStep) IsRejected() bool {
 	return s.Status == TaskStepRejected
 }
 
+// StackLogPath 多工作目录模板中步骤在根目录的执行日志路径
+func (s *TaskStep) StackLogPath(root string) string {
+	return path.Join(path.Dir(s.LogPath), runner.StackDir, root+".log")
+}
+
 func (s *TaskStep) GenLogPath() string {
 	return path.Join(
 		s.ProjectId.String(),
@@ -39,12 +39,20 @@ type Template struct {
 
 	LastScanTaskId Id `json:"lastScanTaskId" gorm:"size:32"` // 最后一次策略扫描任务 id
 
-	TfVersion string `json:"tfVersion" gorm:"default:''"` // 模版使用的terraform版本号
+	TfVersion string `json:"tfVersion" gorm:"default:''"`         // 模版使用的terraform版本号
+	IacEngine string `json:"iacEngine" gorm:"size:32;default:''"` // 模板使用的 IaC 引擎(terraform/opentofu)，为空时为 terraform
+
+	// 多工作目录模板: workdir 下包含多个 terraform 根目录(或 terragrunt 配置)，任务中按依赖顺序依次执行
+	StackType  string   `json:"stackType" gorm:"size:32;default:''"` // 为空表示单个工作目录，multi 或 terragrunt
+	StackRoots StrSlice `json:"stackRoots" gorm:"type:text"`         // 根目录列表(基于 workdir 的相对路径)，为空时自动发现
 
 	// 触发器设置
 	Triggers     StringArray `json:"tplTriggers" gorm:"type:text" swaggertype:"array,string"` // 触发器。commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 	PolicyEnable bool        `json:"policyEnable" gorm:"default:false"`                       // 是否开启合规检测
 
+	// 触发器过滤条件，按分支及变更文件路径过滤 webhook 事件
+	TriggerFilter TriggerFilter `json:"tplTriggerFilter" gorm:"type:text"`
+
 	KeyId Id `json:"keyId" gorm:"size:32"` // 部署密钥ID
 
 	IsDemo bool   `json:"isDemo"`
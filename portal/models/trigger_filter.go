@@ -0,0 +1,113 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"database/sql/driver"
+	"path"
+	"strings"
+)
+
+// TriggerFilter webhook 触发器的过滤条件，用于 monorepo 中只在相关目录有变更时才触发任务
+// 路径均为基于仓库根目录的相对路径，支持 * ? [] 通配符，"**" 匹配任意层级目录
+type TriggerFilter struct {
+	Branches     []string `json:"branches,omitempty"`     // 分支匹配规则，push 时匹配推送分支，PR/MR 时匹配源分支。为空则不限制
+	Paths        []string `json:"paths,omitempty"`        // 变更文件需要匹配的路径，为空时默认为工作目录下的所有文件
+	ExcludePaths []string `json:"excludePaths,omitempty"` // 忽略的路径，只有忽略路径下的文件变更时不触发任务
+}
+
+func (v TriggerFilter) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TriggerFilter) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+func (v TriggerFilter) IsEmpty() bool {
+	return len(v.Branches) == 0 && len(v.Paths) == 0 && len(v.ExcludePaths) == 0
+}
+
+// FilterPaths 是否设置了路径过滤
+func (v TriggerFilter) FilterPaths() bool {
+	return len(v.Paths) > 0 || len(v.ExcludePaths) > 0
+}
+
+// MatchBranch 判断分支是否匹配，未设置分支规则时总是匹配
+func (v TriggerFilter) MatchBranch(branch string) bool {
+	if len(v.Branches) == 0 {
+		return true
+	}
+	for _, pattern := range v.Branches {
+		if MatchPathGlob(pattern, branch) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchFiles 判断变更文件中是否有会影响工作目录 workdir 的文件，未设置路径规则时总是匹配
+func (v TriggerFilter) MatchFiles(workdir string, files []string) bool {
+	if !v.FilterPaths() {
+		return true
+	}
+
+	includes := v.Paths
+	if len(includes) == 0 {
+		includes = []string{path.Join(strings.Trim(workdir, "/"), "**")}
+	}
+	for _, f := range files {
+		if matchAnyGlob(v.ExcludePaths, f) {
+			continue
+		}
+		if matchAnyGlob(includes, f) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchPathGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPathGlob 按路径匹配通配符，"*" 不匹配 "/"，"**" 匹配零或多层目录
+func MatchPathGlob(pattern, name string) bool {
+	pattern = strings.Trim(pattern, "/")
+	name = strings.Trim(name, "/")
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			// 连续的 ** 等同于一个
+			for len(patterns) > 0 && patterns[0] == "**" {
+				patterns = patterns[1:]
+			}
+			if len(patterns) == 0 {
+				return true
+			}
+			for i := range names {
+				if matchSegments(patterns, names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+		if ok, err := path.Match(patterns[0], names[0]); err != nil || !ok {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
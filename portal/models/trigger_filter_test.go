@@ -0,0 +1,62 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPathGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		expect  bool
+	}{
+		{"main.tf", "main.tf", true},
+		{"*.tf", "main.tf", true},
+		{"*.tf", "modules/main.tf", false},
+		{"**/*.tf", "main.tf", true},
+		{"**/*.tf", "modules/vpc/main.tf", true},
+		{"envs/prod/**", "envs/prod/main.tf", true},
+		{"envs/prod/**", "envs/prod", true},
+		{"envs/prod/**", "envs/production/main.tf", false},
+		{"envs/**/variables.tf", "envs/prod/us/variables.tf", true},
+		{"/envs/*/main.tf", "envs/dev/main.tf", true},
+		{"feature/*", "feature/vpc", true},
+		{"feature/*", "feature/vpc/v2", false},
+		{"release-[0-9]*", "release-1.0", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expect, MatchPathGlob(c.pattern, c.name), "%s %s", c.pattern, c.name)
+	}
+}
+
+func TestTriggerFilter(t *testing.T) {
+	files := []string{"README.md", "envs/prod/main.tf", "docs/usage.md"}
+
+	// 未设置过滤条件时总是匹配
+	filter := TriggerFilter{}
+	assert.True(t, filter.IsEmpty())
+	assert.True(t, filter.MatchBranch("any"))
+	assert.True(t, filter.MatchFiles("envs/dev", files))
+
+	// 只设置忽略路径时，默认匹配工作目录下的文件
+	filter = TriggerFilter{ExcludePaths: []string{"**/*.md"}}
+	assert.True(t, filter.MatchFiles("envs/prod", files))
+	assert.False(t, filter.MatchFiles("envs/dev", files))
+	assert.True(t, filter.MatchFiles("", files))
+	assert.False(t, filter.MatchFiles("", []string{"README.md"}))
+
+	filter = TriggerFilter{
+		Branches:     []string{"main", "release/*"},
+		Paths:        []string{"envs/dev/**", "modules/**"},
+		ExcludePaths: []string{"modules/**/README.md"},
+	}
+	assert.True(t, filter.MatchBranch("release/v1"))
+	assert.False(t, filter.MatchBranch("dev"))
+	assert.False(t, filter.MatchFiles("envs/prod", files))
+	assert.False(t, filter.MatchFiles("envs/prod", []string{"modules/vpc/README.md"}))
+	assert.True(t, filter.MatchFiles("envs/prod", []string{"modules/vpc/main.tf"}))
+}
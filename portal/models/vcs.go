@@ -13,6 +13,10 @@ const (
 	VcsGitea  = common.VcsGitea
 	VcsGitee  = common.VcsGitee
 	VcsGithub = common.VcsGithub
+
+	VcsBitbucket = common.VcsBitbucket
+	VcsAzure     = common.VcsAzure
+	VcsGit       = common.VcsGit
 	// git clone 鉴权时使用的user 默认为token
 	RepoUser = "token"
 )
@@ -64,8 +68,35 @@ type VcsPr struct {
 	TaskId Id  `json:"taskId" form:"taskId" `
 	EnvId  Id  `json:"envId" form:"envId" `
 	VcsId  Id  `json:"vcsId" form:"vcsId" `
+
+	// 任务结果写入的 PR 评论 id，同一环境在同一个 PR 中的后续 plan 任务会修改该评论而不是新建
+	CommentId int `json:"commentId" form:"commentId" gorm:"default:0"`
+
+	// apply 任务结果写入的 PR 评论 id，与 plan 评论分开，后续 apply 任务会修改该评论
+	ApplyCommentId int `json:"applyCommentId" form:"applyCommentId" gorm:"default:0"`
 }
 
 func (VcsPr) TableName() string {
 	return "iac_vcs_pr"
 }
+
+// VcsUser vcs 用户与 CloudIaC 用户的映射，PR 评论命令按映射的用户在项目中的角色鉴权
+type VcsUser struct {
+	BaseModel
+	OrgId   Id     `json:"orgId" gorm:"size:32;not null"`
+	VcsId   Id     `json:"vcsId" gorm:"size:32;not null"`
+	VcsUser string `json:"vcsUser" gorm:"not null;comment:vcs用户名"` // github/gitea/gitee 的 login，gitlab/bitbucket 的 username，azure 的 uniqueName
+	UserId  Id     `json:"userId" gorm:"size:32;not null"`
+}
+
+func (VcsUser) TableName() string {
+	return "iac_vcs_user"
+}
+
+func (VcsUser) NewId() Id {
+	return NewId("vu")
+}
+
+func (v VcsUser) Migrate(sess *db.Session) (err error) {
+	return v.AddUniqueIndex(sess, "unique__vcs_user", "vcs_id", "vcs_user")
+}
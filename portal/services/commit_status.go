@@ -0,0 +1,233 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// vcs 对状态描述的长度有限制(github 为 140 个字符)
+const commitStatusMaxDescription = 140
+
+// commitState 将任务状态转换为 commit 状态
+func commitState(taskStatus string) string {
+	switch taskStatus {
+	case common.TaskPending, common.TaskApproving:
+		return vcsrv.CommitStatePending
+	case common.TaskRunning:
+		return vcsrv.CommitStateRunning
+	case common.TaskComplete:
+		return vcsrv.CommitStateSuccess
+	default: // failed, rejected, aborted
+		return vcsrv.CommitStateFailure
+	}
+}
+
+func commitStatusDescription(taskType, taskStatus string, message string) string {
+	desc := fmt.Sprintf("CloudIaC %s %s", taskType, taskStatus)
+	if message != "" && commitState(taskStatus) == vcsrv.CommitStateFailure {
+		desc = fmt.Sprintf("%s: %s", desc, message)
+	}
+	if runes := []rune(desc); len(runes) > commitStatusMaxDescription {
+		desc = string(runes[:commitStatusMaxDescription-3]) + "..."
+	}
+	return desc
+}
+
+func isWebhookTask(task *models.Task) bool {
+	return task.Source == consts.TaskSourceWebhookPlan || task.Source == consts.TaskSourceWebhookApply
+}
+
+func isWebhookScanTask(task *models.ScanTask) bool {
+	extra := struct {
+		Source string `json:"source"`
+	}{}
+	if len(task.ExtraData) == 0 || json.Unmarshal(task.ExtraData, &extra) != nil {
+		return false
+	}
+	return extra.Source == consts.TaskSourceWebhookScan
+}
+
+func setCommitStatus(tplId models.Id, commitId string, status vcsrv.CommitStatus) (int, error) {
+	repo, err := GetVcsRepoByTplId(db.Get(), tplId)
+	if err != nil {
+		return 0, err
+	}
+	return repo.SetCommitStatus(commitId, status)
+}
+
+// 任务状态变更时将上报事件放入队列，由单个 worker 依次上报，保证同一任务的状态按顺序上报
+const (
+	commitStatusQueueSize  = 1024
+	commitStatusMaxRetry   = 5
+	commitStatusRetryDelay = time.Second
+)
+
+type commitStatusEvent struct {
+	taskId models.Id
+	isScan bool
+	status string // 触发上报时的任务状态
+	retry  int
+}
+
+var (
+	commitStatusQueue      = make(chan commitStatusEvent, commitStatusQueueSize)
+	commitStatusWorkerOnce sync.Once
+)
+
+func enqueueCommitStatus(ev commitStatusEvent) {
+	commitStatusWorkerOnce.Do(func() {
+		go commitStatusWorker()
+	})
+	select {
+	case commitStatusQueue <- ev:
+	default:
+		logs.Get().WithField("taskId", ev.taskId).Warnf("commit status queue is full, drop status '%s'", ev.status)
+	}
+}
+
+func commitStatusWorker() {
+	// 记录每个任务最后上报的状态，避免重复上报
+	reported := make(map[models.Id]string)
+	for ev := range commitStatusQueue {
+		reportCommitStatusEvent(ev, reported)
+	}
+}
+
+// reportCommitStatusEvent 上报前从数据库重新查询任务的当前状态(只能读取到已提交的数据)，
+// 与事件中的状态不一致时说明事务还未提交(或已回滚)，或者任务状态已经变更(由后续的事件上报)，
+// 此时延迟重试，超过重试次数后丢弃，保证不会上报过期或者被回滚的状态
+func reportCommitStatusEvent(ev commitStatusEvent, reported map[models.Id]string) {
+	logger := logs.Get().WithField("taskId", ev.taskId)
+
+	var (
+		base   *models.BaseTask
+		status *vcsrv.CommitStatus
+		tplId  models.Id
+		commit string
+	)
+	if ev.isScan {
+		task, err := GetScanTaskById(db.Get(), ev.taskId)
+		if err != nil {
+			// 任务可能在未提交的事务中创建
+			logger.Debugf("report commit status, get scan task err: %v", err)
+			retryCommitStatusEvent(ev)
+			return
+		}
+		base, tplId, commit = &task.BaseTask, task.TplId, task.CommitId
+		if base.Status == ev.status {
+			status = scanTaskCommitStatus(task)
+		}
+	} else {
+		task, err := GetTaskById(db.Get(), ev.taskId)
+		if err != nil {
+			logger.Debugf("report commit status, get task err: %v", err)
+			retryCommitStatusEvent(ev)
+			return
+		}
+		base, tplId, commit = &task.BaseTask, task.TplId, task.CommitId
+		if base.Status == ev.status {
+			status = taskCommitStatus(task)
+		}
+	}
+
+	if base.Status != ev.status {
+		retryCommitStatusEvent(ev)
+		return
+	}
+	if status == nil {
+		return
+	}
+
+	key := status.State + "\n" + status.Description
+	if reported[ev.taskId] == key {
+		return
+	}
+	status.Id = base.CommitStatusId
+	id, err := setCommitStatus(tplId, commit, *status)
+	if err != nil {
+		logger.Warnf("report commit status err: %v", err)
+		return
+	}
+	if base.Exited() {
+		delete(reported, ev.taskId)
+	} else {
+		reported[ev.taskId] = key
+	}
+
+	if id != base.CommitStatusId {
+		model := interface{}(&models.Task{})
+		if ev.isScan {
+			model = &models.ScanTask{}
+		}
+		if _, err := db.Get().Model(model).Where("id = ?", ev.taskId).
+			UpdateColumn("commit_status_id", id); err != nil {
+			logger.Errorf("update commit status id err: %v", err)
+		}
+	}
+}
+
+func retryCommitStatusEvent(ev commitStatusEvent) {
+	if ev.retry < commitStatusMaxRetry {
+		ev.retry++
+		time.AfterFunc(commitStatusRetryDelay, func() { enqueueCommitStatus(ev) })
+	}
+}
+
+// ReportTaskCommitStatus 将 webhook 触发的 plan、apply 任务的状态上报到 vcs 的 commit 状态，
+// 以便在分支保护规则中要求任务执行成功，其他来源的任务直接忽略。
+// 上报是异步进行的，在事务中调用时只有事务提交后的状态才会被上报
+func ReportTaskCommitStatus(task models.Task) {
+	if !isWebhookTask(&task) || task.CommitId == "" {
+		return
+	}
+	enqueueCommitStatus(commitStatusEvent{taskId: task.Id, status: task.Status})
+}
+
+func taskCommitStatus(task *models.Task) *vcsrv.CommitStatus {
+	env, err := GetEnvById(db.Get(), task.EnvId)
+	if err != nil {
+		logs.Get().WithField("taskId", task.Id).Errorf("report commit status, get env err: %v", err)
+		return nil
+	}
+	return &vcsrv.CommitStatus{
+		State:       commitState(task.Status),
+		Context:     fmt.Sprintf("cloudiac/%s (%s)", task.Type, env.Name),
+		Description: commitStatusDescription(task.Type, task.Status, string(task.Message)),
+		TargetUrl: fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s",
+			configs.Get().Portal.Address, task.OrgId, task.ProjectId, task.EnvId, task.Id),
+	}
+}
+
+// ReportScanTaskCommitStatus 上报 webhook 触发的云模板扫描任务状态
+func ReportScanTaskCommitStatus(task models.ScanTask) {
+	if !isWebhookScanTask(&task) || task.CommitId == "" {
+		return
+	}
+	enqueueCommitStatus(commitStatusEvent{taskId: task.Id, isScan: true, status: task.Status})
+}
+
+func scanTaskCommitStatus(task *models.ScanTask) *vcsrv.CommitStatus {
+	tpl, err := GetTemplateById(db.Get(), task.TplId)
+	if err != nil {
+		logs.Get().WithField("taskId", task.Id).Errorf("report commit status, get template err: %v", err)
+		return nil
+	}
+	return &vcsrv.CommitStatus{
+		State:       commitState(task.Status),
+		Context:     fmt.Sprintf("cloudiac/scan (%s)", tpl.Name),
+		Description: commitStatusDescription("scan", task.Status, string(task.Message)),
+		// 云模板扫描任务没有单独的详情页面，链接到组织首页
+		TargetUrl: fmt.Sprintf("%s/org/%s", configs.Get().Portal.Address, task.OrgId),
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/vcsrv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitState(t *testing.T) {
+	assert.Equal(t, vcsrv.CommitStatePending, commitState(common.TaskPending))
+	assert.Equal(t, vcsrv.CommitStatePending, commitState(common.TaskApproving))
+	assert.Equal(t, vcsrv.CommitStateRunning, commitState(common.TaskRunning))
+	assert.Equal(t, vcsrv.CommitStateSuccess, commitState(common.TaskComplete))
+	for _, s := range []string{common.TaskFailed, common.TaskRejected, common.TaskAborted} {
+		assert.Equal(t, vcsrv.CommitStateFailure, commitState(s))
+	}
+}
+
+func TestCommitStatusDescription(t *testing.T) {
+	assert.Equal(t, "CloudIaC plan running", commitStatusDescription("plan", common.TaskRunning, "ignored"))
+	assert.Equal(t, "CloudIaC apply failed: exit status 1",
+		commitStatusDescription("apply", common.TaskFailed, "exit status 1"))
+
+	desc := commitStatusDescription("plan", common.TaskFailed, strings.Repeat("错误", 100))
+	assert.Equal(t, commitStatusMaxDescription, len([]rune(desc)))
+	assert.True(t, strings.HasSuffix(desc, "..."))
+}
+
+func TestIsWebhookTask(t *testing.T) {
+	assert.True(t, isWebhookTask(&models.Task{Source: consts.TaskSourceWebhookPlan}))
+	assert.False(t, isWebhookTask(&models.Task{Source: consts.TaskSourceManual}))
+
+	assert.True(t, isWebhookScanTask(&models.ScanTask{ExtraData: models.JSON(`{"source":"webhookScan"}`)}))
+	assert.False(t, isWebhookScanTask(&models.ScanTask{ExtraData: models.JSON(`{"source":"manual"}`)}))
+	assert.False(t, isWebhookScanTask(&models.ScanTask{}))
+}
@@ -230,7 +230,8 @@ func ChangeEnvStatusWithTaskAndStep(tx *db.Session, id models.Id, task *models.T
 				return e.New(e.InternalError, errors.Wrap(err, "getEnvStatusOnTaskAborted"))
 			}
 		case models.TaskComplete:
-			if task.Type == models.TaskTypeApply {
+			// 导入资源后环境即管理了这些资源
+			if task.Type == models.TaskTypeApply || task.Type == models.TaskTypeImport {
 				envStatus = models.EnvStatusActive
 			} else if task.Type == models.TaskTypeDestroy {
 				envStatus = models.EnvStatusDestroyed
@@ -260,6 +261,11 @@ func ChangeEnvStatusWithTaskAndStep(tx *db.Session, id models.Id, task *models.T
 		}
 		return e.New(e.DBError, err)
 	}
+
+	// state 操作任务创建时锁定了环境，任务结束后解锁
+	if task.Exited() {
+		return EnvUnlockByTask(tx, id, task.Id)
+	}
 	return nil
 }
 
@@ -271,8 +277,9 @@ func getEnvStatusOnTaskAborted(db *db.Session, taskId models.Id) (string, error)
 	}
 
 	for _, s := range steps {
-		// 如果执行了 apply 步骤则环境变为 failed 状态
-		if (s.Type == models.TaskStepApply || s.Type == models.TaskStepDestroy) && s.IsStarted() {
+		// 如果执行了 apply、destroy、import、state 恢复或 state 操作步骤则环境变为 failed 状态
+		if (s.Type == models.TaskStepApply || s.Type == models.TaskStepDestroy || s.Type == models.TaskStepImport ||
+			s.Type == models.TaskStepStateRestore || s.Type == models.TaskStepStateOperation) && s.IsStarted() {
 			return models.EnvStatusFailed, nil
 		}
 	}
@@ -486,9 +493,33 @@ func CheckEnvTags(tags string) e.Error {
 }
 
 func EnvLock(dbSess *db.Session, id models.Id) e.Error {
+	// 手动锁定后任务结束时不再自动解锁
 	if _, err := dbSess.Model(models.Env{}).
 		Where("id =?", id).
-		UpdateColumn("locked", true); err != nil {
+		UpdateAttrs(models.Attrs{"locked": true, "locked_task_id": ""}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// EnvLockByTask 将未锁定的环境锁定到任务，用于执行期间需要独占环境的任务(如 state 操作)，
+// 环境已被锁定时返回 EnvLocked 错误
+func EnvLockByTask(dbSess *db.Session, id models.Id, taskId models.Id) e.Error {
+	affected, err := dbSess.Model(&models.Env{}).Where("id = ? AND locked = ?", id, false).
+		UpdateAttrs(models.Attrs{"locked": true, "locked_task_id": taskId})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if affected == 0 {
+		return e.New(e.EnvLocked)
+	}
+	return nil
+}
+
+// EnvUnlockByTask 解除任务对环境的锁定，环境未被该任务锁定(如已被手动解锁后重新锁定)时不做修改。
+// 任务结束(包括在 pending 状态被中止)时都需要调用
+func EnvUnlockByTask(dbSess *db.Session, id models.Id, taskId models.Id) e.Error {
+	if _, err := dbSess.Model(&models.Env{}).Where("id = ? AND locked_task_id = ?", id, taskId).
+		UpdateAttrs(models.Attrs{"locked": false, "locked_task_id": ""}); err != nil {
 		return e.New(e.DBError, err)
 	}
 	return nil
@@ -497,7 +528,7 @@ func EnvLock(dbSess *db.Session, id models.Id) e.Error {
 func EnvUnLocked(dbSess *db.Session, id models.Id) e.Error {
 	if _, err := dbSess.Model(models.Env{}).
 		Where("id =?", id).
-		UpdateColumn("locked", false); err != nil {
+		UpdateAttrs(models.Attrs{"locked": false, "locked_pr_id": 0, "locked_task_id": ""}); err != nil {
 		return e.New(e.DBError, err)
 	}
 	return nil
@@ -0,0 +1,176 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/utils"
+)
+
+// CopyEnvSettings 复制环境的部署配置(模板参数、审批、触发器、偏移检测、生命周期等)，
+// 不复制环境的标识、状态及任务相关字段
+func CopyEnvSettings(dst *models.Env, src *models.Env) {
+	dst.Description = src.Description
+	dst.Tags = src.Tags
+	dst.StepTimeout = src.StepTimeout
+
+	dst.TfVarsFile = src.TfVarsFile
+	dst.PlayVarsFile = src.PlayVarsFile
+	dst.Playbook = src.Playbook
+	dst.RunnerId = src.RunnerId
+	dst.RunnerTags = src.RunnerTags
+	dst.Revision = src.Revision
+	dst.KeyId = src.KeyId
+	dst.Workdir = src.Workdir
+	dst.IacEngine = src.IacEngine
+
+	dst.AutoApproval = src.AutoApproval
+	dst.StopOnViolation = src.StopOnViolation
+	dst.PolicyEnable = src.PolicyEnable
+	dst.PolicyEnforcement = src.PolicyEnforcement
+	dst.Targets = src.Targets
+
+	dst.TTL = src.TTL
+	dst.AutoDestroyCron = src.AutoDestroyCron
+	dst.AutoDeployCron = src.AutoDeployCron
+
+	dst.Triggers = src.Triggers
+	dst.TriggerFilter = src.TriggerFilter
+	dst.RetryAble = src.RetryAble
+	dst.RetryDelay = src.RetryDelay
+	dst.RetryNumber = src.RetryNumber
+
+	dst.CronDriftExpress = src.CronDriftExpress
+	dst.AutoRepairDrift = src.AutoRepairDrift
+	dst.OpenCronDrift = src.OpenCronDrift
+}
+
+// EnvSettingsAttrs 返回 CopyEnvSettings 复制的字段及由其计算的定时任务时间，用于更新已存在的环境
+func EnvSettingsAttrs(env *models.Env) models.Attrs {
+	return models.Attrs{
+		"description":    env.Description,
+		"tags":           env.Tags,
+		"step_timeout":   env.StepTimeout,
+		"tf_vars_file":   env.TfVarsFile,
+		"play_vars_file": env.PlayVarsFile,
+		"playbook":       env.Playbook,
+		"runner_id":      env.RunnerId,
+		"runner_tags":    env.RunnerTags,
+		"revision":       env.Revision,
+		"key_id":         env.KeyId,
+		"workdir":        env.Workdir,
+		"iac_engine":     env.IacEngine,
+
+		"auto_approval":     env.AutoApproval,
+		"stop_on_violation": env.StopOnViolation,
+		"policy_enable":     env.PolicyEnable,
+		"targets":           env.Targets,
+
+		"policy_enforcement": env.PolicyEnforcement,
+
+		"ttl":               env.TTL,
+		"auto_destroy_cron": env.AutoDestroyCron,
+		"auto_destroy_at":   env.AutoDestroyAt,
+		"auto_deploy_cron":  env.AutoDeployCron,
+		"auto_deploy_at":    env.AutoDeployAt,
+
+		"triggers":       env.Triggers,
+		"trigger_filter": env.TriggerFilter,
+		"retry_able":     env.RetryAble,
+		"retry_delay":    env.RetryDelay,
+		"retry_number":   env.RetryNumber,
+
+		"cron_drift_express":   env.CronDriftExpress,
+		"auto_repair_drift":    env.AutoRepairDrift,
+		"open_cron_drift":      env.OpenCronDrift,
+		"next_drift_task_time": env.NextDriftTaskTime,
+	}
+}
+
+// CopyEnvVars 使用 src 环境的变量替换 dst 环境的变量，敏感变量解密后使用新的密文保存
+func CopyEnvVars(tx *db.Session, dst *models.Env, src *models.Env) e.Error {
+	srcVars := make([]models.Variable, 0)
+	if err := WithVarScopeIdWhere(tx, models.Variable{}.TableName(), consts.ScopeEnv, src.Id).
+		Find(&srcVars); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	vars := make([]models.Variable, 0, len(srcVars))
+	for _, v := range srcVars {
+		if v.Sensitive && v.Value != "" {
+			// UpdateObjectVars 会对敏感变量的明文重新加密
+			plain, err := utils.DecryptSecretVarForce(string(v.Value))
+			if err != nil {
+				return e.New(e.InternalError, err)
+			}
+			v.Value = models.Text(plain)
+		}
+		v.Id = ""
+		v.OrgId = dst.OrgId
+		v.ProjectId = dst.ProjectId
+		v.TplId = dst.TplId
+		v.EnvId = dst.Id
+		vars = append(vars, v)
+	}
+
+	_, err := UpdateObjectVars(tx, consts.ScopeEnv, dst.Id, vars)
+	return err
+}
+
+// CopyEnvVarGroupRels 使用 src 环境关联的变量组替换 dst 环境的变量组，变量组需要授权给 dst 所在项目
+func CopyEnvVarGroupRels(tx *db.Session, dst *models.Env, src *models.Env) e.Error {
+	srcIds, err := getEnvVarGroupIds(tx, src.Id)
+	if err != nil {
+		return err
+	}
+	dstIds, err := getEnvVarGroupIds(tx, dst.Id)
+	if err != nil {
+		return err
+	}
+	return BatchUpdateVarGroupObjectRel(tx, srcIds, dstIds, consts.ScopeEnv, dst.Id)
+}
+
+func getEnvVarGroupIds(sess *db.Session, envId models.Id) ([]models.Id, e.Error) {
+	ids := make([]models.Id, 0)
+	if err := sess.Model(&models.VariableGroupRel{}).
+		Where("object_type = ? AND object_id = ?", consts.ScopeEnv, envId).
+		Pluck("var_group_id", &ids); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return ids, nil
+}
+
+// CopyEnvPolicyRels 使用 src 环境绑定的策略组替换 dst 环境的策略组
+func CopyEnvPolicyRels(tx *db.Session, dst *models.Env, src *models.Env) e.Error {
+	groupIds := make([]models.Id, 0)
+	if err := tx.Model(&models.PolicyRel{}).
+		Where("scope = ? AND env_id = ? AND group_id != ''", consts.ScopeEnv, src.Id).
+		Pluck("group_id", &groupIds); err != nil {
+		return e.New(e.DBError, err)
+	}
+	_, err := UpdatePolicyRel(tx, &forms.UpdatePolicyRelForm{
+		Id:             dst.Id,
+		Scope:          consts.ScopeEnv,
+		PolicyGroupIds: groupIds,
+	})
+	return err
+}
+
+// GetEnvLastSuccessApplyTask 查询环境最后一次执行成功的部署任务，不存在时返回 nil
+func GetEnvLastSuccessApplyTask(sess *db.Session, envId models.Id) (*models.Task, e.Error) {
+	task := models.Task{}
+	err := sess.Where("env_id = ? AND `type` = ? AND status = ?", envId, common.TaskTypeApply, common.TaskComplete).
+		Order("created_at DESC").First(&task)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &task, nil
+}
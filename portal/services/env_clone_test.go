@@ -0,0 +1,59 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyEnvSettings(t *testing.T) {
+	src := models.Env{
+		OrgId:            "org-1",
+		ProjectId:        "p-dev",
+		TplId:            "tpl-1",
+		Name:             "dev",
+		Status:           models.EnvStatusActive,
+		Revision:         "v1.2.0",
+		TfVarsFile:       "dev.tfvars",
+		AutoApproval:     true,
+		StopOnViolation:  true,
+		TTL:              "1d",
+		Triggers:         models.StringArray{"commit"},
+		TriggerFilter:    models.TriggerFilter{Branches: []string{"main"}},
+		CronDriftExpress: "*/10 * * * *",
+		OpenCronDrift:    true,
+		LastTaskId:       "run-1",
+		Locked:           true,
+	}
+	src.Id = "env-dev"
+
+	dst := models.Env{OrgId: "org-1", ProjectId: "p-prod", TplId: "tpl-1", Name: "prod", Status: models.EnvStatusInactive}
+	dst.Id = "env-prod"
+	CopyEnvSettings(&dst, &src)
+
+	// 复制部署配置
+	assert.Equal(t, "v1.2.0", dst.Revision)
+	assert.Equal(t, "dev.tfvars", dst.TfVarsFile)
+	assert.True(t, dst.AutoApproval)
+	assert.True(t, dst.StopOnViolation)
+	assert.Equal(t, "1d", dst.TTL)
+	assert.Equal(t, src.Triggers, dst.Triggers)
+	assert.Equal(t, src.TriggerFilter, dst.TriggerFilter)
+	assert.True(t, dst.OpenCronDrift)
+
+	// 不复制标识、状态及任务相关字段
+	assert.Equal(t, models.Id("env-prod"), dst.Id)
+	assert.Equal(t, models.Id("p-prod"), dst.ProjectId)
+	assert.Equal(t, "prod", dst.Name)
+	assert.Equal(t, models.EnvStatusInactive, dst.Status)
+	assert.Equal(t, models.Id(""), dst.LastTaskId)
+	assert.False(t, dst.Locked)
+
+	attrs := EnvSettingsAttrs(&dst)
+	assert.Equal(t, "v1.2.0", attrs["revision"])
+	assert.NotContains(t, attrs, "name")
+	assert.NotContains(t, attrs, "status")
+}
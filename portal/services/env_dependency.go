@@ -0,0 +1,333 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// QueryEnvDependency 查询环境依赖的上游环境
+func QueryEnvDependency(query *db.Session, envId models.Id) *db.Session {
+	t := models.EnvDependency{}.TableName()
+	return query.Model(&models.EnvDependency{}).
+		Joins("LEFT JOIN iac_env AS env ON env.id = "+t+".depends_on_env_id").
+		Where(t+".env_id = ?", envId).
+		LazySelectAppend(t + ".*, env.name AS depends_on_env_name").
+		Order("env.name")
+}
+
+func GetEnvDependencies(sess *db.Session, envId models.Id) ([]models.EnvDependency, e.Error) {
+	deps := make([]models.EnvDependency, 0)
+	if err := sess.Where("env_id = ?", envId).Find(&deps); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return deps, nil
+}
+
+// ReplaceEnvDependencies 使用 deps 替换环境的所有上游依赖，上游环境必须与环境属于同一项目且依赖关系不能成环
+func ReplaceEnvDependencies(tx *db.Session, env *models.Env, deps []models.EnvDependency) e.Error {
+	projectDeps := make([]models.EnvDependency, 0)
+	if err := tx.Where("project_id = ? AND env_id != ?", env.ProjectId, env.Id).Find(&projectDeps); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	edges := make(map[models.Id][]models.Id)
+	for _, d := range projectDeps {
+		edges[d.EnvId] = append(edges[d.EnvId], d.DependsOnEnvId)
+	}
+	for i := range deps {
+		upstream, err := GetEnvById(tx, deps[i].DependsOnEnvId)
+		if err != nil {
+			return err
+		}
+		if upstream.ProjectId != env.ProjectId || upstream.Archived {
+			return e.New(e.EnvNotExists, fmt.Errorf("upstream environment %s not found in project", upstream.Id))
+		}
+		edges[env.Id] = append(edges[env.Id], upstream.Id)
+	}
+	if cycle := FindEnvDependencyCycle(edges); len(cycle) > 0 {
+		return e.New(e.EnvDependencyCycle, fmt.Errorf("dependency cycle: %v", cycle))
+	}
+
+	if _, err := tx.Where("env_id = ?", env.Id).Delete(&models.EnvDependency{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	for i := range deps {
+		deps[i].Id = deps[i].NewId()
+		deps[i].OrgId = env.OrgId
+		deps[i].ProjectId = env.ProjectId
+		deps[i].EnvId = env.Id
+		if err := models.Create(tx, &deps[i]); err != nil {
+			if e.IsDuplicate(err) {
+				return e.New(e.ObjectAlreadyExists, err)
+			}
+			return e.New(e.DBError, err)
+		}
+	}
+	return nil
+}
+
+// DeleteEnvDependencies 删除环境相关的依赖关系(环境作为上游或下游)
+func DeleteEnvDependencies(tx *db.Session, envId models.Id) e.Error {
+	if _, err := tx.Where("env_id = ? OR depends_on_env_id = ?", envId, envId).
+		Delete(&models.EnvDependency{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// FindEnvDependencyCycle 检查依赖图中是否存在环，edges 为环境到其上游环境的映射，
+// 存在环时返回环上的环境(首尾为同一环境)，否则返回 nil
+func FindEnvDependencyCycle(edges map[models.Id][]models.Id) []models.Id {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[models.Id]int)
+	path := make([]models.Id, 0)
+
+	var visit func(id models.Id) []models.Id
+	visit = func(id models.Id) []models.Id {
+		state[id] = visiting
+		path = append(path, id)
+		for _, next := range edges[id] {
+			switch state[next] {
+			case visiting:
+				for i := range path {
+					if path[i] == next {
+						return append(append([]models.Id{}, path[i:]...), next)
+					}
+				}
+			case 0:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		return nil
+	}
+
+	// 按 id 排序遍历保证结果稳定
+	ids := make([]string, 0, len(edges))
+	for id := range edges {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if state[models.Id(id)] == 0 {
+			if cycle := visit(models.Id(id)); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// GetEnvDependencyGraph 查询环境所在的依赖图(与环境直接或间接关联的所有环境)
+func GetEnvDependencyGraph(sess *db.Session, env *models.Env) (*resps.EnvDependencyGraphResp, e.Error) {
+	projectDeps := make([]models.EnvDependency, 0)
+	if err := sess.Where("project_id = ?", env.ProjectId).Find(&projectDeps); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	adjacent := make(map[models.Id][]models.Id)
+	for _, d := range projectDeps {
+		adjacent[d.EnvId] = append(adjacent[d.EnvId], d.DependsOnEnvId)
+		adjacent[d.DependsOnEnvId] = append(adjacent[d.DependsOnEnvId], d.EnvId)
+	}
+	nodeIds := map[models.Id]bool{env.Id: true}
+	queue := []models.Id{env.Id}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacent[id] {
+			if !nodeIds[next] {
+				nodeIds[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	ids := make([]models.Id, 0, len(nodeIds))
+	for id := range nodeIds {
+		ids = append(ids, id)
+	}
+	graph := &resps.EnvDependencyGraphResp{
+		Nodes: make([]resps.EnvDependencyNode, 0),
+		Edges: make([]resps.EnvDependencyEdge, 0),
+	}
+	if err := sess.Model(&models.Env{}).Where("id IN (?)", ids).Order("name").
+		Scan(&graph.Nodes); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, d := range projectDeps {
+		if nodeIds[d.EnvId] {
+			graph.Edges = append(graph.Edges, resps.EnvDependencyEdge{
+				From:        d.DependsOnEnvId,
+				To:          d.EnvId,
+				Outputs:     d.Outputs,
+				TriggerType: d.TriggerType,
+			})
+		}
+	}
+	return graph, nil
+}
+
+// GetEnvDependencyVars 获取上游环境输出映射的 terraform 变量，
+// strict 为 true 时上游环境输出不存在则返回错误，否则忽略该变量
+func GetEnvDependencyVars(sess *db.Session, envId models.Id, strict bool) (map[string]string, e.Error) {
+	deps, err := GetEnvDependencies(sess, envId)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string)
+	for _, dep := range deps {
+		upstream, err := GetEnvById(sess, dep.DependsOnEnvId)
+		if err != nil {
+			return nil, err
+		}
+		outputs := map[string]interface{}{}
+		if upstream.LastResTaskId != "" {
+			task, err := GetTaskById(sess, upstream.LastResTaskId)
+			if err != nil {
+				return nil, err
+			}
+			if task.Result.Outputs != nil {
+				outputs = task.Result.Outputs
+			}
+		}
+
+		for _, m := range dep.Outputs {
+			output, ok := outputs[m.Output]
+			if !ok {
+				if strict {
+					return nil, e.New(e.EnvDependencyOutput,
+						fmt.Errorf("output '%s' of environment '%s' not exists", m.Output, upstream.Name))
+				}
+				continue
+			}
+			value, sensitive, er := envOutputVarValue(output)
+			if er != nil {
+				return nil, e.New(e.InternalError, er)
+			}
+			if sensitive {
+				if value, er = utils.EncryptSecretVar(value); er != nil {
+					return nil, e.New(e.InternalError, er)
+				}
+			}
+			vars[m.Variable] = value
+		}
+	}
+	return vars, nil
+}
+
+// envOutputVarValue 将环境输出转换为 terraform 变量值，字符串直接使用，其他类型使用 json 编码
+func envOutputVarValue(output interface{}) (value string, sensitive bool, err error) {
+	var v TfStateVariable
+	bs, err := json.Marshal(output)
+	if err != nil {
+		return "", false, err
+	}
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return "", false, err
+	}
+
+	if s, ok := v.Value.(string); ok {
+		return s, v.Sensitive, nil
+	}
+	bs, err = json.Marshal(v.Value)
+	if err != nil {
+		return "", false, err
+	}
+	return string(bs), v.Sensitive, nil
+}
+
+// TriggerDownstreamEnvTasks 环境部署成功后为配置了触发的下游环境创建 plan 或 apply 任务
+func TriggerDownstreamEnvTasks(sess *db.Session, task *models.Task) {
+	logger := logs.Get().WithField("action", "triggerDownstream").WithField("envId", task.EnvId)
+
+	deps := make([]models.EnvDependency, 0)
+	if err := sess.Where("depends_on_env_id = ? AND trigger_type != ''", task.EnvId).Find(&deps); err != nil {
+		logger.Errorf("query downstream envs error: %v", err)
+		return
+	}
+	for _, dep := range deps {
+		if _, err := createDownstreamEnvTask(sess, dep); err != nil {
+			logger.WithField("downstreamEnvId", dep.EnvId).Errorf("create downstream env task error: %v", err)
+		}
+	}
+}
+
+func createDownstreamEnvTask(sess *db.Session, dep models.EnvDependency) (*models.Task, e.Error) {
+	env, err := GetEnvById(sess, dep.EnvId)
+	if err != nil {
+		return nil, err
+	}
+	// 已归档、已锁定、未部署或已销毁的环境不触发
+	if env.Archived || env.Locked || env.Status == models.EnvStatusInactive || env.Status == models.EnvStatusDestroyed {
+		return nil, nil
+	}
+
+	tx := sess.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	tpl, err := GetTemplateById(tx, env.TplId)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	vars, er := GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if er != nil {
+		_ = tx.Rollback()
+		return nil, e.AutoNew(er, e.DBError)
+	}
+
+	taskType, autoApprove := common.TaskTypePlan, false
+	if dep.TriggerType == models.EnvDependencyTriggerApply {
+		taskType, autoApprove = common.TaskTypeApply, env.AutoApproval
+	}
+	task, err := CreateTask(tx, tpl, env, models.Task{
+		Name:            consts.TaskEnvDependencyName,
+		Targets:         env.Targets,
+		CreatorId:       consts.SysUserId,
+		KeyId:           env.KeyId,
+		Variables:       vars,
+		AutoApprove:     autoApprove,
+		Revision:        env.Revision,
+		StopOnViolation: env.StopOnViolation,
+		ExtraData:       env.ExtraData,
+		BaseTask: models.BaseTask{
+			Type:        taskType,
+			StepTimeout: env.StepTimeout,
+			RunnerId:    env.RunnerId,
+		},
+		Source: consts.TaskSourceEnvDependency,
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return task, nil
+}
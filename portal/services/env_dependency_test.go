@@ -0,0 +1,61 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindEnvDependencyCycle(t *testing.T) {
+	assert.Nil(t, FindEnvDependencyCycle(nil))
+	assert.Nil(t, FindEnvDependencyCycle(map[models.Id][]models.Id{
+		"env-app": {"env-net", "env-db"},
+		"env-db":  {"env-net"},
+	}))
+
+	assert.Equal(t, []models.Id{"env-a", "env-a"}, FindEnvDependencyCycle(map[models.Id][]models.Id{
+		"env-a": {"env-a"},
+	}))
+	assert.Equal(t, []models.Id{"env-a", "env-b", "env-c", "env-a"}, FindEnvDependencyCycle(map[models.Id][]models.Id{
+		"env-a": {"env-b"},
+		"env-b": {"env-c"},
+		"env-c": {"env-a"},
+		"env-d": {"env-a"},
+	}))
+}
+
+func TestEnvOutputVarValue(t *testing.T) {
+	// task.Result.Outputs 从数据库读取后为 map 结构
+	var outputs map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"vpc_id": {"value": "vpc-123"},
+		"port": {"value": 8080},
+		"subnets": {"value": ["a", "b"]},
+		"password": {"value": "secret", "sensitive": true}
+	}`), &outputs))
+
+	cases := []struct {
+		name      string
+		value     string
+		sensitive bool
+	}{
+		{"vpc_id", "vpc-123", false},
+		{"port", "8080", false},
+		{"subnets", `["a","b"]`, false},
+		{"password", "secret", true},
+	}
+	for _, c := range cases {
+		value, sensitive, err := envOutputVarValue(outputs[c.name])
+		assert.NoError(t, err)
+		assert.Equal(t, c.value, value, c.name)
+		assert.Equal(t, c.sensitive, sensitive, c.name)
+	}
+
+	value, _, err := envOutputVarValue(TfStateVariable{Value: map[string]interface{}{"k": "v"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"k":"v"}`, value)
+}
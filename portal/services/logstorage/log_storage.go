@@ -3,14 +3,19 @@
 package logstorage
 
 import (
+	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/libs/db"
+	"fmt"
 	"sync"
 )
 
 type LogStorage interface {
 	Write(path string, content []byte) error
 	Read(path string) ([]byte, error)
+	// ReadRange 读取 offset 开始的最多 limit 字节内容，offset 超出内容长度时返回空内容，
+	// 文件不存在时返回 os.ErrNotExist
+	ReadRange(path string, offset int64, limit int64) ([]byte, error)
 }
 
 var (
@@ -21,17 +26,53 @@ var (
 func Get() LogStorage {
 	initOnce.Do(func() {
 		if logStorage == nil {
-			logStorage = &dBLogStorage{db: db.Get()}
+			var err error
+			logStorage, err = New(configs.Get().LogStorage)
+			if err != nil {
+				panic(fmt.Errorf("init log storage error: %v", err))
+			}
 		}
 	})
 	return logStorage
 }
 
+// New 根据配置创建日志存储
+func New(conf configs.LogStorageConfig) (LogStorage, error) {
+	switch conf.GetType() {
+	case consts.LogStorageTypeDB:
+		return &dBLogStorage{db: db.Get()}, nil
+	case consts.LogStorageTypeFS:
+		return newFSLogStorage(conf.Path)
+	case consts.LogStorageTypeS3:
+		return newS3LogStorage(conf.S3)
+	default:
+		return nil, fmt.Errorf("unknown log storage type '%s'", conf.Type)
+	}
+}
+
 // CutLogContent 判断内容日志长度是否超限，若超限则截断(保留最新内容)
+// 只有 db 存储需要截断，其他存储类型保存完整日志
 func CutLogContent(content []byte) []byte {
+	if configs.Get().LogStorage.GetType() != consts.LogStorageTypeDB {
+		return content
+	}
+
 	size := len(content)
 	if size > consts.MaxLogContentSize {
 		content = content[size-consts.MaxLogContentSize:]
 	}
 	return content
 }
+
+// sliceRange 从完整内容中截取 ReadRange 需要的部分
+func sliceRange(content []byte, offset int64, limit int64) []byte {
+	size := int64(len(content))
+	if offset >= size {
+		return []byte{}
+	}
+	end := size
+	if limit >= 0 && offset+limit < size {
+		end = offset + limit
+	}
+	return content[offset:end]
+}
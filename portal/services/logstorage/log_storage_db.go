@@ -60,3 +60,11 @@ func (s *dBLogStorage) Read(path string) ([]byte, error) {
 	}
 	return dbLog.Content, nil
 }
+
+func (s *dBLogStorage) ReadRange(path string, offset int64, limit int64) ([]byte, error) {
+	content, err := s.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return sliceRange(content, offset, limit), nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package logstorage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fsLogStorage 将日志保存到本地文件系统(或挂载的共享存储)，path 做为 root 下的相对路径
+type fsLogStorage struct {
+	root string
+}
+
+func newFSLogStorage(root string) (LogStorage, error) {
+	if root == "" {
+		return nil, fmt.Errorf("log storage path is empty")
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(absRoot, 0755); err != nil {
+		return nil, errors.Wrap(err, "create log storage dir")
+	}
+	return &fsLogStorage{root: absRoot}, nil
+}
+
+func (s *fsLogStorage) fullPath(path string) (string, error) {
+	p := filepath.Join(s.root, filepath.FromSlash(filepath.Clean("/"+path)))
+	if !strings.HasPrefix(p, s.root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid path '%s'", path)
+	}
+	return p, nil
+}
+
+func (s *fsLogStorage) Write(path string, content []byte) error {
+	p, err := s.fullPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	// 先写临时文件再 rename，避免读取到写了一半的内容
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil { //nolint:gosec
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *fsLogStorage) Read(path string) ([]byte, error) {
+	p, err := s.fullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (s *fsLogStorage) ReadRange(path string, offset int64, limit int64) ([]byte, error) {
+	p, err := s.fullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	if _, err := fp.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var reader io.Reader = fp
+	if limit >= 0 {
+		reader = io.LimitReader(fp, limit)
+	}
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package logstorage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFSLogStorage(t *testing.T) {
+	storage, err := newFSLogStorage(t.TempDir())
+	assert.NoError(t, err)
+
+	path := "logs/env-1/run-1/step0/content.log"
+	assert.NoError(t, storage.Write(path, []byte("hello world")))
+
+	content, err := storage.Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	cases := []struct {
+		offset int64
+		limit  int64
+		expect string
+	}{
+		{0, 5, "hello"},
+		{6, -1, "world"},
+		{6, 100, "world"},
+		{11, 5, ""},
+		{100, 5, ""},
+	}
+	for _, c := range cases {
+		content, err = storage.ReadRange(path, c.offset, c.limit)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expect, string(content))
+	}
+
+	_, err = storage.Read("logs/not-exists.log")
+	assert.True(t, os.IsNotExist(err))
+	_, err = storage.ReadRange("logs/not-exists.log", 0, 10)
+	assert.True(t, os.IsNotExist(err))
+
+	// 不允许访问存储目录之外的文件
+	assert.NoError(t, storage.Write("../escape.log", []byte("x")))
+	content, err = storage.Read("escape.log")
+	assert.NoError(t, err)
+	assert.Equal(t, "x", string(content))
+}
+
+func TestSliceRange(t *testing.T) {
+	content := []byte("0123456789")
+	assert.Equal(t, "0123456789", string(sliceRange(content, 0, -1)))
+	assert.Equal(t, "234", string(sliceRange(content, 2, 3)))
+	assert.Equal(t, "89", string(sliceRange(content, 8, 5)))
+	assert.Equal(t, "", string(sliceRange(content, 10, 5)))
+}
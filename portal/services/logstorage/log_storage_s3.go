@@ -0,0 +1,120 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package logstorage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+
+	"cloudiac/configs"
+)
+
+// s3LogStorage 将日志保存到 s3 兼容的对象存储(aws s3、minio 等)，path 做为对象 key
+type s3LogStorage struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func newS3LogStorage(conf configs.S3Config) (LogStorage, error) {
+	if conf.Bucket == "" {
+		return nil, fmt.Errorf("log storage s3 bucket is empty")
+	}
+
+	region := conf.Region
+	if region == "" {
+		// minio 等兼容存储不校验 region，但 sdk 要求必须设置
+		region = "us-east-1"
+	}
+	awsConf := aws.NewConfig().
+		WithRegion(region).
+		WithDisableSSL(conf.DisableSSL).
+		WithS3ForcePathStyle(conf.ForcePathStyle)
+	if conf.Endpoint != "" {
+		awsConf = awsConf.WithEndpoint(conf.Endpoint)
+	}
+	if conf.AccessKeyId != "" {
+		awsConf = awsConf.WithCredentials(
+			credentials.NewStaticCredentials(conf.AccessKeyId, conf.SecretAccessKey, ""))
+	}
+
+	sess, err := session.NewSession(awsConf)
+	if err != nil {
+		return nil, errors.Wrap(err, "create s3 session")
+	}
+	return &s3LogStorage{
+		client: s3.New(sess),
+		bucket: conf.Bucket,
+		prefix: strings.Trim(conf.Prefix, "/"),
+	}, nil
+}
+
+func (s *s3LogStorage) key(path string) string {
+	path = strings.TrimLeft(path, "/")
+	if s.prefix == "" {
+		return path
+	}
+	return s.prefix + "/" + path
+}
+
+func (s *s3LogStorage) Write(path string, content []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(path)),
+		Body:   bytes.NewReader(content),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "put object %s", s.key(path))
+	}
+	return nil
+}
+
+func (s *s3LogStorage) Read(path string) ([]byte, error) {
+	return s.getObject(path, nil)
+}
+
+func (s *s3LogStorage) ReadRange(path string, offset int64, limit int64) ([]byte, error) {
+	if limit == 0 {
+		return []byte{}, nil
+	}
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if limit > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+limit-1)
+	}
+	return s.getObject(path, aws.String(byteRange))
+}
+
+func (s *s3LogStorage) getObject(path string, byteRange *string) ([]byte, error) {
+	output, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(path)),
+		Range:  byteRange,
+	})
+	if err != nil {
+		var reqErr awserr.RequestFailure
+		if errors.As(err, &reqErr) {
+			switch {
+			case reqErr.Code() == s3.ErrCodeNoSuchKey || reqErr.StatusCode() == http.StatusNotFound:
+				return nil, os.ErrNotExist
+			case reqErr.StatusCode() == http.StatusRequestedRangeNotSatisfiable:
+				// offset 超出对象大小
+				return []byte{}, nil
+			}
+		}
+		return nil, errors.Wrapf(err, "get object %s", s.key(path))
+	}
+	defer output.Body.Close()
+
+	return ioutil.ReadAll(output.Body)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package logstorage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"cloudiac/configs"
+)
+
+// s3Stub 模拟 s3 的 PutObject、GetObject 接口(path style)，支持 Range 请求头
+type s3Stub struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		s.objects[key] = body
+	case http.MethodGet:
+		content, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			size := len(content)
+			if n, _ := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); n < 2 || end >= size {
+				end = size - 1
+			}
+			if start >= size {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				fmt.Fprint(w, `<Error><Code>InvalidRange</Code><Message>invalid range</Message></Error>`)
+				return
+			}
+			content = content[start : end+1]
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		_, _ = w.Write(content)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3LogStorage(t *testing.T) {
+	stub := &s3Stub{objects: make(map[string][]byte)}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	storage, err := newS3LogStorage(configs.S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "iac",
+		Prefix:          "/logs/",
+		AccessKeyId:     "ak",
+		SecretAccessKey: "sk",
+		DisableSSL:      true,
+		ForcePathStyle:  true,
+	})
+	assert.NoError(t, err)
+
+	path := "env-1/run-1/step0/content.log"
+	assert.NoError(t, storage.Write(path, []byte("hello world")))
+	assert.Equal(t, "hello world", string(stub.objects["iac/logs/env-1/run-1/step0/content.log"]))
+
+	content, err := storage.Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	cases := []struct {
+		offset int64
+		limit  int64
+		expect string
+	}{
+		{0, 5, "hello"},
+		{6, -1, "world"},
+		{6, 100, "world"},
+		{6, 0, ""},
+		{11, 5, ""},
+		{100, 5, ""},
+	}
+	for _, c := range cases {
+		content, err = storage.ReadRange(path, c.offset, c.limit)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expect, string(content))
+	}
+
+	_, err = storage.Read("not-exists.log")
+	assert.True(t, os.IsNotExist(err))
+	_, err = storage.ReadRange("not-exists.log", 0, 10)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = newS3LogStorage(configs.S3Config{})
+	assert.Error(t, err)
+}
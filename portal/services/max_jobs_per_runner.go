@@ -7,11 +7,21 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/utils"
+	"cloudiac/utils/consulClient"
 	"cloudiac/utils/logs"
+	"strconv"
+	"strings"
 )
 
 var runnerMax int
 
+const (
+	// RunnerMaxJobsTagPrefix runner 通过注册 "max_jobs=N" 格式的 tag 声明自己的并发任务数量
+	RunnerMaxJobsTagPrefix = "max_jobs="
+	// RunnerMaxJobsKVSuffix runner 的并发任务数量也可以保存在 consul kv 的 "<runnerId>/max_jobs" 中，优先级高于 tag
+	RunnerMaxJobsKVSuffix = "/max_jobs"
+)
+
 func GetRunnerMax() int {
 	return runnerMax
 }
@@ -32,3 +42,44 @@ func MaintenanceRunnerPerMax() {
 		UpdateRunnerMax(utils.Str2int(systemCfg.Value))
 	}
 }
+
+// GetRunnersMaxJobs 获取所有可用 runner 在 consul 中声明的并发任务数量，未声明的 runner 不在返回结果中
+func GetRunnersMaxJobs() (map[string]int, e.Error) {
+	runners, er := RunnerSearch()
+	if er != nil {
+		return nil, er
+	}
+	client, err := consulClient.NewConsulClient()
+	if err != nil {
+		return nil, e.New(e.ConsulConnError, err)
+	}
+
+	maxJobs := make(map[string]int)
+	for _, r := range runners {
+		if n := ParseRunnerMaxJobsTags(r.Tags); n > 0 {
+			maxJobs[r.ID] = n
+		}
+
+		pair, _, err := client.KV().Get(r.ID+RunnerMaxJobsKVSuffix, nil)
+		if err != nil {
+			return nil, e.New(e.ConsulConnError, err)
+		}
+		if pair != nil {
+			if n, _ := strconv.Atoi(strings.TrimSpace(string(pair.Value))); n > 0 {
+				maxJobs[r.ID] = n
+			}
+		}
+	}
+	return maxJobs, nil
+}
+
+// ParseRunnerMaxJobsTags 从 runner tags 中解析并发任务数量，未设置或设置错误时返回 0
+func ParseRunnerMaxJobsTags(tags []string) int {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, RunnerMaxJobsTagPrefix) {
+			n, _ := strconv.Atoi(strings.TrimPrefix(tag, RunnerMaxJobsTagPrefix))
+			return n
+		}
+	}
+	return 0
+}
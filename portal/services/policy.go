@@ -117,6 +117,7 @@ func GetTaskPolicies(query *db.Session, task models.Tasker) ([]runner.TaskPolicy
 			Category:     category,
 			Version:      p.Revision,
 			Id:           string(p.Id),
+			InputType:    p.InputType,
 		}
 		taskPolicies = append(taskPolicies, runner.TaskPolicy{
 			PolicyId: string(p.Id),
@@ -716,16 +717,19 @@ func PolicyTargetSuppressSummary(query *db.Session, ids []models.Id, scope strin
 	case consts.ScopeTemplate:
 		key = "tpl_id"
 	}
+	now := time.Now()
 	// 按来源屏蔽记录
 	suppressBySourceQuery := query.Model(models.PolicySuppress{}).
 		Select("policy_id, target_id, target_type").
-		Where("iac_policy_suppress.target_type= ? and iac_policy_suppress.target_id in (?)", scope, ids)
+		Where("iac_policy_suppress.target_type= ? and iac_policy_suppress.target_id in (?)", scope, ids).
+		Where(policySuppressActiveCond("iac_policy_suppress"), now)
 	// 按策略屏蔽记录
 	suppressByPolicyQuery := query.Model(models.Policy{}).
 		Select(fmt.Sprintf("iac_policy.id as policy_id, iac_policy_rel.%s as target_id, iac_policy_suppress.target_type", key)).
 		Joins("JOIN iac_policy_rel on iac_policy_rel.group_id = iac_policy.group_id").
 		Joins("JOIN iac_policy_suppress on iac_policy.id = iac_policy_suppress.target_id").
-		Where(fmt.Sprintf("iac_policy_rel.%s in (?)", key), ids)
+		Where(fmt.Sprintf("iac_policy_rel.%s in (?)", key), ids).
+		Where(policySuppressActiveCond("iac_policy_suppress"), now)
 	// 合并屏蔽记录
 	distinctQuery := query.Table("((?) union (?)) as st", suppressBySourceQuery.Expr(), suppressByPolicyQuery.Expr()).
 		Select("DISTINCT policy_id, target_id")
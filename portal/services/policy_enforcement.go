@@ -0,0 +1,228 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+)
+
+// CheckPolicyEnforcement 检查合规检测分级处理配置，处理方式只能为 block/approve/warn，必须通过的策略组需要存在
+func CheckPolicyEnforcement(query *db.Session, orgId models.Id, pe models.PolicyEnforcement) e.Error {
+	for _, action := range []string{pe.High, pe.Medium, pe.Low} {
+		switch action {
+		case "", common.PolicyEnforceBlock, common.PolicyEnforceApprove, common.PolicyEnforceWarn:
+		default:
+			return e.New(e.BadParam, fmt.Errorf("invalid policy enforcement action '%s'", action), http.StatusBadRequest)
+		}
+	}
+
+	for _, groupId := range pe.RequiredGroups {
+		group, err := GetPolicyGroupById(query, groupId)
+		if err != nil {
+			return e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		if group.OrgId != orgId {
+			return e.New(e.PolicyGroupNotExist, http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// CheckEnvRequiredPolicyGroups 检查必须通过的策略组已绑定到环境，且环境开启了合规检测，否则部署无法进入审批
+func CheckEnvRequiredPolicyGroups(query *db.Session, env *models.Env, groups []models.Id) e.Error {
+	if len(groups) == 0 {
+		return nil
+	}
+	if !env.PolicyEnable {
+		return e.New(e.PolicyScanNotEnabled,
+			fmt.Errorf("policy scan of env '%s' is not enabled, required policy groups can not be scanned", env.Id),
+			http.StatusBadRequest)
+	}
+
+	bound := make([]models.Id, 0)
+	if err := query.Model(&models.PolicyRel{}).Where("env_id = ? AND scope = ? AND group_id IN (?)",
+		env.Id, consts.ScopeEnv, groups).Pluck("group_id", &bound); err != nil {
+		return e.New(e.DBError, err)
+	}
+	boundSet := make(map[models.Id]bool, len(bound))
+	for _, groupId := range bound {
+		boundSet[groupId] = true
+	}
+	for _, groupId := range groups {
+		if !boundSet[groupId] {
+			return e.New(e.PolicyRelNotExist,
+				fmt.Errorf("required policy group '%s' is not bound to env '%s'", groupId, env.Id), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// CheckProjectRequiredPolicyGroups 检查项目下使用项目分级处理配置(未单独配置)的环境都绑定了必须通过的策略组
+func CheckProjectRequiredPolicyGroups(query *db.Session, projectId models.Id, groups []models.Id) e.Error {
+	if len(groups) == 0 {
+		return nil
+	}
+	envs := make([]models.Env, 0)
+	if err := query.Model(&models.Env{}).Where("project_id = ? AND archived = ?", projectId, false).
+		Find(&envs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	for i := range envs {
+		if !envs[i].PolicyEnforcement.IsEmpty() {
+			continue
+		}
+		if er := CheckEnvRequiredPolicyGroups(query, &envs[i], groups); er != nil {
+			return er
+		}
+	}
+	return nil
+}
+
+// GetEnvPolicyEnforcement 获取环境生效的合规检测分级处理配置，环境未配置时使用项目的配置
+func GetEnvPolicyEnforcement(query *db.Session, env *models.Env) (models.PolicyEnforcement, e.Error) {
+	if !env.PolicyEnforcement.IsEmpty() {
+		return env.PolicyEnforcement, nil
+	}
+
+	project := models.Project{}
+	if err := query.Model(&models.Project{}).Where("id = ?", env.ProjectId).First(&project); err != nil {
+		if e.IsRecordNotFound(err) {
+			return models.PolicyEnforcement{}, e.New(e.ProjectNotExists, err)
+		}
+		return models.PolicyEnforcement{}, e.New(e.DBError, err)
+	}
+	return project.PolicyEnforcement, nil
+}
+
+// EvalPolicyEnforcement 根据扫描结果计算分级处理结果，多个违规时取最严格的处理方式(block > approve > warn)。
+// 必须通过的策略组没有扫描结果或者存在违规、执行失败的策略时视为未通过。
+// 扫描失败时无法判断违规情况，配置了 block 的处理方式时直接中止部署
+func EvalPolicyEnforcement(pe models.PolicyEnforcement, results []models.PolicyResult, scanFailed bool) *models.PolicyEnforcementResult {
+	actionLevel := map[string]int{
+		common.PolicyEnforceWarn:    1,
+		common.PolicyEnforceApprove: 2,
+		common.PolicyEnforceBlock:   3,
+	}
+
+	ret := models.PolicyEnforcementResult{}
+	groupPassed := make(map[models.Id]bool)
+	for _, r := range results {
+		passed, ok := groupPassed[r.PolicyGroupId]
+		if !ok {
+			passed = true
+		}
+		switch r.Status {
+		case common.PolicyStatusPassed, common.PolicyStatusSuppressed:
+		case common.PolicyStatusViolated:
+			switch r.Severity {
+			case common.PolicySeverityHigh:
+				ret.Violated.High++
+			case common.PolicySeverityLow:
+				ret.Violated.Low++
+			default:
+				ret.Violated.Medium++
+			}
+			ret.Violated.Total++
+
+			if action := pe.Action(r.Severity); actionLevel[action] > actionLevel[ret.Action] {
+				ret.Action = action
+			}
+			passed = false
+		default:
+			passed = false
+		}
+		groupPassed[r.PolicyGroupId] = passed
+	}
+
+	for _, groupId := range pe.RequiredGroups {
+		if !groupPassed[groupId] {
+			ret.FailedGroups = append(ret.FailedGroups, groupId)
+		}
+	}
+
+	if scanFailed && pe.HasAction(common.PolicyEnforceBlock) {
+		ret.Action = common.PolicyEnforceBlock
+	}
+	return &ret
+}
+
+// EnforceTaskPolicy 根据任务的扫描结果执行合规检测分级处理，处理结果保存到任务执行结果中。
+// 处理方式为 approve 时部署步骤需要审批(即使任务开启了自动审批)
+func EnforceTaskPolicy(tx *db.Session, task *models.Task, policyStatus string) (*models.PolicyEnforcementResult, e.Error) {
+	if task.PolicyEnforcement.IsEmpty() {
+		return nil, nil
+	}
+
+	results := make([]models.PolicyResult, 0)
+	if err := tx.Model(&models.PolicyResult{}).Where("task_id = ?", task.Id).Find(&results); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	ret := EvalPolicyEnforcement(task.PolicyEnforcement, results, policyStatus == common.PolicyStatusFailed)
+	task.Result.PolicyEnforcement = ret
+	if _, err := tx.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateColumn("result", task.Result); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	if ret.Action == common.PolicyEnforceApprove {
+		if _, err := tx.Model(&models.TaskStep{}).
+			Where("task_id = ? AND type = ?", task.Id, common.TaskStepTfApply).
+			UpdateColumn("must_approval", true); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+	return ret, nil
+}
+
+// PolicyViolationBlocked 判断合规检测不通过时是否中止任务，未配置分级处理时按 StopOnViolation 处理
+func PolicyViolationBlocked(task *models.Task) bool {
+	if task.PolicyEnforcement.IsEmpty() {
+		return task.StopOnViolation
+	}
+	return task.Result.PolicyEnforcement != nil &&
+		task.Result.PolicyEnforcement.Action == common.PolicyEnforceBlock
+}
+
+// CheckTaskRequiredPolicyGroups 检查部署进入审批前必须通过的策略组，策略组未绑定到环境或者任务未执行合规检测时视为未通过
+func CheckTaskRequiredPolicyGroups(query *db.Session, task *models.Task) error {
+	groups := task.PolicyEnforcement.RequiredGroups
+	if len(groups) == 0 {
+		return nil
+	}
+	env, er := GetEnvById(query, task.EnvId)
+	if er != nil {
+		return er
+	}
+	if er := CheckEnvRequiredPolicyGroups(query, env, groups); er != nil {
+		return er
+	}
+	return checkTaskRequiredGroupsResult(task)
+}
+
+// checkTaskRequiredGroupsResult 根据任务的合规检测分级处理结果检查必须通过的策略组
+func checkTaskRequiredGroupsResult(task *models.Task) error {
+	groups := task.PolicyEnforcement.RequiredGroups
+	if len(groups) == 0 {
+		return nil
+	}
+	if task.Result.PolicyEnforcement == nil {
+		return fmt.Errorf("required policy groups %v not scanned", groups)
+	}
+	if failed := task.Result.PolicyEnforcement.FailedGroups; len(failed) > 0 {
+		return fmt.Errorf("required policy groups %v not passed", failed)
+	}
+	return nil
+}
+
+// TaskPolicyRequireApproval 合规检测分级处理结果是否要求部署审批
+func TaskPolicyRequireApproval(task *models.Task) bool {
+	return task.Result.PolicyEnforcement != nil &&
+		task.Result.PolicyEnforcement.Action == common.PolicyEnforceApprove
+}
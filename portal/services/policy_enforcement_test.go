@@ -0,0 +1,79 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalPolicyEnforcement(t *testing.T) {
+	newResult := func(groupId models.Id, status, severity string) models.PolicyResult {
+		r := models.PolicyResult{PolicyGroupId: groupId, Status: status}
+		r.Severity = severity
+		return r
+	}
+	results := []models.PolicyResult{
+		newResult("pog-a", common.PolicyStatusPassed, common.PolicySeverityHigh),
+		newResult("pog-a", common.PolicyStatusSuppressed, common.PolicySeverityHigh),
+		newResult("pog-b", common.PolicyStatusViolated, common.PolicySeverityLow),
+		newResult("pog-b", common.PolicyStatusViolated, common.PolicySeverityMedium),
+		newResult("pog-c", common.PolicyStatusFailed, ""),
+	}
+	pe := models.PolicyEnforcement{
+		High:           common.PolicyEnforceBlock,
+		Medium:         common.PolicyEnforceApprove,
+		RequiredGroups: []models.Id{"pog-a", "pog-c", "pog-d"},
+	}
+
+	ret := EvalPolicyEnforcement(pe, results, false)
+	assert.Equal(t, common.PolicyEnforceApprove, ret.Action)
+	assert.Equal(t, models.TsCount{Low: 1, Medium: 1, Total: 2}, ret.Violated)
+	assert.Equal(t, []models.Id{"pog-c", "pog-d"}, ret.FailedGroups)
+
+	results = append(results, newResult("pog-a", common.PolicyStatusViolated, common.PolicySeverityHigh))
+	ret = EvalPolicyEnforcement(pe, results, false)
+	assert.Equal(t, common.PolicyEnforceBlock, ret.Action)
+	assert.Equal(t, []models.Id{"pog-a", "pog-c", "pog-d"}, ret.FailedGroups)
+
+	// 未配置处理方式的违规仅告警
+	ret = EvalPolicyEnforcement(models.PolicyEnforcement{High: common.PolicyEnforceBlock}, results[:3], false)
+	assert.Equal(t, common.PolicyEnforceWarn, ret.Action)
+	assert.Empty(t, ret.FailedGroups)
+
+	// 扫描失败时扫描结果被清空，配置了 block 时中止部署
+	ret = EvalPolicyEnforcement(pe, nil, true)
+	assert.Equal(t, common.PolicyEnforceBlock, ret.Action)
+	assert.Equal(t, []models.Id{"pog-a", "pog-c", "pog-d"}, ret.FailedGroups)
+	task := models.Task{PolicyEnforcement: pe}
+	task.Result.PolicyEnforcement = ret
+	assert.True(t, PolicyViolationBlocked(&task))
+
+	ret = EvalPolicyEnforcement(models.PolicyEnforcement{Medium: common.PolicyEnforceApprove}, nil, true)
+	assert.Equal(t, "", ret.Action)
+}
+
+func TestTaskPolicyEnforcement(t *testing.T) {
+	task := models.Task{StopOnViolation: true}
+	assert.True(t, PolicyViolationBlocked(&task))
+	assert.NoError(t, checkTaskRequiredGroupsResult(&task))
+
+	task.PolicyEnforcement = models.PolicyEnforcement{RequiredGroups: []models.Id{"pog-a"}}
+	assert.False(t, PolicyViolationBlocked(&task))
+	assert.Error(t, checkTaskRequiredGroupsResult(&task))
+
+	task.Result.PolicyEnforcement = &models.PolicyEnforcementResult{Action: common.PolicyEnforceApprove}
+	assert.NoError(t, checkTaskRequiredGroupsResult(&task))
+	assert.True(t, TaskPolicyRequireApproval(&task))
+	assert.False(t, PolicyViolationBlocked(&task))
+
+	task.Result.PolicyEnforcement = &models.PolicyEnforcementResult{
+		Action:       common.PolicyEnforceBlock,
+		FailedGroups: []models.Id{"pog-a"},
+	}
+	assert.True(t, PolicyViolationBlocked(&task))
+	assert.Error(t, checkTaskRequiredGroupsResult(&task))
+}
@@ -200,7 +200,8 @@ func GetPolicyGroupCommitId(sess *db.Session, vcsId models.Id, repoId string, br
 		return "", "", e.New(e.VcsError, er)
 	}
 
-	if vcs.VcsType == models.VcsGitee {
+	// bitbucket server 使用 token clone 时需要指定真实的用户名
+	if vcs.VcsType == models.VcsGitee || vcs.VcsType == models.VcsBitbucket {
 		user, er := vcsInstance.UserInfo()
 		if er != nil {
 			return "", "", e.New(e.VcsError, er)
@@ -227,6 +228,9 @@ func GetPolicyGroupCommitId(sess *db.Session, vcsId models.Id, repoId string, br
 	if er != nil {
 		return "", "", e.New(e.VcsError, er)
 	}
+	if vcsrv.IsGitSshVcs(vcs) {
+		token = ""
+	}
 
 	if repoAddr == "" {
 		return "", "", e.New(e.BadParam, fmt.Errorf("repo address is blank"))
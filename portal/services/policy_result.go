@@ -8,6 +8,7 @@ import (
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
 	"fmt"
 	"time"
 )
@@ -101,8 +102,16 @@ func UpdateScanResult(tx *db.Session, task models.Tasker, result policy.TsResult
 
 	var (
 		policyResults []*models.PolicyResult
+		violated      = make(map[string]*models.PolicyResult)
 	)
 	for _, r := range result.Violations {
+		// plan 策略每个违规资源一条结果，同一策略的结果合并为一条记录并保存所有违规资源地址
+		if policyResult, ok := violated[r.RuleId]; ok {
+			if r.Address != "" {
+				policyResult.Addresses = append(policyResult.Addresses, r.Address)
+			}
+			continue
+		}
 		if policyResult, err := GetPolicyResultById(tx, task.GetId(), models.Id(r.RuleId)); err != nil {
 			return err
 		} else {
@@ -127,6 +136,10 @@ func UpdateScanResult(tx *db.Session, task models.Tasker, result policy.TsResult
 				Line:         r.Line,
 				Source:       models.Text(r.Source),
 			}
+			if r.Address != "" {
+				policyResult.Addresses = models.StrSlice{r.Address}
+			}
+			violated[r.RuleId] = policyResult
 			policyResults = append(policyResults, policyResult)
 		}
 	}
@@ -225,6 +238,75 @@ func QueryPolicyResult(query *db.Session, taskId models.Id) *db.Session {
 	return q
 }
 
+type scanTaskPolicyResult struct {
+	resps.PolicyResult
+	PolicySeverity string
+}
+
+// GetScanTaskResult 将扫描任务保存的策略检测结果转换为扫描结果，用于导出 sarif/junit 报告
+func GetScanTaskResult(query *db.Session, taskId models.Id) (*policy.TsResult, e.Error) {
+	rows := make([]scanTaskPolicyResult, 0)
+	q := QueryPolicyResult(query, taskId).
+		LazySelectAppend("p.severity as policy_severity").
+		Order("policy_group_name, policy_name")
+	if err := q.Scan(&rows); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	result := policy.TsResult{
+		PassedRules:       make([]policy.Rule, 0),
+		Violations:        make([]policy.Violation, 0),
+		SkippedViolations: make([]policy.Violation, 0),
+	}
+	for _, r := range rows {
+		rule := policy.Rule{
+			RuleName:    r.PolicyName,
+			Description: r.Description,
+			RuleId:      string(r.PolicyId),
+			Severity:    r.PolicySeverity,
+			Category:    r.PolicyGroupName,
+		}
+		switch r.Status {
+		case common.PolicyStatusPassed:
+			result.PassedRules = append(result.PassedRules, rule)
+		case common.PolicyStatusSuppressed:
+			result.SuppressedRules = append(result.SuppressedRules, rule)
+		case common.PolicyStatusFailed:
+			result.ScanErrors = append(result.ScanErrors, policy.ScanError{
+				RuleName: rule.RuleName,
+				RuleId:   rule.RuleId,
+				Severity: rule.Severity,
+				Category: rule.Category,
+				ErrMsg:   string(r.Message),
+			})
+		case common.PolicyStatusViolated:
+			v := policy.Violation{
+				RuleName:     rule.RuleName,
+				Description:  rule.Description,
+				RuleId:       rule.RuleId,
+				Severity:     rule.Severity,
+				Category:     rule.Category,
+				ResourceName: r.ResourceName,
+				ResourceType: r.ResourceType,
+				File:         r.File,
+				Line:         r.Line,
+				ModuleName:   r.ModuleName,
+				PlanRoot:     r.PlanRoot,
+				Source:       string(r.Source),
+			}
+			if len(r.Addresses) == 0 {
+				result.Violations = append(result.Violations, v)
+			}
+			// plan 策略的结果合并保存了所有违规资源，导出时每个资源一条结果
+			for _, addr := range r.Addresses {
+				v.Address = addr
+				result.Violations = append(result.Violations, v)
+			}
+		}
+	}
+	return &result, nil
+}
+
 // GetMirrorScanTask 查找部署任务对应的扫描任务
 func GetMirrorScanTask(query *db.Session, taskId models.Id) (*models.ScanTask, e.Error) {
 	t := models.ScanTask{}
@@ -250,6 +332,7 @@ func FilterSuppressPolicies(query *db.Session, policies []models.Policy, targetI
 		Select("policy_id").
 		Where("s.policy_id in (?)", policyIds).
 		Where("(s.target_type = 'policy') OR (s.target_id = ? AND s.target_type = ?)", targetId, scope).
+		Where(policySuppressActiveCond("s"), time.Now()).
 		Group("policy_id")
 
 	// 搜索策略屏蔽 或者 来源屏蔽
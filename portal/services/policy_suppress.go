@@ -3,14 +3,26 @@
 package services
 
 import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
+	"cloudiac/portal/models/resps"
+	"cloudiac/utils"
+	"cloudiac/utils/mail"
 	"fmt"
+	"time"
 )
 
-func SearchPolicySuppress(query *db.Session, id, orgId models.Id) *db.Session {
+// policySuppressActiveCond 生效中的屏蔽记录条件：审批通过且未过期，参数为当前时间
+func policySuppressActiveCond(alias string) string {
+	return fmt.Sprintf("%s.status = '%s' AND (%s.expires_at IS NULL OR %s.expires_at > ?)",
+		alias, common.PolicySuppressStatusApproved, alias, alias)
+}
+
+func queryPolicySuppress(query *db.Session) *db.Session {
 	q := query.Table(fmt.Sprintf("%s as s", models.PolicySuppress{}.TableName())).
 		LazySelect("s.*")
 
@@ -22,11 +34,37 @@ when s.target_type = 'env' then e.name
 when s.target_type = 'template' then t.name
 when s.target_type = 'policy' then p.name
 end as target_name`).
-		Where("s.policy_id = ?", id).
-		Where("s.org_id = ?", orgId).
 		Joins("LEFT JOIN iac_user AS u ON s.creator_id = u.id").
-		LazySelectAppend("u.name as creator")
+		LazySelectAppend("u.name as creator").
+		Joins("LEFT JOIN iac_user AS au ON s.approver_id = au.id").
+		LazySelectAppend("au.name as approver")
+
+	return q
+}
 
+func SearchPolicySuppress(query *db.Session, id, orgId models.Id) *db.Session {
+	return queryPolicySuppress(query).
+		Where("s.policy_id = ?", id).
+		Where("s.org_id = ?", orgId)
+}
+
+// SearchPolicySuppressReport 查询组织下的策略屏蔽记录，用于审计生效中及已过期的屏蔽
+func SearchPolicySuppressReport(query *db.Session, orgId models.Id, status string, now time.Time) *db.Session {
+	q := queryPolicySuppress(query).
+		Joins("LEFT JOIN iac_policy AS po ON s.policy_id = po.id").
+		LazySelectAppend("po.name as policy_name, po.severity as policy_severity").
+		Where("s.org_id = ?", orgId)
+
+	switch status {
+	case consts.PolicySuppressReportActive:
+		q = q.Where(policySuppressActiveCond("s"), now)
+	case consts.PolicySuppressReportExpired:
+		// 已到期但定时任务还未处理的记录同样视为已过期
+		q = q.Where("s.status = ? OR (s.status = ? AND s.expires_at <= ?)",
+			common.PolicySuppressStatusExpired, common.PolicySuppressStatusApproved, now)
+	case common.PolicySuppressStatusPending, common.PolicySuppressStatusRejected:
+		q = q.Where("s.status = ?", status)
+	}
 	return q
 }
 
@@ -68,7 +106,9 @@ func SearchPolicySuppressSource(query *db.Session, form *forms.SearchPolicySuppr
 		Where("id in (?)", subQueryPolicyGroupRel.Select("tpl_id").Expr()).
 		Where("org_id = ?", orgId)
 
+	// 已拒绝或已过期的屏蔽目标可以重新申请
 	suppressQuery := query.Model(models.PolicySuppress{}).Where("policy_id = ?", policyId).
+		Where("status IN (?)", []string{common.PolicySuppressStatusPending, common.PolicySuppressStatusApproved}).
 		Select("target_id")
 
 	q := query.Raw(fmt.Sprintf("select r.* from ((?) union (?)) as r where r.target_id not in (?) %s", form.OrderBy()),
@@ -91,7 +131,143 @@ func GetPolicySuppressByPolicyId(query *db.Session, id models.Id) (*models.Polic
 }
 
 func QueryPolicySuppress(query *db.Session, targetType string, targetId models.Id) *db.Session {
-	query = query.Joins("left join iac_policy_suppress as ps on ps.policy_id = p.id and ps.target_type = ? and ps.target_id = ?", targetType, targetId).
+	query = query.Joins(fmt.Sprintf("left join iac_policy_suppress as ps on ps.policy_id = p.id and ps.target_type = ? and ps.target_id = ? and %s",
+		policySuppressActiveCond("ps")), targetType, targetId, time.Now()).
 		LazySelectAppend("!ISNULL(ps.id) AS policy_suppress")
 	return query
 }
+
+// DeleteInactivePolicySuppress 删除策略在指定目标上已拒绝或已过期的屏蔽记录，以便重新提交屏蔽申请
+func DeleteInactivePolicySuppress(tx *db.Session, policyId models.Id, targetIds []models.Id) e.Error {
+	if _, err := tx.Where("policy_id = ? AND target_id IN (?)", policyId, targetIds).
+		Where("status IN (?)", []string{common.PolicySuppressStatusRejected, common.PolicySuppressStatusExpired}).
+		Delete(&models.PolicySuppress{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// CheckPolicySuppressApprovable 检查用户是否可以审批屏蔽申请，申请人不能审批自己的申请
+func CheckPolicySuppressApprovable(sup *models.PolicySuppress, userId models.Id, now time.Time) e.Error {
+	if sup.Status != common.PolicySuppressStatusPending {
+		return e.New(e.PolicySuppressNotPending, fmt.Errorf("policy suppress %s is %s", sup.Id, sup.Status))
+	}
+	if sup.CreatorId == userId {
+		return e.New(e.PolicySuppressSelfApprove, fmt.Errorf("user %s cannot approve own policy suppress", userId))
+	}
+	if sup.ExpiresAt != nil && !time.Time(*sup.ExpiresAt).After(now) {
+		return e.New(e.BadParam, fmt.Errorf("policy suppress %s already expired", sup.Id))
+	}
+	return nil
+}
+
+// ApprovePolicySuppress 审批屏蔽申请，审批通过的策略屏蔽会同时禁用该策略
+func ApprovePolicySuppress(tx *db.Session, sup *models.PolicySuppress, approverId models.Id, approved bool) e.Error {
+	now := models.Time(time.Now())
+	status := common.PolicySuppressStatusRejected
+	if approved {
+		status = common.PolicySuppressStatusApproved
+	}
+	// 只更新待审批的记录，避免并发审批
+	cnt, err := tx.Model(&models.PolicySuppress{}).
+		Where("id = ? AND status = ?", sup.Id, common.PolicySuppressStatusPending).
+		UpdateAttrs(models.Attrs{"status": status, "approver_id": approverId, "approved_at": &now})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if cnt == 0 {
+		return e.New(e.PolicySuppressNotPending, fmt.Errorf("policy suppress %s is not pending", sup.Id))
+	}
+	sup.Status = status
+	sup.ApproverId = approverId
+	sup.ApprovedAt = &now
+
+	if approved && sup.TargetType == consts.ScopePolicy {
+		if _, err := PolicyEnable(tx, sup.TargetId, false, sup.OrgId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetExpiredPolicySuppress 获取已到期但仍处于生效状态的屏蔽记录
+func GetExpiredPolicySuppress(query *db.Session, now time.Time) ([]models.PolicySuppress, e.Error) {
+	sups := make([]models.PolicySuppress, 0)
+	if err := query.Model(models.PolicySuppress{}).
+		Where("status = ? AND expires_at <= ?", common.PolicySuppressStatusApproved, now).
+		Find(&sups); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return sups, nil
+}
+
+// ExpirePolicySuppress 将到期的屏蔽记录设置为已过期，策略屏蔽到期后重新启用该策略。
+// 返回 false 表示记录已被其他进程处理
+func ExpirePolicySuppress(tx *db.Session, sup *models.PolicySuppress) (bool, e.Error) {
+	cnt, err := tx.Model(&models.PolicySuppress{}).
+		Where("id = ? AND status = ?", sup.Id, common.PolicySuppressStatusApproved).
+		UpdateAttrs(models.Attrs{"status": common.PolicySuppressStatusExpired})
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	} else if cnt == 0 {
+		return false, nil
+	}
+	sup.Status = common.PolicySuppressStatusExpired
+
+	if sup.TargetType == consts.ScopePolicy {
+		if _, err := PolicyEnable(tx, sup.TargetId, true, sup.OrgId); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// SendPolicySuppressExpiredMail 通知屏蔽的申请人和审批人屏蔽已到期
+func SendPolicySuppressExpiredMail(query *db.Session, sup *models.PolicySuppress) e.Error {
+	resp := resps.PolicySuppressReportResp{}
+	if err := SearchPolicySuppressReport(query, sup.OrgId, "", time.Now()).
+		Where("s.id = ?", sup.Id).Scan(&resp); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	emails := make([]string, 0)
+	for _, userId := range []models.Id{sup.CreatorId, sup.ApproverId} {
+		if userId == "" {
+			continue
+		}
+		user, err := GetUserById(query, userId)
+		if err != nil {
+			if err.Code() == e.UserNotExists {
+				continue
+			}
+			return err
+		}
+		if !utils.StrInArray(user.Email, emails...) {
+			emails = append(emails, user.Email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	orgName := ""
+	if org, err := GetOrganizationById(query, sup.OrgId); err == nil {
+		orgName = org.Name
+	}
+	expiresAt := ""
+	if sup.ExpiresAt != nil {
+		expiresAt = time.Time(*sup.ExpiresAt).Format("2006-01-02 15:04:05")
+	}
+	content := utils.SprintTemplate(consts.IacPolicySuppressExpiredTpl, map[string]interface{}{
+		"Creator":    resp.Creator,
+		"OrgName":    orgName,
+		"PolicyName": resp.PolicyName,
+		"TargetName": resp.TargetName,
+		"Reason":     sup.Reason,
+		"Approver":   resp.Approver,
+		"ExpiresAt":  expiresAt,
+	})
+	if err := mail.SendMail(emails, consts.PolicySuppressExpiredMailTitle, content); err != nil {
+		return e.New(e.MailServerError, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckPolicySuppressApprovable(t *testing.T) {
+	now := time.Now()
+	expiresAt := models.Time(now.Add(time.Hour))
+	sup := models.PolicySuppress{
+		CreatorId: "u-requester",
+		Status:    common.PolicySuppressStatusPending,
+		ExpiresAt: &expiresAt,
+	}
+	assert.Nil(t, CheckPolicySuppressApprovable(&sup, "u-approver", now))
+
+	err := CheckPolicySuppressApprovable(&sup, "u-requester", now)
+	assert.NotNil(t, err)
+	assert.Equal(t, e.PolicySuppressSelfApprove, err.Code())
+
+	// 申请在审批前已到期
+	err = CheckPolicySuppressApprovable(&sup, "u-approver", now.Add(2*time.Hour))
+	assert.NotNil(t, err)
+	assert.Equal(t, e.BadParam, err.Code())
+
+	for _, status := range []string{
+		common.PolicySuppressStatusApproved,
+		common.PolicySuppressStatusRejected,
+		common.PolicySuppressStatusExpired,
+	} {
+		sup.Status = status
+		err = CheckPolicySuppressApprovable(&sup, "u-approver", now)
+		assert.NotNil(t, err)
+		assert.Equal(t, e.PolicySuppressNotPending, err.Code())
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/acarl005/stripansi"
+)
+
+const (
+	// PR 评论中最多展示的资源变更数量
+	prCommentMaxResources = 100
+	// 各 vcs 对评论长度都有限制(github 为 65536 个字符)，plan 日志只保留最后的部分
+	prCommentMaxLogSize = 30000
+)
+
+type prCommentResource struct {
+	Action  string
+	Address string
+}
+
+type prCommentViolation struct {
+	Severity   string
+	PolicyName string
+	Resource   string
+	File       string
+}
+
+// planResourceAction 将 plan 中资源的 actions 转换为评论中展示的操作，no-op 及未知操作返回空
+func planResourceAction(actions []string) string {
+	switch {
+	case utils.SliceEqualStr(actions, []string{"create"}):
+		return "+ create"
+	case utils.SliceEqualStr(actions, []string{"update"}):
+		return "~ update"
+	case utils.SliceEqualStr(actions, []string{"delete"}):
+		return "- destroy"
+	case utils.SliceEqualStr(actions, []string{"delete", "create"}):
+		return "-/+ replace"
+	case utils.SliceEqualStr(actions, []string{"create", "delete"}):
+		return "+/- replace"
+	default:
+		return ""
+	}
+}
+
+func getPrCommentResources(rs []TfPlanResource) []prCommentResource {
+	resources := make([]prCommentResource, 0)
+	for _, r := range rs {
+		if action := planResourceAction(r.Change.Actions); action != "" {
+			resources = append(resources, prCommentResource{Action: action, Address: r.Address})
+		}
+	}
+	return resources
+}
+
+func getPrCommentViolations(session *db.Session, taskId models.Id) ([]prCommentViolation, error) {
+	results := make([]resps.PolicyResult, 0)
+	if err := QueryPolicyResult(session, taskId).
+		Where("iac_policy_result.status = ?", common.PolicyStatusViolated).
+		Order("policy_group_name, policy_name").
+		Scan(&results); err != nil {
+		return nil, err
+	}
+
+	violations := make([]prCommentViolation, 0, len(results))
+	for _, r := range results {
+		v := prCommentViolation{
+			Severity:   r.Severity,
+			PolicyName: utils.FirstValueStr(r.PolicyName, r.RuleName),
+			Resource:   fmt.Sprintf("%s.%s", r.ResourceType, r.ResourceName),
+			File:       r.File,
+		}
+		if r.File != "" && r.Line > 0 {
+			v.File = fmt.Sprintf("%s:%d", r.File, r.Line)
+		}
+		violations = append(violations, v)
+	}
+	return violations, nil
+}
+
+func formatCost(cost *float32) string {
+	if cost == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *cost)
+}
+
+// tailLogContent 日志超过长度限制时只保留最后的部分
+func tailLogContent(content string, maxSize int) string {
+	if len(content) <= maxSize {
+		return content
+	}
+	start := len(content) - maxSize
+	for start < len(content) && !utf8.RuneStart(content[start]) {
+		start++
+	}
+	return "...\n" + content[start:]
+}
+
+func renderPrComment(env *models.Env, task *models.Task, taskStatus string, logContent []byte,
+	resources []prCommentResource, violations []prCommentViolation) string {
+	result := task.PlanResult
+	// 标题及结果中展示任务类型，未知类型按 plan 处理
+	action := "Plan"
+	if task.Type != "" {
+		action = strings.ToUpper(task.Type[:1]) + task.Type[1:]
+	}
+	attr := map[string]interface{}{
+		"Action": action,
+		"Status": taskStatus,
+		"Name":   env.Name,
+		//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
+		"Addr":    fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s", configs.Get().Portal.Address, task.OrgId, task.ProjectId, task.EnvId, task.Id),
+		"Content": html.EscapeString(tailLogContent(stripansi.Strip(string(logContent)), prCommentMaxLogSize)),
+
+		"Violations":    violations,
+		"ResourceCount": len(resources),
+	}
+
+	if result.ResAdded != nil && result.ResChanged != nil && result.ResDestroyed != nil {
+		attr["HasChanges"] = true
+		attr["ResAdded"] = *result.ResAdded
+		attr["ResChanged"] = *result.ResChanged
+		attr["ResDestroyed"] = *result.ResDestroyed
+	}
+
+	if result.ResAddedCost != nil {
+		var delta float32
+		for _, c := range []*float32{result.ResAddedCost, result.ResUpdatedCost, result.ResDestroyedCost} {
+			if c != nil {
+				delta += *c
+			}
+		}
+		attr["HasCost"] = true
+		attr["CostDelta"] = fmt.Sprintf("%+.2f", delta)
+		attr["AddedCost"] = formatCost(result.ResAddedCost)
+		attr["UpdatedCost"] = formatCost(result.ResUpdatedCost)
+		attr["DestroyedCost"] = formatCost(result.ResDestroyedCost)
+	}
+
+	if len(resources) > prCommentMaxResources {
+		attr["ResourceOmitted"] = len(resources) - prCommentMaxResources
+		resources = resources[:prCommentMaxResources]
+	}
+	attr["Resources"] = resources
+
+	return utils.SprintTemplate(consts.PrCommentTpl, attr)
+}
+
+// upsertPrComment 同一环境在同一个 PR 中只保留一条 plan 评论和一条 apply 评论，已经评论过时直接修改原评论。
+// column 为保存评论 id 的字段(comment_id 或 apply_comment_id)
+func upsertPrComment(session *db.Session, repo vcsrv.RepoIface, vp models.VcsPr, content string, column string) error {
+	last := models.VcsPr{}
+	err := session.Model(&models.VcsPr{}).
+		Where("env_id = ? AND vcs_id = ? AND pr_id = ?", vp.EnvId, vp.VcsId, vp.PrId).
+		Where(fmt.Sprintf("%s > 0", column)).
+		Order("id DESC").First(&last)
+	if err != nil && !e.IsRecordNotFound(err) {
+		return err
+	}
+
+	commentId := last.CommentId
+	if column == "apply_comment_id" {
+		commentId = last.ApplyCommentId
+	}
+	if commentId > 0 {
+		if err := repo.UpdatePrComment(vp.PrId, commentId, content); err != nil {
+			// 原评论可能已被删除，重新创建评论
+			logs.Get().Warnf("update pr comment %d err: %v, create a new one", commentId, err)
+			commentId = 0
+		}
+	}
+	if commentId == 0 {
+		if commentId, err = repo.CreatePrComment(vp.PrId, content); err != nil {
+			return err
+		}
+	}
+
+	_, err = session.Model(&models.VcsPr{}).Where("id = ?", vp.Id).UpdateColumn(column, commentId)
+	return err
+}
+
+// readPrCommentLog 读取评论中展示的日志，apply 任务使用 apply 步骤的日志，apply 步骤未执行时使用 plan 步骤的日志
+func readPrCommentLog(session *db.Session, task *models.Task) ([]byte, error) {
+	if task.Type == common.TaskTypeApply {
+		if step, err := getTaskStepByType(session, task.Id, common.TaskStepTfApply); err == nil {
+			if content, err := logstorage.Get().Read(step.LogPath); err == nil {
+				return content, nil
+			}
+		}
+	}
+
+	step, err := GetTaskPlanStep(session, task.Id)
+	if err != nil {
+		return nil, err
+	}
+	return logstorage.Get().Read(step.LogPath)
+}
+
+func SendVcsComment(session *db.Session, task *models.Task, taskStatus string) {
+	env, er := GetEnvById(session, task.EnvId)
+	if er != nil {
+		logs.Get().Errorf("vcs comment err, get env detail data err: %v", er)
+		return
+	}
+
+	vp, err := GetVcsPrByTaskId(session, task)
+	if err != nil {
+		if !e.IsRecordNotFound(err) {
+			logs.Get().Errorf("vcs comment err, get vcs pr data err: %v", err)
+		}
+		return
+	}
+
+	vcs, er := GetVcsRepoByTplId(session, task.TplId)
+	if er != nil {
+		logs.Get().Errorf("vcs comment err, get vcs data err: %v", er)
+		return
+	}
+	logContent, err := readPrCommentLog(session, task)
+	if err != nil {
+		logs.Get().Errorf("vcs comment err, get task log err: %v", err)
+		return
+	}
+
+	// plan 失败时没有 plan 文件，资源变更列表为空
+	resources := make([]prCommentResource, 0)
+	if bs, err := logstorage.Get().Read(task.PlanJsonPath()); err != nil {
+		if !os.IsNotExist(err) {
+			logs.Get().Warnf("vcs comment, read plan json err: %v", err)
+		}
+	} else if tfPlan, err := UnmarshalPlanJson(bs); err != nil {
+		logs.Get().Warnf("vcs comment, unmarshal plan json err: %v", err)
+	} else {
+		resources = getPrCommentResources(tfPlan.ResourceChanges)
+	}
+
+	violations, err := getPrCommentViolations(session, task.Id)
+	if err != nil {
+		logs.Get().Warnf("vcs comment, get policy violations err: %v", err)
+	}
+
+	content := renderPrComment(env, task, taskStatus, logContent, resources, violations)
+	column := "comment_id"
+	if task.Type == common.TaskTypeApply {
+		// apply 结果单独评论，不覆盖 plan 的评论
+		column = "apply_comment_id"
+	}
+	if err := upsertPrComment(session, vcs, vp, content, column); err != nil {
+		logs.Get().Errorf("vcs comment err, create comment err: %v", err)
+		return
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPrCommentResources(t *testing.T) {
+	rs := []TfPlanResource{
+		{Address: "aws_vpc.main", Change: TfPlanResourceChange{Actions: []string{"create"}}},
+		{Address: "aws_subnet.a", Change: TfPlanResourceChange{Actions: []string{"no-op"}}},
+		{Address: "aws_instance.web", Change: TfPlanResourceChange{Actions: []string{"delete", "create"}}},
+		{Address: "data.aws_ami.ubuntu", Change: TfPlanResourceChange{Actions: []string{"read"}}},
+		{Address: "aws_eip.web", Change: TfPlanResourceChange{Actions: []string{"update"}}},
+	}
+	assert.Equal(t, []prCommentResource{
+		{Action: "+ create", Address: "aws_vpc.main"},
+		{Action: "-/+ replace", Address: "aws_instance.web"},
+		{Action: "~ update", Address: "aws_eip.web"},
+	}, getPrCommentResources(rs))
+}
+
+func TestTailLogContent(t *testing.T) {
+	assert.Equal(t, "plan", tailLogContent("plan", 10))
+	assert.Equal(t, "...\n6789", tailLogContent("0123456789", 4))
+	// 不会截断多字节字符
+	assert.Equal(t, "...\n成功", tailLogContent("执行成功", 7))
+}
+
+func TestRenderPrComment(t *testing.T) {
+	configs.Set(&configs.Config{Portal: configs.PortalConfig{Address: "https://iac.example.com"}})
+
+	added, changed, destroyed := 2, 1, 0
+	addedCost, updatedCost, destroyedCost := float32(30), float32(-5.5), float32(0)
+	task := &models.Task{}
+	task.Id = "run-c3ek0co6n88ldvq1n6ag"
+	task.EnvId = "env-c3ek0co6n88ldvq1n6ag"
+	task.PlanResult = models.TaskResult{
+		ResAdded: &added, ResChanged: &changed, ResDestroyed: &destroyed,
+		ResAddedCost: &addedCost, ResUpdatedCost: &updatedCost, ResDestroyedCost: &destroyedCost,
+	}
+
+	resources := make([]prCommentResource, 0)
+	for i := 0; i < prCommentMaxResources+2; i++ {
+		resources = append(resources, prCommentResource{Action: "+ create", Address: fmt.Sprintf("null_resource.r[%d]", i)})
+	}
+	violations := []prCommentViolation{
+		{Severity: "HIGH", PolicyName: "S3 bucket public read", Resource: "aws_s3_bucket.logs", File: "main.tf:12"},
+	}
+	content := renderPrComment(&models.Env{Name: "prod"}, task, "complete",
+		[]byte("\x1b[32mPlan:\x1b[0m 2 to add <computed>"), resources, violations)
+
+	assert.Contains(t, content, `<a href="https://iac.example.com/org//project//m-project-env/detail/env-c3ek0co6n88ldvq1n6ag/task/run-c3ek0co6n88ldvq1n6ag">prod</a>`)
+	assert.Contains(t, content, "**Plan:** 2 to add, 1 to change, 0 to destroy.")
+	assert.Contains(t, content, "**Monthly cost:** +24.50 (add 30.00, change -5.50, destroy 0.00)")
+	assert.Contains(t, content, "<summary>Resource Changes (102)</summary>")
+	assert.Contains(t, content, "| + create | `null_resource.r[99]` |")
+	assert.NotContains(t, content, "null_resource.r[100]")
+	assert.Contains(t, content, "| ... | 2 more |")
+	assert.Contains(t, content, "<summary>Policy Violations (1)</summary>")
+	assert.Contains(t, content, "| HIGH | S3 bucket public read | `aws_s3_bucket.logs` | main.tf:12 |")
+	assert.Contains(t, content, "Plan: 2 to add &lt;computed&gt;")
+
+	// 没有变更统计及扫描结果时不展示相应内容
+	content = renderPrComment(&models.Env{Name: "prod"}, &models.Task{}, "failed", []byte("Error"), nil, nil)
+	assert.Contains(t, content, "```Plan failed```")
+	for _, s := range []string{"**Plan:**", "Monthly cost", "Resource Changes", "Policy Violations"} {
+		assert.False(t, strings.Contains(content, s), s)
+	}
+
+	task.Type = models.TaskTypeApply
+	content = renderPrComment(&models.Env{Name: "prod"}, task, "complete", []byte("Apply complete!"), nil, nil)
+	assert.Contains(t, content, "PR Apply for CloudIac environment")
+	assert.Contains(t, content, "```Apply complete```")
+	assert.Contains(t, content, "<summary>Apply Details</summary>")
+
+	task.Type = models.TaskTypeDestroy
+	content = renderPrComment(&models.Env{Name: "prod"}, task, "complete", []byte("Destroy complete!"), nil, nil)
+	assert.Contains(t, content, "PR Destroy for CloudIac environment")
+	assert.Contains(t, content, "```Destroy complete```")
+}
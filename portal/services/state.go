@@ -0,0 +1,213 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"bytes"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// StateTokenClaims 任务访问 http state backend 使用的 token，只能访问 token 中指定环境的 state
+type StateTokenClaims struct {
+	jwt.RegisteredClaims
+
+	TaskId models.Id `json:"taskId"`
+	EnvId  models.Id `json:"envId"`
+}
+
+func GenerateStateToken(taskId models.Id, envId models.Id, expireDuration time.Duration) (string, error) {
+	expire := time.Now().Add(expireDuration)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, StateTokenClaims{
+		TaskId: taskId,
+		EnvId:  envId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expire),
+			Subject:   consts.JwtSubjectTaskState,
+		},
+	})
+
+	return token.SignedString([]byte(configs.Get().JwtSecretKey))
+}
+
+func VerifyStateToken(tokenStr string, envId models.Id) (*StateTokenClaims, e.Error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &StateTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return nil, e.New(e.InvalidToken, err)
+	}
+
+	claims, ok := token.Claims.(*StateTokenClaims)
+	if !ok || !token.Valid || claims.Subject != consts.JwtSubjectTaskState {
+		return nil, e.New(e.InvalidToken, fmt.Errorf("invalid state token"))
+	}
+	if claims.EnvId != envId {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("token not allow to access env '%s'", envId))
+	}
+	return claims, nil
+}
+
+// tfStateMeta state 文件中我们需要记录的字段
+type tfStateMeta struct {
+	Serial  int64  `json:"serial"`
+	Lineage string `json:"lineage"`
+}
+
+// GetStateSerial 获取 state 内容中的 serial，内容为空(环境还没有 state)时返回 0
+func GetStateSerial(content []byte) (int64, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return 0, nil
+	}
+	meta := tfStateMeta{}
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return 0, err
+	}
+	return meta.Serial, nil
+}
+
+// GetLatestStateVersion 获取 state 的最新版本
+func GetLatestStateVersion(query *db.Session, statePath string) (*models.StateVersion, e.Error) {
+	version := models.StateVersion{}
+	err := query.Where("state_path = ?", statePath).Order("created_at DESC, serial DESC").First(&version)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.StateNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &version, nil
+}
+
+// QueryStateVersion 查询 state 版本，同时返回写入该版本的任务信息
+func QueryStateVersion(query *db.Session) *db.Session {
+	query = query.Model(&models.StateVersion{}).LazySelectAppend("iac_state_version.*")
+	query = query.Joins("left join iac_task as t on t.id = iac_state_version.task_id").
+		LazySelectAppend("t.name as task_name, t.type as task_type, t.creator_id")
+	query = query.Joins("left join iac_user as u on u.id = t.creator_id").
+		LazySelectAppend("u.name as creator")
+	return query
+}
+
+func GetStateVersionById(query *db.Session, envId models.Id, id models.Id) (*models.StateVersion, e.Error) {
+	version := models.StateVersion{}
+	if err := query.Where("env_id = ? AND id = ?", envId, id).First(&version); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.StateVersionNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &version, nil
+}
+
+// GetStateVersionContent 读取 state 版本的内容
+func GetStateVersionContent(version *models.StateVersion) ([]byte, e.Error) {
+	content, err := logstorage.Get().Read(version.Path)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return content, nil
+}
+
+// CreateStateVersion 保存 state 内容，若内容与最新版本一致则不生成新版本
+func CreateStateVersion(tx *db.Session, env *models.Env, taskId models.Id, content []byte) (*models.StateVersion, e.Error) {
+	meta := tfStateMeta{}
+	if err := json.Unmarshal(content, &meta); err != nil {
+		return nil, e.New(e.StateInvalid, err)
+	}
+
+	md5 := utils.Md5String(string(content))
+	latest, er := GetLatestStateVersion(tx, env.StatePath)
+	if er != nil && er.Code() != e.StateNotExists {
+		return nil, er
+	} else if latest != nil && latest.MD5 == md5 {
+		return latest, nil
+	}
+
+	version := models.StateVersion{
+		OrgId:     env.OrgId,
+		ProjectId: env.ProjectId,
+		EnvId:     env.Id,
+		TaskId:    taskId,
+		StatePath: env.StatePath,
+		Serial:    meta.Serial,
+		Lineage:   meta.Lineage,
+		MD5:       md5,
+		Size:      len(content),
+	}
+	version.Id = version.NewId()
+	version.Path = path.Join(env.ProjectId.String(), env.Id.String(), "states", version.Id.String()+".tfstate")
+
+	if err := logstorage.Get().Write(version.Path, content); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if err := models.Create(tx, &version); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &version, nil
+}
+
+// GetStateLock 查询 state 当前的锁，未加锁时返回 nil
+func GetStateLock(query *db.Session, statePath string) (*models.StateLock, e.Error) {
+	lock := models.StateLock{}
+	if err := query.Where("state_path = ?", statePath).First(&lock); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &lock, nil
+}
+
+// LockState 为 state 加锁，若已被其他 lock id 锁定则返回 StateLocked 错误及当前的锁
+func LockState(tx *db.Session, lock *models.StateLock) (*models.StateLock, e.Error) {
+	if lock.CreatedAt.IsZero() {
+		lock.CreatedAt = models.Time(time.Now())
+	}
+	err := models.Create(tx, lock)
+	if err == nil {
+		return lock, nil
+	} else if !e.IsDuplicate(err) {
+		return nil, e.New(e.DBError, err)
+	}
+
+	current, er := GetStateLock(tx, lock.StatePath)
+	if er != nil {
+		return nil, er
+	} else if current == nil {
+		// 锁刚好被释放
+		return LockState(tx, lock)
+	} else if current.LockId == lock.LockId {
+		return current, nil
+	}
+	return current, e.New(e.StateLocked, fmt.Errorf("state locked by '%s'", current.LockId))
+}
+
+// UnlockState 释放 state 锁，lockId 与当前锁不一致时返回 StateLocked 错误及当前的锁
+func UnlockState(tx *db.Session, statePath string, lockId string) (*models.StateLock, e.Error) {
+	current, er := GetStateLock(tx, statePath)
+	if er != nil || current == nil {
+		return nil, er
+	}
+	if current.LockId != lockId {
+		return current, e.New(e.StateLocked, fmt.Errorf("state locked by '%s'", current.LockId))
+	}
+
+	if _, err := tx.Where("state_path = ? AND lock_id = ?", statePath, lockId).
+		Delete(&models.StateLock{}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return nil, nil
+}
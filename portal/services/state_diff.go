@@ -0,0 +1,134 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"bytes"
+	"cloudiac/portal/models/resps"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// tfRawState terraform state 文件(version 4)中资源对比需要的字段
+type tfRawState struct {
+	Outputs   map[string]json.RawMessage `json:"outputs"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}                `json:"index_key"`
+			Attributes map[string]json.RawMessage `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+type tfRawStateInstance struct {
+	Type       string
+	Attributes map[string]json.RawMessage
+}
+
+// instances 返回 state 中的所有资源实例，key 为资源地址
+func (s *tfRawState) instances() map[string]tfRawStateInstance {
+	rs := make(map[string]tfRawStateInstance)
+	for _, r := range s.Resources {
+		addr := fmt.Sprintf("%s.%s", r.Type, r.Name)
+		if r.Mode == "data" {
+			addr = "data." + addr
+		}
+		if r.Module != "" {
+			addr = r.Module + "." + addr
+		}
+
+		for _, ins := range r.Instances {
+			insAddr := addr
+			switch k := ins.IndexKey.(type) {
+			case float64:
+				insAddr = fmt.Sprintf("%s[%d]", addr, int64(k))
+			case string:
+				insAddr = fmt.Sprintf("%s[%q]", addr, k)
+			}
+			rs[insAddr] = tfRawStateInstance{Type: r.Type, Attributes: ins.Attributes}
+		}
+	}
+	return rs
+}
+
+func unmarshalRawState(content []byte) (*tfRawState, error) {
+	state := tfRawState{}
+	if len(content) == 0 {
+		return &state, nil
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
+
+// changedKeys 返回两个 map 中值不同的 key(已排序)
+func changedKeys(from, to map[string]json.RawMessage) []string {
+	keys := make([]string, 0)
+	for k, v := range from {
+		if tv, ok := to[k]; !ok || !jsonEqual(v, tv) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range to {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DiffStateContent 对比两个 state 内容，返回资源级别的差异及发生变化的 output 名称
+func DiffStateContent(from, to []byte) ([]resps.StateResourceDiff, []string, error) {
+	fromState, err := unmarshalRawState(from)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unmarshal from state: %v", err)
+	}
+	toState, err := unmarshalRawState(to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unmarshal to state: %v", err)
+	}
+
+	fromIns, toIns := fromState.instances(), toState.instances()
+	diffs := make([]resps.StateResourceDiff, 0)
+	for addr, fi := range fromIns {
+		ti, ok := toIns[addr]
+		if !ok {
+			diffs = append(diffs, resps.StateResourceDiff{
+				Address: addr, Type: fi.Type, Action: resps.StateDiffDelete})
+		} else if attrs := changedKeys(fi.Attributes, ti.Attributes); len(attrs) > 0 {
+			diffs = append(diffs, resps.StateResourceDiff{
+				Address: addr, Type: fi.Type, Action: resps.StateDiffUpdate, Attrs: attrs})
+		}
+	}
+	for addr, ti := range toIns {
+		if _, ok := fromIns[addr]; !ok {
+			diffs = append(diffs, resps.StateResourceDiff{
+				Address: addr, Type: ti.Type, Action: resps.StateDiffCreate})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Address < diffs[j].Address
+	})
+
+	return diffs, changedKeys(fromState.Outputs, toState.Outputs), nil
+}
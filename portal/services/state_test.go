@@ -0,0 +1,76 @@
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models/resps"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateToken(t *testing.T) {
+	configs.Set(&configs.Config{JwtSecretKey: "test-secret"})
+
+	token, err := GenerateStateToken("run-xxx", "env-xxx", time.Minute)
+	assert.NoError(t, err)
+
+	claims, er := VerifyStateToken(token, "env-xxx")
+	assert.Nil(t, er)
+	assert.Equal(t, "run-xxx", claims.TaskId.String())
+
+	_, er = VerifyStateToken(token, "env-yyy")
+	assert.True(t, e.Is(er, e.PermissionDeny))
+
+	expired, _ := GenerateStateToken("run-xxx", "env-xxx", -time.Minute)
+	_, er = VerifyStateToken(expired, "env-xxx")
+	assert.True(t, e.Is(er, e.InvalidToken))
+
+	// 用户登录 token 不能用于访问 state
+	userToken, _ := GenerateToken("u-xxx", "user", false, time.Minute)
+	_, er = VerifyStateToken(userToken, "env-xxx")
+	assert.True(t, e.Is(er, e.InvalidToken))
+}
+
+func TestDiffStateContent(t *testing.T) {
+	from := []byte(`{
+  "version": 4, "serial": 1,
+  "outputs": {"ip": {"value": "10.0.0.1", "type": "string"}},
+  "resources": [
+    {"mode": "managed", "type": "aws_instance", "name": "web",
+     "instances": [{"index_key": 0, "attributes": {"id": "i-1", "tags": {"a": "1"}}}]},
+    {"module": "module.vpc", "mode": "managed", "type": "aws_vpc", "name": "this",
+     "instances": [{"attributes": {"id": "vpc-1"}}]},
+    {"mode": "data", "type": "aws_ami", "name": "ubuntu",
+     "instances": [{"attributes": {"id": "ami-1"}}]}
+  ]
+}`)
+	to := []byte(`{
+  "version": 4, "serial": 2,
+  "outputs": {"ip": {"value": "10.0.0.2", "type": "string"}},
+  "resources": [
+    {"mode": "managed", "type": "aws_instance", "name": "web",
+     "instances": [
+       {"index_key": 0, "attributes": {"tags": {"a": "1"}, "id": "i-1", "ami": "ami-2"}},
+       {"index_key": 1, "attributes": {"id": "i-2"}}
+     ]},
+    {"mode": "data", "type": "aws_ami", "name": "ubuntu",
+     "instances": [{"attributes": {"id": "ami-1"}}]}
+  ]
+}`)
+
+	diffs, outputs, err := DiffStateContent(from, to)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ip"}, outputs)
+	assert.Equal(t, []resps.StateResourceDiff{
+		{Address: "aws_instance.web[0]", Type: "aws_instance", Action: resps.StateDiffUpdate, Attrs: []string{"ami"}},
+		{Address: "aws_instance.web[1]", Type: "aws_instance", Action: resps.StateDiffCreate},
+		{Address: "module.vpc.aws_vpc.this", Type: "aws_vpc", Action: resps.StateDiffDelete},
+	}, diffs)
+
+	// 空 state 对比，所有资源都为新增
+	diffs, _, err = DiffStateContent(nil, from)
+	assert.NoError(t, err)
+	assert.Len(t, diffs, 3)
+}
@@ -11,6 +11,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/pkg/errors"
@@ -68,7 +69,13 @@ func SystemRunnerTags() ([]string, e.Error) {
 		if info.Service != common.RunnerServiceName {
 			continue
 		}
-		tags = append(tags, info.Tags...)
+		for _, tag := range info.Tags {
+			// 并发任务数量 tag 只用于任务调度，不作为 runner 的选择标签
+			if strings.HasPrefix(tag, RunnerMaxJobsTagPrefix) {
+				continue
+			}
+			tags = append(tags, tag)
+		}
 	}
 
 	return utils.RemoveDuplicateElement(tags), nil
@@ -4,7 +4,6 @@ package services
 
 import (
 	"cloudiac/common"
-	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
@@ -27,7 +26,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/acarl005/stripansi"
 	"github.com/alessio/shellescape"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
@@ -213,7 +211,19 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 	return doCreateTask(tx, *task, tpl, env)
 }
 
+// getTaskIacEngine 获取任务使用的 IaC 引擎及版本。环境可以覆盖模板的引擎配置，
+// 引擎与模板不一致时模板的版本号不再适用，返回空版本号(执行时使用该引擎的默认版本)
+func getTaskIacEngine(tpl *models.Template, env *models.Env) (engine string, version string) {
+	tplEngine := utils.FirstValueStr(tpl.IacEngine, common.IacEngineTerraform)
+	engine = utils.FirstValueStr(env.IacEngine, tplEngine)
+	if engine != tplEngine {
+		return engine, ""
+	}
+	return engine, tpl.TfVersion
+}
+
 func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*models.Task, e.Error) {
+	iacEngine, tfVersion := getTaskIacEngine(tpl, env)
 	firstVal := utils.FirstValueStr
 	task := models.Task{
 		// 以下为需要外部传入的属性
@@ -228,6 +238,10 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 		Revision:        firstVal(pt.Revision, env.Revision, tpl.RepoRevision),
 		CommitId:        pt.CommitId,
 		StopOnViolation: pt.StopOnViolation,
+		StateVersionId:  pt.StateVersionId,
+		Imports:         pt.Imports,
+		StateOps:        pt.StateOps,
+		Extra:           pt.Extra,
 
 		RetryDelay:  utils.FirstValueInt(pt.RetryDelay, env.RetryDelay),
 		RetryNumber: utils.FirstValueInt(pt.RetryNumber, env.RetryNumber),
@@ -242,7 +256,11 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 
 		// 任务、环境工作目录为空，工作目录就应该为空，这里不需要在引用云模板的工作目录
 		Workdir:   firstVal(pt.Workdir, env.Workdir),
-		TfVersion: tpl.TfVersion,
+		IacEngine: iacEngine,
+		TfVersion: tfVersion,
+
+		StackType:  tpl.StackType,
+		StackRoots: tpl.StackRoots,
 
 		Playbook:     env.Playbook,
 		TfVarsFile:   env.TfVarsFile,
@@ -274,6 +292,13 @@ func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *m
 		return nil, er
 	}
 
+	// 任务使用创建时环境(或项目)生效的合规检测分级处理配置
+	if pe, er := GetEnvPolicyEnforcement(tx, env); er != nil {
+		return nil, er
+	} else {
+		task.PolicyEnforcement = pe
+	}
+
 	if task.Pipeline == "" {
 		tp, err := GetTplPipeline(tx, tpl.Id, task.Revision, task.Workdir)
 		if err != nil {
@@ -288,16 +313,36 @@ func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *m
 	}
 
 	task.Flow = GetTaskFlowWithPipeline(pipeline, task.Type)
+	if task.Extra.PlanTaskId != "" {
+		if er := setTaskFromPlanTask(tx, &task); er != nil {
+			return nil, er
+		}
+	}
 	steps := make([]models.TaskStep, 0)
 	stepIndex := 0
-	for _, pipelineStep := range task.Flow.Steps {
-		taskStep, er := createTaskStep(tx, env, task, pipelineStep, stepIndex)
-		if er != nil {
-			return nil, er
+	for i, pipelineStep := range task.Flow.Steps {
+		// 并行步骤展开为同一并行组的多个步骤，并行块的 when 条件合并到每个子步骤
+		parallelGroup := ""
+		pipelineSteps := []models.PipelineStep{pipelineStep}
+		if len(pipelineStep.Parallel) > 0 {
+			parallelGroup = fmt.Sprintf("p%d", i)
+			pipelineSteps = make([]models.PipelineStep, 0, len(pipelineStep.Parallel))
+			for _, ps := range pipelineStep.Parallel {
+				ps.When = joinStepWhen(pipelineStep.When, ps.When)
+				pipelineSteps = append(pipelineSteps, ps)
+			}
 		}
-		if taskStep != nil {
-			steps = append(steps, *taskStep)
-			stepIndex += 1
+
+		for _, ps := range pipelineSteps {
+			taskStep, er := createTaskStep(tx, env, task, ps, stepIndex)
+			if er != nil {
+				return nil, er
+			}
+			if taskStep != nil {
+				taskStep.ParallelGroup = parallelGroup
+				steps = append(steps, *taskStep)
+				stepIndex += 1
+			}
 		}
 	}
 
@@ -320,6 +365,86 @@ func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *m
 	return &task, nil
 }
 
+func joinStepWhen(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return fmt.Sprintf("(%s) && (%s)", a, b)
+}
+
+// setTaskFromPlanTask 基于 plan 任务的部署任务直接执行 plan 文件，所以去掉 plan 及合规检测步骤，
+// 并使用 plan 任务的 plan 结果及合规检测结果作为本任务的结果
+func setTaskFromPlanTask(tx *db.Session, task *models.Task) e.Error {
+	planTask, er := GetTaskById(tx, task.Extra.PlanTaskId)
+	if er != nil {
+		return er
+	}
+
+	steps := make([]models.PipelineStep, 0, len(task.Flow.Steps))
+	for _, step := range task.Flow.Steps {
+		if !utils.StrInArray(step.Type, models.TaskStepPlan, models.TaskStepEnvScan, models.TaskStepOpaScan) {
+			steps = append(steps, step)
+		}
+	}
+	task.Flow.Steps = steps
+	task.PlanResult = planTask.PlanResult
+	if er := copyPlanTaskPolicyResult(tx, task, planTask); er != nil {
+		return er
+	}
+
+	if content, err := logstorage.Get().Read(planTask.PlanJsonPath()); err != nil {
+		return e.New(e.InternalError, errors.Wrap(err, "read plan json"))
+	} else if err := logstorage.Get().Write(task.PlanJsonPath(), content); err != nil {
+		return e.New(e.InternalError, errors.Wrap(err, "write plan json"))
+	}
+	return nil
+}
+
+// copyPlanTaskPolicyResult 复制 plan 任务的合规检测结果，并按本任务的分级处理配置重新计算处理结果。
+// 合规检测不通过且需要中止部署时不允许基于该 plan 任务部署
+func copyPlanTaskPolicyResult(tx *db.Session, task *models.Task, planTask *models.Task) e.Error {
+	planScanTask, er := GetMirrorScanTask(tx, planTask.Id)
+	if er != nil {
+		if er.Code() == e.TaskNotExists {
+			// plan 任务未执行合规检测
+			return nil
+		}
+		return er
+	}
+
+	results := make([]models.PolicyResult, 0)
+	if err := tx.Model(&models.PolicyResult{}).Where("task_id = ?", planTask.Id).Find(&results); err != nil {
+		return e.New(e.DBError, err)
+	}
+	for i := range results {
+		results[i].Id = 0
+		results[i].TaskId = task.Id
+		if err := tx.Insert(&results[i]); err != nil {
+			return e.New(e.DBError, errors.Wrap(err, "save policy result"))
+		}
+	}
+
+	scanTask := CreateMirrorScanTask(task)
+	scanTask.Status = planScanTask.Status
+	scanTask.Message = planScanTask.Message
+	scanTask.StartAt = planScanTask.StartAt
+	scanTask.EndAt = planScanTask.EndAt
+	scanTask.PolicyStatus = planScanTask.PolicyStatus
+	if err := tx.Insert(scanTask); err != nil {
+		return e.New(e.DBError, errors.Wrap(err, "save scan task"))
+	}
+
+	scanFailed := planScanTask.PolicyStatus == common.PolicyStatusFailed
+	if !task.PolicyEnforcement.IsEmpty() {
+		task.Result.PolicyEnforcement = EvalPolicyEnforcement(task.PolicyEnforcement, results, scanFailed)
+	}
+	if (scanFailed || planScanTask.PolicyStatus == common.PolicyStatusViolated) && PolicyViolationBlocked(task) {
+		return e.New(e.TaskPlanNotApplicable, fmt.Errorf("policy check of plan task '%s' not passed", planTask.Id),
+			http.StatusBadRequest)
+	}
+	return nil
+}
+
 // 创建任务参数检查
 func createTaskParamCheck(task models.Task) e.Error {
 	if task.Playbook != "" && task.KeyId == "" {
@@ -433,7 +558,8 @@ func getTplRepoInfo(tx *db.Session, tpl *models.Template, revision string) (*tpl
 		return nil, e.New(e.VcsError, er)
 	}
 
-	if vcs.VcsType == models.VcsGitee {
+	// bitbucket server 使用 token clone 时需要指定真实的用户名
+	if vcs.VcsType == models.VcsGitee || vcs.VcsType == models.VcsBitbucket {
 		user, er := vcsInstance.UserInfo()
 		if er != nil {
 			return nil, e.New(e.VcsError, er)
@@ -472,6 +598,10 @@ func getTplRepoInfo(tx *db.Session, tpl *models.Template, revision string) (*tpl
 		}
 		repoToken = token
 	}
+	// ssh 地址由 runner 使用自身的 ssh 配置进行 clone
+	if tpl.RepoToken == "" && vcsrv.IsGitSshVcs(vcs) {
+		repoToken = ""
+	}
 	repoInfo.Token = repoToken
 
 	return &repoInfo, nil
@@ -520,6 +650,7 @@ var stepStatus2TaskStatusMap = map[string]string{
 	models.TaskStepTimeout:   models.TaskFailed,
 	models.TaskStepAborted:   models.TaskAborted,
 	models.TaskStepComplete:  models.TaskComplete,
+	models.TaskStepSkipped:   models.TaskComplete,
 }
 
 func stepStatus2TaskStatus(s string) string {
@@ -592,6 +723,9 @@ func ChangeTaskStatus(dbSess *db.Session, task *models.Task, status, message str
 		!(preStatus == common.TaskApproving && status == common.TaskRunning) {
 		TaskStatusChangeSendMessage(task, status)
 	}
+	if preStatus != status {
+		ReportTaskCommitStatus(*task)
+	}
 
 	defer func() {
 		if task.Exited() {
@@ -636,8 +770,13 @@ func taskStatusExitedCall(dbSess *db.Session, task *models.Task, status string)
 		syncManagedResToProvider(task)
 	}
 
-	// 如果勾选提交pr自动plan，任务结束时 plan作业结果写入PR评论中
-	if task.Type == common.TaskTypePlan {
+	// 部署成功后触发依赖该环境的下游环境
+	if task.Type == common.TaskTypeApply && status == common.TaskComplete {
+		TriggerDownstreamEnvTasks(dbSess, task)
+	}
+
+	// 如果勾选提交pr自动plan(或者通过 PR 评论命令执行任务)，任务结束时作业结果写入PR评论中
+	if task.Type == common.TaskTypePlan || task.Type == common.TaskTypeApply {
 		SendVcsComment(dbSess, task, status)
 	}
 }
@@ -659,6 +798,9 @@ type TfStateModule struct {
 	Address      string            `json:"address"`
 	Resources    []TfStateResource `json:"resources"`
 	ChildModules []TfStateModule   `json:"child_modules,omitempty"`
+
+	// 多工作目录模板的 state 由 runner 合并，每个根目录为一个子模块，该字段为根目录路径
+	StackRoot string `json:"cloudiac_stack_root,omitempty"`
 }
 
 type TfStateVariable struct {
@@ -707,6 +849,11 @@ func TraverseStateModule(module *TfStateModule) (rs []*models.Resource) {
 	for i := range module.ChildModules {
 		rs = append(rs, TraverseStateModule(&module.ChildModules[i])...)
 	}
+	if module.StackRoot != "" {
+		for _, r := range rs {
+			r.StackRoot = module.StackRoot
+		}
+	}
 	return rs
 }
 
@@ -714,7 +861,7 @@ func SaveTaskResources(tx *db.Session, task *models.Task, values TfStateValues,
 
 	bq := utils.NewBatchSQL(1024, "INSERT INTO", models.Resource{}.TableName(),
 		"id", "org_id", "project_id", "env_id", "task_id", "provider", "module",
-		"address", "mode", "type", "name", "index", "attrs", "sensitive_keys", "applied_at", "res_id", "dependencies", "res_name")
+		"address", "mode", "type", "name", "index", "attrs", "sensitive_keys", "applied_at", "res_id", "dependencies", "res_name", "stack_root")
 
 	rs := make([]*models.Resource, 0)
 	rs = append(rs, TraverseStateModule(&values.RootModule)...)
@@ -777,7 +924,7 @@ func SaveTaskResources(tx *db.Session, task *models.Task, values TfStateValues,
 		}
 
 		err := bq.AddRow(models.NewId("r"), task.OrgId, task.ProjectId, task.EnvId, task.Id, r.Provider,
-			r.Module, r.Address, r.Mode, r.Type, r.Name, r.Index, r.Attrs, r.SensitiveKeys, r.AppliedAt, resId, r.Dependencies, resName)
+			r.Module, r.Address, r.Mode, r.Type, r.Name, r.Index, r.Attrs, r.SensitiveKeys, r.AppliedAt, resId, r.Dependencies, resName, r.StackRoot)
 		if err != nil {
 			return err
 		}
@@ -984,15 +1131,32 @@ func fetchTaskStepLog(ctx context.Context, task models.Tasker, writer io.Writer,
 	}
 
 	if step.IsExited() {
-		var content []byte
-		if content, err = storage.Read(step.LogPath); err != nil {
-			if os.IsNotExist(err) {
-				// 当前步骤没有日志文件
+		// 非 db 存储保存的是完整日志，可能会很大，所以分段读取
+		var (
+			offset  int64
+			content []byte
+		)
+		for {
+			if content, err = storage.ReadRange(step.LogPath, offset, consts.LogReadChunkSize); err != nil {
+				if os.IsNotExist(err) {
+					// 当前步骤没有日志文件
+					return nil
+				}
+				return err
+			} else if _, err = writer.Write(content); err != nil {
+				return err
+			}
+
+			if int64(len(content)) < consts.LogReadChunkSize {
+				break
+			}
+			offset += int64(len(content))
+
+			select {
+			case <-ctx.Done():
 				return nil
+			default:
 			}
-			return err
-		} else if _, err = writer.Write(content); err != nil {
-			return err
 		}
 	} else if step.IsStarted() { // running
 		sleepDuration := consts.DbTaskPollInterval
@@ -1146,6 +1310,7 @@ func TaskStatusChangeSendMessage(task *models.Task, status string) {
 //
 //	"status", "policy_status", "message", "start_at", "end_at"
 func ChangeScanTaskStatus(dbSess *db.Session, task *models.ScanTask, status, policyStatus, message string) e.Error {
+	preStatus := task.Status
 	if task.Status == status && task.PolicyStatus == policyStatus && message == "" {
 		return nil
 	}
@@ -1178,6 +1343,9 @@ func ChangeScanTaskStatus(dbSess *db.Session, task *models.ScanTask, status, pol
 	if _, err := dbSess.Model(task).Where("id = ?", task.Id).UpdateAttrs(updateAttrs); err != nil {
 		return e.AutoNew(err, e.DBError)
 	}
+	if status != "" && status != preStatus {
+		ReportScanTaskCommitStatus(*task)
+	}
 
 	return nil
 }
@@ -1428,15 +1596,61 @@ func QueryTaskStepsById(query *db.Session, taskId models.Id) *db.Session {
 
 // 查询任务下某一个单独步骤的具体执行日志
 func GetTaskStepLogById(tx *db.Session, stepId models.Id) ([]byte, e.Error) {
-	query := tx.Joins("left join iac_task_step on iac_task_step.log_path=iac_storage.path").
-		Where("iac_task_step.id = ?", stepId).
-		LazySelectAppend("iac_storage.content as `content`")
+	step := models.TaskStep{}
+	if err := tx.Where("id = ?", stepId).Find(&step); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if step.LogPath == "" {
+		return nil, nil
+	}
+
+	content, err := logstorage.Get().Read(step.LogPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// 当前步骤没有日志文件
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return content, nil
+}
+
+// SaveTaskStepStackLogs 保存多工作目录模板的步骤在各根目录的执行日志，并记录步骤执行的根目录
+func SaveTaskStepStackLogs(tx *db.Session, step *models.TaskStep, stackLogs []runner.StackLog) e.Error {
+	roots := make(models.StrSlice, 0, len(stackLogs))
+	for _, l := range stackLogs {
+		if err := logstorage.Get().Write(step.StackLogPath(l.Root), logstorage.CutLogContent(l.Content)); err != nil {
+			return e.New(e.InternalError, fmt.Errorf("write stack root %s log: %v", l.Root, err))
+		}
+		roots = append(roots, l.Root)
+	}
+
+	step.StackRoots = roots
+	if _, err := tx.Model(&models.TaskStep{}).Where("id = ?", step.Id).
+		UpdateAttrs(models.Attrs{"stack_roots": roots}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// GetTaskStepStackLogById 查询多工作目录模板的步骤在某个根目录的执行日志
+func GetTaskStepStackLogById(tx *db.Session, stepId models.Id, root string) ([]byte, e.Error) {
+	step, err := GetTaskStepByStepId(tx, stepId)
+	if err != nil {
+		return nil, e.AutoNew(err, e.DBError)
+	}
+	if !utils.StrInArray(root, step.StackRoots...) {
+		return nil, e.New(e.BadParam, fmt.Errorf("step has no log of stack root '%s'", root))
+	}
 
-	var dbStorage models.DBStorage
-	if err := query.Find(&dbStorage); err != nil {
+	content, err := logstorage.Get().Read(step.StackLogPath(root))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
 		return nil, e.New(e.DBError, err)
 	}
-	return dbStorage.Content, nil
+	return content, nil
 }
 
 func GetTaskStepLogByErrorCode(dbSess *db.Session, errorCode string) (*models.ErrorMapping, e.Error) {
@@ -1669,53 +1883,6 @@ func InsertCornTaskInfo(session *db.Session, resDrift models.ResourceDrift) {
 	}
 }
 
-func SendVcsComment(session *db.Session, task *models.Task, taskStatus string) {
-	env, er := GetEnvById(session, task.EnvId)
-	if er != nil {
-		logs.Get().Errorf("vcs comment err, get env detail data err: %v", er)
-		return
-	}
-
-	vp, err := GetVcsPrByTaskId(session, task)
-	if err != nil {
-		if !e.IsRecordNotFound(err) {
-			logs.Get().Errorf("vcs comment err, get vcs pr data err: %v", err)
-		}
-		return
-	}
-
-	vcs, er := GetVcsRepoByTplId(session, task.TplId)
-	if er != nil {
-		logs.Get().Errorf("vcs comment err, get vcs data err: %v", er)
-		return
-	}
-	taskStep, er := GetTaskPlanStep(session, task.Id)
-	if er != nil {
-		logs.Get().Errorf("vcs comment err, get task step data err: %v", er)
-		return
-	}
-
-	logContent, err := logstorage.Get().Read(taskStep.LogPath)
-	if err != nil {
-		logs.Get().Errorf("vcs comment err, get task plan log err: %v", err)
-		return
-	}
-
-	attr := map[string]interface{}{
-		"Status": taskStatus,
-		"Name":   env.Name,
-		//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
-		"Addr":    fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s", configs.Get().Portal.Address, task.OrgId, task.ProjectId, task.EnvId, task.Id),
-		"Content": stripansi.Strip(string(logContent)),
-	}
-
-	content := utils.SprintTemplate(consts.PrCommentTpl, attr)
-	if err := vcs.CreatePrComment(vp.PrId, content); err != nil {
-		logs.Get().Errorf("vcs comment err, create comment err: %v", err)
-		return
-	}
-}
-
 func QueryResource(dbSess *db.Session, task *models.Task) *db.Session {
 	return dbSess.Table("iac_resource as r").
 		Joins("inner join iac_resource_drift as rd on rd.address =  r.address  and rd.env_id = ? ", task.EnvId).
@@ -0,0 +1,151 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+func QueryTaskArtifacts(query *db.Session, taskId models.Id) *db.Session {
+	return query.Model(&models.TaskArtifact{}).Where("task_id = ?", taskId).Order("step_index, name")
+}
+
+func GetTaskArtifactById(query *db.Session, taskId models.Id, id models.Id) (*models.TaskArtifact, e.Error) {
+	artifact := models.TaskArtifact{}
+	if err := query.Where("task_id = ? AND id = ?", taskId, id).First(&artifact); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TaskArtifactNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &artifact, nil
+}
+
+func GetTaskArtifactContent(artifact *models.TaskArtifact) ([]byte, e.Error) {
+	content, err := logstorage.Get().Read(artifact.Path)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return content, nil
+}
+
+// SaveTaskStepArtifacts 保存步骤收集的 artifacts，content 为 runner 返回的 zip 内容。
+// 步骤重试时会覆盖之前保存的记录
+func SaveTaskStepArtifacts(tx *db.Session, task *models.Task, step *models.TaskStep, content []byte) e.Error {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return e.New(e.InternalError, fmt.Errorf("read artifacts: %v", err))
+	}
+
+	if _, err := tx.Where("step_id = ?", step.Id).Delete(&models.TaskArtifact{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	for _, f := range reader.File {
+		name := path.Clean(f.Name)
+		if f.FileInfo().IsDir() || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			continue
+		}
+
+		data, err := readZipFile(f)
+		if err != nil {
+			return e.New(e.InternalError, fmt.Errorf("read artifact %s: %v", name, err))
+		}
+
+		artifact := models.TaskArtifact{
+			OrgId:     task.OrgId,
+			ProjectId: task.ProjectId,
+			EnvId:     task.EnvId,
+			TaskId:    task.Id,
+			StepId:    step.Id,
+			StepIndex: step.Index,
+			Name:      name,
+			Size:      len(data),
+			Path: path.Join(task.ProjectId.String(), task.EnvId.String(), task.Id.String(),
+				"artifacts", fmt.Sprintf("step%d", step.Index), name),
+		}
+		artifact.Id = artifact.NewId()
+		if err := logstorage.Get().Write(artifact.Path, data); err != nil {
+			return e.New(e.DBError, err)
+		}
+		if err := models.Create(tx, &artifact); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	return nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// GetTaskInputArtifacts 获取部署任务启动时恢复的 artifacts，返回 zip 格式的内容。
+// 基于 plan 任务部署时使用该 plan 任务的 artifacts，否则使用环境中最近一个执行成功的 plan 或部署任务的 artifacts。
+// 同名文件以后执行的步骤为准，没有 artifacts 时返回 nil
+func GetTaskInputArtifacts(query *db.Session, task *models.Task) ([]byte, e.Error) {
+	srcTaskId := task.Extra.PlanTaskId
+	if srcTaskId == "" {
+		taskIdQuery := query.Model(&models.Task{}).Select("id").
+			Where("env_id = ? AND id != ?", task.EnvId, task.Id).
+			Where("type IN (?) AND status = ?", []string{models.TaskTypePlan, models.TaskTypeApply}, models.TaskComplete)
+		latest := models.TaskArtifact{}
+		if err := query.Where("env_id = ? AND task_id IN (?)", task.EnvId, taskIdQuery.Expr()).
+			Order("created_at DESC").First(&latest); err != nil {
+			if e.IsRecordNotFound(err) {
+				return nil, nil
+			}
+			return nil, e.New(e.DBError, err)
+		}
+		srcTaskId = latest.TaskId
+	}
+
+	artifacts := make([]*models.TaskArtifact, 0)
+	if err := QueryTaskArtifacts(query, srcTaskId).Find(&artifacts); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(artifacts) == 0 {
+		return nil, nil
+	}
+	files := make(map[string]*models.TaskArtifact)
+	names := make([]string, 0, len(artifacts))
+	for _, a := range artifacts {
+		if _, ok := files[a.Name]; !ok {
+			names = append(names, a.Name)
+		}
+		files[a.Name] = a
+	}
+
+	buf := bytes.Buffer{}
+	writer := zip.NewWriter(&buf)
+	for _, name := range names {
+		content, er := GetTaskArtifactContent(files[name])
+		if er != nil {
+			return nil, er
+		}
+		w, err := writer.Create(name)
+		if err != nil {
+			return nil, e.New(e.InternalError, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, e.New(e.InternalError, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, e.New(e.InternalError, err)
+	}
+	return buf.Bytes(), nil
+}
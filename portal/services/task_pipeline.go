@@ -54,6 +54,12 @@ func GetTplPipeline(sess *db.Session, tplId models.Id, revision, workdir string)
 
 // 从 pipeline 中返回指定 typ 的 task，如果 pipeline 中未定义该类型 task 则返回默认 pipeline 中的值
 func GetTaskFlowWithPipeline(p models.IPipeline, typ string) models.PipelineTaskFlow {
+	if flow, ok := models.GetBuiltinTaskFlow(typ); ok {
+		// 内置任务使用与 apply 任务相同的镜像
+		flow.Image = GetTaskFlowWithPipeline(p, common.TaskTypeApply).Image
+		return flow
+	}
+
 	defaultPipeline := models.MustGetPipelineByVersion(models.DefaultPipelineVersion)
 
 	flow := defaultPipeline.GetTaskFlowWithPipeline(typ)
@@ -93,6 +99,10 @@ func DecodePipeline(s string) (models.IPipeline, error) {
 		return models.NewPipelineDot5(s)
 	}
 
+	if ver == "0.6" {
+		return models.NewPipelineDot6(s)
+	}
+
 	return nil, e.New(e.InvalidPipelineVersion)
 }
 
@@ -0,0 +1,233 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/resps"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 任务调度优先级，值越小越先执行
+const (
+	TaskPriorityManual  = 0 // 手动或通过 api 触发的任务
+	TaskPriorityWebhook = 1 // webhook、自动部署、自动销毁等系统触发的任务
+	TaskPriorityDrift   = 2 // 定时偏移检测任务
+	TaskPriorityScan    = 3 // 合规扫描任务
+)
+
+// TaskPriority 获取任务的调度优先级
+func TaskPriority(task models.Tasker) int {
+	t, ok := task.(*models.Task)
+	if !ok {
+		return TaskPriorityScan
+	}
+	switch {
+	case t.IsDriftTask || t.Source == consts.TaskSourceDriftPlan || t.Source == consts.TaskSourceDriftApply:
+		return TaskPriorityDrift
+	case t.Source == "" || t.Source == consts.TaskSourceManual || t.Source == consts.TaskSourceApi:
+		return TaskPriorityManual
+	default:
+		return TaskPriorityWebhook
+	}
+}
+
+// PendingTaskPriorityOrder 查询部署任务时按调度优先级排序的 order 表达式，与 TaskPriority 保持一致
+func PendingTaskPriorityOrder() string {
+	return fmt.Sprintf("CASE WHEN iac_task.is_drift_task OR iac_task.source IN ('%s', '%s') THEN %d "+
+		"WHEN iac_task.source IN ('', '%s', '%s') THEN %d ELSE %d END, iac_task.created_at",
+		consts.TaskSourceDriftPlan, consts.TaskSourceDriftApply, TaskPriorityDrift,
+		consts.TaskSourceManual, consts.TaskSourceApi, TaskPriorityManual, TaskPriorityWebhook)
+}
+
+func taskProjectId(task models.Tasker) models.Id {
+	switch t := task.(type) {
+	case *models.Task:
+		return t.ProjectId
+	case *models.ScanTask:
+		return t.ProjectId
+	}
+	return ""
+}
+
+func taskCreatedAt(task models.Tasker) time.Time {
+	switch t := task.(type) {
+	case *models.Task:
+		return time.Time(t.CreatedAt)
+	case *models.ScanTask:
+		return time.Time(t.CreatedAt)
+	}
+	return time.Time{}
+}
+
+// SortPendingTasks 计算等待任务的调度顺序:
+//   - 优先级高的任务先执行(手动 > webhook > 定时偏移检测 > 扫描)
+//   - 同一优先级内按项目轮转，正在执行(含本次已排在前面)任务数较少的项目优先，
+//     避免单个项目的大量任务占满 runner
+//   - 同一项目内按创建时间先后执行
+//
+// projectRunning 为每个项目当前正在执行的任务数量
+func SortPendingTasks(tasks []models.Tasker, projectRunning map[models.Id]int) []models.Tasker {
+	sorted := make([]models.Tasker, len(tasks))
+	copy(sorted, tasks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		pi, pj := TaskPriority(sorted[i]), TaskPriority(sorted[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return taskCreatedAt(sorted[i]).Before(taskCreatedAt(sorted[j]))
+	})
+
+	result := make([]models.Tasker, 0, len(sorted))
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && TaskPriority(sorted[end]) == TaskPriority(sorted[start]) {
+			end++
+		}
+		result = append(result, fairQueue(sorted[start:end], projectRunning)...)
+		start = end
+	}
+	return result
+}
+
+// fairQueue 对同一优先级的任务(已按创建时间排序)按项目轮转排序
+func fairQueue(tasks []models.Tasker, projectRunning map[models.Id]int) []models.Tasker {
+	queues := make(map[models.Id][]models.Tasker)
+	projects := make([]models.Id, 0) // 按各项目第一个任务的创建时间排序
+	for _, t := range tasks {
+		pid := taskProjectId(t)
+		if _, ok := queues[pid]; !ok {
+			projects = append(projects, pid)
+		}
+		queues[pid] = append(queues[pid], t)
+	}
+
+	counts := make(map[models.Id]int, len(projects))
+	for _, pid := range projects {
+		counts[pid] = projectRunning[pid]
+	}
+
+	result := make([]models.Tasker, 0, len(tasks))
+	for len(result) < len(tasks) {
+		var next models.Id
+		found := false
+		for _, pid := range projects {
+			if len(queues[pid]) == 0 {
+				continue
+			}
+			if !found || counts[pid] < counts[next] ||
+				(counts[pid] == counts[next] && taskCreatedAt(queues[pid][0]).Before(taskCreatedAt(queues[next][0]))) {
+				next, found = pid, true
+			}
+		}
+		result = append(result, queues[next][0])
+		queues[next] = queues[next][1:]
+		counts[next]++
+	}
+	return result
+}
+
+// GetRunningTaskNum 统计正在执行的任务数量，返回每个 runner 及每个项目的任务数
+func GetRunningTaskNum(query *db.Session) (map[string]int, map[models.Id]int, e.Error) {
+	type runningCount struct {
+		RunnerId  string
+		ProjectId models.Id
+		Count     int
+	}
+
+	runnerNum := make(map[string]int)
+	projectNum := make(map[models.Id]int)
+	for _, q := range []*db.Session{
+		query.Model(&models.Task{}).Where("status = ?", models.TaskRunning),
+		query.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0", models.TaskRunning),
+	} {
+		counts := make([]runningCount, 0)
+		if err := q.Select("runner_id, project_id, COUNT(*) AS count").
+			Group("runner_id, project_id").Scan(&counts); err != nil {
+			return nil, nil, e.New(e.DBError, err)
+		}
+		for _, c := range counts {
+			runnerNum[c.RunnerId] += c.Count
+			projectNum[c.ProjectId] += c.Count
+		}
+	}
+	return runnerNum, projectNum, nil
+}
+
+// GetRunnerMaxJobs 获取 runner 的并发任务数量，runner 未声明时使用全局配置
+func GetRunnerMaxJobs(runnersMaxJobs map[string]int, runnerId string) int {
+	if n := runnersMaxJobs[runnerId]; n > 0 {
+		return n
+	}
+	return GetRunnerMax()
+}
+
+// GetTaskQueuePosition 计算等待中的部署任务在所属 runner 队列中的位置。
+// 同一环境的任务串行执行，环境中有更早的等待任务时以该环境第一个等待任务的位置为准
+func GetTaskQueuePosition(query *db.Session, task *models.Task) (*resps.TaskQueueResp, e.Error) {
+	resp := resps.TaskQueueResp{
+		TaskId:   task.Id,
+		Status:   task.Status,
+		Priority: TaskPriority(task),
+		RunnerId: task.RunnerId,
+	}
+
+	runnerNum, projectNum, er := GetRunningTaskNum(query)
+	if er != nil {
+		return nil, er
+	}
+	resp.RunnerRunning = runnerNum[task.RunnerId]
+	// consul 不可用时不影响队列查询，使用全局配置
+	runnersMaxJobs, _ := GetRunnersMaxJobs()
+	resp.RunnerMaxJobs = GetRunnerMaxJobs(runnersMaxJobs, task.RunnerId)
+
+	if task.Status != models.TaskPending {
+		return &resp, nil
+	}
+
+	deployTasks := make([]*models.Task, 0)
+	if err := query.Model(&models.Task{}).Where("status = ? AND runner_id = ?", models.TaskPending, task.RunnerId).
+		Order("created_at, id").Find(&deployTasks); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	scanTasks := make([]*models.ScanTask, 0)
+	if err := query.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0 AND runner_id = ?",
+		models.TaskPending, task.RunnerId).Find(&scanTasks); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	// 每个环境只有第一个等待任务可以被调度
+	envHead := make(map[models.Id]models.Id)
+	tasks := make([]models.Tasker, 0, len(deployTasks)+len(scanTasks))
+	for _, t := range deployTasks {
+		if _, ok := envHead[t.EnvId]; !ok {
+			envHead[t.EnvId] = t.Id
+			tasks = append(tasks, t)
+		}
+	}
+	for _, t := range deployTasks {
+		if t.Id == task.Id {
+			break
+		} else if t.EnvId == task.EnvId {
+			resp.EnvAhead++
+		}
+	}
+	for _, t := range scanTasks {
+		tasks = append(tasks, t)
+	}
+
+	headId := envHead[task.EnvId]
+	for i, t := range SortPendingTasks(tasks, projectNum) {
+		if t.GetId() == headId {
+			resp.Position = i + 1
+			break
+		}
+	}
+	resp.Total = len(tasks)
+	return &resp, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortPendingTasks(t *testing.T) {
+	now := time.Now()
+	newTask := func(id string, project string, source string, drift bool, minutes int) *models.Task {
+		task := &models.Task{ProjectId: models.Id(project), Source: source, IsDriftTask: drift}
+		task.Id = models.Id(id)
+		task.CreatedAt = models.Time(now.Add(time.Duration(minutes) * time.Minute))
+		return task
+	}
+	scan := &models.ScanTask{ProjectId: "p-1"}
+	scan.Id = "scan"
+	scan.CreatedAt = models.Time(now)
+
+	tasks := []models.Tasker{
+		scan,
+		newTask("drift-1", "p-1", consts.TaskSourceDriftPlan, true, 0),
+		newTask("drift-2", "p-1", consts.TaskSourceDriftPlan, true, 1),
+		newTask("drift-3", "p-2", consts.TaskSourceDriftPlan, true, 2),
+		newTask("webhook", "p-1", consts.TaskSourceWebhookPlan, false, 3),
+		newTask("manual-1", "p-1", consts.TaskSourceManual, false, 4),
+		newTask("manual-2", "p-1", consts.TaskSourceManual, false, 5),
+		newTask("api", "p-2", consts.TaskSourceApi, false, 6),
+	}
+
+	ids := make([]models.Id, 0)
+	// p-1 已有一个正在执行的任务，同一优先级内 p-2 优先
+	for _, task := range SortPendingTasks(tasks, map[models.Id]int{"p-1": 1}) {
+		ids = append(ids, task.GetId())
+	}
+	assert.Equal(t, []models.Id{
+		"api", "manual-1", "manual-2",
+		"webhook",
+		"drift-3", "drift-1", "drift-2",
+		"scan",
+	}, ids)
+}
@@ -169,8 +169,13 @@ func newTaskStep(task models.Task, stepBody models.PipelineStep, index int) *mod
 		RetryNumber:  task.RetryNumber,
 	}
 
-	// apply 和 destroy 步骤需要审批
-	if !task.AutoApprove && (s.Type == common.TaskStepTfApply || s.Type == common.TaskStepTfDestroy) {
+	// apply、destroy 和 import 步骤需要审批
+	if !task.AutoApprove && (s.Type == common.TaskStepTfApply || s.Type == common.TaskStepTfDestroy ||
+		s.Type == common.TaskStepTfImport) {
+		s.MustApproval = true
+	}
+	// 恢复 state 及 state 操作会直接修改环境当前的 state，不论是否开启自动审批都需要审批
+	if s.Type == common.TaskStepStateRestore || s.Type == common.TaskStepStateOperation {
 		s.MustApproval = true
 	}
 
@@ -238,9 +243,13 @@ func CreateTaskCallbackStep(sess *db.Session, task models.Task, stepBody models.
 }
 
 func GetTaskPlanStep(sess *db.Session, taskId models.Id) (*models.TaskStep, e.Error) {
+	return getTaskStepByType(sess, taskId, common.TaskStepTfPlan)
+}
+
+func getTaskStepByType(sess *db.Session, taskId models.Id, stepType string) (*models.TaskStep, e.Error) {
 	taskStep := models.TaskStep{}
 	err := sess.Where("task_id = ?", taskId).
-		Where("type = ?", common.TaskStepTfPlan).First(&taskStep)
+		Where("type = ?", stepType).First(&taskStep)
 	if err != nil {
 		if e.IsRecordNotFound(err) {
 			return nil, e.New(e.TaskStepNotExists)
@@ -36,6 +36,10 @@ type exportedTpl struct {
 	Playbook     string `json:"playbook"`
 	PlayVarsFile string `json:"playVarsFile"`
 	TfVersion    string `json:"tfVersion"`
+	IacEngine    string `json:"iacEngine,omitempty"`
+
+	StackType  string          `json:"stackType,omitempty"`
+	StackRoots models.StrSlice `json:"stackRoots,omitempty"`
 
 	Variables   []exportedTplVar `json:"variables"`
 	VarGroupIds []models.Id      `json:"varGroupIds"`
@@ -143,6 +147,9 @@ func appendTemplate(tpls []models.Template, vars []models.Variable, dbSess *db.S
 			Playbook:     t.Playbook,
 			PlayVarsFile: t.PlayVarsFile,
 			TfVersion:    t.TfVersion,
+			IacEngine:    t.IacEngine,
+			StackType:    t.StackType,
+			StackRoots:   t.StackRoots,
 			Variables:    []exportedTplVar{},
 		}
 
@@ -420,6 +420,9 @@ func (t *TplImporter) getTplFromExportData(tpl exportedTpl) (*models.Template, e
 		PlayVarsFile:   tpl.PlayVarsFile,
 		LastScanTaskId: "",
 		TfVersion:      tpl.TfVersion,
+		IacEngine:      tpl.IacEngine,
+		StackType:      tpl.StackType,
+		StackRoots:     tpl.StackRoots,
 	}
 	newTpl.Id = models.Id(tpl.Id)
 
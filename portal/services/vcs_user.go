@@ -0,0 +1,82 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+)
+
+func CreateVcsUser(tx *db.Session, vu models.VcsUser) (*models.VcsUser, e.Error) {
+	if vu.Id == "" {
+		vu.Id = vu.NewId()
+	}
+	if err := models.Create(tx, &vu); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.VcsUserAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &vu, nil
+}
+
+func QueryVcsUser(query *db.Session, vcsId models.Id) *db.Session {
+	u := models.User{}.TableName()
+	return query.Model(&models.VcsUser{}).
+		Joins("LEFT JOIN "+u+" AS u ON u.id = iac_vcs_user.user_id").
+		Where("iac_vcs_user.vcs_id = ?", vcsId).
+		LazySelectAppend("iac_vcs_user.*, u.name AS user_name, u.email AS user_email").
+		Order("iac_vcs_user.vcs_user")
+}
+
+func DeleteVcsUser(tx *db.Session, vcsId models.Id, id models.Id) e.Error {
+	if affected, err := tx.Where("id = ? AND vcs_id = ?", id, vcsId).Delete(&models.VcsUser{}); err != nil {
+		return e.New(e.DBError, err)
+	} else if affected == 0 {
+		return e.New(e.VcsUserNotExists)
+	}
+	return nil
+}
+
+// GetUserIdByVcsUser 查询 vcs 用户映射的 CloudIaC 用户，未配置映射时返回 VcsUserNotExists 错误
+func GetUserIdByVcsUser(sess *db.Session, vcsId models.Id, vcsUser string) (models.Id, e.Error) {
+	if vcsUser == "" {
+		return "", e.New(e.VcsUserNotExists)
+	}
+	vu := models.VcsUser{}
+	if err := sess.Where("vcs_id = ? AND vcs_user = ?", vcsId, vcsUser).First(&vu); err != nil {
+		if e.IsRecordNotFound(err) {
+			return "", e.New(e.VcsUserNotExists, err)
+		}
+		return "", e.New(e.DBError, err)
+	}
+	return vu.UserId, nil
+}
+
+// EnvLockByPr 将未锁定的环境锁定到 PR，锁定后只有该 PR 的评论命令可以在环境上执行任务，
+// 环境已被锁定时返回 EnvLocked 错误
+func EnvLockByPr(sess *db.Session, envId models.Id, prId int) e.Error {
+	affected, err := sess.Model(&models.Env{}).Where("id = ? AND locked = ?", envId, false).
+		UpdateAttrs(models.Attrs{"locked": true, "locked_pr_id": prId})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if affected == 0 {
+		return e.New(e.EnvLocked)
+	}
+	return nil
+}
+
+// EnvUnlockByPr 解除云模板下被 PR 锁定的环境，返回解锁的环境数量
+func EnvUnlockByPr(sess *db.Session, tplIds []models.Id, prId int) (int64, e.Error) {
+	if len(tplIds) == 0 || prId == 0 {
+		return 0, nil
+	}
+	affected, err := sess.Model(&models.Env{}).
+		Where("tpl_id IN (?) AND locked_pr_id = ?", tplIds, prId).
+		UpdateAttrs(models.Attrs{"locked": false, "locked_pr_id": 0})
+	if err != nil {
+		return 0, e.New(e.DBError, err)
+	}
+	return affected, nil
+}
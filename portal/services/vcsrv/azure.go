@@ -0,0 +1,554 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+/*
+Azure DevOps Repos vcs 实现，vcs 地址为组织(或 Azure DevOps Server collection)地址，
+如 https://dev.azure.com/myorg，token 为 personal access token
+*/
+
+import (
+	"bytes"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const azureApiVersion = "6.0"
+
+// azure service hook 事件类型
+const (
+	AzureEventPush      = "git.push"
+	AzureEventPrCreated = "git.pullrequest.created"
+	AzureEventPrMerged  = "git.pullrequest.merged"
+
+	AzureEventPrUpdated   = "git.pullrequest.updated" // pr 被放弃(abandoned)时也是该事件
+	AzureEventPrCommented = "ms.vss-code.git-pullrequest-comment-event"
+)
+
+func newAzureInstance(vcs *models.Vcs) (VcsIface, error) {
+	vcs.Address = strings.TrimRight(utils.GetUrl(vcs.Address), "/")
+	return &azureVcs{vcs: vcs}, nil
+}
+
+type azureVcs struct {
+	vcs *models.Vcs
+}
+
+type azureRepository struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"defaultBranch"` // refs/heads/main
+	RemoteUrl     string `json:"remoteUrl"`
+	SshUrl        string `json:"sshUrl"`
+	WebUrl        string `json:"webUrl"`
+	Project       struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"project"`
+}
+
+type azureList struct {
+	Count int             `json:"count"`
+	Value json.RawMessage `json:"value"`
+}
+
+// apiPath 生成组织级别的 api 地址
+func (a *azureVcs) apiPath(p string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("api-version", azureApiVersion)
+	return a.vcs.Address + "/_apis" + p + "?" + query.Encode()
+}
+
+func (a *azureVcs) GetRepo(idOrPath string) (RepoIface, error) {
+	repo := azureRepository{}
+	if err := azureGetJson(a.apiPath("/git/repositories/"+url.PathEscape(idOrPath), nil), a.vcs.VcsToken, &repo); err != nil {
+		if strings.Contains(err.Error(), "404") {
+			return nil, e.New(e.ObjectNotExists, err)
+		}
+		return nil, e.New(e.VcsError, err)
+	}
+	return &azureRepoIface{azureVcs: a, repository: &repo}, nil
+}
+
+// ListRepos azure 仓库列表接口不支持分页及搜索，查询后在本地过滤。namespace 为项目名称
+func (a *azureVcs) ListRepos(namespace, search string, limit, offset int) ([]RepoIface, int64, error) {
+	link := a.apiPath("/git/repositories", nil)
+	if namespace != "" {
+		link = fmt.Sprintf("%s/%s/_apis/git/repositories?api-version=%s",
+			a.vcs.Address, url.PathEscape(namespace), azureApiVersion)
+	}
+
+	list := azureList{}
+	if err := azureGetJson(link, a.vcs.VcsToken, &list); err != nil {
+		return nil, 0, e.New(e.VcsError, err)
+	}
+	repos := make([]*azureRepository, 0)
+	_ = json.Unmarshal(list.Value, &repos)
+
+	matched := make([]*azureRepository, 0)
+	for _, r := range repos {
+		if search == "" || strings.Contains(strings.ToLower(r.Name), strings.ToLower(search)) {
+			matched = append(matched, r)
+		}
+	}
+	total := int64(len(matched))
+	if offset < len(matched) {
+		matched = matched[offset:]
+	} else {
+		matched = matched[:0]
+	}
+	if limit != 0 && len(matched) > limit {
+		matched = matched[:limit]
+	}
+
+	repoList := make([]RepoIface, 0, len(matched))
+	for _, r := range matched {
+		repoList = append(repoList, &azureRepoIface{azureVcs: a, repository: r})
+	}
+	return repoList, total, nil
+}
+
+func (a *azureVcs) UserInfo() (UserInfo, error) {
+	return UserInfo{}, nil
+}
+
+// TokenCheck token 无效时 azure 会返回 203 及登录页面，所以只有返回 200 才认为 token 有效
+func (a *azureVcs) TokenCheck() error {
+	response, _, err := azureRequest(a.apiPath("/git/repositories", nil), http.MethodGet, a.vcs.VcsToken, nil)
+	if err != nil {
+		return e.New(e.VcsError, err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return e.New(e.VcsInvalidToken, fmt.Sprintf("token valid check response code: %d", response.StatusCode))
+	}
+	return nil
+}
+
+func (a *azureVcs) RepoBaseHttpAddr() string {
+	return a.vcs.Address
+}
+
+type azureRepoIface struct {
+	*azureVcs
+	repository *azureRepository
+
+	// ListWebhook 查询到的 service hook 订阅 id，key 为返回的 RepoHook.Id。
+	// azure 的订阅 id 为字符串，且每个事件类型一个订阅，所以删除 webhook 时通过该映射查找
+	subscriptions map[int][]string
+}
+
+func (a *azureRepoIface) repoPath(p string, query url.Values) string {
+	return a.apiPath(fmt.Sprintf("/git/repositories/%s%s", a.repository.Id, p), query)
+}
+
+func (a *azureRepoIface) listRefs(filter string) ([]string, error) {
+	list := azureList{}
+	if err := azureGetJson(a.repoPath("/refs", url.Values{"filter": []string{filter}}), a.vcs.VcsToken, &list); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	refs := make([]struct {
+		Name     string `json:"name"`
+		ObjectId string `json:"objectId"`
+	}, 0)
+	_ = json.Unmarshal(list.Value, &refs)
+
+	names := make([]string, 0, len(refs))
+	for _, r := range refs {
+		names = append(names, strings.TrimPrefix(r.Name, "refs/"+filter))
+	}
+	return names, nil
+}
+
+func (a *azureRepoIface) ListBranches() ([]string, error) {
+	return a.listRefs("heads/")
+}
+
+func (a *azureRepoIface) ListTags() ([]string, error) {
+	return a.listRefs("tags/")
+}
+
+var commitIdRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// versionQuery 生成查询指定版本(分支、tag 或 commit)内容的参数
+func azureVersionQuery(ref string) url.Values {
+	versionType := "branch"
+	if commitIdRegex.MatchString(ref) {
+		versionType = "commit"
+	}
+	return url.Values{
+		"versionDescriptor.version":     []string{ref},
+		"versionDescriptor.versionType": []string{versionType},
+	}
+}
+
+func (a *azureRepoIface) BranchCommitId(branch string) (string, error) {
+	for _, filter := range []string{"heads/", "tags/"} {
+		list := azureList{}
+		path := a.repoPath("/refs", url.Values{"filter": []string{filter + branch}, "peelTags": []string{"true"}})
+		if err := azureGetJson(path, a.vcs.VcsToken, &list); err != nil {
+			return "", e.New(e.VcsError, err)
+		}
+		refs := make([]struct {
+			Name           string `json:"name"`
+			ObjectId       string `json:"objectId"`
+			PeeledObjectId string `json:"peeledObjectId"`
+		}, 0)
+		_ = json.Unmarshal(list.Value, &refs)
+		// filter 为前缀匹配，需要找到名称完全相同的 ref
+		for _, r := range refs {
+			if r.Name == "refs/"+filter+branch {
+				return utils.FirstValueStr(r.PeeledObjectId, r.ObjectId), nil
+			}
+		}
+	}
+	return "", e.New(e.VcsError, fmt.Errorf("revision '%s' not found", branch))
+}
+
+type azureItem struct {
+	Path          string `json:"path"`
+	IsFolder      bool   `json:"isFolder"`
+	GitObjectType string `json:"gitObjectType"`
+}
+
+func (a *azureRepoIface) ListFiles(option VcsIfaceOptions) ([]string, error) {
+	query := azureVersionQuery(getBranch(a, option.Ref))
+	query.Set("scopePath", "/"+strings.Trim(option.Path, "/"))
+	query.Set("recursionLevel", "OneLevel")
+	if option.Recursive {
+		query.Set("recursionLevel", "Full")
+	}
+	list := azureList{}
+	if err := azureGetJson(a.repoPath("/items", query), a.vcs.VcsToken, &list); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	items := make([]azureItem, 0)
+	_ = json.Unmarshal(list.Value, &items)
+
+	resp := make([]string, 0)
+	for _, item := range items {
+		if item.IsFolder || item.GitObjectType == "tree" {
+			continue
+		}
+		if matchGlob(option.Search, path.Base(item.Path)) {
+			resp = append(resp, strings.TrimPrefix(item.Path, "/"))
+		}
+	}
+	if option.Limit != 0 && len(resp) > option.Limit {
+		resp = resp[:option.Limit]
+	}
+	return resp, nil
+}
+
+func (a *azureRepoIface) UpdateWorkDir(resp []string, paths string, option VcsIfaceOptions) ([]string, error) {
+	return resp, nil
+}
+
+func (a *azureRepoIface) JudgeWorkDirType(branch, workdir string) (string, error) {
+	return workdir, nil
+}
+
+func (a *azureRepoIface) JudgeFileType(branch, workdir, filename string) (string, error) {
+	return path.Join(workdir, filename), nil
+}
+
+func (a *azureRepoIface) ReadFileContent(branch, filePath string) (content []byte, err error) {
+	query := azureVersionQuery(branch)
+	query.Set("path", "/"+strings.TrimPrefix(filePath, "/"))
+	query.Set("$format", "octetStream")
+	response, body, er := azureRequest(a.repoPath("/items", query), http.MethodGet, a.vcs.VcsToken, nil)
+	if er != nil {
+		return []byte{}, e.New(e.VcsError, er)
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return []byte{}, e.New(e.ObjectNotExists)
+	} else if response.StatusCode >= 300 {
+		return []byte{}, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return body, nil
+}
+
+func (a *azureRepoIface) FormatRepoSearch() (project *Projects, err e.Error) {
+	return &Projects{
+		ID:            a.repository.Id,
+		DefaultBranch: a.DefaultBranch(),
+		SSHURLToRepo:  a.repository.SshUrl,
+		HTTPURLToRepo: a.repository.RemoteUrl,
+		Name:          a.repository.Name,
+		FullName:      fmt.Sprintf("%s/%s", a.repository.Project.Name, a.repository.Name),
+	}, nil
+}
+
+func (a *azureRepoIface) DefaultBranch() string {
+	return strings.TrimPrefix(a.repository.DefaultBranch, "refs/heads/")
+}
+
+type azureSubscription struct {
+	Id              string            `json:"id"`
+	EventType       string            `json:"eventType"`
+	PublisherInputs map[string]string `json:"publisherInputs"`
+	ConsumerInputs  map[string]string `json:"consumerInputs"`
+}
+
+// ListWebhook 查询仓库的 service hook 订阅，同一个 url 的多个事件订阅合并为一个 webhook
+func (a *azureRepoIface) ListWebhook() ([]RepoHook, error) {
+	list := azureList{}
+	if err := azureGetJson(a.apiPath("/hooks/subscriptions", nil), a.vcs.VcsToken, &list); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	subs := make([]azureSubscription, 0)
+	_ = json.Unmarshal(list.Value, &subs)
+
+	resp := make([]RepoHook, 0)
+	hookIds := make(map[string]int)
+	a.subscriptions = make(map[int][]string)
+	for _, s := range subs {
+		if s.PublisherInputs["repository"] != a.repository.Id || s.ConsumerInputs["url"] == "" {
+			continue
+		}
+		u := s.ConsumerInputs["url"]
+		id, ok := hookIds[u]
+		if !ok {
+			id = len(resp) + 1
+			hookIds[u] = id
+			resp = append(resp, RepoHook{Id: id, Url: u})
+		}
+		a.subscriptions[id] = append(a.subscriptions[id], s.Id)
+	}
+	return resp, nil
+}
+
+func (a *azureRepoIface) DeleteWebhook(id int) error {
+	for _, subId := range a.subscriptions[id] {
+		response, body, err := azureRequest(a.apiPath("/hooks/subscriptions/"+subId, nil),
+			http.MethodDelete, a.vcs.VcsToken, nil)
+		if err != nil {
+			return e.New(e.VcsError, err)
+		}
+		if response.StatusCode >= 300 {
+			return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+		}
+	}
+	return nil
+}
+
+// AddWebhook 为 push、pr 创建、更新、合并及评论事件分别创建 service hook 订阅
+func (a *azureRepoIface) AddWebhook(url string) error {
+	for _, event := range []string{AzureEventPush, AzureEventPrCreated, AzureEventPrMerged,
+		AzureEventPrUpdated, AzureEventPrCommented} {
+		reqBody, _ := json.Marshal(map[string]interface{}{
+			"publisherId":      "tfs",
+			"eventType":        event,
+			"resourceVersion":  "1.0",
+			"consumerId":       "webHooks",
+			"consumerActionId": "httpRequest",
+			"publisherInputs": map[string]string{
+				"projectId":  a.repository.Project.Id,
+				"repository": a.repository.Id,
+			},
+			"consumerInputs": map[string]string{
+				"url": url,
+			},
+		})
+		response, body, err := azureRequest(a.apiPath("/hooks/subscriptions", nil), http.MethodPost, a.vcs.VcsToken, reqBody)
+		if err != nil {
+			return e.New(e.VcsError, err)
+		}
+		if response.StatusCode >= 300 {
+			return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+		}
+	}
+	return nil
+}
+
+// CreatePrComment 在 pr 中创建一个新的评论线程，返回线程 id
+func (a *azureRepoIface) CreatePrComment(prId int, comment string) (int, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"comments": []map[string]interface{}{
+			{"parentCommentId": 0, "content": comment, "commentType": 1},
+		},
+		"status": 1,
+	})
+	response, body, err := azureRequest(a.repoPath(fmt.Sprintf("/pullRequests/%d/threads", prId), nil),
+		http.MethodPost, a.vcs.VcsToken, reqBody)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+
+	thread := struct {
+		Id int `json:"id"`
+	}{}
+	if err := json.Unmarshal(body, &thread); err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	return thread.Id, nil
+}
+
+// UpdatePrComment 修改评论线程中的第一条评论(即 CreatePrComment 创建的评论，其 id 固定为 1)
+func (a *azureRepoIface) UpdatePrComment(prId int, commentId int, comment string) error {
+	reqBody, _ := json.Marshal(map[string]interface{}{"content": comment})
+	response, body, err := azureRequest(
+		a.repoPath(fmt.Sprintf("/pullRequests/%d/threads/%d/comments/1", prId, commentId), nil),
+		http.MethodPatch, a.vcs.VcsToken, reqBody)
+	if err != nil {
+		return e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return nil
+}
+
+func (a *azureRepoIface) GetFullFilePath(address, filePath, repoRevision string) string {
+	query := url.Values{
+		"path":    []string{"/" + strings.TrimPrefix(filePath, "/")},
+		"version": []string{"GB" + repoRevision},
+	}
+	return a.repository.WebUrl + "?" + query.Encode()
+}
+
+var azureCommitStates = map[string]string{
+	CommitStatePending: "pending",
+	CommitStateRunning: "pending",
+	CommitStateSuccess: "succeeded",
+	CommitStateFailure: "failed",
+}
+
+// SetCommitStatus Context 中 "/" 之前的部分作为 genre，之后的部分作为 name
+func (a *azureRepoIface) SetCommitStatus(commitId string, status CommitStatus) (int, error) {
+	genre, name := "", status.Context
+	if parts := strings.SplitN(status.Context, "/", 2); len(parts) == 2 {
+		genre, name = parts[0], parts[1]
+	}
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"state":       azureCommitStates[status.State],
+		"description": status.Description,
+		"targetUrl":   status.TargetUrl,
+		"context":     map[string]string{"genre": genre, "name": name},
+	})
+	response, body, err := azureRequest(a.repoPath(fmt.Sprintf("/commits/%s/statuses", commitId), nil),
+		http.MethodPost, a.vcs.VcsToken, reqBody)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return 0, nil
+}
+
+// CompareCommits 查询两个版本之间的变更，单次最多返回 2000 条
+func (a *azureRepoIface) CompareCommits(from, to string) ([]string, error) {
+	query := url.Values{
+		"$top":              []string{"2000"},
+		"baseVersion":       []string{from},
+		"baseVersionType":   []string{azureVersionQuery(from).Get("versionDescriptor.versionType")},
+		"targetVersion":     []string{to},
+		"targetVersionType": []string{azureVersionQuery(to).Get("versionDescriptor.versionType")},
+	}
+	rep := struct {
+		Changes []struct {
+			Item             azureItem `json:"item"`
+			SourceServerItem string    `json:"sourceServerItem"` // 重命名前的路径
+		} `json:"changes"`
+	}{}
+	if err := azureGetJson(a.repoPath("/diffs/commits", query), a.vcs.VcsToken, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+
+	files := make([]string, 0, len(rep.Changes))
+	for _, c := range rep.Changes {
+		if c.Item.IsFolder || c.Item.GitObjectType == "tree" {
+			continue
+		}
+		files = append(files, strings.TrimPrefix(c.SourceServerItem, "/"), strings.TrimPrefix(c.Item.Path, "/"))
+	}
+	return uniqChangedFiles(files), nil
+}
+
+type azurePullRequest struct {
+	PullRequestId         int    `json:"pullRequestId"`
+	Status                string `json:"status"` // active、completed、abandoned
+	SourceRefName         string `json:"sourceRefName"`
+	TargetRefName         string `json:"targetRefName"`
+	LastMergeSourceCommit struct {
+		CommitId string `json:"commitId"`
+	} `json:"lastMergeSourceCommit"`
+}
+
+func (a *azureRepoIface) GetPullRequest(prId int) (*PullRequest, error) {
+	rep := azurePullRequest{}
+	if err := azureGetJson(a.repoPath(fmt.Sprintf("/pullrequests/%d", prId), nil), a.vcs.VcsToken, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	state := PrStateOpen
+	switch rep.Status {
+	case "completed":
+		state = PrStateMerged
+	case "abandoned":
+		state = PrStateClosed
+	}
+	return &PullRequest{
+		Id:         rep.PullRequestId,
+		State:      state,
+		BaseRef:    strings.TrimPrefix(rep.TargetRefName, "refs/heads/"),
+		HeadRef:    strings.TrimPrefix(rep.SourceRefName, "refs/heads/"),
+		HeadCommit: rep.LastMergeSourceCommit.CommitId,
+	}, nil
+}
+
+func (a *azureRepoIface) GetCommitFullPath(address, commitId string) string {
+	return a.repository.WebUrl + "/commit/" + commitId
+}
+
+// azureRequest
+// param path : azure devops api 完整地址
+// param method 请求方式
+func azureRequest(path, method, token string, requestBody []byte) (*http.Response, []byte, error) {
+	vcsToken, err := GetVcsToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	request, er := http.NewRequest(method, path, bytes.NewBuffer(requestBody))
+	if er != nil {
+		return nil, nil, er
+	}
+	// personal access token 通过 basic auth 认证，用户名为空
+	auth := base64.StdEncoding.EncodeToString([]byte(":" + vcsToken))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", fmt.Sprintf("Basic %s", auth))
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	return response, body, nil
+}
+
+func azureGetJson(path, token string, v interface{}) error {
+	response, body, err := azureRequest(path, http.MethodGet, token, nil)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", response.Status, body)
+	}
+	return json.Unmarshal(body, v)
+}
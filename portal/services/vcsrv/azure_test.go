@@ -0,0 +1,222 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"cloudiac/portal/models"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const azureTestRepoId = "5febef5a-833d-4e14-b9c0-14cb638f91e6"
+
+func newAzureTestServer(t *testing.T) (*httptest.Server, *[]recordedRequest) {
+	requests := make([]recordedRequest, 0)
+	const repoApi = "/cloudiac/_apis/git/repositories/" + azureTestRepoId
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(":azure-token"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// token 无效时 azure 返回 203 及登录页面
+		if r.Header.Get("Authorization") != auth {
+			w.WriteHeader(http.StatusNonAuthoritativeInfo)
+			_, _ = w.Write([]byte("<html>sign in</html>"))
+			return
+		}
+		assert.Equal(t, azureApiVersion, r.URL.Query().Get("api-version"))
+		if r.Method != http.MethodGet {
+			requests = append(requests, recordRequest(r))
+			if r.Method == http.MethodPost && r.URL.Path == repoApi+"/pullRequests/21/threads" {
+				_, _ = w.Write([]byte(`{"id":8,"status":"active"}`))
+			}
+			return
+		}
+
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/cloudiac/_apis/git/repositories", "/cloudiac/iac/_apis/git/repositories":
+			serveFixture(t, w, "azure/repositories.json")
+		case repoApi:
+			serveFixture(t, w, "azure/repository.json")
+		case repoApi + "/refs":
+			if query.Get("filter") == "tags/" || query.Get("filter") == "tags/v1.0.0" {
+				serveFixture(t, w, "azure/refs_tags.json")
+			} else if query.Get("filter") == "heads/" || query.Get("filter") == "heads/main" {
+				serveFixture(t, w, "azure/refs_heads.json")
+			} else {
+				_, _ = w.Write([]byte(`{"value":[],"count":0}`))
+			}
+		case repoApi + "/items":
+			if query.Get("$format") == "octetStream" {
+				if query.Get("path") != "/main.tf" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				assert.Equal(t, "branch", query.Get("versionDescriptor.versionType"))
+				serveFixture(t, w, "azure/main.tf")
+				return
+			}
+			serveFixture(t, w, "azure/items.json")
+		case repoApi + "/diffs/commits":
+			assert.Equal(t, "commit", query.Get("baseVersionType"))
+			assert.Equal(t, "branch", query.Get("targetVersionType"))
+			serveFixture(t, w, "azure/diffs_commits.json")
+		case repoApi + "/pullrequests/21":
+			serveFixture(t, w, "azure/pull_request.json")
+		case "/cloudiac/_apis/hooks/subscriptions":
+			serveFixture(t, w, "azure/subscriptions.json")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestAzureVcs(t *testing.T) {
+	server, _ := newAzureTestServer(t)
+	vcs, err := newAzureInstance(&models.Vcs{Address: server.URL + "/cloudiac/", VcsToken: "azure-token"})
+	assert.NoError(t, err)
+	assert.NoError(t, vcs.TokenCheck())
+
+	invalid, _ := newAzureInstance(&models.Vcs{Address: server.URL + "/cloudiac", VcsToken: "invalid"})
+	assert.Error(t, invalid.TokenCheck())
+
+	repos, total, err := vcs.ListRepos("iac", "", 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Len(t, repos, 2)
+	project, _ := repos[0].FormatRepoSearch()
+	assert.Equal(t, "network", project.Name)
+
+	repos, total, err = vcs.ListRepos("", "DEM", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	project, _ = repos[0].FormatRepoSearch()
+	assert.Equal(t, azureTestRepoId, project.ID)
+	assert.Equal(t, "iac/demo", project.FullName)
+
+	_, err = vcs.GetRepo("0a1b2c3d-1111-2222-3333-444455556666")
+	assert.True(t, IsNotFoundErr(err))
+}
+
+func TestAzureRepo(t *testing.T) {
+	server, _ := newAzureTestServer(t)
+	vcs, _ := newAzureInstance(&models.Vcs{Address: server.URL + "/cloudiac", VcsToken: "azure-token"})
+	repo, err := vcs.GetRepo(azureTestRepoId)
+	assert.NoError(t, err)
+	assert.Equal(t, "main", repo.DefaultBranch())
+
+	branches, err := repo.ListBranches()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main", "main-old"}, branches)
+	tags, err := repo.ListTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, tags)
+
+	commitId, err := repo.BranchCommitId("main")
+	assert.NoError(t, err)
+	assert.Equal(t, "9b2c3d1e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c", commitId)
+	// tag 返回其指向的 commit
+	commitId, err = repo.BranchCommitId("v1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "9b2c3d1e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c", commitId)
+	_, err = repo.BranchCommitId("none")
+	assert.Error(t, err)
+
+	files, err := repo.ListFiles(VcsIfaceOptions{Search: "*.tf", Recursive: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.tf", "modules/vpc.tf"}, files)
+
+	content, err := repo.ReadFileContent("main", "main.tf")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "required_version")
+	_, err = repo.ReadFileContent("main", "none.tf")
+	assert.True(t, IsNotFoundErr(err))
+
+	assert.Equal(t, "https://dev.azure.com/cloudiac/iac/_git/demo/commit/9b2c3d1e",
+		repo.GetCommitFullPath("", "9b2c3d1e"))
+
+	// 目录的变更被忽略
+	changed, err := repo.CompareCommits("aad331d8d3b131fa9ae03cf5e53965b51942618a", "main")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.tf", "modules/vpc.tf", "modules/network.tf"}, changed)
+
+	// 已完成的 pr 视为已合并
+	pr, err := repo.GetPullRequest(21)
+	assert.NoError(t, err)
+	assert.Equal(t, &PullRequest{
+		Id:         21,
+		State:      PrStateMerged,
+		BaseRef:    "main",
+		HeadRef:    "feature/vpc",
+		HeadCommit: "4f3a2b1c9b2c3d1e6f5a4b3c2d1e0f9a8b7c6d5e",
+	}, pr)
+}
+
+func TestAzureWebhook(t *testing.T) {
+	server, requests := newAzureTestServer(t)
+	vcs, _ := newAzureInstance(&models.Vcs{Address: server.URL + "/cloudiac", VcsToken: "azure-token"})
+	repo, _ := vcs.GetRepo(azureTestRepoId)
+
+	// 同一个 url 的多个事件订阅合并为一个 webhook，其他仓库及非 webhook 订阅被忽略
+	hooks, err := repo.ListWebhook()
+	assert.NoError(t, err)
+	assert.Equal(t, []RepoHook{{
+		Id:  1,
+		Url: "https://iac.example.com/api/v1/webhooks/azure/vcs-c3ek0co6n88ldvq1n6ag?token=t",
+	}}, hooks)
+
+	assert.NoError(t, repo.DeleteWebhook(1))
+	assert.Len(t, *requests, 2)
+	assert.Equal(t, "/cloudiac/_apis/hooks/subscriptions/0d8e5b2a-0001-4c3d-9e8f-000000000001", (*requests)[0].Path)
+	assert.Equal(t, "/cloudiac/_apis/hooks/subscriptions/0d8e5b2a-0002-4c3d-9e8f-000000000002", (*requests)[1].Path)
+
+	*requests = (*requests)[:0]
+	assert.NoError(t, repo.AddWebhook("https://iac.example.com/hook"))
+	assert.Len(t, *requests, 5)
+	for i, event := range []string{AzureEventPush, AzureEventPrCreated, AzureEventPrMerged,
+		AzureEventPrUpdated, AzureEventPrCommented} {
+		assert.Equal(t, event, (*requests)[i].Body["eventType"])
+		assert.Equal(t, map[string]interface{}{"url": "https://iac.example.com/hook"}, (*requests)[i].Body["consumerInputs"])
+	}
+
+	*requests = (*requests)[:0]
+	threadId, err := repo.CreatePrComment(21, "plan succeeded")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, threadId)
+	assert.Equal(t, "/cloudiac/_apis/git/repositories/"+azureTestRepoId+"/pullRequests/21/threads", (*requests)[0].Path)
+
+	assert.NoError(t, repo.UpdatePrComment(21, threadId, "plan failed"))
+	assert.Equal(t, recordedRequest{
+		Method: http.MethodPatch,
+		Path:   "/cloudiac/_apis/git/repositories/" + azureTestRepoId + "/pullRequests/21/threads/8/comments/1",
+		Body:   map[string]interface{}{"content": "plan failed"},
+	}, (*requests)[1])
+}
+
+func TestAzureCommitStatus(t *testing.T) {
+	server, requests := newAzureTestServer(t)
+	vcs, _ := newAzureInstance(&models.Vcs{Address: server.URL + "/cloudiac", VcsToken: "azure-token"})
+	repo, _ := vcs.GetRepo(azureTestRepoId)
+
+	_, err := repo.SetCommitStatus("9b2c3d1e", CommitStatus{
+		State:       CommitStateSuccess,
+		Context:     "cloudiac/plan (prod)",
+		Description: "CloudIaC plan complete",
+		TargetUrl:   "https://iac.example.com/task",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []recordedRequest{{
+		Method: http.MethodPost,
+		Path:   "/cloudiac/_apis/git/repositories/" + azureTestRepoId + "/commits/9b2c3d1e/statuses",
+		Body: map[string]interface{}{
+			"state":       "succeeded",
+			"description": "CloudIaC plan complete",
+			"targetUrl":   "https://iac.example.com/task",
+			"context":     map[string]interface{}{"genre": "cloudiac", "name": "plan (prod)"},
+		},
+	}}, *requests)
+}
@@ -0,0 +1,557 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+/*
+Bitbucket Server(Data Center) vcs 实现，使用 REST API 1.0，
+token 为用户的 HTTP access token(personal access token)
+*/
+
+import (
+	"bytes"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const bitbucketApiRoute = "/rest/api/1.0"
+
+// bitbucket webhook 事件类型
+const (
+	BitbucketEventPush     = "repo:refs_changed"
+	BitbucketEventPrOpened = "pr:opened"
+	BitbucketEventPrMerged = "pr:merged"
+
+	BitbucketEventPrDeclined     = "pr:declined"
+	BitbucketEventPrDeleted      = "pr:deleted"
+	BitbucketEventPrCommentAdded = "pr:comment:added"
+)
+
+func newBitbucketInstance(vcs *models.Vcs) (VcsIface, error) {
+	vcs.Address = utils.GetUrl(vcs.Address)
+	return &bitbucketVcs{vcs: vcs}, nil
+}
+
+type bitbucketVcs struct {
+	vcs *models.Vcs
+}
+
+type bitbucketLink struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type bitbucketRepository struct {
+	Id          int    `json:"id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Project     struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Clone []bitbucketLink `json:"clone"`
+		Self  []bitbucketLink `json:"self"`
+	} `json:"links"`
+}
+
+// bitbucketPage 分页接口的返回结构
+type bitbucketPage struct {
+	Size          int             `json:"size"`
+	IsLastPage    bool            `json:"isLastPage"`
+	NextPageStart int             `json:"nextPageStart"`
+	Values        json.RawMessage `json:"values"`
+}
+
+type bitbucketRef struct {
+	Id           string `json:"id"`
+	DisplayId    string `json:"displayId"`
+	LatestCommit string `json:"latestCommit"`
+}
+
+// bitbucketRepoId 仓库 id 格式为 "<project key>/<repo slug>"
+func bitbucketRepoId(repo *bitbucketRepository) string {
+	return fmt.Sprintf("%s/%s", repo.Project.Key, repo.Slug)
+}
+
+func (b *bitbucketVcs) GetRepo(idOrPath string) (RepoIface, error) {
+	parts := strings.SplitN(idOrPath, "/", 2)
+	if len(parts) != 2 {
+		return nil, e.New(e.VcsError, fmt.Errorf("invalid repository '%s'", idOrPath))
+	}
+	path := b.vcs.Address + bitbucketApiRoute + fmt.Sprintf("/projects/%s/repos/%s", parts[0], parts[1])
+	response, body, err := bitbucketRequest(path, http.MethodGet, b.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return nil, e.New(e.ObjectNotExists, fmt.Errorf("repository '%s' not found", idOrPath))
+	} else if response.StatusCode >= 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+
+	repo := bitbucketRepository{}
+	if err := json.Unmarshal(body, &repo); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	return &bitbucketRepoIface{vcs: b.vcs, repository: &repo}, nil
+}
+
+// ListRepos bitbucket 分页接口不返回总数，不是最后一页时 total 多计一条以便前端继续翻页
+func (b *bitbucketVcs) ListRepos(namespace, search string, limit, offset int) ([]RepoIface, int64, error) {
+	query := url.Values{}
+	query.Set("start", fmt.Sprintf("%d", offset))
+	if limit > 0 {
+		query.Set("limit", fmt.Sprintf("%d", limit))
+	}
+	if search != "" {
+		query.Set("name", search)
+	}
+	if namespace != "" {
+		query.Set("projectname", namespace)
+	}
+	path := b.vcs.Address + bitbucketApiRoute + "/repos?" + query.Encode()
+
+	page := bitbucketPage{}
+	if err := bitbucketGetJson(path, b.vcs.VcsToken, &page); err != nil {
+		return nil, 0, e.New(e.VcsError, err)
+	}
+	repos := make([]*bitbucketRepository, 0)
+	_ = json.Unmarshal(page.Values, &repos)
+
+	repoList := make([]RepoIface, 0)
+	for _, r := range repos {
+		repoList = append(repoList, &bitbucketRepoIface{vcs: b.vcs, repository: r})
+	}
+	total := int64(offset + page.Size)
+	if !page.IsLastPage {
+		total++
+	}
+	return repoList, total, nil
+}
+
+// UserInfo bitbucket 会在响应头 X-AUSERNAME 中返回当前认证的用户名，git clone 时需要使用该用户名
+func (b *bitbucketVcs) UserInfo() (UserInfo, error) {
+	path := b.vcs.Address + bitbucketApiRoute + "/repos?limit=1"
+	response, _, err := bitbucketRequest(path, http.MethodGet, b.vcs.VcsToken, nil)
+	if err != nil {
+		return UserInfo{}, e.New(e.VcsError, err)
+	}
+	name := response.Header.Get("X-AUSERNAME")
+	return UserInfo{Login: name, Name: name}, nil
+}
+
+func (b *bitbucketVcs) TokenCheck() error {
+	path := b.vcs.Address + bitbucketApiRoute + "/repos?limit=1"
+	response, _, err := bitbucketRequest(path, http.MethodGet, b.vcs.VcsToken, nil)
+	if err != nil {
+		return e.New(e.VcsError, err)
+	}
+	// 匿名访问也可以查询公开仓库，所以需要检查是否返回了认证用户
+	if response.StatusCode > 300 || response.Header.Get("X-AUSERNAME") == "" {
+		return e.New(e.VcsInvalidToken, fmt.Sprintf("token valid check response code: %d", response.StatusCode))
+	}
+	return nil
+}
+
+// RepoBaseHttpAddr bitbucket 的 http clone 地址为 <address>/scm/<project>/<repo>.git
+func (b *bitbucketVcs) RepoBaseHttpAddr() string {
+	return utils.JoinURL(b.vcs.Address, "scm")
+}
+
+type bitbucketRepoIface struct {
+	vcs        *models.Vcs
+	repository *bitbucketRepository
+}
+
+func (b *bitbucketRepoIface) repoPath(format string, args ...interface{}) string {
+	return b.vcs.Address + bitbucketApiRoute +
+		fmt.Sprintf("/projects/%s/repos/%s", b.repository.Project.Key, b.repository.Slug) +
+		fmt.Sprintf(format, args...)
+}
+
+// listAll 查询分页接口的所有数据
+func (b *bitbucketRepoIface) listAll(path string, values interface{}) error {
+	all := make([]json.RawMessage, 0)
+	start := 0
+	for {
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		page := bitbucketPage{}
+		if err := bitbucketGetJson(fmt.Sprintf("%s%sstart=%d&limit=1000", path, sep, start), b.vcs.VcsToken, &page); err != nil {
+			return err
+		}
+		items := make([]json.RawMessage, 0)
+		_ = json.Unmarshal(page.Values, &items)
+		all = append(all, items...)
+		if page.IsLastPage || len(items) == 0 {
+			break
+		}
+		start = page.NextPageStart
+	}
+	bs, _ := json.Marshal(all)
+	return json.Unmarshal(bs, values)
+}
+
+func (b *bitbucketRepoIface) listRefs(kind string) ([]bitbucketRef, error) {
+	refs := make([]bitbucketRef, 0)
+	if err := b.listAll(b.repoPath("/%s", kind), &refs); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	return refs, nil
+}
+
+func (b *bitbucketRepoIface) ListBranches() ([]string, error) {
+	refs, err := b.listRefs("branches")
+	if err != nil {
+		return nil, err
+	}
+	branches := make([]string, 0, len(refs))
+	for _, r := range refs {
+		branches = append(branches, r.DisplayId)
+	}
+	return branches, nil
+}
+
+func (b *bitbucketRepoIface) ListTags() ([]string, error) {
+	refs, err := b.listRefs("tags")
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(refs))
+	for _, r := range refs {
+		tags = append(tags, r.DisplayId)
+	}
+	return tags, nil
+}
+
+// BranchCommitId 获取分支或者 tag 的最新 commit id
+func (b *bitbucketRepoIface) BranchCommitId(branch string) (string, error) {
+	path := b.repoPath("/commits?limit=1&until=%s", url.QueryEscape(branch))
+	page := bitbucketPage{}
+	if err := bitbucketGetJson(path, b.vcs.VcsToken, &page); err != nil {
+		return "", e.New(e.VcsError, err)
+	}
+	commits := make([]struct {
+		Id string `json:"id"`
+	}, 0)
+	_ = json.Unmarshal(page.Values, &commits)
+	if len(commits) == 0 {
+		return "", e.New(e.VcsError, fmt.Errorf("revision '%s' not found", branch))
+	}
+	return commits[0].Id, nil
+}
+
+// ListFiles bitbucket 的 files 接口会递归返回目录下的所有文件(相对该目录的路径)
+func (b *bitbucketRepoIface) ListFiles(option VcsIfaceOptions) ([]string, error) {
+	branch := getBranch(b, option.Ref)
+	dir := strings.Trim(option.Path, "/")
+	files := make([]string, 0)
+	if err := b.listAll(b.repoPath("/files/%s?at=%s", dir, url.QueryEscape(branch)), &files); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+
+	resp := make([]string, 0)
+	for _, f := range files {
+		if !option.Recursive && strings.Contains(f, "/") {
+			continue
+		}
+		if matchGlob(option.Search, path.Base(f)) {
+			resp = append(resp, path.Join(dir, f))
+		}
+	}
+	if option.Limit != 0 && len(resp) > option.Limit {
+		resp = resp[:option.Limit]
+	}
+	return resp, nil
+}
+
+func (b *bitbucketRepoIface) UpdateWorkDir(resp []string, paths string, option VcsIfaceOptions) ([]string, error) {
+	return resp, nil
+}
+
+func (b *bitbucketRepoIface) JudgeWorkDirType(branch, workdir string) (string, error) {
+	return workdir, nil
+}
+
+func (b *bitbucketRepoIface) JudgeFileType(branch, workdir, filename string) (string, error) {
+	return path.Join(workdir, filename), nil
+}
+
+func (b *bitbucketRepoIface) ReadFileContent(branch, path string) (content []byte, err error) {
+	pathAddr := b.repoPath("/raw/%s?at=%s", strings.TrimPrefix(path, "/"), url.QueryEscape(branch))
+	response, body, er := bitbucketRequest(pathAddr, http.MethodGet, b.vcs.VcsToken, nil)
+	if er != nil {
+		return []byte{}, e.New(e.VcsError, er)
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return []byte{}, e.New(e.ObjectNotExists)
+	} else if response.StatusCode >= 300 {
+		return []byte{}, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return body, nil
+}
+
+func (b *bitbucketRepoIface) cloneUrl(name string) string {
+	for _, l := range b.repository.Links.Clone {
+		if l.Name == name {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func (b *bitbucketRepoIface) FormatRepoSearch() (project *Projects, err e.Error) {
+	return &Projects{
+		ID:            bitbucketRepoId(b.repository),
+		Description:   b.repository.Description,
+		DefaultBranch: b.DefaultBranch(),
+		SSHURLToRepo:  b.cloneUrl("ssh"),
+		HTTPURLToRepo: b.cloneUrl("http"),
+		Name:          b.repository.Name,
+		FullName:      bitbucketRepoId(b.repository),
+	}, nil
+}
+
+func (b *bitbucketRepoIface) DefaultBranch() string {
+	ref := bitbucketRef{}
+	if err := bitbucketGetJson(b.repoPath("/branches/default"), b.vcs.VcsToken, &ref); err != nil {
+		return ""
+	}
+	return ref.DisplayId
+}
+
+type bitbucketWebhook struct {
+	Id  int    `json:"id"`
+	Url string `json:"url"`
+}
+
+func (b *bitbucketRepoIface) ListWebhook() ([]RepoHook, error) {
+	hooks := make([]bitbucketWebhook, 0)
+	if err := b.listAll(b.repoPath("/webhooks"), &hooks); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	resp := make([]RepoHook, 0, len(hooks))
+	for _, h := range hooks {
+		resp = append(resp, RepoHook{Id: h.Id, Url: h.Url})
+	}
+	return resp, nil
+}
+
+func (b *bitbucketRepoIface) DeleteWebhook(id int) error {
+	response, body, err := bitbucketRequest(b.repoPath("/webhooks/%d", id), http.MethodDelete, b.vcs.VcsToken, nil)
+	if err != nil {
+		return e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return nil
+}
+
+func (b *bitbucketRepoIface) AddWebhook(url string) error {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"name":   "cloudiac",
+		"url":    url,
+		"active": true,
+		"events": []string{
+			BitbucketEventPush,
+			BitbucketEventPrOpened,
+			BitbucketEventPrMerged,
+			BitbucketEventPrDeclined,
+			BitbucketEventPrDeleted,
+			BitbucketEventPrCommentAdded,
+		},
+	})
+	response, body, err := bitbucketRequest(b.repoPath("/webhooks"), http.MethodPost, b.vcs.VcsToken, reqBody)
+	if err != nil {
+		return e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return nil
+}
+
+type bitbucketComment struct {
+	Id      int `json:"id"`
+	Version int `json:"version"`
+}
+
+func (b *bitbucketRepoIface) CreatePrComment(prId int, comment string) (int, error) {
+	reqBody, _ := json.Marshal(map[string]string{"text": comment})
+	response, body, err := bitbucketRequest(b.repoPath("/pull-requests/%d/comments", prId),
+		http.MethodPost, b.vcs.VcsToken, reqBody)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+
+	rep := bitbucketComment{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	return rep.Id, nil
+}
+
+// UpdatePrComment bitbucket 修改评论时需要传入当前的版本号，所以先查询评论
+func (b *bitbucketRepoIface) UpdatePrComment(prId int, commentId int, comment string) error {
+	path := b.repoPath("/pull-requests/%d/comments/%d", prId, commentId)
+	current := bitbucketComment{}
+	if err := bitbucketGetJson(path, b.vcs.VcsToken, &current); err != nil {
+		return e.New(e.VcsError, err)
+	}
+
+	reqBody, _ := json.Marshal(map[string]interface{}{"text": comment, "version": current.Version})
+	response, body, err := bitbucketRequest(path, http.MethodPut, b.vcs.VcsToken, reqBody)
+	if err != nil {
+		return e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return nil
+}
+
+func (b *bitbucketRepoIface) GetFullFilePath(address, filePath, repoRevision string) string {
+	u, _ := url.Parse(address)
+	u.Path = path.Join(u.Path, "projects", b.repository.Project.Key, "repos", b.repository.Slug, "browse", filePath)
+	u.RawQuery = url.Values{"at": []string{repoRevision}}.Encode()
+	return u.String()
+}
+
+var bitbucketCommitStates = map[string]string{
+	CommitStatePending: "INPROGRESS",
+	CommitStateRunning: "INPROGRESS",
+	CommitStateSuccess: "SUCCESSFUL",
+	CommitStateFailure: "FAILED",
+}
+
+// SetCommitStatus 通过 build status 接口设置 commit 的构建状态，相同 key 的状态会被覆盖
+func (b *bitbucketRepoIface) SetCommitStatus(commitId string, status CommitStatus) (int, error) {
+	reqBody, _ := json.Marshal(map[string]string{
+		"state":       bitbucketCommitStates[status.State],
+		"key":         status.Context,
+		"name":        status.Context,
+		"url":         status.TargetUrl,
+		"description": status.Description,
+	})
+	response, body, err := bitbucketRequest(b.vcs.Address+"/rest/build-status/1.0/commits/"+commitId,
+		http.MethodPost, b.vcs.VcsToken, reqBody)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return 0, nil
+}
+
+type bitbucketChange struct {
+	Path    bitbucketPath `json:"path"`
+	SrcPath bitbucketPath `json:"srcPath"` // 重命名前的路径
+}
+
+type bitbucketPath struct {
+	ToString string `json:"toString"`
+}
+
+// CompareCommits bitbucket compare 接口返回的是 from 相对于 to 的变更，所以参数需要对调
+func (b *bitbucketRepoIface) CompareCommits(from, to string) ([]string, error) {
+	changes := make([]bitbucketChange, 0)
+	path := b.repoPath("/compare/changes?from=%s&to=%s", url.QueryEscape(to), url.QueryEscape(from))
+	if err := b.listAll(path, &changes); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	files := make([]string, 0, len(changes))
+	for _, c := range changes {
+		files = append(files, c.SrcPath.ToString, c.Path.ToString)
+	}
+	return uniqChangedFiles(files), nil
+}
+
+type bitbucketPullRequest struct {
+	Id      int    `json:"id"`
+	State   string `json:"state"` // OPEN、MERGED、DECLINED
+	FromRef struct {
+		DisplayId    string `json:"displayId"`
+		LatestCommit string `json:"latestCommit"`
+	} `json:"fromRef"`
+	ToRef struct {
+		DisplayId string `json:"displayId"`
+	} `json:"toRef"`
+}
+
+func (b *bitbucketRepoIface) GetPullRequest(prId int) (*PullRequest, error) {
+	rep := bitbucketPullRequest{}
+	if err := bitbucketGetJson(b.repoPath("/pull-requests/%d", prId), b.vcs.VcsToken, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	state := PrStateOpen
+	switch rep.State {
+	case "MERGED":
+		state = PrStateMerged
+	case "DECLINED":
+		state = PrStateClosed
+	}
+	return &PullRequest{
+		Id:         rep.Id,
+		State:      state,
+		BaseRef:    rep.ToRef.DisplayId,
+		HeadRef:    rep.FromRef.DisplayId,
+		HeadCommit: rep.FromRef.LatestCommit,
+	}, nil
+}
+
+func (b *bitbucketRepoIface) GetCommitFullPath(address, commitId string) string {
+	u, _ := url.Parse(address)
+	u.Path = path.Join(u.Path, "projects", b.repository.Project.Key, "repos", b.repository.Slug, "commits", commitId)
+	return u.String()
+}
+
+// bitbucketRequest
+// param path : bitbucket api 路径
+// param method 请求方式
+func bitbucketRequest(path, method, token string, requestBody []byte) (*http.Response, []byte, error) {
+	vcsToken, err := GetVcsToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	request, er := http.NewRequest(method, path, bytes.NewBuffer(requestBody))
+	if er != nil {
+		return nil, nil, er
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", vcsToken))
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	return response, body, nil
+}
+
+func bitbucketGetJson(path, token string, v interface{}) error {
+	response, body, err := bitbucketRequest(path, http.MethodGet, token, nil)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", response.Status, body)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"cloudiac/portal/models"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveFixture 返回 testdata 中录制的 api 响应
+func serveFixture(t *testing.T, w http.ResponseWriter, name string) {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Errorf("read fixture %s: %v", name, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+func recordRequest(r *http.Request) recordedRequest {
+	req := recordedRequest{Method: r.Method, Path: r.URL.Path}
+	if bs, _ := ioutil.ReadAll(r.Body); len(bs) > 0 {
+		_ = json.Unmarshal(bs, &req.Body)
+	}
+	return req
+}
+
+func newBitbucketTestServer(t *testing.T) (*httptest.Server, *[]recordedRequest) {
+	requests := make([]recordedRequest, 0)
+	const repoApi = "/rest/api/1.0/projects/IAC/repos/demo"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer bitbucket-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-AUSERNAME", "admin")
+		if r.Method != http.MethodGet {
+			requests = append(requests, recordRequest(r))
+			w.WriteHeader(http.StatusCreated)
+			if strings.HasPrefix(r.URL.Path, repoApi+"/pull-requests/5/comments") {
+				_, _ = w.Write([]byte(`{"id":12,"version":4}`))
+			}
+			return
+		}
+
+		switch r.URL.Path {
+		case "/rest/api/1.0/repos":
+			serveFixture(t, w, "bitbucket/repos.json")
+		case repoApi:
+			serveFixture(t, w, "bitbucket/repo.json")
+		case repoApi + "/branches":
+			serveFixture(t, w, "bitbucket/branches_"+r.URL.Query().Get("start")+".json")
+		case repoApi + "/branches/default":
+			serveFixture(t, w, "bitbucket/default_branch.json")
+		case repoApi + "/tags":
+			serveFixture(t, w, "bitbucket/tags.json")
+		case repoApi + "/commits":
+			assert.Equal(t, "master", r.URL.Query().Get("until"))
+			serveFixture(t, w, "bitbucket/commits.json")
+		case repoApi + "/files/":
+			serveFixture(t, w, "bitbucket/files.json")
+		case repoApi + "/raw/main.tf":
+			serveFixture(t, w, "bitbucket/main.tf")
+		case repoApi + "/webhooks":
+			serveFixture(t, w, "bitbucket/webhooks.json")
+		case repoApi + "/pull-requests/5":
+			serveFixture(t, w, "bitbucket/pull_request.json")
+		case repoApi + "/pull-requests/5/comments/12":
+			_, _ = w.Write([]byte(`{"id":12,"version":3,"text":"plan succeeded"}`))
+		case repoApi + "/compare/changes":
+			assert.Equal(t, "8d51122d", r.URL.Query().Get("from"))
+			assert.Equal(t, "2a8c2e8b", r.URL.Query().Get("to"))
+			serveFixture(t, w, "bitbucket/compare_changes.json")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestBitbucketVcs(t *testing.T) {
+	server, _ := newBitbucketTestServer(t)
+	vcs, err := newBitbucketInstance(&models.Vcs{Address: server.URL, VcsToken: "bitbucket-token"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, vcs.TokenCheck())
+	user, err := vcs.UserInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", user.Login)
+	assert.Equal(t, server.URL+"/scm", vcs.RepoBaseHttpAddr())
+
+	repos, total, err := vcs.ListRepos("", "demo", 1, 0)
+	assert.NoError(t, err)
+	assert.Len(t, repos, 1)
+	assert.Equal(t, int64(2), total)
+
+	_, err = vcs.GetRepo("IAC/other")
+	assert.True(t, IsNotFoundErr(err))
+
+	invalid, _ := newBitbucketInstance(&models.Vcs{Address: server.URL, VcsToken: "invalid"})
+	assert.Error(t, invalid.TokenCheck())
+}
+
+func TestBitbucketRepo(t *testing.T) {
+	server, _ := newBitbucketTestServer(t)
+	vcs, _ := newBitbucketInstance(&models.Vcs{Address: server.URL, VcsToken: "bitbucket-token"})
+	repo, err := vcs.GetRepo("IAC/demo")
+	assert.NoError(t, err)
+
+	project, er := repo.FormatRepoSearch()
+	assert.Nil(t, er)
+	assert.Equal(t, "IAC/demo", project.ID)
+	assert.Equal(t, "master", project.DefaultBranch)
+	assert.Equal(t, "https://bitbucket.example.com/scm/iac/demo.git", project.HTTPURLToRepo)
+
+	branches, err := repo.ListBranches()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"master", "feature/vpc"}, branches)
+
+	tags, err := repo.ListTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, tags)
+
+	commitId, err := repo.BranchCommitId("master")
+	assert.NoError(t, err)
+	assert.Equal(t, "8d51122def5632836d1cb1026e879069e10a1e13", commitId)
+
+	files, err := repo.ListFiles(VcsIfaceOptions{Search: "*.tf"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.tf", "variables.tf"}, files)
+	files, err = repo.ListFiles(VcsIfaceOptions{Search: "*.tf", Recursive: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.tf", "variables.tf", "modules/vpc/main.tf"}, files)
+
+	content, err := repo.ReadFileContent("master", "main.tf")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "required_version")
+	_, err = repo.ReadFileContent("master", "none.tf")
+	assert.True(t, IsNotFoundErr(err))
+
+	assert.Equal(t, "https://bitbucket.example.com/projects/IAC/repos/demo/browse/main.tf?at=master",
+		repo.GetFullFilePath("https://bitbucket.example.com", "main.tf", "master"))
+
+	// 重命名的文件同时返回新旧路径
+	changed, err := repo.CompareCommits("2a8c2e8b", "8d51122d")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.tf", "modules/vpc/main.tf", "modules/network/main.tf"}, changed)
+
+	pr, err := repo.GetPullRequest(5)
+	assert.NoError(t, err)
+	assert.Equal(t, &PullRequest{
+		Id:         5,
+		State:      PrStateOpen,
+		BaseRef:    "master",
+		HeadRef:    "feature/vpc",
+		HeadCommit: "2a8c2e8b7e1c54b2f0a3d2e5f7c8e0d1a2b3c4d5",
+	}, pr)
+}
+
+func TestBitbucketWebhook(t *testing.T) {
+	server, requests := newBitbucketTestServer(t)
+	vcs, _ := newBitbucketInstance(&models.Vcs{Address: server.URL, VcsToken: "bitbucket-token"})
+	repo, _ := vcs.GetRepo("IAC/demo")
+
+	hooks, err := repo.ListWebhook()
+	assert.NoError(t, err)
+	assert.Equal(t, []RepoHook{{
+		Id:  7,
+		Url: "https://iac.example.com/api/v1/webhooks/bitbucket/vcs-c3ek0co6n88ldvq1n6ag?token=t",
+	}}, hooks)
+
+	assert.NoError(t, repo.AddWebhook("https://iac.example.com/hook"))
+	assert.NoError(t, repo.DeleteWebhook(7))
+	commentId, err := repo.CreatePrComment(5, "plan succeeded")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, commentId)
+	// 修改评论时带上当前的版本号
+	assert.NoError(t, repo.UpdatePrComment(5, commentId, "plan failed"))
+
+	const repoApi = "/rest/api/1.0/projects/IAC/repos/demo"
+	assert.Len(t, *requests, 4)
+	assert.Equal(t, http.MethodPost, (*requests)[0].Method)
+	assert.Equal(t, repoApi+"/webhooks", (*requests)[0].Path)
+	assert.Equal(t, []interface{}{BitbucketEventPush, BitbucketEventPrOpened, BitbucketEventPrMerged,
+		BitbucketEventPrDeclined, BitbucketEventPrDeleted, BitbucketEventPrCommentAdded},
+		(*requests)[0].Body["events"])
+	assert.Equal(t, recordedRequest{Method: http.MethodDelete, Path: repoApi + "/webhooks/7"}, (*requests)[1])
+	assert.Equal(t, repoApi+"/pull-requests/5/comments", (*requests)[2].Path)
+	assert.Equal(t, "plan succeeded", (*requests)[2].Body["text"])
+	assert.Equal(t, recordedRequest{
+		Method: http.MethodPut,
+		Path:   repoApi + "/pull-requests/5/comments/12",
+		Body:   map[string]interface{}{"text": "plan failed", "version": float64(3)},
+	}, (*requests)[3])
+}
+
+func TestBitbucketCommitStatus(t *testing.T) {
+	server, requests := newBitbucketTestServer(t)
+	vcs, _ := newBitbucketInstance(&models.Vcs{Address: server.URL, VcsToken: "bitbucket-token"})
+	repo, _ := vcs.GetRepo("IAC/demo")
+
+	_, err := repo.SetCommitStatus("8d51122def5632836d1cb1026e879069e10a1e13", CommitStatus{
+		State:       CommitStateRunning,
+		Context:     "cloudiac/plan (prod)",
+		Description: "CloudIaC plan running",
+		TargetUrl:   "https://iac.example.com/task",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []recordedRequest{{
+		Method: http.MethodPost,
+		Path:   "/rest/build-status/1.0/commits/8d51122def5632836d1cb1026e879069e10a1e13",
+		Body: map[string]interface{}{
+			"state":       "INPROGRESS",
+			"key":         "cloudiac/plan (prod)",
+			"name":        "cloudiac/plan (prod)",
+			"url":         "https://iac.example.com/task",
+			"description": "CloudIaC plan running",
+		},
+	}}, *requests)
+}
@@ -0,0 +1,490 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+/*
+通用 git vcs 实现，适用于不提供托管平台 api 的 git 服务(如 gitolite、cgit)。
+仓库以 bare 镜像的方式缓存在 portal 本地，分支、tag、文件等信息均从镜像中读取。
+
+vcs 地址为仓库地址的公共前缀，如 https://git.example.com、ssh://git@git.example.com，
+仓库 id 为其下的相对路径。file:///data/repos 形式的本地地址需要开启 portal.git_allow_file_scheme 配置。
+https 地址使用 token 作为密码进行认证，ssh 地址的 token 为私钥内容(需要 portal 的 known_hosts 中包含服务端公钥)。
+仓库需要先通过 AddGitRepo 添加(clone 镜像)后才能使用，之后由定时任务及 webhook 通知同步。
+*/
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/pkg/errors"
+)
+
+const (
+	gitMirrorRemote       = "origin"
+	gitMirrorFetchedFile  = "cloudiac_fetched" // 记录镜像最近一次同步时间的标记文件
+	gitMirrorFetchTimeout = 10 * time.Minute
+)
+
+// 同一个镜像同时只允许一个同步操作
+var gitMirrorLocks sync.Map
+
+type gitVcs struct {
+	vcs *models.Vcs
+}
+
+func newGitInstance(vcs *models.Vcs) (VcsIface, error) {
+	vcs.Address = strings.TrimRight(vcs.Address, "/")
+	u, err := url.Parse(vcs.Address)
+	if err != nil || !utils.StrInArray(u.Scheme, "http", "https", "ssh", "file") {
+		return nil, fmt.Errorf("unsupported git address '%s', must start with http(s):// or ssh://", vcs.Address)
+	}
+	if u.Scheme == "file" && !configs.Get().Portal.GitAllowFileScheme {
+		return nil, fmt.Errorf("file:// git address is not allowed")
+	}
+	return &gitVcs{vcs: vcs}, nil
+}
+
+func isGitSshAddr(address string) bool {
+	return strings.HasPrefix(address, "ssh://")
+}
+
+// IsGitSshVcs 是否为 ssh 地址的通用 git vcs，此时 token 为私钥，不能作为 clone 地址中的密码使用
+func IsGitSshVcs(vcs *models.Vcs) bool {
+	return vcs.VcsType == consts.GitTypeGit && isGitSshAddr(vcs.Address)
+}
+
+func (g *gitVcs) mirrorsDir() string {
+	return filepath.Join(configs.Get().Portal.GetGitMirrorPath(), string(g.vcs.Id))
+}
+
+func (g *gitVcs) newMirror(repoPath string) (*gitMirror, error) {
+	repoPath = strings.Trim(path.Clean("/"+repoPath), "/")
+	if repoPath == "" {
+		return nil, e.New(e.BadParam, fmt.Errorf("repository path is blank"))
+	}
+	return &gitMirror{
+		vcs:  g.vcs,
+		path: repoPath,
+		dir:  filepath.Join(g.mirrorsDir(), filepath.FromSlash(repoPath)),
+	}, nil
+}
+
+// GetRepo 获取已添加的仓库，镜像过期时会先同步
+func (g *gitVcs) GetRepo(repoPath string) (RepoIface, error) {
+	m, err := g.newMirror(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if !m.exists() {
+		return nil, e.New(e.ObjectNotExists, fmt.Errorf("git repository '%s' is not added", m.path))
+	}
+	if err := m.sync(false); err != nil {
+		return nil, err
+	}
+	return m.open()
+}
+
+// listMirrors 列出已缓存的仓库镜像路径
+func (g *gitVcs) listMirrors() ([]string, error) {
+	root := g.mirrorsDir()
+	repoPaths := make([]string, 0)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() || p == root {
+			return nil
+		}
+		if utils.FileExist(filepath.Join(p, gitMirrorFetchedFile)) {
+			rel, _ := filepath.Rel(root, p)
+			repoPaths = append(repoPaths, filepath.ToSlash(rel))
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return repoPaths, err
+}
+
+// ListRepos git 服务没有仓库列表接口，只返回已添加的仓库镜像
+func (g *gitVcs) ListRepos(namespace, search string, limit, offset int) ([]RepoIface, int64, error) {
+	mirrors, err := g.listMirrors()
+	if err != nil {
+		return nil, 0, e.New(e.InternalError, err)
+	}
+
+	repoPaths := make([]string, 0)
+	for _, p := range mirrors {
+		if namespace != "" && !strings.HasPrefix(p, strings.Trim(namespace, "/")+"/") {
+			continue
+		}
+		if search == "" || strings.Contains(p, search) {
+			repoPaths = append(repoPaths, p)
+		}
+	}
+	total := int64(len(repoPaths))
+	if offset < len(repoPaths) {
+		repoPaths = repoPaths[offset:]
+	} else {
+		repoPaths = repoPaths[:0]
+	}
+	if limit != 0 && len(repoPaths) > limit {
+		repoPaths = repoPaths[:limit]
+	}
+
+	repos := make([]RepoIface, 0, len(repoPaths))
+	for _, p := range repoPaths {
+		m, _ := g.newMirror(p)
+		r, err := m.open()
+		if err != nil {
+			logs.Get().Warnf("open git mirror '%s' error: %v", p, err)
+			continue
+		}
+		repos = append(repos, r)
+	}
+	return repos, total, nil
+}
+
+func (g *gitVcs) UserInfo() (UserInfo, error) {
+	return UserInfo{}, nil
+}
+
+// TokenCheck 没有可用于校验 token 的接口，在 clone 仓库时才会校验
+func (g *gitVcs) TokenCheck() error {
+	return nil
+}
+
+func (g *gitVcs) RepoBaseHttpAddr() string {
+	return g.vcs.Address
+}
+
+// AddGitRepo 添加仓库，从远端 clone 仓库镜像(镜像已存在时立即同步)
+func AddGitRepo(vcs *models.Vcs, repoPath string) (RepoIface, error) {
+	vcsObject := *vcs
+	v, err := newGitInstance(&vcsObject)
+	if err != nil {
+		return nil, err
+	}
+	m, err := v.(*gitVcs).newMirror(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.sync(true); err != nil {
+		return nil, err
+	}
+	return m.open()
+}
+
+// RefreshGitMirror 立即同步仓库镜像，用于 webhook 通知仓库变更，未添加的仓库不做处理
+func RefreshGitMirror(vcs *models.Vcs, repoPath string) error {
+	vcsObject := *vcs
+	v, err := newGitInstance(&vcsObject)
+	if err != nil {
+		return err
+	}
+	m, err := v.(*gitVcs).newMirror(repoPath)
+	if err != nil {
+		return err
+	}
+	if !m.exists() {
+		return nil
+	}
+	return m.sync(true)
+}
+
+// RefreshGitMirrors 同步 vcs 下所有已缓存的仓库镜像
+func RefreshGitMirrors(vcs *models.Vcs) error {
+	vcsObject := *vcs
+	v, err := newGitInstance(&vcsObject)
+	if err != nil {
+		return err
+	}
+	g := v.(*gitVcs)
+	mirrors, err := g.listMirrors()
+	if err != nil {
+		return err
+	}
+	for _, p := range mirrors {
+		m, _ := g.newMirror(p)
+		if err := m.sync(true); err != nil {
+			logs.Get().Warnf("refresh git mirror '%s' of vcs %s error: %v", p, vcs.Id, err)
+		}
+	}
+	return nil
+}
+
+type gitMirror struct {
+	vcs  *models.Vcs
+	path string // vcs 下的仓库路径
+	dir  string // 镜像目录
+}
+
+func (m *gitMirror) remoteUrl() string {
+	return utils.JoinURL(m.vcs.Address, m.path)
+}
+
+func (m *gitMirror) auth() (transport.AuthMethod, error) {
+	token, err := GetVcsToken(m.vcs.VcsToken)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, nil
+	}
+
+	if isGitSshAddr(m.vcs.Address) {
+		ep, err := transport.NewEndpoint(m.remoteUrl())
+		if err != nil {
+			return nil, err
+		}
+		return gitssh.NewPublicKeys(utils.FirstValueStr(ep.User, "git"), []byte(token), "")
+	} else if strings.HasPrefix(m.vcs.Address, "http") {
+		return &githttp.BasicAuth{Username: models.RepoUser, Password: token}, nil
+	}
+	return nil, nil
+}
+
+// fetchedAt 镜像最近一次同步的时间，镜像不存在时返回零值
+func (m *gitMirror) fetchedAt() time.Time {
+	info, err := os.Stat(filepath.Join(m.dir, gitMirrorFetchedFile))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// exists 镜像是否存在(仓库已添加)
+func (m *gitMirror) exists() bool {
+	return !m.fetchedAt().IsZero()
+}
+
+// sync 同步远端仓库的所有分支及 tag 到镜像，force 为 false 时只在镜像不存在或者过期时同步
+func (m *gitMirror) sync(force bool) error {
+	lock, _ := gitMirrorLocks.LoadOrStore(m.dir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	fetchedAt := m.fetchedAt()
+	if !force && !fetchedAt.IsZero() && time.Since(fetchedAt) < configs.Get().Portal.GetGitMirrorInterval() {
+		return nil
+	}
+
+	repo, err := git.PlainOpen(m.dir)
+	if err == git.ErrRepositoryNotExists {
+		if err := os.MkdirAll(m.dir, 0755); err != nil {
+			return e.New(e.InternalError, err)
+		}
+		repo, err = git.PlainInit(m.dir, true)
+	}
+	if err != nil {
+		return e.New(e.InternalError, errors.Wrapf(err, "open git mirror %s", m.path))
+	}
+
+	if err := m.fetch(repo); err != nil {
+		// 首次同步失败时删除镜像目录，避免留下空仓库
+		if fetchedAt.IsZero() {
+			_ = os.RemoveAll(m.dir)
+		}
+		return e.New(e.VcsError, errors.Wrapf(err, "fetch %s", m.path))
+	}
+
+	fetchedFile := filepath.Join(m.dir, gitMirrorFetchedFile)
+	if err := os.WriteFile(fetchedFile, []byte(time.Now().Format(time.RFC3339)), 0644); err != nil {
+		return e.New(e.InternalError, err)
+	}
+	return nil
+}
+
+func (m *gitMirror) fetch(repo *git.Repository) error {
+	remote, err := repo.Remote(gitMirrorRemote)
+	if err == nil && remote.Config().URLs[0] != m.remoteUrl() {
+		// vcs 地址有修改
+		_ = repo.DeleteRemote(gitMirrorRemote)
+		err = git.ErrRemoteNotFound
+	}
+	if err == git.ErrRemoteNotFound {
+		remote, err = repo.CreateRemote(&config.RemoteConfig{
+			Name: gitMirrorRemote,
+			URLs: []string{m.remoteUrl()},
+			Fetch: []config.RefSpec{
+				"+refs/heads/*:refs/heads/*",
+				"+refs/tags/*:refs/tags/*",
+			},
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	auth, err := m.auth()
+	if err != nil {
+		return err
+	}
+	insecure := configs.Get().HttpClientInsecure
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitMirrorFetchTimeout)
+	defer cancel()
+	remoteRefs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth, InsecureSkipTLS: insecure})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return err
+	}
+
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RemoteName:      gitMirrorRemote,
+		Auth:            auth,
+		Force:           true,
+		Tags:            git.NoTags,
+		InsecureSkipTLS: insecure,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate && err != transport.ErrEmptyRemoteRepository {
+		return err
+	}
+	return m.pruneAndSetHead(repo, remoteRefs)
+}
+
+// pruneAndSetHead 删除远端已经不存在的分支及 tag，并将 HEAD 指向远端的默认分支
+func (m *gitMirror) pruneAndSetHead(repo *git.Repository, remoteRefs []*plumbing.Reference) error {
+	remoteNames := make(map[plumbing.ReferenceName]bool)
+	var remoteHead *plumbing.Reference
+	for _, ref := range remoteRefs {
+		remoteNames[ref.Name()] = true
+		if ref.Name() == plumbing.HEAD {
+			remoteHead = ref
+		}
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return err
+	}
+	defer refs.Close()
+
+	stale := make([]plumbing.ReferenceName, 0)
+	branches := make([]*plumbing.Reference, 0)
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		if !name.IsBranch() && !name.IsTag() {
+			return nil
+		}
+		if !remoteNames[name] {
+			stale = append(stale, name)
+		} else if name.IsBranch() {
+			branches = append(branches, ref)
+		}
+		return nil
+	})
+	for _, name := range stale {
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+
+	// 服务端支持 symref 时 HEAD 为符号引用，否则查找与 HEAD 指向同一 commit 的分支
+	var head plumbing.ReferenceName
+	if remoteHead != nil && remoteHead.Type() == plumbing.SymbolicReference {
+		head = remoteHead.Target()
+	} else {
+		for _, ref := range branches {
+			if remoteHead != nil && ref.Hash() == remoteHead.Hash() &&
+				(head == "" || ref.Name() == plumbing.Master || ref.Name().Short() == "main") {
+				head = ref.Name()
+			}
+		}
+		if head == "" && len(branches) > 0 {
+			head = branches[0].Name()
+		}
+	}
+	if head == "" {
+		return nil
+	}
+	return repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, head))
+}
+
+func (m *gitMirror) open() (*gitRepo, error) {
+	repo, err := newLocalRepo(m.dir, "")
+	if err != nil {
+		return nil, e.New(e.ObjectNotExists, err)
+	}
+	repo.path = m.path
+	return &gitRepo{LocalRepo: repo, mirror: m}, nil
+}
+
+// gitRepo 基于本地镜像实现仓库的读取操作，webhook 及 pr 评论等接口使用 LocalRepo 的空实现
+type gitRepo struct {
+	*LocalRepo
+	mirror *gitMirror
+}
+
+func (r *gitRepo) ListFiles(opt VcsIfaceOptions) ([]string, error) {
+	commit, err := r.getCommit(getBranch(r, opt.Ref))
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	filesIter, err := commit.Files()
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	defer filesIter.Close()
+
+	opt.Path = strings.Trim(opt.Path, "/")
+	results, err := getMatchedFiles(filesIter, opt)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	if opt.Offset < len(results) {
+		results = results[opt.Offset:]
+	} else {
+		results = results[:0]
+	}
+	if opt.Limit != 0 && len(results) > opt.Limit {
+		results = results[:opt.Limit]
+	}
+	return results, nil
+}
+
+func (r *gitRepo) DefaultBranch() string {
+	head, err := r.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return ""
+	}
+	return head.Target().Short()
+}
+
+func (r *gitRepo) FormatRepoSearch() (*Projects, e.Error) {
+	project := &Projects{
+		ID:            r.mirror.path,
+		DefaultBranch: r.DefaultBranch(),
+		HTTPURLToRepo: r.mirror.remoteUrl(),
+		Name:          strings.TrimSuffix(path.Base(r.mirror.path), ".git"),
+		FullName:      r.mirror.path,
+	}
+	if commit, err := r.getCommit(project.DefaultBranch); err == nil {
+		project.LastActivityAt = &commit.Author.When
+	}
+	if isGitSshAddr(r.mirror.vcs.Address) {
+		project.SSHURLToRepo = project.HTTPURLToRepo
+	}
+	return project, nil
+}
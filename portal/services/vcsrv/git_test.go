@@ -0,0 +1,140 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+func gitTestCommit(t *testing.T, repo *git.Repository, dir string, files map[string]string) plumbing.Hash {
+	wt, err := repo.Worktree()
+	assert.NoError(t, err)
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+		_, err = wt.Add(name)
+		assert.NoError(t, err)
+	}
+	hash, err := wt.Commit("update", &git.CommitOptions{
+		Author: &object.Signature{Name: "iac", Email: "iac@example.com", When: time.Now()},
+	})
+	assert.NoError(t, err)
+	return hash
+}
+
+func TestGitVcs(t *testing.T) {
+	configs.Set(&configs.Config{Portal: configs.PortalConfig{GitMirrorPath: t.TempDir(), GitAllowFileScheme: true}})
+
+	// 源仓库
+	srcRoot := t.TempDir()
+	srcDir := filepath.Join(srcRoot, "team", "infra")
+	src, err := git.PlainInit(srcDir, false)
+	assert.NoError(t, err)
+	first := gitTestCommit(t, src, srcDir, map[string]string{
+		"main.tf":             `resource "null_resource" "a" {}`,
+		"variables.tf":        `variable "a" {}`,
+		"modules/vpc/main.tf": `resource "null_resource" "b" {}`,
+	})
+	_, err = src.CreateTag("v1.0.0", first, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "iac", Email: "iac@example.com", When: time.Now()},
+		Message: "v1.0.0",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, src.Storer.SetReference(plumbing.NewHashReference("refs/heads/dev", first)))
+
+	vcs := &models.Vcs{BaseModel: models.BaseModel{Id: "vcs-git"}, VcsType: consts.GitTypeGit, Address: "file://" + srcRoot + "/"}
+	v, err := GetVcsInstance(vcs)
+	assert.NoError(t, err)
+
+	_, err = AddGitRepo(vcs, "team/none")
+	assert.Error(t, err)
+
+	// 仓库需要先添加，搜索不会 clone 仓库
+	_, err = v.GetRepo("team/infra")
+	assert.Error(t, err)
+	repos, total, err := v.ListRepos("", "team/infra", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+	assert.Empty(t, repos)
+	assert.NoError(t, RefreshGitMirror(vcs, "team/infra"))
+	_, err = v.GetRepo("team/infra")
+	assert.Error(t, err)
+
+	_, err = AddGitRepo(vcs, "/team/infra")
+	assert.NoError(t, err)
+	repo, err := v.GetRepo("/team/infra")
+	assert.NoError(t, err)
+	assert.Equal(t, "master", repo.DefaultBranch())
+
+	branches, err := repo.ListBranches()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"master", "dev"}, branches)
+	tags, err := repo.ListTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0"}, tags)
+
+	commitId, err := repo.BranchCommitId("v1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, first.String(), commitId)
+
+	files, err := repo.ListFiles(VcsIfaceOptions{Search: "*.tf"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.tf", "variables.tf"}, files)
+	files, err = repo.ListFiles(VcsIfaceOptions{Path: "modules/vpc/", Search: "*.tf", Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"modules/vpc/main.tf"}, files)
+
+	content, err := repo.ReadFileContent("master", "variables.tf")
+	assert.NoError(t, err)
+	assert.Equal(t, `variable "a" {}`, string(content))
+	_, err = repo.ReadFileContent("master", "none.tf")
+	assert.True(t, IsNotFoundErr(err))
+
+	project, _ := repo.FormatRepoSearch()
+	assert.Equal(t, "team/infra", project.ID)
+	assert.Equal(t, "file://"+srcRoot+"/team/infra", project.HTTPURLToRepo)
+
+	// 镜像未过期时不会同步，webhook 通知后立即同步
+	second := gitTestCommit(t, src, srcDir, map[string]string{"outputs.tf": `output "a" {}`})
+	assert.NoError(t, src.Storer.RemoveReference("refs/heads/dev"))
+	repo, _ = v.GetRepo("team/infra")
+	commitId, _ = repo.BranchCommitId("master")
+	assert.Equal(t, first.String(), commitId)
+
+	assert.NoError(t, RefreshGitMirror(vcs, "team/infra"))
+	repo, _ = v.GetRepo("team/infra")
+	commitId, _ = repo.BranchCommitId("master")
+	assert.Equal(t, second.String(), commitId)
+	branches, _ = repo.ListBranches()
+	assert.Equal(t, []string{"master"}, branches)
+
+	changed, err := repo.CompareCommits(first.String(), second.String())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outputs.tf"}, changed)
+
+	repos, total, err = v.ListRepos("", "infra", 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	project, _ = repos[0].FormatRepoSearch()
+	assert.Equal(t, "team/infra", project.FullName)
+
+	_, err = GetVcsInstance(&models.Vcs{VcsType: consts.GitTypeGit, Address: "git@example.com:team"})
+	assert.Error(t, err)
+
+	// 未开启配置时不允许使用 file:// 地址
+	configs.Get().Portal.GitAllowFileScheme = false
+	_, err = GetVcsInstance(&models.Vcs{VcsType: consts.GitTypeGit, Address: "file://" + srcRoot})
+	assert.Error(t, err)
+}
@@ -383,6 +383,7 @@ func (gitea *giteaRepoIface) AddWebhook(url string) error {
 		"events": []string{
 			"pull_request_only",
 			"push",
+			"pull_request_comment",
 		},
 		"type": "gitea",
 	}
@@ -443,19 +444,46 @@ func (gitea *giteaRepoIface) DeleteWebhook(id int) error {
 	return nil
 }
 
-func (gitea *giteaRepoIface) CreatePrComment(prId int, comment string) error {
-	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/pulls/%d/reviews", gitea.repository.FullName, prId)
+// CreatePrComment gitea 的 review 不支持修改，所以使用 issue 评论(pr 同时也是 issue)
+func (gitea *giteaRepoIface) CreatePrComment(prId int, comment string) (int, error) {
+	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/issues/%d/comments", gitea.repository.FullName, prId)
 	requestBody := map[string]string{
 		"body": comment,
 	}
 	b, err := json.Marshal(requestBody)
+	if err != nil {
+		return 0, err
+	}
+	response, body, err := giteaRequest(path, http.MethodPost, gitea.vcs.VcsToken, b)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+
+	rep := struct {
+		Id int `json:"id"`
+	}{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	return rep.Id, nil
+}
+
+func (gitea *giteaRepoIface) UpdatePrComment(prId int, commentId int, comment string) error {
+	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/issues/comments/%d", gitea.repository.FullName, commentId)
+	b, err := json.Marshal(map[string]string{"body": comment})
 	if err != nil {
 		return err
 	}
-	_, _, err = giteaRequest(path, http.MethodPost, gitea.vcs.VcsToken, b)
+	response, body, err := giteaRequest(path, http.MethodPatch, gitea.vcs.VcsToken, b)
 	if err != nil {
 		return e.New(e.VcsError, err)
 	}
+	if response.StatusCode >= 300 {
+		return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
 	return nil
 }
 
@@ -465,6 +493,72 @@ func (gitea *giteaRepoIface) GetFullFilePath(address, filePath, repoRevision str
 	return u.String()
 }
 
+func (gitea *giteaRepoIface) SetCommitStatus(commitId string, status CommitStatus) (int, error) {
+	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/statuses/%s", gitea.repository.FullName, commitId)
+	b, err := json.Marshal(map[string]string{
+		"state":       githubCommitState(status.State),
+		"context":     status.Context,
+		"description": status.Description,
+		"target_url":  status.TargetUrl,
+	})
+	if err != nil {
+		return 0, err
+	}
+	response, body, err := giteaRequest(path, http.MethodPost, gitea.vcs.VcsToken, b)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return 0, nil
+}
+
+type giteaCompare struct {
+	Commits []struct {
+		Files []struct {
+			Filename string `json:"filename"`
+		} `json:"files"`
+	} `json:"commits"`
+}
+
+// CompareCommits gitea 1.19 及以上版本才支持 compare 接口
+func (gitea *giteaRepoIface) CompareCommits(from, to string) ([]string, error) {
+	path := gitea.vcs.Address + giteaApiRoute +
+		fmt.Sprintf("/repos/%s/compare/%s...%s", gitea.repository.FullName, from, to)
+	response, body, err := giteaRequest(path, "GET", gitea.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("compare commits response code: %d", response.StatusCode))
+	}
+
+	rep := giteaCompare{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	files := make([]string, 0)
+	for _, c := range rep.Commits {
+		for _, f := range c.Files {
+			files = append(files, f.Filename)
+		}
+	}
+	return uniqChangedFiles(files), nil
+}
+
+func (gitea *giteaRepoIface) GetPullRequest(prId int) (*PullRequest, error) {
+	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/pulls/%d", gitea.repository.FullName, prId)
+	response, body, err := giteaRequest(path, "GET", gitea.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return parseGithubPullRequest(body)
+}
+
 func (gitea *giteaRepoIface) GetCommitFullPath(address, commitId string) string {
 	u, _ := url.Parse(address)
 	u.Path = path.Join(u.Path, gitea.repository.FullName, "commit", commitId)
@@ -7,6 +7,7 @@ import (
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/models"
 	"cloudiac/utils"
+	"cloudiac/utils/logs"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -374,6 +375,7 @@ func (gitee *giteeRepoIface) AddWebhook(url string) error {
 		"url":                   url,
 		"push_events":           "true",
 		"merge_requests_events": "true",
+		"note_events":           "true",
 	}
 	b, _ := json.Marshal(&body)
 	response, respBody, err := giteeRequest(path, http.MethodPost, b)
@@ -428,7 +430,7 @@ func (gitee *giteeRepoIface) DeleteWebhook(id int) error {
 	return nil
 }
 
-func (gitee *giteeRepoIface) CreatePrComment(prId int, comment string) error {
+func (gitee *giteeRepoIface) CreatePrComment(prId int, comment string) (int, error) {
 	path := gitee.vcs.Address +
 		fmt.Sprintf("/repos/%s/pulls/%d/comments?access_token=%s", gitee.repository.FullName, prId, gitee.urlParam.Get("access_token"))
 
@@ -436,13 +438,40 @@ func (gitee *giteeRepoIface) CreatePrComment(prId int, comment string) error {
 		"body": comment,
 	}
 	b, er := json.Marshal(requestBody)
+	if er != nil {
+		return 0, er
+	}
+	response, body, err := giteeRequest(path, http.MethodPost, b)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+
+	rep := struct {
+		Id int `json:"id"`
+	}{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	return rep.Id, nil
+}
+
+func (gitee *giteeRepoIface) UpdatePrComment(prId int, commentId int, comment string) error {
+	path := gitee.vcs.Address +
+		fmt.Sprintf("/repos/%s/pulls/comments/%d?access_token=%s", gitee.repository.FullName, commentId, gitee.urlParam.Get("access_token"))
+	b, er := json.Marshal(map[string]string{"body": comment})
 	if er != nil {
 		return er
 	}
-	_, _, err := giteeRequest(path, http.MethodPost, b)
+	response, body, err := giteeRequest(path, http.MethodPatch, b)
 	if err != nil {
 		return e.New(e.VcsError, err)
 	}
+	if response.StatusCode >= 300 {
+		return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
 	return nil
 }
 
@@ -452,6 +481,108 @@ func (gitee *giteeRepoIface) GetFullFilePath(address, filePath, repoRevision str
 	return u.String()
 }
 
+// SetCommitStatus gitee 没有 commit status 接口，通过检查项(check run)实现。
+// 检查项每次创建都会新增一条记录，所以状态变更时通过 id 更新已创建的检查项
+// doc: https://gitee.com/api/v5/swagger#/postV5ReposOwnerRepoCheckRuns
+func (gitee *giteeRepoIface) SetCommitStatus(commitId string, status CommitStatus) (int, error) {
+	requestBody := map[string]interface{}{
+		"name":        status.Context,
+		"details_url": status.TargetUrl,
+		"output": map[string]string{
+			"title":   status.Context,
+			"summary": status.Description,
+		},
+	}
+	switch status.State {
+	case CommitStatePending:
+		requestBody["status"] = "queued"
+	case CommitStateRunning:
+		requestBody["status"] = "in_progress"
+	default:
+		requestBody["status"] = "completed"
+		requestBody["conclusion"] = status.State
+	}
+
+	if status.Id > 0 {
+		path := gitee.vcs.Address + fmt.Sprintf("/repos/%s/check-runs/%d?access_token=%s",
+			gitee.repository.FullName, status.Id, gitee.urlParam.Get("access_token"))
+		id, err := gitee.requestCheckRun(path, http.MethodPatch, requestBody)
+		if err == nil {
+			return id, nil
+		}
+		// 检查项可能已被删除，重新创建
+		logs.Get().Warnf("update gitee check run %d err: %v, create a new one", status.Id, err)
+	}
+
+	path := gitee.vcs.Address +
+		fmt.Sprintf("/repos/%s/check-runs?access_token=%s", gitee.repository.FullName, gitee.urlParam.Get("access_token"))
+	requestBody["head_sha"] = commitId
+	return gitee.requestCheckRun(path, http.MethodPost, requestBody)
+}
+
+func (gitee *giteeRepoIface) requestCheckRun(path string, method string, requestBody map[string]interface{}) (int, error) {
+	b, er := json.Marshal(requestBody)
+	if er != nil {
+		return 0, er
+	}
+	response, body, err := giteeRequest(path, method, b)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+
+	rep := struct {
+		Id int `json:"id"`
+	}{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	return rep.Id, nil
+}
+
+type giteeCompare struct {
+	Files []struct {
+		Filename string `json:"filename"`
+	} `json:"files"`
+}
+
+func (gitee *giteeRepoIface) CompareCommits(from, to string) ([]string, error) {
+	path := gitee.vcs.Address + fmt.Sprintf("/repos/%s/compare/%s...%s?access_token=%s",
+		gitee.repository.FullName, from, to, gitee.urlParam.Get("access_token"))
+	response, body, err := giteeRequest(path, "GET", nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("compare commits response code: %d", response.StatusCode))
+	}
+
+	rep := giteeCompare{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	files := make([]string, 0, len(rep.Files))
+	for _, f := range rep.Files {
+		files = append(files, f.Filename)
+	}
+	return uniqChangedFiles(files), nil
+}
+
+func (gitee *giteeRepoIface) GetPullRequest(prId int) (*PullRequest, error) {
+	path := gitee.vcs.Address + fmt.Sprintf("/repos/%s/pulls/%d?access_token=%s",
+		gitee.repository.FullName, prId, gitee.urlParam.Get("access_token"))
+	response, body, err := giteeRequest(path, "GET", nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return parseGithubPullRequest(body)
+}
+
 func (gitee *giteeRepoIface) GetCommitFullPath(address, commitId string) string {
 	u, _ := url.Parse(address)
 	u.Path = path.Join(u.Path, gitee.repository.FullName, "commit", commitId)
@@ -0,0 +1,68 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"cloudiac/portal/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGiteeCommitStatus(t *testing.T) {
+	requests := make([]recordedRequest, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gitee-token", r.URL.Query().Get("access_token"))
+		requests = append(requests, recordRequest(r))
+		switch r.URL.Path {
+		case "/repos/iac/demo/check-runs":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":21}`))
+		case "/repos/iac/demo/check-runs/21":
+			_, _ = w.Write([]byte(`{"id":21}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	repo := &giteeRepoIface{
+		vcs:        &models.Vcs{Address: server.URL},
+		repository: &RepositoryGitee{FullName: "iac/demo"},
+		urlParam:   url.Values{"access_token": []string{"gitee-token"}},
+	}
+	status := CommitStatus{State: CommitStateRunning, Context: "cloudiac/plan (prod)"}
+	id, err := repo.SetCommitStatus("9b2c3d1e", status)
+	assert.NoError(t, err)
+	assert.Equal(t, 21, id)
+	assert.Equal(t, http.MethodPost, requests[0].Method)
+	assert.Equal(t, "in_progress", requests[0].Body["status"])
+	assert.Equal(t, "9b2c3d1e", requests[0].Body["head_sha"])
+
+	// 状态变更时更新已创建的检查项
+	status.Id, status.State = id, CommitStateSuccess
+	id, err = repo.SetCommitStatus("9b2c3d1e", status)
+	assert.NoError(t, err)
+	assert.Equal(t, 21, id)
+	assert.Equal(t, recordedRequest{
+		Method: http.MethodPatch,
+		Path:   "/repos/iac/demo/check-runs/21",
+		Body: map[string]interface{}{
+			"name":        "cloudiac/plan (prod)",
+			"details_url": "",
+			"output":      map[string]interface{}{"title": "cloudiac/plan (prod)", "summary": ""},
+			"status":      "completed",
+			"conclusion":  "success",
+		},
+	}, requests[1])
+
+	// 检查项不存在时重新创建
+	status.Id = 22
+	_, err = repo.SetCommitStatus("9b2c3d1e", status)
+	assert.NoError(t, err)
+	assert.Len(t, requests, 4)
+	assert.Equal(t, http.MethodPost, requests[3].Method)
+}
@@ -431,6 +431,7 @@ func (github *githubRepoIface) AddWebhook(url string) error {
 		"events": []string{
 			"pull_request",
 			"push",
+			"issue_comment",
 		},
 		"type":   "gitea",
 		"active": true,
@@ -469,7 +470,7 @@ func (github *githubRepoIface) DeleteWebhook(id int) error {
 }
 
 // CreatePrComment doc: https://docs.github.com/en/rest/reference/pulls#submit-a-review-for-a-pull-request
-func (github *githubRepoIface) CreatePrComment(prId int, comment string) error {
+func (github *githubRepoIface) CreatePrComment(prId int, comment string) (int, error) {
 	path := utils.GenQueryURL(github.vcs.Address, fmt.Sprintf("/repos/%s/pulls/%d/reviews", github.repository.FullName, prId), nil)
 	requestBody := map[string]string{
 		"body":  comment,
@@ -477,14 +478,39 @@ func (github *githubRepoIface) CreatePrComment(prId int, comment string) error {
 	}
 	b, er := json.Marshal(requestBody)
 	if er != nil {
-		return er
+		return 0, er
 	}
 	response, body, err := githubRequest(path, http.MethodPost, github.vcs.VcsToken, b)
 
 	if err != nil {
-		return e.New(e.VcsError, err)
+		return 0, e.New(e.VcsError, err)
+	}
+
+	if response.StatusCode > 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("code: %s, err: %s", response.Status, string(body)))
+	}
+
+	review := struct {
+		Id int `json:"id"`
+	}{}
+	if err := json.Unmarshal(body, &review); err != nil {
+		return 0, e.New(e.VcsError, err)
 	}
+	return review.Id, nil
+}
 
+// UpdatePrComment doc: https://docs.github.com/en/rest/pulls/reviews#update-a-review-for-a-pull-request
+func (github *githubRepoIface) UpdatePrComment(prId int, commentId int, comment string) error {
+	path := utils.GenQueryURL(github.vcs.Address,
+		fmt.Sprintf("/repos/%s/pulls/%d/reviews/%d", github.repository.FullName, prId, commentId), nil)
+	b, er := json.Marshal(map[string]string{"body": comment})
+	if er != nil {
+		return er
+	}
+	response, body, err := githubRequest(path, http.MethodPut, github.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.VcsError, err)
+	}
 	if response.StatusCode > 300 {
 		return e.New(e.VcsError, fmt.Errorf("code: %s, err: %s", response.Status, string(body)))
 	}
@@ -497,6 +523,115 @@ func (github *githubRepoIface) GetFullFilePath(address, filePath, repoRevision s
 	return u.String()
 }
 
+// githubCommitState github 没有 running 状态，执行中也使用 pending
+func githubCommitState(state string) string {
+	if state == CommitStateRunning {
+		return CommitStatePending
+	}
+	return state
+}
+
+// SetCommitStatus doc: https://docs.github.com/en/rest/commits/statuses#create-a-commit-status
+func (github *githubRepoIface) SetCommitStatus(commitId string, status CommitStatus) (int, error) {
+	path := utils.GenQueryURL(github.vcs.Address,
+		fmt.Sprintf("/repos/%s/statuses/%s", github.repository.FullName, commitId), nil)
+	b, er := json.Marshal(map[string]string{
+		"state":       githubCommitState(status.State),
+		"context":     status.Context,
+		"description": status.Description,
+		"target_url":  status.TargetUrl,
+	})
+	if er != nil {
+		return 0, er
+	}
+	response, body, err := githubRequest(path, http.MethodPost, github.vcs.VcsToken, b)
+	if err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	if response.StatusCode > 300 {
+		return 0, e.New(e.VcsError, fmt.Errorf("code: %s, err: %s", response.Status, string(body)))
+	}
+	return 0, nil
+}
+
+type githubCompare struct {
+	Files []struct {
+		Filename         string `json:"filename"`
+		PreviousFilename string `json:"previous_filename"`
+	} `json:"files"`
+}
+
+// CompareCommits doc: https://docs.github.com/en/rest/commits/commits#compare-two-commits
+func (github *githubRepoIface) CompareCommits(from, to string) ([]string, error) {
+	path := utils.GenQueryURL(github.vcs.Address,
+		fmt.Sprintf("/repos/%s/compare/%s...%s", github.repository.FullName, from, to), nil)
+	response, body, err := githubRequest(path, "GET", github.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("compare commits response code: %d", response.StatusCode))
+	}
+
+	rep := githubCompare{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	files := make([]string, 0, len(rep.Files))
+	for _, f := range rep.Files {
+		files = append(files, f.PreviousFilename, f.Filename)
+	}
+	return uniqChangedFiles(files), nil
+}
+
+// githubPullRequest github、gitea、gitee 的 PR 接口返回格式相同
+type githubPullRequest struct {
+	Number int    `json:"number"`
+	State  string `json:"state"` // open, closed, merged(gitee)
+	Merged bool   `json:"merged"`
+	Base   struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	Head struct {
+		Ref string `json:"ref"`
+		Sha string `json:"sha"`
+	} `json:"head"`
+}
+
+func parseGithubPullRequest(body []byte) (*PullRequest, error) {
+	rep := githubPullRequest{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	state := PrStateOpen
+	if rep.Merged || rep.State == PrStateMerged {
+		state = PrStateMerged
+	} else if rep.State != "open" {
+		state = PrStateClosed
+	}
+	return &PullRequest{
+		Id:         rep.Number,
+		State:      state,
+		BaseRef:    rep.Base.Ref,
+		HeadRef:    rep.Head.Ref,
+		HeadCommit: rep.Head.Sha,
+	}, nil
+}
+
+// GetPullRequest doc: https://docs.github.com/en/rest/pulls/pulls#get-a-pull-request
+func (github *githubRepoIface) GetPullRequest(prId int) (*PullRequest, error) {
+	path := utils.GenQueryURL(github.vcs.Address,
+		fmt.Sprintf("/repos/%s/pulls/%d", github.repository.FullName, prId), nil)
+	response, body, err := githubRequest(path, "GET", github.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	if response.StatusCode >= 300 {
+		return nil, e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return parseGithubPullRequest(body)
+}
+
 func (github *githubRepoIface) GetCommitFullPath(address, commitId string) string {
 	u, _ := url.Parse("https://github.com/")
 	u.Path = path.Join(u.Path, github.repository.FullName, "commit", commitId)
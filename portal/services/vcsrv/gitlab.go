@@ -350,6 +350,7 @@ func (git *gitlabRepoIface) AddWebhook(url string) error {
 		URL:                 gitlab.String(url),
 		PushEvents:          gitlab.Bool(true),
 		MergeRequestsEvents: gitlab.Bool(true),
+		NoteEvents:          gitlab.Bool(true),
 	})
 	return err
 }
@@ -391,8 +392,17 @@ func (git *gitlabRepoIface) DeleteWebhook(id int) error {
 	return err
 }
 
-func (git *gitlabRepoIface) CreatePrComment(prId int, comment string) error {
-	if _, _, err := git.gitConn.Notes.CreateMergeRequestNote(git.Project.ID, prId, &gitlab.CreateMergeRequestNoteOptions{Body: gitlab.String(comment)}); err != nil {
+func (git *gitlabRepoIface) CreatePrComment(prId int, comment string) (int, error) {
+	note, _, err := git.gitConn.Notes.CreateMergeRequestNote(git.Project.ID, prId, &gitlab.CreateMergeRequestNoteOptions{Body: gitlab.String(comment)})
+	if err != nil {
+		return 0, err
+	}
+	return note.ID, nil
+}
+
+func (git *gitlabRepoIface) UpdatePrComment(prId int, commentId int, comment string) error {
+	if _, _, err := git.gitConn.Notes.UpdateMergeRequestNote(git.Project.ID, prId, commentId,
+		&gitlab.UpdateMergeRequestNoteOptions{Body: gitlab.String(comment)}); err != nil {
 		return err
 	}
 	return nil
@@ -421,3 +431,58 @@ func GetGitConn(gitlabToken, gitlabUrl string) (*gitlab.Client, e.Error) {
 	}
 	return git, nil
 }
+
+var gitlabCommitStates = map[string]gitlab.BuildStateValue{
+	CommitStatePending: gitlab.Pending,
+	CommitStateRunning: gitlab.Running,
+	CommitStateSuccess: gitlab.Success,
+	CommitStateFailure: gitlab.Failed,
+}
+
+func (git *gitlabRepoIface) SetCommitStatus(commitId string, status CommitStatus) (int, error) {
+	if _, _, err := git.gitConn.Commits.SetCommitStatus(git.Project.ID, commitId, &gitlab.SetCommitStatusOptions{
+		State:       gitlabCommitStates[status.State],
+		Name:        gitlab.String(status.Context),
+		TargetURL:   gitlab.String(status.TargetUrl),
+		Description: gitlab.String(status.Description),
+	}); err != nil {
+		return 0, e.New(e.VcsError, err)
+	}
+	return 0, nil
+}
+
+func (git *gitlabRepoIface) GetPullRequest(prId int) (*PullRequest, error) {
+	mr, _, err := git.gitConn.MergeRequests.GetMergeRequest(git.Project.ID, prId, nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	state := PrStateOpen
+	switch mr.State {
+	case "merged":
+		state = PrStateMerged
+	case "closed", "locked":
+		state = PrStateClosed
+	}
+	return &PullRequest{
+		Id:         mr.IID,
+		State:      state,
+		BaseRef:    mr.TargetBranch,
+		HeadRef:    mr.SourceBranch,
+		HeadCommit: mr.SHA,
+	}, nil
+}
+
+func (git *gitlabRepoIface) CompareCommits(from, to string) ([]string, error) {
+	compare, _, err := git.gitConn.Repositories.Compare(git.Project.ID, &gitlab.CompareOptions{
+		From: gitlab.String(from),
+		To:   gitlab.String(to),
+	})
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	files := make([]string, 0, len(compare.Diffs))
+	for _, d := range compare.Diffs {
+		files = append(files, d.OldPath, d.NewPath)
+	}
+	return uniqChangedFiles(files), nil
+}
@@ -291,7 +291,12 @@ func (l *LocalRepo) DeleteWebhook(id int) error {
 	return nil
 }
 
-func (l *LocalRepo) CreatePrComment(prId int, comment string) error {
+func (l *LocalRepo) CreatePrComment(prId int, comment string) (int, error) {
+
+	return 0, nil
+}
+
+func (l *LocalRepo) UpdatePrComment(prId int, commentId int, comment string) error {
 
 	return nil
 }
@@ -300,6 +305,43 @@ func (l *LocalRepo) GetFullFilePath(address, filePath, repoRevision string) stri
 	return ""
 }
 
+func (l *LocalRepo) SetCommitStatus(commitId string, status CommitStatus) (int, error) {
+	return 0, nil
+}
+
+func (l *LocalRepo) GetPullRequest(prId int) (*PullRequest, error) {
+	return nil, e.New(e.NotImplement)
+}
+
+func (l *LocalRepo) CompareCommits(from, to string) ([]string, error) {
+	fromCommit, err := l.getCommit(from)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := l.getCommit(to)
+	if err != nil {
+		return nil, err
+	}
+	fromTree, err := fromCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := toCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(changes))
+	for _, c := range changes {
+		files = append(files, c.From.Name, c.To.Name)
+	}
+	return uniqChangedFiles(files), nil
+}
+
 func (l *LocalRepo) GetCommitFullPath(address, commitId string) string {
 	return ""
 }
@@ -266,7 +266,12 @@ func (r *RegistryRepo) DeleteWebhook(id int) error {
 	return nil
 }
 
-func (r *RegistryRepo) CreatePrComment(prId int, comment string) error {
+func (r *RegistryRepo) CreatePrComment(prId int, comment string) (int, error) {
+
+	return 0, nil
+}
+
+func (r *RegistryRepo) UpdatePrComment(prId int, commentId int, comment string) error {
 
 	return nil
 }
@@ -275,6 +280,18 @@ func (r *RegistryRepo) GetFullFilePath(address, filePath, repoRevision string) s
 	return ""
 }
 
+func (r *RegistryRepo) SetCommitStatus(commitId string, status CommitStatus) (int, error) {
+	return 0, nil
+}
+
+func (r *RegistryRepo) GetPullRequest(prId int) (*PullRequest, error) {
+	return nil, e.New(e.NotImplement)
+}
+
+func (r *RegistryRepo) CompareCommits(from, to string) ([]string, error) {
+	return nil, e.New(e.NotImplement)
+}
+
 func (r *RegistryRepo) GetCommitFullPath(address, commitId string) string {
 	return ""
 }
@@ -35,6 +35,10 @@ const (
 	WebhookUrlGitea  = "/webhooks/gitea"
 	WebhookUrlGitee  = "/webhooks/gitee"
 	WebhookUrlGithub = "/webhooks/github"
+
+	WebhookUrlBitbucket = "/webhooks/bitbucket"
+	WebhookUrlAzure     = "/webhooks/azure"
+	WebhookUrlGit       = "/webhooks/git"
 )
 
 type VcsIfaceOptions struct {
@@ -116,14 +120,30 @@ type RepoIface interface {
 	//AddWebhook 查询Webhook列表
 	AddWebhook(url string) error
 
-	//CreatePrComment 添加PR评论
-	CreatePrComment(prId int, comment string) error
+	//CreatePrComment 添加PR评论，返回评论 id
+	CreatePrComment(prId int, comment string) (int, error)
+
+	// UpdatePrComment 修改PR评论内容，commentId 为 CreatePrComment 返回的评论 id
+	UpdatePrComment(prId int, commentId int, comment string) error
 
 	// GetVcsFullFilePath 获取文件完整路径
 	GetFullFilePath(address, filePath, repoRevision string) string
 
 	// GetCommitFullPath  获取仓库commit的完整路径
 	GetCommitFullPath(address, commitId string) string
+
+	// CompareCommits 获取两个版本之间变更的文件列表
+	// param from: 起始 commit id 或者分支
+	// param to: 结束 commit id 或者分支
+	// return: 文件完整路径列表，重命名的文件同时返回新旧路径
+	CompareCommits(from, to string) ([]string, error)
+
+	// SetCommitStatus 设置 commit 的状态，vcs 中相同 Context 的状态会被覆盖。
+	// 返回状态在 vcs 中的 id，只有需要通过 id 更新状态的 vcs(gitee 检查项)返回非 0 值
+	SetCommitStatus(commitId string, status CommitStatus) (int, error)
+
+	// GetPullRequest 获取 PR/MR 的分支、最新 commit 及状态
+	GetPullRequest(prId int) (*PullRequest, error)
 }
 
 type RepoHook struct {
@@ -131,6 +151,37 @@ type RepoHook struct {
 	Url string `json:"url"`
 }
 
+// commit 状态，各 vcs 实现中转换为对应的状态值
+const (
+	CommitStatePending = "pending"
+	CommitStateRunning = "running"
+	CommitStateSuccess = "success"
+	CommitStateFailure = "failure"
+)
+
+type CommitStatus struct {
+	State       string // pending, running, success, failure
+	Context     string // 状态名称，如 "cloudiac/plan (prod)"
+	Description string
+	TargetUrl   string // 状态详情链接
+	Id          int    // 之前设置的状态 id(SetCommitStatus 的返回值)，不为 0 时更新该状态
+}
+
+// PR 状态，各 vcs 实现中转换为对应的状态值
+const (
+	PrStateOpen   = "open"
+	PrStateMerged = "merged"
+	PrStateClosed = "closed"
+)
+
+type PullRequest struct {
+	Id         int
+	State      string // open, merged, closed
+	BaseRef    string // 目标分支
+	HeadRef    string // 源分支
+	HeadCommit string // 源分支最新的 commit id
+}
+
 func GetVcsInstance(vcs *models.Vcs) (VcsIface, error) {
 	// 先进行值拷贝再创建实例, 防止因为指针类型导致上层变量被修改;
 	vcsObject := *vcs
@@ -147,6 +198,12 @@ func GetVcsInstance(vcs *models.Vcs) (VcsIface, error) {
 		return newGiteeInstance(&vcsObject)
 	case consts.GitTypeRegistry:
 		return newRegistryVcs(&vcsObject)
+	case consts.GitTypeBitbucket:
+		return newBitbucketInstance(&vcsObject)
+	case consts.GitTypeAzure:
+		return newAzureInstance(&vcsObject)
+	case consts.GitTypeGit:
+		return newGitInstance(&vcsObject)
 	default:
 		return nil, errors.New("vcs type doesn't exist")
 	}
@@ -172,6 +229,17 @@ func matchGlob(search, name string) bool {
 	return matched
 }
 
+// uniqChangedFiles 变更文件去重，并去掉空路径(新增或删除的文件旧路径或新路径为空)
+func uniqChangedFiles(files []string) []string {
+	result := make([]string, 0, len(files))
+	for _, f := range utils.RemoveDuplicateElement(files) {
+		if f != "" {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
 // 校验ref是否为空 空则返回默认分支
 func getBranch(repo RepoIface, ref string) string {
 	if ref == "" {
@@ -258,6 +326,12 @@ func GetWebhookUrl(vcs *models.Vcs, apiToken string) string {
 		webhookUrl += WebhookUrlGitee
 	case models.VcsGithub:
 		webhookUrl += WebhookUrlGithub
+	case models.VcsBitbucket:
+		webhookUrl += WebhookUrlBitbucket
+	case models.VcsAzure:
+		webhookUrl += WebhookUrlAzure
+	case models.VcsGit:
+		webhookUrl += WebhookUrlGit
 	}
 	webhookUrl += fmt.Sprintf("/%s?token=%s", vcs.Id.String(), apiToken)
 	return webhookUrl
@@ -298,5 +372,11 @@ func GetRepoHttpAddr(vcs *models.Vcs, repoFullName string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if vcs.VcsType == models.VcsAzure {
+		// azure 仓库全名为 project/repo，clone 地址为 {org}/{project}/_git/{repo}
+		if parts := strings.SplitN(repoFullName, "/", 2); len(parts) == 2 {
+			return utils.JoinURL(v.RepoBaseHttpAddr(), parts[0], "_git", parts[1]), nil
+		}
+	}
 	return utils.JoinURL(v.RepoBaseHttpAddr(), fmt.Sprintf("%s.git", repoFullName)), nil
 }
@@ -3,10 +3,16 @@
 package task_manager
 
 import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
 	"cloudiac/utils/logs"
 	"context"
+	"fmt"
 	"github.com/robfig/cron/v3"
 	"time"
 )
@@ -25,6 +31,89 @@ func billCron(ctx context.Context) {
 	}()
 }
 
+// gitMirrorCron 定时同步通用 git vcs 的仓库镜像
+func gitMirrorCron(ctx context.Context) {
+	c := cron.New()
+	spec := fmt.Sprintf("@every %s", configs.Get().Portal.GetGitMirrorInterval())
+	if _, err := c.AddFunc(spec, cronRefreshGitMirrors); err != nil {
+		logs.Get().Errorf("git mirror cron task start failed: %v", err)
+		return
+	}
+	c.Start()
+
+	go func() {
+		<-ctx.Done()
+		c.Stop()
+	}()
+}
+
+func cronRefreshGitMirrors() {
+	logger := logs.Get().WithField("action", "git mirror cron task")
+
+	vcsList := make([]models.Vcs, 0)
+	if err := db.Get().Model(&models.Vcs{}).Where("vcs_type = ? AND status = 'enable'", models.VcsGit).
+		Find(&vcsList); err != nil {
+		logger.Errorf("query vcs err: %s", err)
+		return
+	}
+
+	for index := range vcsList {
+		if err := vcsrv.RefreshGitMirrors(&vcsList[index]); err != nil {
+			logger.Errorf("refresh git mirrors of vcs %s err: %s", vcsList[index].Id, err)
+		}
+	}
+}
+
+// policySuppressCron 定时检查到期的策略屏蔽，重新启用策略并通知屏蔽的申请人和审批人
+func policySuppressCron(ctx context.Context) {
+	c := cron.New()
+	spec := fmt.Sprintf("@every %s", consts.PolicySuppressExpireInterval)
+	if _, err := c.AddFunc(spec, cronExpirePolicySuppress); err != nil {
+		logs.Get().Errorf("policy suppress cron task start failed: %v", err)
+		return
+	}
+	c.Start()
+
+	go func() {
+		<-ctx.Done()
+		c.Stop()
+	}()
+}
+
+func cronExpirePolicySuppress() {
+	logger := logs.Get().WithField("action", "policy suppress cron task")
+
+	sups, err := services.GetExpiredPolicySuppress(db.Get(), time.Now())
+	if err != nil {
+		logger.Errorf("query expired policy suppress err: %s", err)
+		return
+	}
+
+	for index := range sups {
+		sup := &sups[index]
+		expired := false
+		if err := db.Get().Transaction(func(tx *db.Session) error {
+			var er e.Error
+			expired, er = services.ExpirePolicySuppress(tx, sup)
+			if er != nil {
+				return er
+			}
+			return nil
+		}); err != nil {
+			logger.Errorf("expire policy suppress %s err: %s", sup.Id, err)
+			continue
+		}
+		if !expired {
+			continue
+		}
+
+		logger.Infof("policy suppress %s expired, policy: %s, target: %s", sup.Id, sup.PolicyId, sup.TargetId)
+		if err := services.SendPolicySuppressExpiredMail(db.Get(), sup); err != nil {
+			logger.Warnf("send policy suppress %s expired mail err: %s", sup.Id, err)
+		}
+	}
+}
+
 func cronBillCollectTask() {
 	logger := logs.Get().WithField("action", "billing cron task")
 	logger.Info("start bill collect")
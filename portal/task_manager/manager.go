@@ -46,14 +46,20 @@ type TaskManager struct {
 	db     *db.Session
 	logger logs.Logger
 
-	envRunningTask sync.Map       // 每个环境下正在执行的任务
-	runnerTaskNum  map[string]int // 每个 runner 正在执行的任务数量
+	envRunningTask sync.Map          // 每个环境下正在执行的任务
+	runnerTaskNum  map[string]int    // 每个 runner 正在执行的任务数量
+	projectTaskNum map[models.Id]int // 每个项目正在执行的任务数量
 
 	wg sync.WaitGroup // 等待执行任务协程退出的 wait group
 
-	maxTasksPerRunner int // 每个 runner 并发任务数量限制
+	maxTasksPerRunner int            // 每个 runner 默认的并发任务数量限制
+	runnerMaxJobs     map[string]int // runner 在 consul 中声明的并发任务数量
+	runnerMaxJobsAt   time.Time      // runnerMaxJobs 的更新时间
 }
 
+// runner 并发任务数量的刷新间隔
+const runnerMaxJobsRefreshInterval = 30 * time.Second
+
 func Start(serviceId string) {
 	m := TaskManager{
 		id:     serviceId,
@@ -81,8 +87,11 @@ func (m *TaskManager) reset() {
 	m.db = db.Get()
 	m.envRunningTask = sync.Map{}
 	m.runnerTaskNum = make(map[string]int)
+	m.projectTaskNum = make(map[models.Id]int)
 	m.wg = sync.WaitGroup{}
 	m.maxTasksPerRunner = services.GetRunnerMax()
+	m.runnerMaxJobs = make(map[string]int)
+	m.runnerMaxJobsAt = time.Time{}
 }
 
 func (m *TaskManager) acquireLock(ctx context.Context) (<-chan struct{}, error) {
@@ -141,6 +150,10 @@ func (m *TaskManager) start() {
 
 	// 启动账单采集定时任务
 	billCron(ctx)
+	// 启动 git 仓库镜像同步定时任务
+	gitMirrorCron(ctx)
+	// 启动策略屏蔽到期检查定时任务
+	policySuppressCron(ctx)
 
 	// 恢复执行中的任务状态
 	if err = m.recoverTask(ctx); err != nil {
@@ -309,8 +322,9 @@ func (m *TaskManager) getPendingDeployTasks() []*models.Task {
 		"WHERE iac_task.env_id = fpt.env_id AND iac_task.created_at = fpt.created_at "+
 		"AND iac_task.status = ? GROUP BY iac_task.env_id", firstPendingQuery.Expr(), models.TaskPending)
 
-	// 通过 id 查询完整任务信息
-	query := m.db.Model(&models.Task{}).Joins("JOIN (?) AS t ON t.task_id = iac_task.id", firstPendingIdQuery.Expr())
+	// 通过 id 查询完整任务信息，按调度优先级查询，避免大量低优先级任务占满单次查询数量
+	query := m.db.Model(&models.Task{}).Joins("JOIN (?) AS t ON t.task_id = iac_task.id", firstPendingIdQuery.Expr()).
+		Order(services.PendingTaskPriorityOrder())
 
 	if len(runningEnvs) > 0 {
 		// 过滤掉同一环境下有其他任务在执行的任务
@@ -336,7 +350,7 @@ func (m *TaskManager) getPendingScanTasks() []*models.ScanTask {
 	logger := m.logger
 
 	// 扫描类型任务支持多个并行执行，不会互相影响，这里获取所有处于 pending 状态的任务列表
-	query := m.db.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0", models.TaskPending)
+	query := m.db.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0", models.TaskPending).Order("created_at")
 
 	limitedRunners := m.getLimitedRunner()
 	if len(limitedRunners) > 0 {
@@ -356,30 +370,61 @@ func (m *TaskManager) getPendingScanTasks() []*models.ScanTask {
 func (m *TaskManager) getLimitedRunner() []string {
 	limitedRunners := make([]string, 0)
 	for runnerId, count := range m.runnerTaskNum {
-		if count >= m.maxTasksPerRunner {
+		if count >= m.getRunnerMaxJobs(runnerId) {
 			limitedRunners = append(limitedRunners, runnerId)
 		}
 	}
 	return limitedRunners
 }
 
+func (m *TaskManager) getRunnerMaxJobs(runnerId string) int {
+	if n := services.GetRunnerMaxJobs(m.runnerMaxJobs, runnerId); n > 0 {
+		return n
+	}
+	return m.maxTasksPerRunner
+}
+
+// refreshRunnerTaskNum 更新各 runner 的并发限制及正在执行的任务数量
+func (m *TaskManager) refreshRunnerTaskNum() {
+	logger := m.logger
+
+	if time.Since(m.runnerMaxJobsAt) > runnerMaxJobsRefreshInterval {
+		if maxJobs, err := services.GetRunnersMaxJobs(); err != nil {
+			// 获取失败时继续使用之前的配置
+			logger.Warnf("get runners max jobs error: %v", err)
+		} else {
+			m.runnerMaxJobs = maxJobs
+		}
+		m.runnerMaxJobsAt = time.Now()
+	}
+
+	runnerNum, projectNum, err := services.GetRunningTaskNum(m.db)
+	if err != nil {
+		logger.Errorf("get running task num error: %v", err)
+		return
+	}
+	m.runnerTaskNum = runnerNum
+	m.projectTaskNum = projectNum
+}
+
 func (m *TaskManager) processPendingTask(ctx context.Context) {
 	logger := m.logger
 
+	m.refreshRunnerTaskNum()
+
 	scanTasks := m.getPendingScanTasks()
 	m.logger.Tracef("get pending scan tasks: %d", len(scanTasks))
 	deployTasks := m.getPendingDeployTasks()
 	m.logger.Tracef("get pending deploy tasks: %d", len(deployTasks))
-	tasks := make([]models.Tasker, len(scanTasks)+len(deployTasks))
-
-	// 合并等待任务列表，扫描任务更轻量，我们先执行扫描任务
-	for idx := range scanTasks {
-		tasks[idx] = scanTasks[idx]
-	}
-	scanTasksLen := len(scanTasks)
+	tasks := make([]models.Tasker, 0, len(scanTasks)+len(deployTasks))
 	for idx := range deployTasks {
-		tasks[scanTasksLen+idx] = deployTasks[idx]
+		tasks = append(tasks, deployTasks[idx])
+	}
+	for idx := range scanTasks {
+		tasks = append(tasks, scanTasks[idx])
 	}
+	// 按优先级及项目轮转确定执行顺序
+	tasks = services.SortPendingTasks(tasks, m.projectTaskNum)
 
 	for i := range tasks {
 		select {
@@ -393,7 +438,7 @@ func (m *TaskManager) processPendingTask(ctx context.Context) {
 
 		// 判断 runner 并发数量
 		n := m.runnerTaskNum[task.GetRunnerId()]
-		if n >= m.maxTasksPerRunner {
+		if n >= m.getRunnerMaxJobs(task.GetRunnerId()) {
 			logger.WithField("count", n).Infof("runner %s: %v", task.GetRunnerId(), ErrMaxTasksPerRunner)
 			continue
 		}
@@ -404,6 +449,9 @@ func (m *TaskManager) processPendingTask(ctx context.Context) {
 			} else {
 				logger.WithField("taskId", task.GetId()).Errorf("run task error: %s", err)
 			}
+		} else {
+			// 任务状态在协程中更新，这里先计数，避免同一轮调度超出并发限制
+			m.runnerTaskNum[task.GetRunnerId()]++
 		}
 	}
 }
@@ -545,7 +593,8 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 		return
 	}
 	var PlanIndex int
-	for _, step := range steps {
+	for i := 0; i < len(steps); i++ {
+		step := steps[i]
 		if step.PipelineStep.Type == models.TaskStepPlan {
 			PlanIndex = step.Index
 		}
@@ -564,14 +613,28 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 				}
 			}
 
-			if _, er := m.db.Model(&models.Task{}).
-				Where("id = ?", step.TaskId). //nolint
-				Update(&models.Task{Applied: true}); er != nil {
-				logger.Errorf("update task  terraformApply applied: %v", er)
+			// 有执行条件的 apply 步骤可能被跳过，在 runTaskStep() 中条件满足时再标识 applied
+			if step.When == "" {
+				setTaskApplied(m.db, task.Id, logger)
 			}
 		}
+		// 流程中包含 collect 步骤(如 state 恢复任务)时不需要在步骤结束后再执行信息采集
+		if step.PipelineStep.Type == models.TaskStepCollect {
+			setTaskApplied(m.db, task.Id, logger)
+		}
 
-		startErr, runErr := m.processStartStep(ctx, task, step, *runTaskReq)
+		var startErr, runErr error
+		if step.ParallelGroup != "" {
+			// 相邻的同一并行组的步骤同时执行
+			j := i
+			for j+1 < len(steps) && steps[j+1].ParallelGroup == step.ParallelGroup {
+				j++
+			}
+			startErr, runErr = m.processStartParallelSteps(ctx, task, steps[i:j+1], *runTaskReq)
+			i = j
+		} else {
+			startErr, runErr = m.processStartStep(ctx, task, step, *runTaskReq)
+		}
 		if startErr != nil {
 			taskStartFailed(startErr)
 			return startErr
@@ -628,7 +691,7 @@ func (m *TaskManager) processStartStep(
 	if runErr != nil {
 		logger.Warnf("run task step err: %v", runErr)
 		if (step.Type == common.TaskStepEnvScan || step.Type == common.TaskStepOpaScan) &&
-			!task.StopOnViolation {
+			!services.PolicyViolationBlocked(task) {
 			// 合规任务失败不影响环境部署流程
 			logger.Infof("run scan task step: %v", runErr)
 			return nil, nil
@@ -638,6 +701,75 @@ func (m *TaskManager) processStartStep(
 	return nil, nil
 }
 
+// processStartParallelSteps 同时执行一个并行组中的所有步骤，所有步骤结束后再返回
+func (m *TaskManager) processStartParallelSteps(
+	ctx context.Context,
+	task *models.Task,
+	steps []*models.TaskStep,
+	req runner.RunTaskReq) (startErr error, runErr error) {
+	logger := m.logger.WithField("taskId", task.Id)
+
+	pending := make([]*models.TaskStep, 0, len(steps))
+	for _, step := range steps {
+		// 跳过己执行的步骤
+		if step.Index >= task.CurrStep {
+			pending = append(pending, step)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	if _, err := m.db.Model(task).UpdateAttrs(models.Attrs{"CurrStep": pending[0].Index}); err != nil {
+		return errors.Wrap(err, "update task"), nil
+	}
+	task.CurrStep = pending[0].Index
+
+	tTask, err := services.GetTaskById(m.db, task.Id)
+	if err != nil {
+		return errors.Wrapf(err, "get task %s", task.Id.String()), nil
+	}
+	req.ContainerId = tTask.ContainerId
+
+	runErrs := make([]error, len(pending))
+	wg := sync.WaitGroup{}
+	for i, step := range pending {
+		wg.Add(1)
+		// 每个步骤使用独立的 task 对象，避免并发修改
+		go func(i int, step *models.TaskStep, t models.Task) {
+			defer wg.Done()
+			runErrs[i] = m.runTaskStep(ctx, req, &t, step)
+		}(i, step, *task)
+	}
+	wg.Wait()
+
+	for i, step := range pending {
+		if err := m.processStepDone(task, step); err != nil {
+			logger.Warnf("process step done error: %v", err)
+			return nil, err
+		}
+		if runErrs[i] != nil && runErr == nil {
+			logger.WithField("step", fmt.Sprintf("%d(%s)", step.Index, step.Name)).
+				Warnf("run task step err: %v", runErrs[i])
+			// 任务状态以 CurrStep 步骤的状态为准，所以指向第一个失败的步骤
+			if _, err := m.db.Model(task).UpdateAttrs(models.Attrs{"CurrStep": step.Index}); err != nil {
+				logger.Errorf("update task curr step: %v", err)
+			}
+			task.CurrStep = step.Index
+			runErr = runErrs[i]
+		}
+	}
+	return nil, runErr
+}
+
+func setTaskApplied(dbSess *db.Session, taskId models.Id, logger logs.Logger) {
+	if _, er := dbSess.Model(&models.Task{}).
+		Where("id = ?", taskId). //nolint
+		Update(&models.Task{Applied: true}); er != nil {
+		logger.Errorf("update task  terraformApply applied: %v", er)
+	}
+}
+
 func (m *TaskManager) processStepDone(task *models.Task, step *models.TaskStep) error {
 	dbSess := m.db
 
@@ -680,6 +812,13 @@ func (m *TaskManager) processStepDone(task *models.Task, step *models.TaskStep)
 			}
 		}
 
+		// 根据扫描结果进行合规检测分级处理，扫描失败时必须通过的策略组视为未通过，配置了 block 时中止部署
+		if scanTask.PolicyStatus != common.PolicyStatusPending {
+			if _, err := services.EnforceTaskPolicy(dbSess, task, scanTask.PolicyStatus); err != nil {
+				return fmt.Errorf("enforce task policy: %v", err)
+			}
+		}
+
 		return err
 	}
 
@@ -755,17 +894,27 @@ func (m *TaskManager) processTaskDone(taskId models.Id) { //nolint:cyclop
 		if err := taskDoneProcessState(dbSess, task); err != nil {
 			logger.Errorf("process task state: %v", err)
 		}
+		if err := taskDoneProcessStateVersion(dbSess, task); err != nil {
+			logger.Errorf("process task state version: %v", err)
+		}
 
 		// 任务执行成功才会进行 changes 统计，失败的话基于 plan 文件进行变更统计是不准确的
-		// (terraform 执行 apply 失败也不会输出资源变更情况)
-		if lastStep.Status == models.TaskComplete {
+		// (terraform 执行 apply 失败也不会输出资源变更情况)。
+		// import 任务的 plan 是导入后与配置之间仍存在的差异，并未执行，不作为任务的变更结果
+		if lastStep.IsSuccess() && task.Type != models.TaskTypeImport {
 			if err := taskDoneProcessPlan(dbSess, task, false); err != nil {
 				logger.Errorf("process task plan: %v", err)
 			}
 		}
 	}
 
-	if lastStep.Status == models.TaskComplete && task.IsDriftTask {
+	if lastStep.IsSuccess() && task.Type == models.TaskTypePlan {
+		if err := taskDoneProcessPlanState(dbSess, task); err != nil {
+			logger.Errorf("process plan task state: %v", err)
+		}
+	}
+
+	if lastStep.IsSuccess() && task.IsDriftTask {
 		if err := taskDoneProcessDriftTask(logger, dbSess, task); err != nil {
 			logger.Errorf("process drafit task done: %v", err)
 			return
@@ -824,7 +973,24 @@ func (m *TaskManager) runTaskStep(
 		}
 	}()
 
-	if step.NextStep != "" {
+	if step.When != "" && step.Status == models.TaskStepPending {
+		changeStepStatus := getChangeStepStatusFunc(m.db, task, logger)
+		ok, err := models.EvalStepWhen(step.When, task.StepWhenParameters())
+		if err != nil {
+			changeStepStatus(models.TaskStepFailed, err.Error(), step)
+			return err
+		} else if !ok {
+			logger.Infof("step condition '%s' not met, skip", step.When)
+			changeStepStatus(models.TaskStepSkipped, fmt.Sprintf("condition '%s' not met", step.When), step)
+			return nil
+		}
+		if step.Type == models.TaskStepApply {
+			setTaskApplied(m.db, task.Id, logger)
+		}
+	}
+
+	// 并行步骤执行时其他步骤可能还在运行，不能暂停容器
+	if step.NextStep != "" && step.ParallelGroup == "" {
 		if nextStep, err := services.GetTaskStepByStepId(m.db, step.NextStep); err != nil {
 			err = errors.Wrapf(err, "get task step %s", string(step.NextStep))
 			return err
@@ -839,12 +1005,20 @@ func (m *TaskManager) runTaskStep(
 		step = newStep
 	}
 
+	// 步骤可能等待审批很长时间，所以 state token 在步骤执行前重新生成
+	if taskReq.StateStore.Backend == common.StateBackendHttp {
+		if taskReq.StateStore, err = buildStateStore(
+			task.Id, task.EnvId, task.StatePath, task.StepTimeout); err != nil {
+			return err
+		}
+	}
+
 	if err := waitTaskStepDone(ctx, m.db, task, step, taskReq); err != nil {
 		return err
 	}
 
 	switch step.Status {
-	case models.TaskStepComplete:
+	case models.TaskStepComplete, models.TaskStepSkipped:
 		return nil
 	case models.TaskStepFailed:
 		message := "failed"
@@ -880,6 +1054,18 @@ func waitTaskStepApprove(ctx context.Context, db *db.Session, task *models.Task,
 		newStep = step
 		err     error
 	)
+	if step.Type == common.TaskStepTfApply && step.Status == models.TaskStepPending {
+		// 必须通过的策略组未通过时部署步骤不进入审批
+		if err = services.CheckTaskRequiredPolicyGroups(db, task); err != nil {
+			logger.Warnf("check required policy groups: %v", err)
+			changeStepStatus(models.TaskStepFailed, err.Error(), step)
+			return nil, err
+		}
+		if services.TaskPolicyRequireApproval(task) {
+			step.MustApproval = true
+		}
+	}
+
 	if step.MustApproval && !step.IsApproved() {
 		logger.Infof("waitting task step approve")
 		changeStepStatus(models.TaskStepApproving, "", step)
@@ -997,6 +1183,45 @@ func (m *TaskManager) stop() {
 	logger.Infof("task manager stopped")
 }
 
+// buildStateStore 根据 state_backend 配置生成任务使用的 terraform state 存储配置
+func buildStateStore(taskId models.Id, envId models.Id, statePath string, stepTimeout int) (runner.StateStore, error) {
+	if configs.Get().StateBackend.GetType() == common.StateBackendHttp {
+		// token 有效期为步骤超时时间再加一小时，每个步骤执行时都会重新生成
+		expire := time.Duration(stepTimeout)*time.Second + time.Hour
+		token, err := services.GenerateStateToken(taskId, envId, expire)
+		if err != nil {
+			return runner.StateStore{}, errors.Wrap(err, "generate state token")
+		}
+		return runner.StateStore{
+			Backend:  common.StateBackendHttp,
+			Path:     statePath,
+			Address:  fmt.Sprintf("%s/api/v1/tfstate/%s", strings.TrimRight(configs.Get().StateBackend.GetAddress(), "/"), envId),
+			Username: taskId.String(),
+			Password: token,
+		}, nil
+	}
+
+	stateStore := runner.StateStore{
+		Backend: common.StateBackendConsul,
+		Scheme:  "http",
+		Path:    statePath,
+		Address: "",
+	}
+
+	if configs.Get().Consul.ConsulAcl {
+		stateStore.ConsulAcl = configs.Get().Consul.ConsulAcl
+		stateStore.ConsulToken = configs.Get().Consul.ConsulAclToken
+	}
+
+	if configs.Get().Consul.ConsulTls {
+		stateStore.ConsulTls = configs.Get().Consul.ConsulTls
+		stateStore.CaPath = path.Join(common.ConsulContainerPath, common.ConsulCa)
+		stateStore.CakeyPath = path.Join(common.ConsulContainerPath, common.ConsulCakey)
+		stateStore.CapemPath = path.Join(common.ConsulContainerPath, common.ConsulCapem)
+	}
+	return stateStore, nil
+}
+
 // buildRunTaskReq 基于任务信息构建一个 RunTaskReq 对象。
 //
 //	注意这里不会设置 step 相关的数据，step 相关字段在 StartTaskStep() 方法中设置
@@ -1008,35 +1233,32 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		Playbook:        task.Playbook,
 		PlayVarsFile:    task.PlayVarsFile,
 		TfVersion:       task.TfVersion,
+		IacEngine:       task.IacEngine,
+		StackType:       task.StackType,
+		StackRoots:      task.StackRoots,
 		EnvironmentVars: make(map[string]string),
 		TerraformVars:   make(map[string]string),
 		AnsibleVars:     make(map[string]string),
 	}
 
 	if runnerEnv.TfVersion == "" {
-		runnerEnv.TfVersion = configs.Get().GetDefaultTerraformVersion()
+		runnerEnv.TfVersion = configs.Get().GetDefaultIacEngineVersion(task.IacEngine)
 	}
 	if err := buildTaskReqEnvVars(&runnerEnv, task.Variables); err != nil {
 		return nil, err
 	}
-
-	stateStore := runner.StateStore{
-		Backend: "consul",
-		Scheme:  "http",
-		Path:    task.StatePath,
-		Address: "",
+	// 上游环境的输出覆盖同名 terraform 变量，销毁任务允许上游输出不存在
+	depVars, er := services.GetEnvDependencyVars(dbSess, task.EnvId, task.Type != common.TaskTypeDestroy)
+	if er != nil {
+		return nil, er
 	}
-
-	if configs.Get().Consul.ConsulAcl {
-		stateStore.ConsulAcl = configs.Get().Consul.ConsulAcl
-		stateStore.ConsulToken = configs.Get().Consul.ConsulAclToken
+	for k, v := range depVars {
+		runnerEnv.TerraformVars[k] = v
 	}
 
-	if configs.Get().Consul.ConsulTls {
-		stateStore.ConsulTls = configs.Get().Consul.ConsulTls
-		stateStore.CaPath = path.Join(common.ConsulContainerPath, common.ConsulCa)
-		stateStore.CakeyPath = path.Join(common.ConsulContainerPath, common.ConsulCakey)
-		stateStore.CapemPath = path.Join(common.ConsulContainerPath, common.ConsulCapem)
+	stateStore, err := buildStateStore(task.Id, task.EnvId, task.StatePath, task.StepTimeout)
+	if err != nil {
+		return nil, err
 	}
 
 	pk := ""
@@ -1080,6 +1302,47 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		taskReq.PrivateKey = utils.EncodeSecretVar(pk, true)
 	}
 
+	if task.Type == models.TaskTypeStateRestore {
+		version, err := services.GetStateVersionById(dbSess, task.EnvId, task.StateVersionId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get state version '%s'", task.StateVersionId)
+		}
+		if taskReq.RestoreState, err = services.GetStateVersionContent(version); err != nil {
+			return nil, errors.Wrapf(err, "read state version '%s'", task.StateVersionId)
+		}
+	}
+
+	if task.Type == models.TaskTypeImport {
+		for _, i := range task.Imports {
+			taskReq.Imports = append(taskReq.Imports, runner.TaskImport{Address: i.Address, Id: i.Id})
+		}
+	}
+
+	if task.Type == models.TaskTypeStateOperation {
+		for _, op := range task.StateOps {
+			taskReq.StateOps = append(taskReq.StateOps, runner.TaskStateOp{
+				Type: op.Type, Address: op.Address, Destination: op.Destination,
+			})
+		}
+	}
+
+	if task.Extra.PlanTaskId != "" {
+		planTask, er := services.GetTaskById(dbSess, task.Extra.PlanTaskId)
+		if er != nil {
+			return nil, errors.Wrapf(er, "get plan task '%s'", task.Extra.PlanTaskId)
+		}
+		if taskReq.PlanFile, err = logstorage.Get().Read(planTask.PlanFilePath()); err != nil {
+			return nil, errors.Wrapf(err, "read plan file of task '%s'", planTask.Id)
+		}
+	}
+
+	// 部署任务可以使用 plan 任务(或环境上一个成功的任务)收集的 artifacts
+	if task.Type == models.TaskTypeApply {
+		if taskReq.InputArtifacts, err = services.GetTaskInputArtifacts(dbSess, &task); err != nil {
+			return nil, errors.Wrap(err, "get env artifacts")
+		}
+	}
+
 	return taskReq, nil
 }
 
@@ -1407,26 +1670,10 @@ func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.Ta
 	if task.Type == common.TaskTypeEnvScan || task.Type == common.TaskTypeEnvParse {
 		env, _ := services.GetEnvById(dbSess, task.EnvId)
 
-		stateStore := runner.StateStore{
-			Backend: "consul",
-			Scheme:  "http",
-			Path:    env.StatePath,
-			Address: "",
-		}
-
-		if configs.Get().Consul.ConsulAcl {
-			stateStore.ConsulAcl = configs.Get().Consul.ConsulAcl
-			stateStore.ConsulToken = configs.Get().Consul.ConsulAclToken
-		}
-
-		if configs.Get().Consul.ConsulTls {
-			stateStore.ConsulTls = configs.Get().Consul.ConsulTls
-			stateStore.CaPath = path.Join(common.ConsulContainerPath, common.ConsulCa)
-			stateStore.CakeyPath = path.Join(common.ConsulContainerPath, common.ConsulCakey)
-			stateStore.CapemPath = path.Join(common.ConsulContainerPath, common.ConsulCapem)
+		taskReq.StateStore, err = buildStateStore(task.Id, env.Id, env.StatePath, task.StepTimeout)
+		if err != nil {
+			return nil, err
 		}
-
-		taskReq.StateStore = stateStore
 	}
 
 	if err := runTaskReqAddSysEnvs(taskReq); err != nil {
@@ -1590,6 +1837,8 @@ func runTaskReqAddSysEnvs(req *runner.RunTaskReq) error {
 		sysEnvs["CLOUDIAC_WORKDIR"] = filepath.Join(runner.ContainerCodeDir, env.Workdir)
 		// workdir 相对路径(相对云模板仓库根目录)
 		sysEnvs["CLOUDIAC_WORKDIR_REL"] = env.Workdir
+		// 步骤 artifacts 目录，包含本任务之前步骤及环境上一个任务收集的文件
+		sysEnvs["CLOUDIAC_ARTIFACTS_DIR"] = runner.ContainerArtifactsDir
 
 		// 当前任务的组织 ID
 		sysEnvs["CLOUDIAC_ORG_ID"] = env.OrgId.String()
@@ -1608,6 +1857,8 @@ func runTaskReqAddSysEnvs(req *runner.RunTaskReq) error {
 		sysEnvs["CLOUDIAC_ENV_RESOURCES"] = fmt.Sprintf("%d", resCount)
 		// 当前任务使用的 terraform 版本号(eg. 0.14.11)
 		sysEnvs["CLOUDIAC_TF_VERSION"] = req.Env.TfVersion
+		// 当前任务使用的 IaC 引擎(terraform/opentofu)
+		sysEnvs["CLOUDIAC_IAC_ENGINE"] = utils.FirstValueStr(req.Env.IacEngine, common.IacEngineTerraform)
 
 		// 自动设置 tags
 		{
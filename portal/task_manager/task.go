@@ -51,6 +51,14 @@ func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (
 	taskReq.StepArgs = step.Args
 	taskReq.StepBeforeCmds = step.BeforeCmds
 	taskReq.StepAfterCmds = step.AfterCmds
+	taskReq.StepArtifacts = step.Artifacts
+	if step.Index != 0 {
+		// 输入的 artifacts 只在第一个步骤初始化 workspace 时使用
+		taskReq.InputArtifacts = nil
+	}
+	if step.Type != models.TaskStepApply {
+		taskReq.PlanFile = nil
+	}
 
 	respData, err := utils.HttpService(requestUrl, "POST", header, taskReq,
 		int(consts.RunnerConnectTimeout.Seconds()), int(consts.RunnerConnectTimeout.Seconds())*10)
@@ -121,6 +129,17 @@ func WaitTaskStep(ctx context.Context, sess *db.Session, task *models.Task, step
 	}
 
 	saveTaskStepResultFiles(task, step, stepResult.Result)
+	// 信息采集等功能性步骤没有保存到 db，不记录根目录日志
+	if len(stepResult.Result.StackLogs) > 0 && step.Id != "" {
+		if er := services.SaveTaskStepStackLogs(sess, step, stepResult.Result.StackLogs); er != nil {
+			logger.Errorf("save task step stack logs error: %v", er)
+		}
+	}
+	if len(stepResult.Result.Artifacts) > 0 {
+		if er := services.SaveTaskStepArtifacts(sess, task, step, stepResult.Result.Artifacts); er != nil {
+			logger.Errorf("save task step artifacts error: %v", er)
+		}
+	}
 
 	message := ""
 	switch stepResult.Status {
@@ -159,6 +178,12 @@ func saveTaskStepResultFiles(task *models.Task, step *models.TaskStep, result ru
 			logger.WithField("path", path).Errorf("write task state json error: %v", err)
 		}
 	}
+	if len(result.TfState) > 0 {
+		path := task.StateFilePath()
+		if err := logstorage.Get().Write(path, result.TfState); err != nil {
+			logger.WithField("path", path).Errorf("write task state error: %v", err)
+		}
+	}
 	if len(result.TFProviderSchemaJson) > 0 {
 		path := task.ProviderSchemaJsonPath()
 		if err := logstorage.Get().Write(path, result.TFProviderSchemaJson); err != nil {
@@ -171,6 +196,12 @@ func saveTaskStepResultFiles(task *models.Task, step *models.TaskStep, result ru
 			logger.WithField("path", path).Errorf("write task plan json error: %v", err)
 		}
 	}
+	if len(result.TfPlan) > 0 {
+		path := task.PlanFilePath()
+		if err := logstorage.Get().Write(path, result.TfPlan); err != nil {
+			logger.WithField("path", path).Errorf("write task plan file error: %v", err)
+		}
+	}
 	if len(result.TfScanJson) > 0 {
 		path := task.TfParseJsonPath()
 		if err := logstorage.Get().Write(path, result.TfScanJson); err != nil {
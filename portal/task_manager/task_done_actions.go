@@ -63,6 +63,44 @@ func taskDoneProcessState(dbSess *db.Session, task *models.Task) error {
 	return nil
 }
 
+// taskDoneProcessStateVersion 将任务执行后的 state 保存为环境的 state 版本
+func taskDoneProcessStateVersion(dbSess *db.Session, task *models.Task) error {
+	bs, err := readIfExist(task.StateFilePath())
+	if err != nil {
+		return fmt.Errorf("read state: %v", err)
+	} else if len(bs) == 0 {
+		return nil
+	}
+
+	env, er := services.GetEnvById(dbSess, task.EnvId)
+	if er != nil {
+		return er
+	}
+	if _, er := services.CreateStateVersion(dbSess, env, task.Id, bs); er != nil {
+		return fmt.Errorf("create state version: %v", er)
+	}
+	return nil
+}
+
+// taskDoneProcessPlanState 记录 plan 任务执行时环境 state 的 serial，基于该 plan 任务部署时用于检查 state 是否己变化
+func taskDoneProcessPlanState(dbSess *db.Session, task *models.Task) error {
+	bs, err := readIfExist(task.StateFilePath())
+	if err != nil {
+		return fmt.Errorf("read state: %v", err)
+	}
+	serial, err := services.GetStateSerial(bs)
+	if err != nil {
+		return fmt.Errorf("parse state: %v", err)
+	}
+
+	task.Extra.StateSerial = &serial
+	if _, err := dbSess.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateColumn("extra", task.Extra); err != nil {
+		return err
+	}
+	return nil
+}
+
 func taskDoneProcessPlan(dbSess *db.Session, task *models.Task, isPlanResult bool) error {
 	if bs, err := readIfExist(task.PlanJsonPath()); err != nil {
 		return fmt.Errorf("read plan json: %v", err)
@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// CloneEnv 克隆环境
+// @Tags 环境
+// @Summary 克隆环境的配置、变量、变量组及策略组到当前项目或其他项目
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "源环境ID"
+// @Param data body forms.CloneEnvForm true "克隆参数"
+// @router /envs/{envId}/clone [post]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvDetail}
+func CloneEnv(c *ctx.GinRequest) {
+	form := &forms.CloneEnvForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CloneEnv(c.Service(), form))
+}
+
+// PromoteEnv 推广环境
+// @Tags 环境
+// @Summary 将环境的配置、变量、变量组及策略组推广到已存在的目标环境
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "源环境ID"
+// @Param data body forms.PromoteEnvForm true "推广参数"
+// @router /envs/{envId}/promote [post]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvDetail}
+func PromoteEnv(c *ctx.GinRequest) {
+	form := &forms.PromoteEnvForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PromoteEnv(c.Service(), form))
+}
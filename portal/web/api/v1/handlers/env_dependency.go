@@ -0,0 +1,67 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchEnvDependencies 环境依赖的上游环境列表
+// @Tags 环境
+// @Summary 环境依赖的上游环境列表
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/dependencies [get]
+// @Success 200 {object} ctx.JSONResult{result=[]resps.EnvDependencyResp}
+func SearchEnvDependencies(c *ctx.GinRequest) {
+	form := &forms.DetailEnvForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvDependencies(c.Service(), form))
+}
+
+// UpdateEnvDependencies 设置环境依赖
+// @Tags 环境
+// @Summary 设置环境依赖的上游环境及输出到变量的映射
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param json body forms.UpdateEnvDependencyForm true "parameter"
+// @router /envs/{envId}/dependencies [put]
+// @Success 200 {object} ctx.JSONResult{result=[]resps.EnvDependencyResp}
+func UpdateEnvDependencies(c *ctx.GinRequest) {
+	form := &forms.UpdateEnvDependencyForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateEnvDependencies(c.Service(), form))
+}
+
+// EnvDependencyGraph 环境依赖关系图
+// @Tags 环境
+// @Summary 环境依赖关系图，包含与环境直接或间接关联的所有环境
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/dependency_graph [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.EnvDependencyGraphResp}
+func EnvDependencyGraph(c *ctx.GinRequest) {
+	form := &forms.DetailEnvForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvDependencyGraph(c.Service(), form))
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// ImportEnvResources 导入已存在的资源到环境
+// @Tags 环境
+// @Summary 导入已存在的云资源到环境 state，会创建一个 import 任务，导入后执行 plan 展示剩余的差异
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form body forms.ImportEnvResourcesForm true "parameter"
+// @router /envs/{envId}/import [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func ImportEnvResources(c *ctx.GinRequest) {
+	form := &forms.ImportEnvResourcesForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ImportEnvResources(c.Service(), form))
+}
@@ -3,6 +3,7 @@
 package handlers
 
 import (
+	"cloudiac/policy"
 	"cloudiac/portal/apps"
 	"cloudiac/portal/libs/ctrl"
 	"cloudiac/portal/libs/ctx"
@@ -139,3 +140,31 @@ func (Policy) Test(c *ctx.GinRequest) {
 func (Policy) PolicySummary(c *ctx.GinRequest) {
 	c.JSONResult(apps.PolicySummary(c.Service()))
 }
+
+// ExportScanResult 导出扫描结果
+// @Tags 合规/策略
+// @Summary 导出扫描任务的检测结果
+// @Description 导出扫描任务的检测结果为 SARIF 2.1.0 或 JUnit XML 格式，用于接入代码扫描平台及 CI。环境部署任务的扫描结果使用部署任务ID导出。
+// @Produce octet-stream
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param taskId path string true "扫描任务ID"
+// @Param form query forms.ExportScanResultForm true "parameter"
+// @Router /policies/scans/{taskId}/export [get]
+// @Success 200 {file} file
+func (Policy) ExportScanResult(c *ctx.GinRequest) {
+	form := &forms.ExportScanResultForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	content, er := apps.ExportScanResult(c.Service(), form)
+	if er != nil {
+		c.JSONError(er)
+		return
+	}
+	if form.Format == policy.ExportFormatSarif {
+		c.FileDownloadResponse(content, form.Id.String()+".sarif", "application/sarif+json")
+	} else {
+		c.FileDownloadResponse(content, form.Id.String()+".xml", "application/xml")
+	}
+}
@@ -86,3 +86,43 @@ func (Policy) SearchPolicySuppressSource(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.SearchPolicySuppressSource(c.Service(), form))
 }
+
+// ApprovePolicySuppress 审批策略屏蔽申请
+// @Tags 合规/策略屏蔽
+// @Summary 审批策略屏蔽申请
+// @Description 审批策略屏蔽申请，审批通过后屏蔽生效，到达过期时间后自动失效。申请人不能审批自己提交的申请。
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param policyId path string true "策略id"
+// @Param suppressId path string true "屏蔽记录id"
+// @Param json body forms.ApprovePolicySuppressForm true "parameter"
+// @Router /policies/{policyId}/suppress/{suppressId}/approve [post]
+// @Success 200 {object} ctx.JSONResult{result=models.PolicySuppress}
+func (Policy) ApprovePolicySuppress(c *ctx.GinRequest) {
+	form := &forms.ApprovePolicySuppressForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ApprovePolicySuppress(c.Service(), form))
+}
+
+// SearchPolicySuppressReport 策略屏蔽报表
+// @Tags 合规/策略屏蔽
+// @Summary 策略屏蔽报表
+// @Description 列出组织下的策略屏蔽记录，可按生效中、已过期、待审批、已拒绝过滤。
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchPolicySuppressReportForm true "parameter"
+// @Router /policies/suppress/report [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]resps.PolicySuppressReportResp}}
+func (Policy) SearchPolicySuppressReport(c *ctx.GinRequest) {
+	form := &forms.SearchPolicySuppressReportForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchPolicySuppressReport(c.Service(), form))
+}
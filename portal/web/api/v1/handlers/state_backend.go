@@ -0,0 +1,122 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"io/ioutil"
+	"net/http"
+)
+
+// terraform http state backend 接口，由任务中的 terraform 调用，
+// 认证信息通过 basic auth 传入(password 为 portal 下发的 state token)
+
+func stateToken(c *ctx.GinRequest) string {
+	_, token, _ := c.Request.BasicAuth()
+	return token
+}
+
+// stateBackendError 返回错误，state 被锁定时按协议返回 423 及当前锁信息
+func stateBackendError(c *ctx.GinRequest, lock *models.StateLock, er e.Error) {
+	switch er.Code() {
+	case e.StateLocked:
+		if lock != nil {
+			c.Data(http.StatusLocked, "application/json", []byte(lock.Info))
+			c.Abort()
+		} else {
+			c.JSONError(er, http.StatusLocked)
+		}
+	case e.InvalidToken:
+		c.JSONError(er, http.StatusUnauthorized)
+	case e.PermissionDeny:
+		c.JSONError(er, http.StatusForbidden)
+	case e.EnvNotExists:
+		c.JSONError(er, http.StatusNotFound)
+	case e.BadParam, e.StateInvalid:
+		c.JSONError(er, http.StatusBadRequest)
+	default:
+		c.JSONError(er, http.StatusInternalServerError)
+	}
+}
+
+func readStateBody(c *ctx.GinRequest) ([]byte, bool) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSONError(e.New(e.IOError, err), http.StatusInternalServerError)
+		return nil, false
+	}
+	return body, true
+}
+
+// TfStateGet 读取环境 state
+// @Tags 环境
+// @Summary terraform http state backend 读取 state
+// @Produce json
+// @Param id path string true "环境ID"
+// @router /tfstate/{id} [get]
+// @Success 200 {object} string
+func TfStateGet(c *ctx.GinRequest) {
+	content, er := apps.GetTfState(c.Service(), models.Id(c.Param("id")), stateToken(c))
+	if er != nil {
+		stateBackendError(c, nil, er)
+		return
+	}
+	if content == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", content)
+}
+
+// TfStateUpdate 更新环境 state
+// @Tags 环境
+// @Summary terraform http state backend 更新 state
+// @Accept json
+// @Produce json
+// @Param id path string true "环境ID"
+// @Param ID query string false "lock id"
+// @router /tfstate/{id} [post]
+// @Success 200
+func TfStateUpdate(c *ctx.GinRequest) {
+	body, ok := readStateBody(c)
+	if !ok {
+		return
+	}
+	lock, er := apps.UpdateTfState(c.Service(), models.Id(c.Param("id")), stateToken(c), c.Query("ID"), body)
+	if er != nil {
+		stateBackendError(c, lock, er)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// TfStateLock 锁定环境 state(LOCK 方法)
+func TfStateLock(c *ctx.GinRequest) {
+	body, ok := readStateBody(c)
+	if !ok {
+		return
+	}
+	lock, er := apps.LockTfState(c.Service(), models.Id(c.Param("id")), stateToken(c), body)
+	if er != nil {
+		stateBackendError(c, lock, er)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// TfStateUnlock 解锁环境 state(UNLOCK 方法)
+func TfStateUnlock(c *ctx.GinRequest) {
+	body, ok := readStateBody(c)
+	if !ok {
+		return
+	}
+	lock, er := apps.UnlockTfState(c.Service(), models.Id(c.Param("id")), stateToken(c), body)
+	if er != nil {
+		stateBackendError(c, lock, er)
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// CreateStateOperation 执行 state 操作
+// @Tags 环境
+// @Summary 执行 state mv/rm、taint/untaint 操作，会创建一个需要审批的 state 操作任务，任务执行期间环境被锁定
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form body forms.StateOperationForm true "parameter"
+// @router /envs/{envId}/state_operations [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func CreateStateOperation(c *ctx.GinRequest) {
+	form := &forms.StateOperationForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateStateOperationTask(c.Service(), form))
+}
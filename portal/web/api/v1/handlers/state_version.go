@@ -0,0 +1,93 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// SearchStateVersions 环境 state 版本列表
+// @Tags 环境
+// @Summary 环境 state 版本列表
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchStateVersionForm true "parameter"
+// @router /envs/{envId}/states [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]resps.StateVersionResp}}
+func SearchStateVersions(c *ctx.GinRequest) {
+	form := &forms.SearchStateVersionForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvStateVersions(c.Service(), form))
+}
+
+// DiffStateVersions 对比环境的两个 state 版本
+// @Tags 环境
+// @Summary 对比环境的两个 state 版本(资源级别)
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.DiffStateVersionForm true "parameter"
+// @router /envs/{envId}/states/diff [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.StateVersionDiffResp}
+func DiffStateVersions(c *ctx.GinRequest) {
+	form := &forms.DiffStateVersionForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DiffEnvStateVersions(c.Service(), form))
+}
+
+// DownloadStateVersion 下载环境 state 版本
+// @Tags 环境
+// @Summary 下载环境 state 版本
+// @Produce octet-stream
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param versionId path string true "state 版本ID"
+// @router /envs/{envId}/states/{versionId}/download [get]
+// @Success 200 {file} file
+func DownloadStateVersion(c *ctx.GinRequest) {
+	form := &forms.StateVersionForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	content, er := apps.DownloadEnvStateVersion(c.Service(), form)
+	if er != nil {
+		c.JSONError(er)
+		return
+	}
+	c.FileDownloadResponse(content, form.VersionId.String()+".tfstate", "application/json")
+}
+
+// RestoreStateVersion 恢复环境 state 到指定版本
+// @Tags 环境
+// @Summary 恢复环境 state 到指定版本，会创建一个需要审批的 state 恢复任务
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param versionId path string true "state 版本ID"
+// @router /envs/{envId}/states/{versionId}/restore [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func RestoreStateVersion(c *ctx.GinRequest) {
+	form := &forms.StateVersionForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RestoreEnvStateVersion(c.Service(), form))
+}
@@ -8,6 +8,7 @@ import (
 	"cloudiac/portal/libs/ctx"
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
+	"path"
 )
 
 type Task struct {
@@ -52,6 +53,25 @@ func (Task) Detail(c *ctx.GinRequest) {
 	c.JSONResult(apps.TaskDetail(c.Service(), form))
 }
 
+// Queue 任务排队信息
+// @Tags 环境
+// @Summary 任务排队信息，包括调度优先级及在 runner 队列中的位置
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/queue [get]
+// @Success 200 {object} ctx.JSONResult{result=resps.TaskQueueResp}
+func (Task) Queue(c *ctx.GinRequest) {
+	form := forms.DetailTaskForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TaskQueue(c.Service(), form))
+}
+
 // FollowLogSse 当前任务实时日志
 // @Tags 环境
 // @Summary 当前任务实时日志
@@ -255,6 +275,7 @@ func (Task) SearchTaskStep(c *ctx.GinRequest) {
 // @Param IaC-Project-Id header string true "项目ID"
 // @Param id path string true "任务ID"
 // @Param stepId path string true "任务步骤ID"
+// @Param stackRoot query string false "多工作目录模板的根目录名称"
 // @router /tasks/{id}/steps/{stepId}/log [get]
 // @Success 200 {object} ctx.JSONResult{result=string}
 func (Task) GetTaskStepLog(c *ctx.GinRequest) {
@@ -309,3 +330,47 @@ func (Task) DownloadStepLogs(c *ctx.GinRequest) {
 	}
 	c.FileDownloadResponse(zip.Bytes(), string(taskId)+".zip", "application/zip")
 }
+
+// SearchArtifacts 任务步骤收集的文件列表
+// @Tags 环境
+// @Summary 任务步骤收集的文件(artifacts)列表
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param form query forms.SearchTaskArtifactForm true "parameter"
+// @router /tasks/{taskId}/artifacts [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.TaskArtifact}}
+func (Task) SearchArtifacts(c *ctx.GinRequest) {
+	form := &forms.SearchTaskArtifactForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskArtifacts(c.Service(), form))
+}
+
+// DownloadArtifact 下载任务步骤收集的文件
+// @Tags 环境
+// @Summary 下载任务步骤收集的文件
+// @Produce octet-stream
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param artifactId path string true "文件ID"
+// @router /tasks/{taskId}/artifacts/{artifactId}/download [get]
+// @Success 200 {file} file
+func (Task) DownloadArtifact(c *ctx.GinRequest) {
+	form := &forms.TaskArtifactForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	artifact, content, er := apps.DownloadTaskArtifact(c.Service(), form)
+	if er != nil {
+		c.JSONError(er)
+		return
+	}
+	c.FileDownloadResponse(content, path.Base(artifact.Name), "application/octet-stream")
+}
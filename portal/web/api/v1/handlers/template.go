@@ -175,14 +175,19 @@ func TemplatePlaybookSearch(c *ctx.GinRequest) {
 
 // TemplateTfVersionSearch
 // @Tags 云模板
-// @Summary terraform versions tf版本列表接口
+// @Summary terraform versions tf版本列表接口，iacEngine 为 opentofu 时返回 opentofu 版本列表
 // @Accept application/x-www-form-urlencoded
 // @Security AuthToken
 // @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.TemplateTfVersionsForm true "parameter"
 // @router /templates/tfversions [get]
 // @Success 200 {object} ctx.JSONResult{result=[]string}
 func TemplateTfVersionSearch(c *ctx.GinRequest) {
-	c.JSONResult(configs.Get().GetTerraformVersions(), nil)
+	form := forms.TemplateTfVersionsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(configs.Get().GetIacEngineVersions(form.IacEngine), nil)
 }
 
 // AutoTemplateTfVersionChoice
@@ -114,6 +114,26 @@ func (Vcs) ListRepos(c *ctx.GinRequest) {
 	c.JSONResult(apps.ListRepos(c.Service(), &form))
 }
 
+// AddRepo 添加代码仓库
+// @Tags Vcs仓库
+// @Summary 添加代码仓库(仅支持通用 git 类型的 vcs)
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form formData forms.AddVcsRepoForm true "parameter"
+// @Router /vcs/{vcsId}/repo [post]
+// @Success 200 {object} ctx.JSONResult{result=vcsrv.Projects}
+func (Vcs) AddRepo(c *ctx.GinRequest) {
+	form := forms.AddVcsRepoForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.AddRepo(c.Service(), &form))
+}
+
 // ListBranches 列出代码仓库下所有分支
 // @Tags Vcs仓库
 // @Summary 列出代码仓库下所有分支
@@ -228,3 +248,60 @@ func (Vcs) GetFileFullPath(c *ctx.GinRequest) {
 func (Vcs) GetRegistryVcs(c *ctx.GinRequest) {
 	c.JSONResult(apps.GetRegistryVcs(c.Service()))
 }
+
+// SearchVcsUser 查询 vcs 用户映射
+// @Tags Vcs仓库
+// @Summary 查询 vcs 用户与 CloudIaC 用户的映射
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form query forms.SearchVcsUserForm true "parameter"
+// @Router /vcs/{vcsId}/users [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]resps.VcsUserResp}}
+func (Vcs) SearchVcsUser(c *ctx.GinRequest) {
+	form := &forms.SearchVcsUserForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchVcsUser(c.Service(), form))
+}
+
+// CreateVcsUser 添加 vcs 用户映射，PR 评论命令按映射用户的项目角色鉴权
+// @Tags Vcs仓库
+// @Summary 添加 vcs 用户与 CloudIaC 用户的映射
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form formData forms.CreateVcsUserForm true "parameter"
+// @Router /vcs/{vcsId}/users [post]
+// @Success 200 {object} ctx.JSONResult{result=models.VcsUser}
+func (Vcs) CreateVcsUser(c *ctx.GinRequest) {
+	form := &forms.CreateVcsUserForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateVcsUser(c.Service(), form))
+}
+
+// DeleteVcsUser 删除 vcs 用户映射
+// @Tags Vcs仓库
+// @Summary 删除 vcs 用户映射
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param vcsUserId path string true "用户映射ID"
+// @Router /vcs/{vcsId}/users/{vcsUserId} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Vcs) DeleteVcsUser(c *ctx.GinRequest) {
+	form := &forms.DeleteVcsUserForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteVcsUser(c.Service(), form))
+}
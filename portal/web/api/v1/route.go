@@ -44,6 +44,12 @@ func Register(g *gin.RouterGroup) {
 	// sso token 验证
 	g.GET("/sso/tokens/verify", w(handlers.VerifySsoToken))
 
+	// terraform http state backend，使用任务的 state token 认证
+	g.GET("/tfstate/:id", w(handlers.TfStateGet))
+	g.POST("/tfstate/:id", w(handlers.TfStateUpdate))
+	g.Handle("LOCK", "/tfstate/:id", w(handlers.TfStateLock))
+	g.Handle("UNLOCK", "/tfstate/:id", w(handlers.TfStateUnlock))
+
 	// 触发器
 	apiToken := g.Group("")
 	apiToken.Use(w(middleware.AuthApiToken))
@@ -143,7 +149,10 @@ func Register(g *gin.RouterGroup) {
 	g.POST("/policies/:id/suppress", ac("suppress"), w(handlers.Policy{}.UpdatePolicySuppress))
 	g.GET("/policies/:id/suppress/sources", ac(), w(handlers.Policy{}.SearchPolicySuppressSource))
 	g.DELETE("/policies/:id/suppress/:suppressId", ac("suppress"), w(handlers.Policy{}.DeletePolicySuppress))
+	g.POST("/policies/:id/suppress/:suppressId/approve", ac("approvesuppress"), w(handlers.Policy{}.ApprovePolicySuppress))
+	g.GET("/policies/suppress/report", ac(), w(handlers.Policy{}.SearchPolicySuppressReport))
 	g.GET("/policies/:id/report", ac(), w(handlers.Policy{}.PolicyReport))
+	g.GET("/policies/scans/:id/export", ac(), w(handlers.Policy{}.ExportScanResult))
 	g.POST("/policies/parse", ac(), w(handlers.Policy{}.Parse))
 	g.POST("/policies/test", ac(), w(handlers.Policy{}.Test))
 
@@ -237,9 +246,13 @@ func Register(g *gin.RouterGroup) {
 	ctrl.Register(g.Group("vcs", ac()), &handlers.Vcs{})
 	g.GET("/vcs/registry", ac(), w(handlers.Vcs{}.GetRegistryVcs))
 	g.GET("/vcs/:id/repo", ac(), w(handlers.Vcs{}.ListRepos))
+	g.POST("/vcs/:id/repo", ac(), w(handlers.Vcs{}.AddRepo))
 	g.GET("/vcs/:id/branch", ac(), w(handlers.Vcs{}.ListBranches))
 	g.GET("/vcs/:id/tag", ac(), w(handlers.Vcs{}.ListTags))
 	g.GET("/vcs/:id/readme", ac(), w(handlers.Vcs{}.GetReadmeContent))
+	g.GET("/vcs/:id/users", ac(), w(handlers.Vcs{}.SearchVcsUser))
+	g.POST("/vcs/:id/users", ac(), w(handlers.Vcs{}.CreateVcsUser))
+	g.DELETE("/vcs/:id/users/:vcsUserId", ac(), w(handlers.Vcs{}.DeleteVcsUser))
 
 	g.GET("/registry/policy_groups", w(handlers.SearchRegistryPG))
 	g.GET("/registry/policy_groups/versions", w(handlers.SearchRegistryPGVersions))
@@ -304,6 +317,25 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/envs/:id/drift/last/resources", ac(), w(handlers.DriftLastResources))
 	g.GET("/envs/:id/drift/last", ac(), w(handlers.DriftLast))
 
+	// state 版本管理(state 中包含敏感信息，下载、恢复需要 state 权限)
+	g.GET("/envs/:id/states", ac(), w(handlers.SearchStateVersions))
+	g.GET("/envs/:id/states/diff", ac(), w(handlers.DiffStateVersions))
+	g.GET("/envs/:id/states/:versionId/download", ac("envs", "state"), w(handlers.DownloadStateVersion))
+	g.POST("/envs/:id/states/:versionId/restore", ac("envs", "state"), w(handlers.RestoreStateVersion))
+	g.POST("/envs/:id/state_operations", ac("envs", "state"), w(handlers.CreateStateOperation))
+
+	// 导入已存在的资源
+	g.POST("/envs/:id/import", ac("envs", "deploy"), w(handlers.ImportEnvResources))
+
+	// 环境克隆及推广(目标项目的权限在接口中校验)
+	g.POST("/envs/:id/clone", ac("envs", "clone"), w(handlers.CloneEnv))
+	g.POST("/envs/:id/promote", ac("envs", "promote"), w(handlers.PromoteEnv))
+
+	// 环境依赖(上游环境的输出作为环境的 terraform 变量)
+	g.GET("/envs/:id/dependencies", ac(), w(handlers.SearchEnvDependencies))
+	g.PUT("/envs/:id/dependencies", ac(), w(handlers.UpdateEnvDependencies))
+	g.GET("/envs/:id/dependency_graph", ac(), w(handlers.EnvDependencyGraph))
+
 	// 声明式
 	g.POST("/declare/env", ac(), w(handlers.DeclareEnv))
 
@@ -313,6 +345,7 @@ func Register(g *gin.RouterGroup) {
 	// 任务管理
 	g.GET("/tasks", ac(), w(handlers.Task{}.Search))
 	g.GET("/tasks/:id", ac(), w(handlers.Task{}.Detail))
+	g.GET("/tasks/:id/queue", ac(), w(handlers.Task{}.Queue))
 	g.GET("/tasks/:id/log", ac(), w(handlers.Task{}.Log))
 	g.GET("/tasks/:id/error_log", ac(), w(handlers.Task{}.ErrorStepLog))
 	g.GET("/tasks/:id/output", ac(), w(handlers.Task{}.Output))
@@ -326,6 +359,8 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/tasks/:id/steps/:stepId/log/sse", ac(), w(handlers.Task{}.FollowStepLogSse))
 	g.GET("/tasks/:id/steps/log/download", ac(), w(handlers.Task{}.DownloadStepLogs))
 	g.GET("/tasks/:id/resources/graph", ac(), w(handlers.Task{}.ResourceGraph))
+	g.GET("/tasks/:id/artifacts", ac(), w(handlers.Task{}.SearchArtifacts))
+	g.GET("/tasks/:id/artifacts/:artifactId/download", ac(), w(handlers.Task{}.DownloadArtifact))
 
 	//g.GET("/tokens/trigger", ac(), w(handlers.Token{}.VcsWebhookUrl))
 	g.GET("/vcs/webhook", ac(), w(handlers.Token{}.VcsWebhookUrl))
@@ -150,12 +150,22 @@ func doSendTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, withLog
 			msg.LogContent = logContent
 		}
 
+		if err := runner.MergeStackOutputs(task.EnvId, task.TaskId); err != nil {
+			logger.Errorf("merge stack outputs error: %v", err)
+		}
+
 		if stateJson, err := runner.FetchStateJson(task.EnvId, task.TaskId); err != nil {
 			logger.Errorf("fetch terraform state json error: %v", err)
 		} else {
 			msg.TfStateJson = stateJson
 		}
 
+		if state, err := runner.FetchJson(task.EnvId, task.TaskId, runner.TFStateFile); err != nil {
+			logger.Errorf("fetch terraform state error: %v", err)
+		} else {
+			msg.TfState = state
+		}
+
 		if providerJson, err := runner.FetchProviderJson(task.EnvId, task.TaskId); err != nil {
 			logger.Errorf("fetch terraform provider json error: %v", err)
 		} else {
@@ -168,6 +178,12 @@ func doSendTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, withLog
 			msg.TfPlanJson = planJson
 		}
 
+		if plan, err := runner.FetchJson(task.EnvId, task.TaskId, runner.TFPlanFile); err != nil {
+			logger.Errorf("fetch terraform plan file error: %v", err)
+		} else {
+			msg.TfPlan = plan
+		}
+
 		if parseJson, err := runner.FetchJson(task.EnvId, task.TaskId, runner.ScanInputFile); err != nil {
 			logger.Errorf("fetch terrascan parsed json error: %v", err)
 		} else {
@@ -178,6 +194,22 @@ func doSendTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, withLog
 		} else {
 			msg.TfResultJson = resultJson
 		}
+
+		if stackLogs, err := runner.FetchStackLogs(task.EnvId, task.TaskId, task.Step); err != nil {
+			logger.Errorf("fetch stack logs error: %v", err)
+		} else {
+			msg.StackLogs = stackLogs
+		}
+
+		if msg.Exited && len(task.Artifacts) > 0 {
+			if artifacts, err := runner.CollectStepArtifacts(
+				task.EnvId, task.TaskId, task.Workdir, task.Artifacts); err != nil {
+				logger.Errorf("collect step artifacts error: %v", err)
+				msg.LogContent = append(msg.LogContent, utils.TaskLogMsgBytes("Collect artifacts error: %v", err)...)
+			} else {
+				msg.Artifacts = artifacts
+			}
+		}
 	}
 
 	if err := wsConn.WriteJSON(msg); err != nil {
@@ -0,0 +1,153 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CollectStepArtifacts 收集步骤声明的 artifacts，返回 zip 格式的内容。
+// patterns 为相对 workdir 的路径，支持通配符，匹配到目录时会收集目录下的所有文件。
+// 收集到的文件同时会拷贝到任务的 artifacts 目录，后续步骤可以通过 CLOUDIAC_ARTIFACTS_DIR 访问
+func CollectStepArtifacts(envId string, taskId string, workdir string, patterns []string) ([]byte, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	workspace := GetTaskWorkspace(envId, taskId)
+	baseDir := filepath.Join(workspace, "code", workdir)
+	files := make(map[string]string) // 相对路径 => 文件绝对路径
+	for _, pattern := range patterns {
+		if err := checkArtifactPath(pattern); err != nil {
+			return nil, err
+		}
+		matches, err := filepath.Glob(filepath.Join(baseDir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid artifact path '%s': %v", pattern, err)
+		}
+		for _, m := range matches {
+			err := filepath.Walk(m, func(path string, info os.FileInfo, err error) error {
+				if err != nil || !info.Mode().IsRegular() {
+					return err
+				}
+				rel, err := filepath.Rel(baseDir, path)
+				if err != nil {
+					return err
+				}
+				files[filepath.ToSlash(rel)] = path
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bytes.Buffer{}
+	writer := zip.NewWriter(&buf)
+	var total int64
+	for _, name := range names {
+		content, err := os.ReadFile(files[name])
+		if err != nil {
+			return nil, err
+		}
+		if total += int64(len(content)); total > MaxArtifactsSize {
+			return nil, fmt.Errorf("artifacts size exceeds the limit of %d bytes", MaxArtifactsSize)
+		}
+		w, err := writer.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+
+		dst := filepath.Join(workspace, ArtifactsDir, name)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(dst, content, 0644); err != nil { //nolint:gosec
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExtractArtifacts 将 zip 格式的 artifacts 内容解压到 dir 目录，解压后的总大小超出限制时返回错误
+func ExtractArtifacts(content []byte, dir string) error {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if err := checkArtifactPath(f.Name); err != nil {
+			return err
+		}
+		n, err := extractArtifactFile(f, filepath.Join(dir, f.Name), MaxArtifactsSize-total)
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+	return nil
+}
+
+// extractArtifactFile 解压文件并返回文件大小，文件大小超过 limit 时返回错误
+func extractArtifactFile(f *zip.File, path string, limit int64) (int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644) //nolint:gosec
+	if err != nil {
+		return 0, err
+	}
+	defer fp.Close()
+
+	// 多读取一个字节用于判断是否超出限制
+	n, err := io.CopyN(fp, rc, limit+1)
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	if n > limit {
+		return n, fmt.Errorf("artifacts size exceeds the limit of %d bytes", MaxArtifactsSize)
+	}
+	return n, nil
+}
+
+// artifact 路径必须为相对路径，且不能访问上层目录
+func checkArtifactPath(p string) error {
+	clean := filepath.ToSlash(filepath.Clean(p))
+	if filepath.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid artifact path '%s'", p)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package runner
+
+import (
+	"archive/zip"
+	"bytes"
+	"cloudiac/configs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectStepArtifacts(t *testing.T) {
+	storage := t.TempDir()
+	configs.Set(&configs.Config{Runner: configs.RunnerConfig{StoragePath: storage}})
+
+	codeDir := filepath.Join(GetTaskWorkspace("env-1", "run-1"), "code", "sub")
+	for name, content := range map[string]string{
+		"report.json":    "{}",
+		"out/a.txt":      "a",
+		"out/b/c.txt":    "c",
+		"other/skip.txt": "skip",
+	} {
+		p := filepath.Join(codeDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+
+	content, err := CollectStepArtifacts("env-1", "run-1", "sub", []string{"*.json", "out"})
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	assert.NoError(t, ExtractArtifacts(content, dir))
+	for name, expect := range map[string]string{"report.json": "{}", "out/a.txt": "a", "out/b/c.txt": "c"} {
+		bs, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, expect, string(bs))
+	}
+	_, err = os.Stat(filepath.Join(dir, "other/skip.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// 收集的文件会同时拷贝到 workspace 的 artifacts 目录
+	bs, err := os.ReadFile(filepath.Join(GetTaskWorkspace("env-1", "run-1"), ArtifactsDir, "out/a.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(bs))
+
+	_, err = CollectStepArtifacts("env-1", "run-1", "sub", []string{"../../secret"})
+	assert.Error(t, err)
+}
+
+func TestExtractArtifactsSizeLimit(t *testing.T) {
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("big.bin")
+	assert.NoError(t, err)
+	_, err = w.Write(make([]byte, MaxArtifactsSize+1))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	assert.Error(t, ExtractArtifacts(buf.Bytes(), t.TempDir()))
+}
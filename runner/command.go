@@ -3,20 +3,12 @@
 package runner
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/pkg/errors"
 
 	"cloudiac/common"
@@ -33,6 +25,7 @@ type Executor struct {
 	PrivateKey string
 
 	TerraformVersion string
+	IacEngine        string // 执行任务使用的 IaC 引擎
 	Commands         []string
 	HostWorkdir      string // 宿主机目录
 	Workdir          string // 容器目录
@@ -49,55 +42,60 @@ type Container struct {
 	RunID   string
 }
 
-func (exec *Executor) tryPullImage(cli *client.Client) {
-	logger := logger.WithField("image", exec.Image).WithField("action", "TryPullImage")
-	if cli == nil {
-		var err error
-		cli, err = dockerClient()
-		if err != nil {
-			logger.Warn(err)
-			return
-		}
-	}
+// executorBackend 任务容器的运行后端，Executor 的方法都会转发给当前配置的后端执行。
+// 执行信息统一使用 docker 的 ContainerExecInspect 结构，该结构会被保存到步骤目录的 container.json 中，
+// 其他后端需要自行填充 ExecID、ContainerID、Running、ExitCode 和 Pid 字段。
+type executorBackend interface {
+	Start(exec *Executor) (cid string, err error)
+	RunCommand(cid string, command []string) (execId string, err error)
+	RunCommandOutput(cid string, command []string) (output []byte, err error)
+	GetExecInfo(execId string) (execInfo types.ContainerExecInspect, err error)
+	Wait(ctx context.Context, cid string) error
+	WaitCommand(ctx context.Context, containerId string, execId string) (execInfo types.ContainerExecInspect, err error)
+	StopCommand(execId string) error
+	IsPaused(cid string) (bool, error)
+	Pause(cid string) error
+	Unpause(cid string) error
+	KillContainers(ctx context.Context, cids ...string) error
+}
 
-	reader, err := cli.ImagePull(context.Background(), exec.Image, types.ImagePullOptions{})
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			logger.Debugf("pull image: %v", err)
-		} else {
-			logger.Warnf("pull image: %v", err)
-		}
-		return
-	}
-	defer reader.Close()
+var (
+	defaultBackend         executorBackend
+	defaultBackendInitOnce sync.Once
+)
 
-	bs, _ := ioutil.ReadAll(reader)
-	logger.Tracef("pull image: %s", bs)
+// containerBackend 根据 runner.backend 配置返回任务容器的运行后端
+func containerBackend() executorBackend {
+	defaultBackendInitOnce.Do(func() {
+		switch configs.Get().Runner.GetBackend() {
+		case common.RunnerBackendKubernetes:
+			b, err := newK8sBackend(configs.Get().Runner.Kubernetes)
+			if err != nil {
+				panic(fmt.Errorf("init kubernetes backend error: %v", err))
+			}
+			defaultBackend = b
+		default:
+			defaultBackend = dockerBackend{}
+		}
+	})
+	return defaultBackend
 }
 
-func (exec *Executor) Start() (string, error) {
-	logger := logger.WithField("taskId", filepath.Base(exec.HostWorkdir))
-	cli, err := dockerClient()
-	if err != nil {
-		logger.Error(err)
-		return "", err
-	}
-	logger.Infof("pull image: %s", exec.Image)
-	// TODO: 补充 pull 失败的错误处理
-	exec.tryPullImage(cli)
+// hostMount 需要挂载到任务容器中的宿主机目录
+type hostMount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
 
+// hostMounts 返回任务容器需要挂载的宿主机目录，docker 和 kubernetes 后端共用
+func (exec *Executor) hostMounts() []hostMount {
 	conf := configs.Get()
-	mountConfigs := []mount.Mount{
+	mounts := []hostMount{
 		{
-			Type:   mount.TypeBind,
 			Source: exec.HostWorkdir,
 			Target: ContainerWorkspace,
 		},
-		{
-			Type:   mount.TypeBind,
-			Source: "/var/run/docker.sock",
-			Target: "/var/run/docker.sock",
-		},
 	}
 	providerCacheMod := conf.Runner.ProviderCacheMod
 	if providerCacheMod != common.ProviderCacheModNoCache {
@@ -105,15 +103,13 @@ func (exec *Executor) Start() (string, error) {
 		if providerCacheMod == common.ProviderCacheModOnlyEnv {
 			pluginCachePathMountSource = exec.PluginCache
 		}
-		mountConfigs = append(mountConfigs, mount.Mount{
-			Type:   mount.TypeBind,
+		mounts = append(mounts, hostMount{
 			Source: pluginCachePathMountSource,
 			Target: ContainerPluginCachePath,
 		})
 	}
 	if conf.Consul.ConsulTls {
-		mountConfigs = append(mountConfigs, mount.Mount{
-			Type:   mount.TypeBind,
+		mounts = append(mounts, hostMount{
 			Source: conf.Consul.ConsulCertPath,
 			Target: ContainerCertificateDir,
 		})
@@ -123,15 +119,13 @@ func (exec *Executor) Start() (string, error) {
 	// 在 runner 容器化部署时运行 runner 的宿主机(docker host)并没有 assets 目录，
 	// 如果配置了 assets 路径，进行 bind mount 时会因为源目录不存在而报错。
 	if conf.Runner.AssetsPath != "" {
-		mountConfigs = append(mountConfigs, mount.Mount{
-			Type:     mount.TypeBind,
+		mounts = append(mounts, hostMount{
 			Source:   conf.Runner.AbsAssetsPath(),
 			Target:   ContainerAssetsDir,
 			ReadOnly: true,
 		})
-		mountConfigs = append(mountConfigs, mount.Mount{
+		mounts = append(mounts, hostMount{
 			// providers 需要挂载到指定目录才能被 terraform 查找到，所以单独做一次挂载
-			Type:     mount.TypeBind,
 			Source:   conf.Runner.ProviderPath(),
 			Target:   ContainerPluginPath,
 			ReadOnly: true,
@@ -142,168 +136,43 @@ func (exec *Executor) Start() (string, error) {
 	// 注意，该方案有个问题：客户无法自定义镜像预先安装需要的 terraform 版本，
 	// 因为判断版本不在 TerraformVersions 列表中就会挂载目录，客户自定义镜像安装的版本会被覆盖
 	//（考虑把版本列表写到配置文件？）
-	if !utils.StrInArray(exec.TerraformVersion, configs.Get().GetTerraformVersions()...) {
-		mountConfigs = append(mountConfigs, mount.Mount{
-			Type:   mount.TypeBind,
-			Source: conf.Runner.AbsTfenvVersionsCachePath(),
-			Target: "/root/.tfenv/versions",
+	// opentofu 同理，使用 tofuenv 的版本目录
+	if !utils.StrInArray(exec.TerraformVersion, conf.GetIacEngineVersions(exec.IacEngine)...) {
+		engine := GetIacEngine(exec.IacEngine)
+		mounts = append(mounts, hostMount{
+			Source: engine.VersionsCachePath(),
+			Target: engine.VersionsDir,
 		})
 	}
+	return mounts
+}
 
-	c, err := cli.ContainerCreate(
-		context.Background(),
-		&container.Config{
-			Image:        exec.Image,
-			WorkingDir:   exec.Workdir,
-			Cmd:          exec.Commands,
-			Env:          exec.Env,
-			OpenStdin:    true,
-			Tty:          true,
-			AttachStdin:  false,
-			AttachStdout: true,
-			AttachStderr: true,
-		},
-		&container.HostConfig{
-			AutoRemove: exec.AutoRemove,
-			Mounts:     mountConfigs,
-			Privileged: conf.Runner.Privileged,
-		},
-		nil,
-		nil,
-		exec.Name)
-	if err != nil {
-		logger.Errorf("create container err: %v", err)
-		return "", err
-	}
-
-	cid := utils.ShortContainerId(c.ID)
-	logger.Infof("container id: %s", cid)
-	err = cli.ContainerStart(context.Background(), c.ID, types.ContainerStartOptions{})
-	return cid, err
+func (exec *Executor) Start() (string, error) {
+	return containerBackend().Start(exec)
 }
 
 func (Executor) RunCommand(cid string, command []string) (execId string, err error) {
-	cli, err := dockerClient()
-	if err != nil {
-		return "", err
-	}
-
-	resp, err := cli.ContainerExecCreate(context.Background(), cid, types.ExecConfig{
-		Detach: false,
-		Cmd:    command,
-	})
-	if err != nil {
-		err = errors.Wrap(err, "container exec create")
-		return "", err
-	}
-
-	err = cli.ContainerExecStart(context.Background(), resp.ID, types.ExecStartCheck{})
-	if err != nil {
-		err = errors.Wrap(err, "container exec start")
-		return "", err
-	}
-
-	return resp.ID, nil
+	return containerBackend().RunCommand(cid, command)
 }
 
 // 执行命令并获取输出
 func (Executor) RunCommandOutput(cid string, command []string) (output []byte, err error) {
-	cli, err := dockerClient()
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := cli.ContainerExecCreate(context.Background(), cid, types.ExecConfig{
-		AttachStdin:  false,
-		AttachStderr: true,
-		AttachStdout: true,
-		Detach:       false,
-		Cmd:          command,
-	})
-	if err != nil {
-		err = errors.Wrap(err, "container exec create")
-		return nil, err
-	}
-
-	hijackedResp, err := cli.ContainerExecAttach(context.Background(), resp.ID, types.ExecStartCheck{})
-	if err != nil {
-		err = errors.Wrap(err, "container exec start")
-		return nil, err
-	}
-	defer hijackedResp.Close()
-
-	buffer := bytes.NewBuffer(nil)
-	_, err = stdcopy.StdCopy(buffer, buffer, hijackedResp.Reader)
-	if err != nil && !errors.Is(err, io.EOF) {
-		return buffer.Bytes(), err
-	}
-	return buffer.Bytes(), nil
+	return containerBackend().RunCommandOutput(cid, command)
 }
 
 func (Executor) GetExecInfo(execId string) (execInfo types.ContainerExecInspect, err error) {
-	cli, err := dockerClient()
-	if err != nil {
-		return execInfo, err
-	}
-	execInfo, err = cli.ContainerExecInspect(context.Background(), execId)
-	if err != nil {
-		return execInfo, errors.Wrap(err, "container exec attach")
-	}
-	return execInfo, nil
+	return containerBackend().GetExecInfo(execId)
 }
 
 func (Executor) Wait(ctx context.Context, cid string) error {
-	cli, err := dockerClient()
-	if err != nil {
-		return err
-	}
-
-	okCh, errCh := cli.ContainerWait(ctx, cid, container.WaitConditionNotRunning)
-	select {
-	case <-okCh:
-		return nil
-	case err = <-errCh:
-		return err
-	}
+	return containerBackend().Wait(ctx, cid)
 }
 
 var ErrContainerNotRun = fmt.Errorf("container not running")
 var ErrTaskAborted = fmt.Errorf("task aborted")
 
 func (Executor) WaitCommand(ctx context.Context, containerId string, execId string) (execInfo types.ContainerExecInspect, err error) {
-	cli, err := dockerClient()
-	if err != nil {
-		return execInfo, err
-	}
-
-	ticker := time.NewTicker(time.Second * 1)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return execInfo, ctx.Err()
-		case <-ticker.C:
-		default:
-		}
-
-		if ci, err := cli.ContainerInspect(ctx, containerId); err != nil {
-			return execInfo, errors.Wrap(err, "container inspect")
-		} else if ci.State.Paused || !ci.State.Running {
-			return execInfo, errors.Wrapf(ErrContainerNotRun, "container status is %s", ci.State.Status)
-		}
-
-		inspect, err := cli.ContainerExecInspect(ctx, execId)
-		if err != nil {
-			if errors.Is(err, context.DeadlineExceeded) {
-				return execInfo, err
-			}
-			return execInfo, errors.Wrap(err, "container exec inspect")
-		}
-		if !inspect.Running {
-			return execInfo, nil
-		}
-	}
+	return containerBackend().WaitCommand(ctx, containerId, execId)
 }
 
 // 等待进程结束，如果提前触发了 deadline 则 kill 进程
@@ -327,71 +196,19 @@ func (exec Executor) WaitCommandWithDeadline(ctx context.Context, containerId st
 }
 
 func (e Executor) StopCommand(execId string) (err error) {
-	cli, err := dockerClient()
-	if err != nil {
-		return err
-	}
-
-	inspect, err := cli.ContainerExecInspect(context.Background(), execId)
-	if err != nil {
-		return errors.Wrap(err, "container exec attach")
-	}
-
-	// 先执行 kill，等待 30s，然后 kill -9
-	if _, err := e.RunCommand(inspect.ContainerID, []string{
-		"sh", "-c",
-		fmt.Sprintf(
-			"for i in `seq 1 30`;do kill %d && sleep 1 || break; done; kill -9 %d",
-			inspect.Pid, inspect.Pid),
-	}); err != nil {
-		return errors.Wrap(err, "kill process")
-	}
-	return nil
+	return containerBackend().StopCommand(execId)
 }
 
 func (Executor) IsPaused(cid string) (bool, error) {
-	cli, err := dockerClient()
-	if err != nil {
-		return false, err
-	}
-
-	inspect, err := cli.ContainerInspect(context.Background(), cid)
-	if err != nil {
-		return false, errors.Wrapf(err, "%s, container inspect", cid)
-	}
-
-	return inspect.State.Paused, nil
+	return containerBackend().IsPaused(cid)
 }
 
 func (Executor) Pause(cid string) (err error) {
-	cli, err := dockerClient()
-	if err != nil {
-		return err
-	}
-
-	if err := cli.ContainerPause(context.Background(), cid); err != nil {
-		if strings.Contains(err.Error(), "is not running") ||
-			strings.Contains(err.Error(), "is already paused") {
-			return nil
-		}
-		err = errors.Wrapf(err, "pause container %s", cid)
-		return err
-	}
-
-	return nil
+	return containerBackend().Pause(cid)
 }
 
 func (Executor) Unpause(cid string) (err error) {
-	cli, err := dockerClient()
-	if err != nil {
-		return err
-	}
-
-	if err := cli.ContainerUnpause(context.Background(), cid); err != nil {
-		err = errors.Wrapf(err, "unpause container %s", cid)
-		return err
-	}
-	return nil
+	return containerBackend().Unpause(cid)
 }
 
 func (Executor) UnpauseIf(cid string) (err error) {
@@ -406,3 +223,13 @@ func (Executor) UnpauseIf(cid string) (err error) {
 	}
 	return nil
 }
+
+// killProcessScript 先执行 kill，等待 30s，然后 kill -9
+func killProcessScript(pid int) []string {
+	return []string{
+		"sh", "-c",
+		fmt.Sprintf(
+			"for i in `seq 1 30`;do kill %d && sleep 1 || break; done; kill -9 %d",
+			pid, pid),
+	}
+}
@@ -31,6 +31,8 @@ type StepInfo struct {
 	Timeout   int        `json:"timeout"`
 
 	PauseOnFinish bool `json:"pauseOnFinish"` // 该步骤结束时暂停容器
+
+	Artifacts []string `json:"artifacts"` // 步骤结束后需要收集的文件
 }
 
 type StartedTask struct {
@@ -28,6 +28,7 @@ const (
 	ContainerAssetsDir       = "/cloudiac/assets"                  // 挂载依赖资源，如 terraform.py 等(己打包到 worker 镜像)
 	ContainerPluginPath      = "/cloudiac/terraform/plugins"       // 预置 providers 目录(己打包到镜像)
 	ContainerPluginCachePath = "/cloudiac/terraform/plugins-cache" // terraform plugins 缓存目录
+	ContainerArtifactsDir    = "/cloudiac/workspace/artifacts"     // 步骤 artifacts 目录，必须为 ContainerWorkspace/ArtifactsDir
 )
 
 const (
@@ -48,7 +49,10 @@ const (
 	CloudIacAnsibleRequirements = "requirements.yml"
 
 	TFStateJsonFile  = "tfstate.json"
+	TFStateFile      = "tfstate.tfstate" // terraform state pull 输出的原始 state
+	TFRestoreFile    = "restore.tfstate" // state 恢复任务要推送的 state
 	TFPlanJsonFile   = "tfplan.json"
+	TFPlanFile       = "tfplan.bin" // plan 步骤生成的 plan 文件的拷贝
 	TFProviderSchema = "tfproviderschema.json"
 
 	AnsibleStateAnalysisName = "terraform.py"
@@ -62,5 +66,10 @@ const (
 	ScanLogFile      = "scan.log"
 	RegoResultFile   = "scan_raw.json"
 
+	ScanPlanInputFile = "tfplan_input.json" // 由 plan json 生成的 plan 策略输入
+
 	PopulateSourceLineCount = 3
+
+	ArtifactsDir     = "artifacts" // 任务 workspace 下保存步骤 artifacts 的目录
+	MaxArtifactsSize = 50 << 20    // 单个步骤的 artifacts 总大小限制
 )
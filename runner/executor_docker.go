@@ -0,0 +1,322 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/pkg/errors"
+
+	"cloudiac/configs"
+	"cloudiac/utils"
+)
+
+// dockerBackend 通过 docker api 启动任务容器，并使用 docker exec 执行步骤命令
+type dockerBackend struct{}
+
+func (dockerBackend) tryPullImage(cli *client.Client, image string) {
+	logger := logger.WithField("image", image).WithField("action", "TryPullImage")
+	if cli == nil {
+		var err error
+		cli, err = dockerClient()
+		if err != nil {
+			logger.Warn(err)
+			return
+		}
+	}
+
+	reader, err := cli.ImagePull(context.Background(), image, types.ImagePullOptions{})
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			logger.Debugf("pull image: %v", err)
+		} else {
+			logger.Warnf("pull image: %v", err)
+		}
+		return
+	}
+	defer reader.Close()
+
+	bs, _ := ioutil.ReadAll(reader)
+	logger.Tracef("pull image: %s", bs)
+}
+
+func (b dockerBackend) Start(exec *Executor) (string, error) {
+	logger := logger.WithField("taskId", filepath.Base(exec.HostWorkdir))
+	cli, err := dockerClient()
+	if err != nil {
+		logger.Error(err)
+		return "", err
+	}
+	logger.Infof("pull image: %s", exec.Image)
+	// TODO: 补充 pull 失败的错误处理
+	b.tryPullImage(cli, exec.Image)
+
+	conf := configs.Get()
+	mountConfigs := []mount.Mount{
+		{
+			Type:   mount.TypeBind,
+			Source: "/var/run/docker.sock",
+			Target: "/var/run/docker.sock",
+		},
+	}
+	for _, m := range exec.hostMounts() {
+		mountConfigs = append(mountConfigs, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+
+	c, err := cli.ContainerCreate(
+		context.Background(),
+		&container.Config{
+			Image:        exec.Image,
+			WorkingDir:   exec.Workdir,
+			Cmd:          exec.Commands,
+			Env:          exec.Env,
+			OpenStdin:    true,
+			Tty:          true,
+			AttachStdin:  false,
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+		&container.HostConfig{
+			AutoRemove: exec.AutoRemove,
+			Mounts:     mountConfigs,
+			Privileged: conf.Runner.Privileged,
+		},
+		nil,
+		nil,
+		exec.Name)
+	if err != nil {
+		logger.Errorf("create container err: %v", err)
+		return "", err
+	}
+
+	cid := utils.ShortContainerId(c.ID)
+	logger.Infof("container id: %s", cid)
+	err = cli.ContainerStart(context.Background(), c.ID, types.ContainerStartOptions{})
+	return cid, err
+}
+
+func (dockerBackend) RunCommand(cid string, command []string) (execId string, err error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := cli.ContainerExecCreate(context.Background(), cid, types.ExecConfig{
+		Detach: false,
+		Cmd:    command,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "container exec create")
+		return "", err
+	}
+
+	err = cli.ContainerExecStart(context.Background(), resp.ID, types.ExecStartCheck{})
+	if err != nil {
+		err = errors.Wrap(err, "container exec start")
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+func (dockerBackend) RunCommandOutput(cid string, command []string) (output []byte, err error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cli.ContainerExecCreate(context.Background(), cid, types.ExecConfig{
+		AttachStdin:  false,
+		AttachStderr: true,
+		AttachStdout: true,
+		Detach:       false,
+		Cmd:          command,
+	})
+	if err != nil {
+		err = errors.Wrap(err, "container exec create")
+		return nil, err
+	}
+
+	hijackedResp, err := cli.ContainerExecAttach(context.Background(), resp.ID, types.ExecStartCheck{})
+	if err != nil {
+		err = errors.Wrap(err, "container exec start")
+		return nil, err
+	}
+	defer hijackedResp.Close()
+
+	buffer := bytes.NewBuffer(nil)
+	_, err = stdcopy.StdCopy(buffer, buffer, hijackedResp.Reader)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return buffer.Bytes(), err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (dockerBackend) GetExecInfo(execId string) (execInfo types.ContainerExecInspect, err error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return execInfo, err
+	}
+	execInfo, err = cli.ContainerExecInspect(context.Background(), execId)
+	if err != nil {
+		return execInfo, errors.Wrap(err, "container exec attach")
+	}
+	return execInfo, nil
+}
+
+func (dockerBackend) Wait(ctx context.Context, cid string) error {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+
+	okCh, errCh := cli.ContainerWait(ctx, cid, container.WaitConditionNotRunning)
+	select {
+	case <-okCh:
+		return nil
+	case err = <-errCh:
+		return err
+	}
+}
+
+func (dockerBackend) WaitCommand(ctx context.Context, containerId string, execId string) (execInfo types.ContainerExecInspect, err error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return execInfo, err
+	}
+
+	ticker := time.NewTicker(time.Second * 1)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return execInfo, ctx.Err()
+		case <-ticker.C:
+		default:
+		}
+
+		if ci, err := cli.ContainerInspect(ctx, containerId); err != nil {
+			return execInfo, errors.Wrap(err, "container inspect")
+		} else if ci.State.Paused || !ci.State.Running {
+			return execInfo, errors.Wrapf(ErrContainerNotRun, "container status is %s", ci.State.Status)
+		}
+
+		inspect, err := cli.ContainerExecInspect(ctx, execId)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return execInfo, err
+			}
+			return execInfo, errors.Wrap(err, "container exec inspect")
+		}
+		if !inspect.Running {
+			return execInfo, nil
+		}
+	}
+}
+
+func (b dockerBackend) StopCommand(execId string) (err error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+
+	inspect, err := cli.ContainerExecInspect(context.Background(), execId)
+	if err != nil {
+		return errors.Wrap(err, "container exec attach")
+	}
+
+	if _, err := b.RunCommand(inspect.ContainerID, killProcessScript(inspect.Pid)); err != nil {
+		return errors.Wrap(err, "kill process")
+	}
+	return nil
+}
+
+func (dockerBackend) IsPaused(cid string) (bool, error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return false, err
+	}
+
+	inspect, err := cli.ContainerInspect(context.Background(), cid)
+	if err != nil {
+		return false, errors.Wrapf(err, "%s, container inspect", cid)
+	}
+
+	return inspect.State.Paused, nil
+}
+
+func (dockerBackend) Pause(cid string) (err error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+
+	if err := cli.ContainerPause(context.Background(), cid); err != nil {
+		if strings.Contains(err.Error(), "is not running") ||
+			strings.Contains(err.Error(), "is already paused") {
+			return nil
+		}
+		err = errors.Wrapf(err, "pause container %s", cid)
+		return err
+	}
+
+	return nil
+}
+
+func (dockerBackend) Unpause(cid string) (err error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+
+	if err := cli.ContainerUnpause(context.Background(), cid); err != nil {
+		err = errors.Wrapf(err, "unpause container %s", cid)
+		return err
+	}
+	return nil
+}
+
+func (dockerBackend) KillContainers(ctx context.Context, cids ...string) error {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+
+	// 这里仅 kill container，container 的删除通过启动时的 AutoRemove 参数配置
+	for _, cid := range cids {
+		// default signal "SIGKILL"
+		if err := cli.ContainerKill(ctx, cid, ""); err != nil {
+			var targetErr errdefs.ErrNotFound
+			if errors.As(err, &targetErr) {
+				continue
+			}
+
+			// 有可能己经提交了删除请求，这里忽略掉这些报错
+			if !strings.Contains(err.Error(), "already in progress") &&
+				!strings.Contains(err.Error(), "No such container") {
+				logger.Info("kill container error: %v", err)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
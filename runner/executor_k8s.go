@@ -0,0 +1,501 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"cloudiac/configs"
+	"cloudiac/utils"
+)
+
+const (
+	k8sDefaultNamespace       = "default"
+	k8sDefaultPodStartTimeout = 300
+	k8sWorkerContainer        = "worker"
+
+	// 步骤命令在 pod 中后台执行，进程 pid 和退出码写入该目录，用于实现与 docker exec inspect 相同的语义
+	k8sExecStateDir = "/tmp/.cloudiac-exec"
+
+	k8sLabelApp             = "app"
+	k8sLabelTaskId          = "cloudiac.io/task-id"
+	k8sAnnotationPaused     = "cloudiac.io/paused"
+	k8sAnnotationAutoRemove = "cloudiac.io/auto-remove"
+)
+
+// pod 的主进程，收到 SIGTERM 后正常退出，保留容器时通过该方式停止 pod
+var k8sKeepaliveCommand = []string{"/bin/sh", "-c", "trap 'exit 0' TERM; while true; do sleep 1; done"}
+
+// k8sBackend 每个任务启动一个 pod，步骤命令通过 pod exec 在 pod 中后台执行。
+// kubernetes 没有原生的容器暂停功能，暂停通过向 pod 内所有进程发送 SIGSTOP 实现，并在 pod 的 annotation 中记录暂停状态。
+type k8sBackend struct {
+	client       kubernetes.Interface
+	execer       podExecer
+	conf         configs.KubernetesConfig
+	pollInterval time.Duration
+}
+
+func newK8sBackend(conf configs.KubernetesConfig) (*k8sBackend, error) {
+	restConf, cli, err := initKubernetesClient(conf.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return &k8sBackend{
+		client:       cli,
+		execer:       spdyPodExecer{config: restConf, client: cli},
+		conf:         conf,
+		pollInterval: time.Second,
+	}, nil
+}
+
+func (b *k8sBackend) namespace() string {
+	if b.conf.Namespace == "" {
+		return k8sDefaultNamespace
+	}
+	return b.conf.Namespace
+}
+
+func (b *k8sBackend) pods() podsClient {
+	return b.client.CoreV1().Pods(b.namespace())
+}
+
+type podsClient interface {
+	Create(ctx context.Context, pod *corev1.Pod, opts metav1.CreateOptions) (*corev1.Pod, error)
+	Update(ctx context.Context, pod *corev1.Pod, opts metav1.UpdateOptions) (*corev1.Pod, error)
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Pod, error)
+}
+
+// k8sPodName 将任务 id 转为合法的 pod 名称
+func k8sPodName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.Trim(name, "-")
+}
+
+// buildVolumes 将宿主机目录挂载转为 pod 的 volume。
+// 配置了 workspace_pvc 时，位于 storage_path 下的目录通过 pvc 的 subPath 挂载，其他目录仍使用 hostPath
+func (b *k8sBackend) buildVolumes(exec *Executor) ([]corev1.Volume, []corev1.VolumeMount) {
+	var (
+		volumes     = make([]corev1.Volume, 0)
+		mounts      = make([]corev1.VolumeMount, 0)
+		storagePath = configs.Get().Runner.AbsStoragePath()
+		pvcVolume   = "workspace"
+		pvcAdded    = false
+	)
+
+	for i, m := range exec.hostMounts() {
+		if b.conf.WorkspacePVC != "" {
+			if rel, err := filepath.Rel(storagePath, m.Source); err == nil && !strings.HasPrefix(rel, "..") {
+				if !pvcAdded {
+					volumes = append(volumes, corev1.Volume{
+						Name: pvcVolume,
+						VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+								ClaimName: b.conf.WorkspacePVC,
+							},
+						},
+					})
+					pvcAdded = true
+				}
+				mounts = append(mounts, corev1.VolumeMount{
+					Name:      pvcVolume,
+					MountPath: m.Target,
+					SubPath:   rel,
+					ReadOnly:  m.ReadOnly,
+				})
+				continue
+			}
+		}
+
+		name := fmt.Sprintf("mount-%d", i)
+		hostPathType := corev1.HostPathDirectoryOrCreate
+		volumes = append(volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: m.Source,
+					Type: &hostPathType,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: m.Target,
+			ReadOnly:  m.ReadOnly,
+		})
+	}
+	return volumes, mounts
+}
+
+func (b *k8sBackend) buildPod(exec *Executor) *corev1.Pod {
+	env := make([]corev1.EnvVar, 0, len(exec.Env))
+	for _, e := range exec.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		env = append(env, corev1.EnvVar{Name: kv[0], Value: kv[1]})
+	}
+
+	pullPolicy := corev1.PullIfNotPresent
+	if b.conf.ImagePullPolicy != "" {
+		pullPolicy = corev1.PullPolicy(b.conf.ImagePullPolicy)
+	}
+	pullSecrets := make([]corev1.LocalObjectReference, 0)
+	for _, s := range strings.Split(b.conf.ImagePullSecrets, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			pullSecrets = append(pullSecrets, corev1.LocalObjectReference{Name: s})
+		}
+	}
+
+	volumes, mounts := b.buildVolumes(exec)
+	privileged := configs.Get().Runner.Privileged
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k8sPodName(exec.Name),
+			Namespace: b.namespace(),
+			Labels: map[string]string{
+				k8sLabelApp:    "cloudiac-worker",
+				k8sLabelTaskId: exec.Name,
+			},
+			Annotations: map[string]string{
+				k8sAnnotationAutoRemove: strconv.FormatBool(exec.AutoRemove),
+			},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:      corev1.RestartPolicyNever,
+			ServiceAccountName: b.conf.ServiceAccount,
+			ImagePullSecrets:   pullSecrets,
+			Volumes:            volumes,
+			Containers: []corev1.Container{
+				{
+					Name:            k8sWorkerContainer,
+					Image:           exec.Image,
+					ImagePullPolicy: pullPolicy,
+					// exec.Commands 依赖 tty 保持 /bin/bash 运行，pod 中使用自定义的保活命令
+					Command:      k8sKeepaliveCommand,
+					WorkingDir:   exec.Workdir,
+					Env:          env,
+					VolumeMounts: mounts,
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: &privileged,
+					},
+				},
+			},
+		},
+	}
+	// 使用 hostPath 挂载任务目录时 pod 必须与 runner 运行在同一节点
+	if b.conf.WorkspacePVC == "" {
+		pod.Spec.NodeName = b.conf.GetNodeName()
+	}
+	return pod
+}
+
+func (b *k8sBackend) Start(exec *Executor) (string, error) {
+	logger := logger.WithField("taskId", filepath.Base(exec.HostWorkdir))
+
+	pod, err := b.pods().Create(context.Background(), b.buildPod(exec), metav1.CreateOptions{})
+	if err != nil {
+		logger.Errorf("create pod err: %v", err)
+		return "", errors.Wrap(err, "create pod")
+	}
+	logger.Infof("pod name: %s", pod.Name)
+
+	timeout := b.conf.PodStartTimeout
+	if timeout <= 0 {
+		timeout = k8sDefaultPodStartTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	return pod.Name, b.waitPodRunning(ctx, pod.Name)
+}
+
+func (b *k8sBackend) waitPodRunning(ctx context.Context, name string) error {
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		pod, err := b.pods().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return errors.Wrapf(err, "get pod %s", name)
+		}
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
+			return nil
+		case corev1.PodSucceeded, corev1.PodFailed:
+			return errors.Wrapf(ErrContainerNotRun, "pod status is %s", pod.Status.Phase)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "wait pod %s running", name)
+		case <-ticker.C:
+		}
+	}
+}
+
+func k8sExecStateFiles(id string) (pidFile string, exitFile string) {
+	return filepath.Join(k8sExecStateDir, id+".pid"), filepath.Join(k8sExecStateDir, id+".exit")
+}
+
+// execId 格式为 "<pod>/<id>"，pod 名称中不会出现 "/"
+func parseK8sExecId(execId string) (pod string, id string, err error) {
+	parts := strings.SplitN(execId, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid exec id '%s'", execId)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (b *k8sBackend) RunCommand(cid string, command []string) (execId string, err error) {
+	id := utils.GenGuid("exec")
+	pidFile, exitFile := k8sExecStateFiles(id)
+
+	// 命令在后台执行，pod exec 请求会立即返回。
+	// 进程 pid 写入 pidFile 用于中止命令，命令结束后退出码写入 exitFile
+	inner := fmt.Sprintf("echo $$ >%s; exec %s", pidFile, shellescape.QuoteCommand(command))
+	wrapper := fmt.Sprintf("sh -c %s; echo $? >%s.tmp && mv %s.tmp %s",
+		shellescape.Quote(inner), exitFile, exitFile, exitFile)
+	script := fmt.Sprintf("mkdir -p %s && nohup sh -c %s >/dev/null 2>&1 &",
+		k8sExecStateDir, shellescape.Quote(wrapper))
+
+	if err := b.execer.Exec(b.namespace(), cid, k8sWorkerContainer,
+		[]string{"sh", "-c", script}, ioutil.Discard, ioutil.Discard); err != nil {
+		return "", errors.Wrap(err, "pod exec")
+	}
+	return fmt.Sprintf("%s/%s", cid, id), nil
+}
+
+func (b *k8sBackend) RunCommandOutput(cid string, command []string) (output []byte, err error) {
+	buffer := bytes.NewBuffer(nil)
+	err = b.execer.Exec(b.namespace(), cid, k8sWorkerContainer, command, buffer, buffer)
+	if err != nil {
+		// 与 docker 后端保持一致，命令退出码非 0 不做为错误返回
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) {
+			return buffer.Bytes(), nil
+		}
+		return buffer.Bytes(), errors.Wrap(err, "pod exec")
+	}
+	return buffer.Bytes(), nil
+}
+
+func (b *k8sBackend) GetExecInfo(execId string) (execInfo types.ContainerExecInspect, err error) {
+	pod, id, err := parseK8sExecId(execId)
+	if err != nil {
+		return execInfo, err
+	}
+
+	pidFile, exitFile := k8sExecStateFiles(id)
+	output, err := b.RunCommandOutput(pod, []string{"sh", "-c",
+		fmt.Sprintf(`printf '%%s,%%s' "$(cat %s 2>/dev/null)" "$(cat %s 2>/dev/null)"`, pidFile, exitFile)})
+	if err != nil {
+		return execInfo, errors.Wrap(err, "read exec state")
+	}
+
+	execInfo.ExecID = execId
+	execInfo.ContainerID = pod
+	parts := strings.SplitN(strings.TrimSpace(string(output)), ",", 2)
+	if len(parts) != 2 {
+		return execInfo, fmt.Errorf("invalid exec state '%s'", output)
+	}
+	if parts[0] != "" {
+		if execInfo.Pid, err = strconv.Atoi(parts[0]); err != nil {
+			return execInfo, errors.Wrap(err, "parse exec pid")
+		}
+	}
+	if parts[1] == "" {
+		// 未写入退出码则命令仍在运行(或者还未启动)
+		execInfo.Running = true
+	} else if execInfo.ExitCode, err = strconv.Atoi(parts[1]); err != nil {
+		return execInfo, errors.Wrap(err, "parse exec exit code")
+	}
+	return execInfo, nil
+}
+
+func (b *k8sBackend) Wait(ctx context.Context, cid string) error {
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		pod, err := b.pods().Get(ctx, cid, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				return nil
+			}
+			return errors.Wrapf(err, "get pod %s", cid)
+		}
+		if pod.Status.Phase != corev1.PodRunning && pod.Status.Phase != corev1.PodPending {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *k8sBackend) WaitCommand(ctx context.Context, containerId string, execId string) (execInfo types.ContainerExecInspect, err error) {
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if pod, err := b.pods().Get(ctx, containerId, metav1.GetOptions{}); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return execInfo, err
+			}
+			return execInfo, errors.Wrap(err, "get pod")
+		} else if isK8sPodPaused(pod) || pod.Status.Phase != corev1.PodRunning {
+			return execInfo, errors.Wrapf(ErrContainerNotRun, "pod status is %s", pod.Status.Phase)
+		}
+
+		execInfo, err = b.GetExecInfo(execId)
+		if err != nil {
+			return execInfo, errors.Wrap(err, "get exec info")
+		}
+		if !execInfo.Running {
+			return execInfo, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return execInfo, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *k8sBackend) StopCommand(execId string) error {
+	info, err := b.GetExecInfo(execId)
+	if err != nil {
+		return err
+	}
+	if !info.Running {
+		return nil
+	}
+	if info.Pid <= 0 {
+		return fmt.Errorf("exec %s pid unknown", execId)
+	}
+
+	if _, err := b.RunCommand(info.ContainerID, killProcessScript(info.Pid)); err != nil {
+		return errors.Wrap(err, "kill process")
+	}
+	return nil
+}
+
+func isK8sPodPaused(pod *corev1.Pod) bool {
+	return pod.Annotations[k8sAnnotationPaused] == "true"
+}
+
+func (b *k8sBackend) IsPaused(cid string) (bool, error) {
+	pod, err := b.pods().Get(context.Background(), cid, metav1.GetOptions{})
+	if err != nil {
+		return false, errors.Wrapf(err, "%s, get pod", cid)
+	}
+	return isK8sPodPaused(pod), nil
+}
+
+// setPaused 向 pod 中除 1 号进程外的所有进程发送信号，并记录暂停状态
+func (b *k8sBackend) setPaused(cid string, paused bool) error {
+	ctx := context.Background()
+	pod, err := b.pods().Get(ctx, cid, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "%s, get pod", cid)
+	}
+	if pod.Status.Phase != corev1.PodRunning || isK8sPodPaused(pod) == paused {
+		return nil
+	}
+
+	signal := "CONT"
+	if paused {
+		signal = "STOP"
+	}
+	if _, err := b.RunCommandOutput(cid, []string{"sh", "-c", fmt.Sprintf("kill -%s -1", signal)}); err != nil {
+		return errors.Wrapf(err, "send SIG%s", signal)
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = make(map[string]string)
+	}
+	pod.Annotations[k8sAnnotationPaused] = strconv.FormatBool(paused)
+	if _, err := b.pods().Update(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "update pod %s", cid)
+	}
+	return nil
+}
+
+func (b *k8sBackend) Pause(cid string) error {
+	if err := b.setPaused(cid, true); err != nil {
+		return errors.Wrapf(err, "pause pod %s", cid)
+	}
+	return nil
+}
+
+func (b *k8sBackend) Unpause(cid string) error {
+	if err := b.setPaused(cid, false); err != nil {
+		return errors.Wrapf(err, "unpause pod %s", cid)
+	}
+	return nil
+}
+
+// KillContainers 启用了 AutoRemove 的 pod 直接删除，否则停止 pod 的主进程，pod 会以 Succeeded 状态保留
+func (b *k8sBackend) KillContainers(ctx context.Context, cids ...string) error {
+	for _, cid := range cids {
+		pod, err := b.pods().Get(ctx, cid, metav1.GetOptions{})
+		if err != nil {
+			if k8serrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "get pod %s", cid)
+		}
+
+		if pod.Annotations[k8sAnnotationAutoRemove] == "true" {
+			var gracePeriod int64 = 0
+			if err := b.pods().Delete(ctx, cid, metav1.DeleteOptions{
+				GracePeriodSeconds: &gracePeriod,
+			}); err != nil && !k8serrors.IsNotFound(err) {
+				return errors.Wrapf(err, "delete pod %s", cid)
+			}
+			continue
+		}
+
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		// 暂停的进程无法响应信号，先恢复再停止
+		if err := b.Unpause(cid); err != nil {
+			logger.Warnf("unpause pod %s error: %v", cid, err)
+		}
+		if _, err := b.RunCommandOutput(cid, []string{"kill", "1"}); err != nil {
+			logger.Infof("kill pod %s error: %v", cid, err)
+		}
+	}
+	return nil
+}
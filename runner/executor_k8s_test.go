@@ -0,0 +1,233 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"cloudiac/common"
+	"cloudiac/configs"
+)
+
+type fakePodExecer struct {
+	lock     sync.Mutex
+	commands [][]string
+	output   string
+}
+
+func (e *fakePodExecer) Exec(namespace, pod, container string, command []string, stdout, stderr io.Writer) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.commands = append(e.commands, command)
+	if stdout != nil {
+		_, _ = stdout.Write([]byte(e.output))
+	}
+	return nil
+}
+
+func (e *fakePodExecer) lastCommand() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.commands) == 0 {
+		return ""
+	}
+	return strings.Join(e.commands[len(e.commands)-1], " ")
+}
+
+func newTestK8sBackend(conf configs.KubernetesConfig) (*k8sBackend, *fake.Clientset, *fakePodExecer) {
+	configs.Set(&configs.Config{
+		Runner: configs.RunnerConfig{
+			StoragePath:      "/var/storage",
+			PluginCachePath:  "/var/plugin-cache",
+			ProviderCacheMod: common.ProviderCacheModCommon,
+		},
+	})
+
+	client := fake.NewSimpleClientset()
+	// fake clientset 不会调度 pod，创建时直接将状态设置为 Running
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status.Phase = corev1.PodRunning
+		return false, nil, nil
+	})
+
+	execer := &fakePodExecer{}
+	return &k8sBackend{
+		client:       client,
+		execer:       execer,
+		conf:         conf,
+		pollInterval: time.Millisecond,
+	}, client, execer
+}
+
+func TestK8sBackendStart(t *testing.T) {
+	b, client, _ := newTestK8sBackend(configs.KubernetesConfig{Namespace: "iac", NodeName: "node-1"})
+
+	cid, err := b.Start(&Executor{
+		Image:            "cloudiac/ct-worker:latest",
+		Name:             "run-cf1abc",
+		Env:              []string{"A=1", "B=x=y"},
+		Workdir:          ContainerWorkspace,
+		HostWorkdir:      "/var/storage/env-1/run-cf1abc",
+		TerraformVersion: common.TerraformVersions[0],
+		AutoRemove:       true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "run-cf1abc", cid)
+
+	pod, err := client.CoreV1().Pods("iac").Get(context.Background(), cid, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "node-1", pod.Spec.NodeName)
+	assert.Equal(t, "run-cf1abc", pod.Labels[k8sLabelTaskId])
+	assert.Equal(t, "true", pod.Annotations[k8sAnnotationAutoRemove])
+	assert.Equal(t, []corev1.EnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "x=y"}}, pod.Spec.Containers[0].Env)
+
+	mounts := pod.Spec.Containers[0].VolumeMounts
+	assert.Len(t, mounts, 2)
+	assert.Equal(t, ContainerWorkspace, mounts[0].MountPath)
+	assert.Equal(t, "/var/storage/env-1/run-cf1abc", pod.Spec.Volumes[0].HostPath.Path)
+	assert.Equal(t, ContainerPluginCachePath, mounts[1].MountPath)
+}
+
+func TestK8sBackendNodeNameFromEnv(t *testing.T) {
+	t.Setenv("NODE_NAME", "node-2")
+	b, _, _ := newTestK8sBackend(configs.KubernetesConfig{})
+
+	pod := b.buildPod(&Executor{
+		Name:             "run-cf1abc",
+		HostWorkdir:      "/var/storage/env-1/run-cf1abc",
+		TerraformVersion: common.TerraformVersions[0],
+	})
+	assert.Equal(t, "node-2", pod.Spec.NodeName)
+}
+
+func TestK8sBackendWorkspacePVC(t *testing.T) {
+	b, _, _ := newTestK8sBackend(configs.KubernetesConfig{NodeName: "node-1", WorkspacePVC: "iac-storage"})
+
+	pod := b.buildPod(&Executor{
+		Name:             "run-cf1abc",
+		HostWorkdir:      "/var/storage/env-1/run-cf1abc",
+		TerraformVersion: common.TerraformVersions[0],
+	})
+	assert.Equal(t, "", pod.Spec.NodeName)
+	assert.Equal(t, "iac-storage", pod.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	assert.Equal(t, "env-1/run-cf1abc", pod.Spec.Containers[0].VolumeMounts[0].SubPath)
+	// plugin cache 不在 storage_path 下，仍使用 hostPath
+	assert.Equal(t, "/var/plugin-cache", pod.Spec.Volumes[1].HostPath.Path)
+}
+
+func TestK8sBackendRunCommand(t *testing.T) {
+	b, _, execer := newTestK8sBackend(configs.KubernetesConfig{})
+
+	execId, err := b.RunCommand("run-cf1abc", []string{"/bin/sh", "-c", "echo 'hello'"})
+	assert.NoError(t, err)
+	pod, id, err := parseK8sExecId(execId)
+	assert.NoError(t, err)
+	assert.Equal(t, "run-cf1abc", pod)
+
+	pidFile, exitFile := k8sExecStateFiles(id)
+	cmd := execer.lastCommand()
+	assert.Contains(t, cmd, pidFile)
+	assert.Contains(t, cmd, exitFile)
+	assert.Contains(t, cmd, "nohup")
+
+	cases := []struct {
+		output   string
+		running  bool
+		pid      int
+		exitCode int
+	}{
+		{",", true, 0, 0},
+		{"12,", true, 12, 0},
+		{"12,0", false, 12, 0},
+		{"12,2\n", false, 12, 2},
+	}
+	for _, c := range cases {
+		execer.output = c.output
+		info, err := b.GetExecInfo(execId)
+		assert.NoError(t, err, c.output)
+		assert.Equal(t, c.running, info.Running, c.output)
+		assert.Equal(t, c.pid, info.Pid, c.output)
+		assert.Equal(t, c.exitCode, info.ExitCode, c.output)
+	}
+
+	_, err = b.GetExecInfo("invalid")
+	assert.Error(t, err)
+}
+
+func TestK8sBackendWaitCommand(t *testing.T) {
+	b, _, execer := newTestK8sBackend(configs.KubernetesConfig{})
+	cid, err := b.Start(&Executor{Name: "run-wait", TerraformVersion: common.TerraformVersions[0]})
+	assert.NoError(t, err)
+
+	execer.output = "12,3"
+	info, err := b.WaitCommand(context.Background(), cid, fmt.Sprintf("%s/exec-1", cid))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, info.ExitCode)
+
+	execer.output = "12,"
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	_, err = b.WaitCommand(ctx, cid, fmt.Sprintf("%s/exec-1", cid))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NoError(t, b.Pause(cid))
+	_, err = b.WaitCommand(context.Background(), cid, fmt.Sprintf("%s/exec-1", cid))
+	assert.ErrorIs(t, err, ErrContainerNotRun)
+}
+
+func TestK8sBackendPause(t *testing.T) {
+	b, _, execer := newTestK8sBackend(configs.KubernetesConfig{})
+	cid, err := b.Start(&Executor{Name: "run-pause", TerraformVersion: common.TerraformVersions[0]})
+	assert.NoError(t, err)
+
+	paused, err := b.IsPaused(cid)
+	assert.NoError(t, err)
+	assert.False(t, paused)
+
+	assert.NoError(t, b.Pause(cid))
+	assert.Contains(t, execer.lastCommand(), "kill -STOP -1")
+	paused, err = b.IsPaused(cid)
+	assert.NoError(t, err)
+	assert.True(t, paused)
+
+	assert.NoError(t, b.Unpause(cid))
+	assert.Contains(t, execer.lastCommand(), "kill -CONT -1")
+	paused, err = b.IsPaused(cid)
+	assert.NoError(t, err)
+	assert.False(t, paused)
+}
+
+func TestK8sBackendKillContainers(t *testing.T) {
+	b, client, execer := newTestK8sBackend(configs.KubernetesConfig{})
+	removed, err := b.Start(&Executor{Name: "run-remove", AutoRemove: true, TerraformVersion: common.TerraformVersions[0]})
+	assert.NoError(t, err)
+	reserved, err := b.Start(&Executor{Name: "run-reserve", AutoRemove: false, TerraformVersion: common.TerraformVersions[0]})
+	assert.NoError(t, err)
+
+	assert.NoError(t, b.KillContainers(context.Background(), removed, reserved, "not-exists"))
+
+	pods, err := client.CoreV1().Pods(k8sDefaultNamespace).List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, pods.Items, 1)
+	assert.Equal(t, reserved, pods.Items[0].Name)
+	assert.Equal(t, "kill 1", execer.lastCommand())
+}
+
+func TestK8sPodName(t *testing.T) {
+	assert.Equal(t, "run-cf1abc", k8sPodName("run-cf1abc"))
+	assert.Equal(t, "run-cf1abc", k8sPodName("Run-CF1abc"))
+	assert.Equal(t, "run-cf1-abc", k8sPodName("RUN_cf1.abc"))
+	assert.Len(t, k8sPodName(strings.Repeat("a", 100)), 63)
+}
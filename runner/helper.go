@@ -13,9 +13,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/docker/docker/errdefs"
-	"github.com/pkg/errors"
 )
 
 type IaCTemplate struct {
@@ -229,30 +226,7 @@ func TaskControlFilePath(envId, taskId string) string {
 }
 
 func KillContainers(ctx context.Context, cids ...string) error {
-	cli, err := DockerClient()
-	if err != nil {
-		return err
-	}
-
-	// 这里仅 kill container，container 的删除通过启动时的 AutoRemove 参数配置
-	for _, cid := range cids {
-		// default signal "SIGKILL"
-		if err := cli.ContainerKill(ctx, cid, ""); err != nil {
-			var targetErr errdefs.ErrNotFound
-			if errors.As(err, &targetErr) {
-				continue
-			}
-
-			// 有可能己经提交了删除请求，这里忽略掉这些报错
-			if !strings.Contains(err.Error(), "already in progress") &&
-				!strings.Contains(err.Error(), "No such container") {
-				logger.Info("kill container error: %v", err)
-				continue
-			}
-			return err
-		}
-	}
-	return nil
+	return containerBackend().KillContainers(ctx, cids...)
 }
 
 //判断provider缓存目录是否存在，存在删除
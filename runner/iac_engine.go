@@ -0,0 +1,56 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+)
+
+// TerragruntBin terragrunt 类型的多工作目录模板执行的命令
+const TerragruntBin = "terragrunt"
+
+// IacEngine 任务执行 terraform 代码使用的命令及版本管理工具
+type IacEngine struct {
+	Name        string
+	Bin         string // 执行命令，如 terraform init
+	VersionEnv  string // 版本管理工具(tfenv/tofuenv)读取版本号的环境变量
+	VersionTool string // 版本管理工具
+	VersionsDir string // 版本管理工具在容器中的版本安装目录
+	Registry    string // 默认的 provider registry 地址
+}
+
+var (
+	terraformEngine = IacEngine{
+		Name:        common.IacEngineTerraform,
+		Bin:         "terraform",
+		VersionEnv:  "TFENV_TERRAFORM_VERSION",
+		VersionTool: "tfenv",
+		VersionsDir: "/root/.tfenv/versions",
+		Registry:    "registry.terraform.io",
+	}
+	openTofuEngine = IacEngine{
+		Name:        common.IacEngineOpenTofu,
+		Bin:         "tofu",
+		VersionEnv:  "TOFUENV_TOFU_VERSION",
+		VersionTool: "tofuenv",
+		VersionsDir: "/root/.tofuenv/versions",
+		Registry:    "registry.opentofu.org",
+	}
+)
+
+// GetIacEngine 获取 IaC 引擎，未指定或者未知的引擎使用 terraform
+func GetIacEngine(name string) IacEngine {
+	if name == common.IacEngineOpenTofu {
+		return openTofuEngine
+	}
+	return terraformEngine
+}
+
+// VersionsCachePath 宿主机上缓存版本管理工具下载的版本的目录
+func (e IacEngine) VersionsCachePath() string {
+	if e.Name == common.IacEngineOpenTofu {
+		return configs.Get().Runner.AbsTofuenvVersionsCachePath()
+	}
+	return configs.Get().Runner.AbsTfenvVersionsCachePath()
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// podExecer 在 pod 中执行命令，单独定义接口以便在测试中替换(fake clientset 不支持 exec)
+type podExecer interface {
+	Exec(namespace, pod, container string, command []string, stdout, stderr io.Writer) error
+}
+
+type spdyPodExecer struct {
+	config *rest.Config
+	client kubernetes.Interface
+}
+
+func (e spdyPodExecer) Exec(namespace, pod, container string, command []string, stdout, stderr io.Writer) error {
+	req := e.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod).
+		Namespace(namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(e.config, "POST", req.URL())
+	if err != nil {
+		return errors.Wrap(err, "create pod executor")
+	}
+	return exec.Stream(remotecommand.StreamOptions{
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
+
+func initKubernetesClient(kubeconfig string) (*rest.Config, kubernetes.Interface, error) {
+	var (
+		config *rest.Config
+		err    error
+	)
+	if kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "load kubernetes config")
+	}
+
+	cli, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "create kubernetes client")
+	}
+	return config, cli, nil
+}
@@ -0,0 +1,686 @@
+// Copyright (c) 2015-2023 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"bytes"
+	"cloudiac/common"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+/*
+多工作目录(stack)模板的支持:
+一个模板中包含多个 terraform 根目录(monorepo 或者 terragrunt 项目)，
+任务执行时按依赖关系依次在每个根目录中执行 init/plan/apply，
+每个根目录使用独立的 state，执行结果合并为一个 state json 提供给 portal 解析。
+*/
+
+const (
+	StackDir           = "stack"      // 任务 workspace 下保存各根目录输出文件的目录
+	StackInfoFile      = "stack.json" // 本次任务的根目录列表(按执行顺序)
+	TerragruntFile     = "terragrunt.hcl"
+	StackConfigFile    = ".cloudiac-stack.hcl" // 多工作目录模板通过该文件声明根目录的依赖
+	StackRootModuleKey = "cloudiac_stack_root" // 合并后的 state/plan json 中标识根目录的字段
+)
+
+type StackRoot struct {
+	Name         string   `json:"name"` // 根目录名称，用于 state 路径及合并后的模块地址
+	Path         string   `json:"path"` // 基于 workdir 的相对路径
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+var stackNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+func stackRootName(path string) string {
+	if path == "." {
+		return "root"
+	}
+	return stackNameInvalidChars.ReplaceAllString(filepath.ToSlash(path), "_")
+}
+
+// LoadStack 发现 codeDir 下的根目录，解析依赖关系，并返回按依赖排序后的根目录列表。
+// roots 为模板中指定的根目录列表，为空时自动发现
+func LoadStack(codeDir string, stackType string, roots []string) ([]StackRoot, error) {
+	var (
+		paths []string
+		err   error
+	)
+	if len(roots) > 0 {
+		for _, r := range roots {
+			p := filepath.Clean(r)
+			if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+				return nil, fmt.Errorf("invalid stack root '%s'", r)
+			}
+			if fi, err := os.Stat(filepath.Join(codeDir, p)); err != nil || !fi.IsDir() {
+				return nil, fmt.Errorf("stack root '%s' is not a directory", r)
+			}
+			paths = append(paths, p)
+		}
+	} else if stackType == common.StackTypeTerragrunt {
+		paths, err = discoverTerragruntRoots(codeDir)
+	} else {
+		paths, err = discoverTerraformRoots(codeDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no stack root found")
+	}
+
+	stack := make([]StackRoot, 0, len(paths))
+	names := make(map[string]string)
+	for _, p := range paths {
+		// 根目录路径会写入步骤脚本中
+		if shellescape.Quote(p) != p {
+			return nil, fmt.Errorf("invalid stack root '%s'", p)
+		}
+		root := StackRoot{Name: stackRootName(p), Path: p}
+		if other, ok := names[root.Name]; ok {
+			return nil, fmt.Errorf("stack root '%s' and '%s' have the same name", other, p)
+		}
+		names[root.Name] = p
+
+		cfgFile := StackConfigFile
+		if stackType == common.StackTypeTerragrunt {
+			cfgFile = TerragruntFile
+		}
+		deps, err := parseStackDependencies(filepath.Join(codeDir, p, cfgFile))
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deps {
+			root.Dependencies = append(root.Dependencies, filepath.Join(p, d))
+		}
+		stack = append(stack, root)
+	}
+	return SortStackRoots(stack)
+}
+
+// SortStackRoots 按依赖关系对根目录进行拓扑排序，没有依赖关系的根目录按路径排序
+func SortStackRoots(roots []StackRoot) ([]StackRoot, error) {
+	byPath := make(map[string]StackRoot, len(roots))
+	for _, r := range roots {
+		byPath[r.Path] = r
+	}
+	pending := make(map[string]int, len(roots)) // 未完成的依赖数量
+	dependents := make(map[string][]string)
+	for _, r := range roots {
+		for _, d := range r.Dependencies {
+			if _, ok := byPath[d]; !ok {
+				return nil, fmt.Errorf("dependency '%s' of stack root '%s' is not a stack root", d, r.Path)
+			}
+			pending[r.Path]++
+			dependents[d] = append(dependents[d], r.Path)
+		}
+	}
+
+	ready := make([]string, 0)
+	for _, r := range roots {
+		if pending[r.Path] == 0 {
+			ready = append(ready, r.Path)
+		}
+	}
+	sorted := make([]StackRoot, 0, len(roots))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		p := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, byPath[p])
+		for _, dp := range dependents[p] {
+			pending[dp]--
+			if pending[dp] == 0 {
+				ready = append(ready, dp)
+			}
+		}
+	}
+	if len(sorted) != len(roots) {
+		cycle := make([]string, 0)
+		for _, r := range roots {
+			if pending[r.Path] > 0 {
+				cycle = append(cycle, r.Path)
+			}
+		}
+		return nil, fmt.Errorf("dependency cycle between stack roots: %s", strings.Join(cycle, ", "))
+	}
+	return sorted, nil
+}
+
+// 遍历目录，跳过隐藏目录(.git、.terraform、.terragrunt-cache 等)
+func walkStackDirs(codeDir string, fn func(dir string, entries []os.DirEntry) error) error {
+	return filepath.WalkDir(codeDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != codeDir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		return fn(path, entries)
+	})
+}
+
+// discoverTerragruntRoots 包含 terragrunt.hcl 文件的目录为根目录，
+// workdir 下的 terragrunt.hcl 通常是被 include 的公共配置，存在其他根目录时不作为根目录
+func discoverTerragruntRoots(codeDir string) ([]string, error) {
+	paths := make([]string, 0)
+	err := walkStackDirs(codeDir, func(dir string, entries []os.DirEntry) error {
+		for _, e := range entries {
+			if !e.IsDir() && e.Name() == TerragruntFile {
+				rel, _ := filepath.Rel(codeDir, dir)
+				paths = append(paths, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) > 1 && paths[0] == "." {
+		paths = paths[1:]
+	}
+	return paths, nil
+}
+
+// discoverTerraformRoots 包含 .tf 文件的目录为根目录，被其他目录作为本地 module 引用的目录除外
+func discoverTerraformRoots(codeDir string) ([]string, error) {
+	dirs := make([]string, 0)
+	modules := make(map[string]bool)
+	err := walkStackDirs(codeDir, func(dir string, entries []os.DirEntry) error {
+		hasTf := false
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".tf") || e.Name() == CloudIacTfFile {
+				continue
+			}
+			hasTf = true
+			sources, err := parseLocalModuleSources(filepath.Join(dir, e.Name()))
+			if err != nil {
+				return err
+			}
+			for _, s := range sources {
+				modules[filepath.Join(dir, s)] = true
+			}
+		}
+		if hasTf {
+			dirs = append(dirs, dir)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0)
+	for _, dir := range dirs {
+		if !modules[dir] {
+			rel, _ := filepath.Rel(codeDir, dir)
+			paths = append(paths, rel)
+		}
+	}
+	return paths, nil
+}
+
+func parseHclFile(path string) (*hclsyntax.Body, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(content, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, errors.Wrapf(diags, "parse %s", path)
+	}
+	return file.Body.(*hclsyntax.Body), nil
+}
+
+// parseLocalModuleSources 解析 tf 文件中 module 引用的本地目录
+func parseLocalModuleSources(path string) ([]string, error) {
+	body, err := parseHclFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]string, 0)
+	for _, block := range body.Blocks {
+		if block.Type != "module" {
+			continue
+		}
+		attr, ok := block.Body.Attributes["source"]
+		if !ok {
+			continue
+		}
+		var source string
+		if diags := gohcl.DecodeExpression(attr.Expr, nil, &source); diags.HasErrors() {
+			continue
+		}
+		if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+// parseStackDependencies 解析根目录依赖的其他根目录(相对该根目录的路径)，支持以下配置:
+//
+//	dependency "vpc" { config_path = "../vpc" }
+//	dependencies { paths = ["../vpc", "../db"] }
+//
+// 配置文件不存在时返回空列表
+func parseStackDependencies(path string) ([]string, error) {
+	if !utils.FileExist(path) {
+		return nil, nil
+	}
+	body, err := parseHclFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	ctx := stackEvalContext(dir)
+
+	exprs := make([]hcl.Expression, 0)
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "dependency":
+			if attr, ok := block.Body.Attributes["config_path"]; ok {
+				exprs = append(exprs, attr.Expr)
+			}
+		case "dependencies":
+			attr, ok := block.Body.Attributes["paths"]
+			if !ok {
+				continue
+			}
+			if tuple, ok := attr.Expr.(*hclsyntax.TupleConsExpr); ok {
+				for _, ex := range tuple.Exprs {
+					exprs = append(exprs, ex)
+				}
+				continue
+			}
+			var ps []string
+			if diags := gohcl.DecodeExpression(attr.Expr, ctx, &ps); diags.HasErrors() {
+				return nil, errors.Wrapf(diags, "resolve dependencies of %s", path)
+			}
+			for _, p := range ps {
+				exprs = append(exprs, hcl.StaticExpr(cty.StringVal(p), attr.Expr.Range()))
+			}
+		}
+	}
+
+	// 无法解析的依赖(如引用了 locals 或者不支持的函数)返回错误，忽略依赖会导致根目录先于其依赖的根目录执行
+	deps := make([]string, 0)
+	for _, expr := range exprs {
+		var p string
+		if diags := gohcl.DecodeExpression(expr, ctx, &p); diags.HasErrors() {
+			return nil, errors.Wrapf(diags, "resolve dependency of %s", path)
+		}
+		if filepath.IsAbs(p) {
+			if p, err = filepath.Rel(dir, p); err != nil {
+				return nil, errors.Wrapf(err, "resolve dependency of %s", path)
+			}
+		}
+		deps = append(deps, p)
+	}
+	return deps, nil
+}
+
+// stackEvalContext 解析依赖配置时提供 terragrunt 常用的目录函数，dir 为配置文件所在目录
+func stackEvalContext(dir string) *hcl.EvalContext {
+	dirFunc := function.New(&function.Spec{
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			return cty.StringVal(dir), nil
+		},
+	})
+	return &hcl.EvalContext{
+		Functions: map[string]function.Function{
+			"get_terragrunt_dir":          dirFunc,
+			"get_original_terragrunt_dir": dirFunc,
+		},
+	}
+}
+
+func stackInfoPath(envId, taskId string) string {
+	return filepath.Join(GetTaskWorkspace(envId, taskId), StackDir, StackInfoFile)
+}
+
+func readStackInfo(envId, taskId string) ([]StackRoot, error) {
+	content, err := os.ReadFile(stackInfoPath(envId, taskId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	roots := make([]StackRoot, 0)
+	if err := json.Unmarshal(content, &roots); err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// isStack 是否需要将步骤展开到 stack 的各个根目录中执行
+func (t *Task) isStack() bool {
+	return t.req.Env.StackType != "" && t.stackRoot == nil
+}
+
+func (t *Task) loadStack() ([]StackRoot, error) {
+	workspace := GetTaskWorkspace(t.req.Env.Id, t.req.TaskId)
+	roots, err := LoadStack(filepath.Join(workspace, "code", t.req.Env.Workdir), t.req.Env.StackType, t.req.Env.StackRoots)
+	if err != nil {
+		return nil, errors.Wrap(err, "load stack")
+	}
+
+	for _, r := range roots {
+		if err := os.MkdirAll(filepath.Join(workspace, StackDir, r.Name), 0755); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.WriteFile(stackInfoPath(t.req.Env.Id, t.req.TaskId), utils.MustJSON(roots), 0644); err != nil { //nolint:gosec
+		return nil, err
+	}
+	return roots, nil
+}
+
+// genStackIacTfFile 生成根目录使用的 backend 配置，每个根目录的 state 保存在环境 state 路径下的子路径中
+func (t *Task) genStackIacTfFile(root StackRoot) (string, error) {
+	t.fillStateAddress()
+	state := t.req.StateStore
+	state.Path = fmt.Sprintf("%s/%s", state.Path, root.Name)
+	path := filepath.Join(StackDir, root.Name, CloudIacTfFile)
+	ctx := map[string]interface{}{
+		"PrivateKeyPath": filepath.Join(ContainerWorkspace, "ssh_key"),
+		"State":          state,
+	}
+	if err := execTpl2File(iacTerraformTpl, ctx, filepath.Join(GetTaskWorkspace(t.req.Env.Id, t.req.TaskId), path)); err != nil {
+		return "", err
+	}
+	return filepath.Join(ContainerWorkspace, path), nil
+}
+
+// stackRootTask 生成在根目录中执行步骤的 task，步骤的 before 命令只在第一个根目录执行，after 命令只在最后一个根目录执行
+func (t *Task) stackRootTask(root StackRoot, first, last bool) *Task {
+	rt := *t
+	rt.stackRoot = &root
+	rt.req.Env.Workdir = filepath.Join(t.req.Env.Workdir, root.Path)
+	if t.req.Env.TfVarsFile != "" {
+		rt.req.Env.TfVarsFile = filepath.Join(ContainerCodeDir, t.req.Env.Workdir, t.req.Env.TfVarsFile)
+	}
+	if !first {
+		rt.req.StepBeforeCmds = nil
+	}
+	if !last {
+		rt.req.StepAfterCmds = nil
+	}
+	return &rt
+}
+
+// 根目录的执行输出同时写入步骤日志及根目录的日志文件
+var stackRootCommandTpl = template.Must(template.New("").Parse(`
+echo '===== [{{.Index}}/{{.Total}}] stack root: {{.Root.Path}} ====='
+(
+ln -sf '{{.IacTfFile}}' '{{.ContainerWorkspace}}/code/{{.Workdir}}/_cloudiac.tf' || exit 1
+{{.Command}}
+) 2>&1 | tee '{{.LogFile}}' || exit $?
+`))
+
+// stackRootLogPath 根目录在步骤中的执行日志路径，stepDir 为步骤目录
+func stackRootLogPath(stepDir string, root StackRoot) string {
+	return filepath.Join(stepDir, StackDir, root.Name+".log")
+}
+
+// FetchStackLogs 读取 stack 模板任务步骤在各根目录的执行日志，非 stack 任务返回空列表
+func FetchStackLogs(envId string, taskId string, step int) ([]StackLog, error) {
+	roots, err := readStackInfo(envId, taskId)
+	if err != nil || len(roots) == 0 {
+		return nil, err
+	}
+
+	stepDir := GetTaskDir(envId, taskId, step)
+	stackLogs := make([]StackLog, 0, len(roots))
+	for _, r := range roots {
+		content, err := os.ReadFile(stackRootLogPath(stepDir, r))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// 根目录未执行(前面的根目录执行失败)或者步骤未在根目录中展开执行
+				continue
+			}
+			return nil, err
+		}
+		stackLogs = append(stackLogs, StackLog{Root: r.Name, Path: r.Path, Content: content})
+	}
+	return stackLogs, nil
+}
+
+// stackStepScript 按依赖顺序在每个根目录中执行步骤(destroy 时按相反顺序)，任一根目录执行失败则退出
+func (t *Task) stackStepScript(step func(*Task) (string, error)) (string, error) {
+	if t.req.StateStore.Backend == common.StateBackendHttp {
+		return "", fmt.Errorf("stack template does not support http state backend")
+	}
+	if len(t.req.PlanFile) > 0 {
+		return "", fmt.Errorf("stack template does not support deploying from a saved plan")
+	}
+
+	roots, err := t.loadStack()
+	if err != nil {
+		return "", err
+	}
+	if t.req.StepType == common.TaskStepTfDestroy || utils.StrInArray("-destroy", t.req.StepArgs...) {
+		for i, j := 0, len(roots)-1; i < j; i, j = i+1, j-1 {
+			roots[i], roots[j] = roots[j], roots[i]
+		}
+	}
+
+	stepDir := GetTaskDir(t.req.Env.Id, t.req.TaskId, t.req.Step)
+	if err := os.MkdirAll(filepath.Join(stepDir, StackDir), 0755); err != nil {
+		return "", err
+	}
+
+	buffer := bytes.NewBufferString("#!/bin/sh\nset -o pipefail\n")
+	for i, root := range roots {
+		rt := t.stackRootTask(root, i == 0, i == len(roots)-1)
+		command, err := step(rt)
+		if err != nil {
+			return "", err
+		}
+		iacTfFile, err := t.genStackIacTfFile(root)
+		if err != nil {
+			return "", errors.Wrap(err, "generate stack backend file")
+		}
+		if err := stackRootCommandTpl.Execute(buffer, map[string]interface{}{
+			"Index":              i + 1,
+			"Total":              len(roots),
+			"Root":               root,
+			"Workdir":            rt.req.Env.Workdir,
+			"IacTfFile":          iacTfFile,
+			"LogFile":            filepath.Join(ContainerWorkspace, stackRootLogPath(t.stepDirName(t.req.Step), root)),
+			"Command":            command,
+			"ContainerWorkspace": ContainerWorkspace,
+		}); err != nil {
+			return "", err
+		}
+	}
+	return buffer.String(), nil
+}
+
+type stackJsonMerger func(merged, content map[string]interface{}, root StackRoot)
+
+// MergeStackOutputs 将 stack 各根目录的 state、plan 及 provider schema json 合并后保存到 workspace 根目录，
+// 每个根目录合并为一个地址为 module.<root> 的子模块。非 stack 任务直接返回
+func MergeStackOutputs(envId string, taskId string) error {
+	roots, err := readStackInfo(envId, taskId)
+	if err != nil || len(roots) == 0 {
+		return err
+	}
+
+	workspace := GetTaskWorkspace(envId, taskId)
+	for name, merge := range map[string]stackJsonMerger{
+		TFStateJsonFile:  mergeStackState,
+		TFPlanJsonFile:   mergeStackPlan,
+		TFProviderSchema: mergeStackProviderSchema,
+	} {
+		merged := make(map[string]interface{})
+		found := false
+		for _, r := range roots {
+			content, err := os.ReadFile(filepath.Join(workspace, StackDir, r.Name, name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			// 根目录执行失败时输出文件可能为空
+			if len(content) == 0 {
+				continue
+			}
+			js := make(map[string]interface{})
+			if err := json.Unmarshal(content, &js); err != nil {
+				return errors.Wrapf(err, "parse %s of stack root %s", name, r.Path)
+			}
+			merge(merged, js, r)
+			found = true
+		}
+		if !found {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(workspace, name), utils.MustJSON(merged), 0644); err != nil { //nolint:gosec
+			return err
+		}
+	}
+	return nil
+}
+
+func jsonObject(m map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := m[key].(map[string]interface{}); ok {
+		return v
+	}
+	v := make(map[string]interface{})
+	m[key] = v
+	return v
+}
+
+func jsonArray(v interface{}) []interface{} {
+	arr, _ := v.([]interface{})
+	return arr
+}
+
+func stackAddress(prefix, addr string) string {
+	if addr == "" {
+		return prefix
+	}
+	return prefix + "." + addr
+}
+
+// prefixStackModule 为模块及其资源、子模块的地址加上根目录的模块地址前缀
+func prefixStackModule(module map[string]interface{}, prefix string) {
+	if addr, ok := module["address"].(string); ok && addr != "" {
+		module["address"] = stackAddress(prefix, addr)
+	}
+	for _, r := range jsonArray(module["resources"]) {
+		res, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		addr, _ := res["address"].(string)
+		res["address"] = stackAddress(prefix, addr)
+		deps := jsonArray(res["depends_on"])
+		for i := range deps {
+			if d, ok := deps[i].(string); ok {
+				deps[i] = stackAddress(prefix, d)
+			}
+		}
+	}
+	for _, c := range jsonArray(module["child_modules"]) {
+		if child, ok := c.(map[string]interface{}); ok {
+			prefixStackModule(child, prefix)
+		}
+	}
+}
+
+func mergeStackVersion(merged, content map[string]interface{}) {
+	for _, k := range []string{"format_version", "terraform_version"} {
+		if _, ok := merged[k]; !ok && content[k] != nil {
+			merged[k] = content[k]
+		}
+	}
+}
+
+// mergeStackValues 合并 state 的 values 结构(state json 的 values 及 plan json 的 planned_values)
+func mergeStackValues(merged, values map[string]interface{}, root StackRoot) {
+	prefix := "module." + root.Name
+	outputs := jsonObject(merged, "outputs")
+	for k, v := range jsonObject(values, "outputs") {
+		outputs[root.Name+"."+k] = v
+	}
+
+	module := jsonObject(values, "root_module")
+	prefixStackModule(module, prefix)
+	module["address"] = prefix
+	module[StackRootModuleKey] = root.Path
+	rootModule := jsonObject(merged, "root_module")
+	rootModule["child_modules"] = append(jsonArray(rootModule["child_modules"]), module)
+}
+
+func mergeStackState(merged, content map[string]interface{}, root StackRoot) {
+	mergeStackVersion(merged, content)
+	if values, ok := content["values"].(map[string]interface{}); ok {
+		mergeStackValues(jsonObject(merged, "values"), values, root)
+	}
+}
+
+func mergeStackPlan(merged, content map[string]interface{}, root StackRoot) {
+	mergeStackVersion(merged, content)
+	prefix := "module." + root.Name
+	if values, ok := content["planned_values"].(map[string]interface{}); ok {
+		mergeStackValues(jsonObject(merged, "planned_values"), values, root)
+	}
+	if state, ok := content["prior_state"].(map[string]interface{}); ok {
+		mergeStackState(jsonObject(merged, "prior_state"), state, root)
+	}
+
+	changes := jsonArray(merged["resource_changes"])
+	for _, c := range jsonArray(content["resource_changes"]) {
+		change, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		addr, _ := change["address"].(string)
+		change["address"] = stackAddress(prefix, addr)
+		moduleAddr, _ := change["module_address"].(string)
+		change["module_address"] = stackAddress(prefix, moduleAddr)
+		changes = append(changes, change)
+	}
+	merged["resource_changes"] = changes
+
+	outputs := jsonObject(merged, "output_changes")
+	for k, v := range jsonObject(content, "output_changes") {
+		outputs[root.Name+"."+k] = v
+	}
+}
+
+func mergeStackProviderSchema(merged, content map[string]interface{}, _ StackRoot) {
+	mergeStackVersion(merged, content)
+	schemas := jsonObject(merged, "provider_schemas")
+	for k, v := range jsonObject(content, "provider_schemas") {
+		schemas[k] = v
+	}
+}
@@ -0,0 +1,207 @@
+package runner
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeStackFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func stackPaths(roots []StackRoot) []string {
+	paths := make([]string, 0)
+	for _, r := range roots {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+func TestLoadTerragruntStack(t *testing.T) {
+	dir := t.TempDir()
+	writeStackFiles(t, dir, map[string]string{
+		"terragrunt.hcl":                    `remote_state {}`,
+		"app/terragrunt.hcl":                `dependency "vpc" { config_path = "../network/vpc" }` + "\n" + `dependencies { paths = ["../db"] }`,
+		"db/terragrunt.hcl":                 `dependency "vpc" { config_path = "../network/vpc" }`,
+		"network/vpc/terragrunt.hcl":        ``,
+		"network/vpc/.terragrunt-cache/x/a": ``,
+	})
+
+	roots, err := LoadStack(dir, common.StackTypeTerragrunt, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"network/vpc", "db", "app"}, stackPaths(roots))
+	assert.Equal(t, "network_vpc", roots[0].Name)
+
+	// 循环依赖
+	writeStackFiles(t, dir, map[string]string{
+		"network/vpc/terragrunt.hcl": `dependency "app" { config_path = "../../app" }`,
+	})
+	_, err = LoadStack(dir, common.StackTypeTerragrunt, nil)
+	assert.Error(t, err)
+}
+
+func TestParseStackDependencies(t *testing.T) {
+	dir := t.TempDir()
+	writeStackFiles(t, dir, map[string]string{
+		"app/terragrunt.hcl": `
+dependency "vpc" { config_path = "${get_terragrunt_dir()}/../vpc" }
+dependencies { paths = ["../cache", "${get_original_terragrunt_dir()}/../queue"] }
+`,
+		"db/terragrunt.hcl":    `dependency "vpc" { config_path = local.vpc_path }`,
+		"cache/terragrunt.hcl": `dependencies { paths = [find_in_parent_folders("vpc")] }`,
+	})
+
+	deps, err := parseStackDependencies(filepath.Join(dir, "app/terragrunt.hcl"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"../vpc", "../cache", "../queue"}, deps)
+
+	// 无法解析的依赖返回错误，而不是忽略依赖
+	_, err = parseStackDependencies(filepath.Join(dir, "db/terragrunt.hcl"))
+	assert.Error(t, err)
+	_, err = parseStackDependencies(filepath.Join(dir, "cache/terragrunt.hcl"))
+	assert.Error(t, err)
+}
+
+func TestLoadMultiStack(t *testing.T) {
+	dir := t.TempDir()
+	writeStackFiles(t, dir, map[string]string{
+		"vpc/main.tf":                 `module "subnet" { source = "../modules/subnet" }`,
+		"modules/subnet/main.tf":      `resource "null_resource" "a" {}`,
+		"ecs/main.tf":                 `resource "null_resource" "b" {}`,
+		"ecs/.cloudiac-stack.hcl":     `dependencies { paths = ["../vpc"] }`,
+		"ecs/.terraform/modules/x.tf": `resource "null_resource" "c" {}`,
+	})
+
+	roots, err := LoadStack(dir, common.StackTypeMulti, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpc", "ecs"}, stackPaths(roots))
+
+	// 指定根目录
+	_, err = LoadStack(dir, common.StackTypeMulti, []string{"ecs/"})
+	assert.Error(t, err) // ecs 依赖的 vpc 不在根目录列表中
+	roots, err = LoadStack(dir, common.StackTypeMulti, []string{"vpc"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vpc"}, stackPaths(roots))
+
+	_, err = LoadStack(dir, common.StackTypeMulti, []string{"../other"})
+	assert.Error(t, err)
+}
+
+func TestStackStepScript(t *testing.T) {
+	storage := t.TempDir()
+	configs.Set(&configs.Config{Runner: configs.RunnerConfig{StoragePath: storage}})
+
+	writeStackFiles(t, filepath.Join(GetTaskWorkspace("env-1", "run-1"), "code", "live"), map[string]string{
+		"app/terragrunt.hcl": `dependency "vpc" { config_path = "../vpc" }`,
+		"vpc/terragrunt.hcl": ``,
+	})
+	task := Task{
+		req: RunTaskReq{
+			Env:        TaskEnv{Id: "env-1", Workdir: "live", StackType: common.StackTypeTerragrunt},
+			StateStore: StateStore{Backend: common.StateBackendConsul, Address: "consul:8500", Path: "org/project/env.tfstate"},
+			TaskId:     "run-1",
+			StepType:   common.TaskStepTfPlan,
+		},
+		logger: logs.Get(),
+	}
+
+	script, err := task.stepPlan()
+	assert.NoError(t, err)
+	assert.Less(t, strings.Index(script, "stack root: vpc"), strings.Index(script, "stack root: app"))
+	assert.Contains(t, script, "cd '/cloudiac/workspace/code/live/app'")
+	assert.Contains(t, script, "terragrunt plan")
+	assert.Contains(t, script, ">/cloudiac/workspace/stack/app/tfplan.json")
+	assert.Contains(t, script, "-out=/cloudiac/workspace/stack/app/_cloudiac.tfplan")
+	assert.Contains(t, script, "show -no-color -json /cloudiac/workspace/stack/app/_cloudiac.tfplan")
+	assert.Contains(t, script, "cp /cloudiac/workspace/stack/app/_cloudiac.tfplan /cloudiac/workspace/stack/app/"+TFPlanFile)
+	assert.Contains(t, script, "| tee '/cloudiac/workspace/step0/stack/app.log'")
+
+	backend, err := os.ReadFile(filepath.Join(GetTaskWorkspace("env-1", "run-1"), StackDir, "app", CloudIacTfFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(backend), `path    = "org/project/env.tfstate/app"`)
+
+	// destroy 按相反顺序执行
+	task.req.StepArgs = []string{"-destroy"}
+	script, err = task.stepPlan()
+	assert.NoError(t, err)
+	assert.Greater(t, strings.Index(script, "stack root: vpc"), strings.Index(script, "stack root: app"))
+
+	// 各根目录的步骤日志
+	stepDir := GetTaskDir("env-1", "run-1", 0)
+	assert.NoError(t, os.WriteFile(filepath.Join(stepDir, StackDir, "app.log"), []byte("app log"), 0644))
+	stackLogs, err := FetchStackLogs("env-1", "run-1", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []StackLog{{Root: "app", Path: "app", Content: []byte("app log")}}, stackLogs)
+}
+
+func TestMergeStackOutputs(t *testing.T) {
+	storage := t.TempDir()
+	configs.Set(&configs.Config{Runner: configs.RunnerConfig{StoragePath: storage}})
+
+	roots := []StackRoot{{Name: "vpc", Path: "vpc"}, {Name: "ecs", Path: "ecs"}}
+	workspace := GetTaskWorkspace("env-1", "run-1")
+	bs, _ := json.Marshal(roots)
+	writeStackFiles(t, workspace, map[string]string{
+		"stack/stack.json": string(bs),
+		"stack/vpc/tfstate.json": `{"format_version":"1.0","values":{"outputs":{"id":{"value":"v"}},` +
+			`"root_module":{"resources":[{"address":"aws_vpc.a","type":"aws_vpc"}]}}}`,
+		"stack/ecs/tfstate.json": `{"format_version":"1.0","values":{"root_module":{"child_modules":[` +
+			`{"address":"module.web","resources":[{"address":"module.web.aws_instance.a","depends_on":["aws_eip.b"]}]}]}}}`,
+		"stack/vpc/tfplan.json": `{"resource_changes":[{"address":"aws_vpc.a","change":{"actions":["create"]}}]}`,
+		"stack/ecs/tfplan.json": ``,
+	})
+
+	assert.NoError(t, MergeStackOutputs("env-1", "run-1"))
+
+	state := struct {
+		Values struct {
+			Outputs    map[string]interface{} `json:"outputs"`
+			RootModule struct {
+				ChildModules []struct {
+					Address      string                   `json:"address"`
+					StackRoot    string                   `json:"cloudiac_stack_root"`
+					Resources    []map[string]interface{} `json:"resources"`
+					ChildModules []struct {
+						Address   string                   `json:"address"`
+						Resources []map[string]interface{} `json:"resources"`
+					} `json:"child_modules"`
+				} `json:"child_modules"`
+			} `json:"root_module"`
+		} `json:"values"`
+	}{}
+	content, err := FetchStateJson("env-1", "run-1")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(content, &state))
+
+	assert.Contains(t, state.Values.Outputs, "vpc.id")
+	modules := state.Values.RootModule.ChildModules
+	assert.Len(t, modules, 2)
+	assert.Equal(t, "module.vpc", modules[0].Address)
+	assert.Equal(t, "vpc", modules[0].StackRoot)
+	assert.Equal(t, "module.vpc.aws_vpc.a", modules[0].Resources[0]["address"])
+	assert.Equal(t, "module.ecs.module.web", modules[1].ChildModules[0].Address)
+	assert.Equal(t, "module.ecs.module.web.aws_instance.a", modules[1].ChildModules[0].Resources[0]["address"])
+	assert.Equal(t, []interface{}{"module.ecs.aws_eip.b"}, modules[1].ChildModules[0].Resources[0]["depends_on"])
+
+	plan := struct {
+		ResourceChanges []map[string]interface{} `json:"resource_changes"`
+	}{}
+	content, err = FetchPlanJson("env-1", "run-1")
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(content, &plan))
+	assert.Len(t, plan.ResourceChanges, 1)
+	assert.Equal(t, "module.vpc.aws_vpc.a", plan.ResourceChanges[0]["address"])
+	assert.Equal(t, "module.vpc", plan.ResourceChanges[0]["module_address"])
+}
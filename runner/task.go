@@ -16,6 +16,7 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
@@ -25,6 +26,7 @@ type Task struct {
 	logger logs.Logger
 	// config    configs.RunnerConfig
 	workspace string
+	stackRoot *StackRoot // 在 stack 的某个根目录中执行步骤时设置
 }
 
 func NewTask(req RunTaskReq, logger logs.Logger) *Task {
@@ -156,13 +158,27 @@ func (t *Task) buildVarsAndCmdEnv(cmd *Executor) error {
 	}
 
 	if t.req.Env.TfVersion == "" {
-		t.req.Env.TfVersion = configs.Get().GetDefaultTerraformVersion()
+		t.req.Env.TfVersion = configs.Get().GetDefaultIacEngineVersion(t.req.Env.IacEngine)
 	}
 	cmd.TerraformVersion = t.req.Env.TfVersion
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TFENV_TERRAFORM_VERSION=%s", cmd.TerraformVersion))
+	cmd.IacEngine = t.req.Env.IacEngine
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", t.engine().VersionEnv, cmd.TerraformVersion))
+	if t.req.Env.StackType == common.StackTypeTerragrunt {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("TERRAGRUNT_TFPATH=%s", GetIacEngine(t.req.Env.IacEngine).Bin),
+			"TERRAGRUNT_NON_INTERACTIVE=true")
+	}
 	return nil
 }
 
+func (t *Task) engine() IacEngine {
+	engine := GetIacEngine(t.req.Env.IacEngine)
+	if t.req.Env.StackType == common.StackTypeTerragrunt {
+		// terragrunt 通过 TERRAGRUNT_TFPATH 环境变量调用 terraform/tofu
+		engine.Bin = TerragruntBin
+	}
+	return engine
+}
+
 func (t *Task) generateCommand(cmd string) []string {
 	cmds := []string{"/bin/sh"}
 	if utils.IsTrueStr(t.req.Env.EnvironmentVars["CLOUDIAC_DEBUG"]) {
@@ -200,6 +216,10 @@ func (t *Task) runStep() (err error) {
 		return err
 	}
 
+	if t.req.StateStore.Backend == common.StateBackendHttp && t.req.StateStore.Password != "" {
+		command = fmt.Sprintf("export TF_HTTP_PASSWORD='%s'\n%s", t.req.StateStore.Password, command)
+	}
+
 	execId, err := (&Executor{}).RunCommand(t.req.ContainerId, t.generateCommand(command))
 	if err != nil {
 		return err
@@ -214,6 +234,7 @@ func (t *Task) runStep() (err error) {
 		StatePath:     t.req.StateStore.Path,
 		ContainerId:   t.req.ContainerId,
 		PauseOnFinish: t.req.PauseTask,
+		Artifacts:     t.req.StepArtifacts,
 		ExecId:        execId,
 		StartedAt:     &now,
 		Timeout:       t.req.Timeout,
@@ -287,12 +308,26 @@ func (t *Task) initWorkspace() (workspace string, err error) {
 	if err = t.genTerraformrcFile(workspace); err != nil {
 		return workspace, errors.Wrap(err, "generate terraformrc file")
 	}
+	if err = os.MkdirAll(filepath.Join(workspace, ArtifactsDir), 0755); err != nil {
+		return workspace, err
+	}
+	if len(t.req.InputArtifacts) > 0 {
+		if err = ExtractArtifacts(t.req.InputArtifacts, filepath.Join(workspace, ArtifactsDir)); err != nil {
+			return workspace, errors.Wrap(err, "extract input artifacts")
+		}
+	}
 
 	return workspace, nil
 }
 
 var iacTerraformTpl = template.Must(template.New("").Parse(` terraform {
   backend "{{.State.Backend}}" {
+{{- if eq .State.Backend "http"}}
+    address        = "{{.State.Address}}"
+    lock_address   = "{{.State.Address}}"
+    unlock_address = "{{.State.Address}}"
+    username       = "{{.State.Username}}"
+{{- else}}
     address = "{{.State.Address}}"
     scheme  = "{{.State.Scheme}}"
     path    = "{{.State.Path}}"
@@ -304,6 +339,7 @@ var iacTerraformTpl = template.Must(template.New("").Parse(` terraform {
     cert_file = "{{.State.CapemPath}}"
     key_file = "{{.State.CakeyPath}}"
 	{{end}}
+{{- end}}
   }
 }
 
@@ -330,8 +366,8 @@ func (t *Task) genEnvironmentFile(workspace string) error {
 	return os.WriteFile(path, b, 0644) //nolint:gosec
 }
 
-func (t *Task) genIacTfFile(workspace string) error {
-	if t.req.StateStore.Address == "" {
+func (t *Task) fillStateAddress() {
+	if t.req.StateStore.Backend != common.StateBackendHttp && t.req.StateStore.Address == "" {
 		if os.Getenv("IAC_WORKER_CONSUL") != "" {
 			t.req.StateStore.Address = os.Getenv("IAC_WORKER_CONSUL")
 			//t.req.StateStore.Backend = "consul"
@@ -340,6 +376,10 @@ func (t *Task) genIacTfFile(workspace string) error {
 			t.req.StateStore.Address = configs.Get().Consul.Address
 		}
 	}
+}
+
+func (t *Task) genIacTfFile(workspace string) error {
+	t.fillStateAddress()
 	ctx := map[string]interface{}{
 		"Workspace":      workspace,
 		"PrivateKeyPath": t.up2Workspace("ssh_key"),
@@ -425,8 +465,8 @@ var terraformrcTpl = template.Must(template.New("").Parse(`provider_installation
   {{ if .NetworkMirrorUrl }}
   network_mirror {
     url = "{{.NetworkMirrorUrl}}"
-    include = ["registry.terraform.io/*/*"]
-    exclude = ["registry.terraform.io/idcos/*"]
+    include = ["{{.Registry}}/*/*"]
+    exclude = ["{{.Registry}}/idcos/*"]
   }
   {{ end }}
 
@@ -440,16 +480,19 @@ func (t *Task) genTerraformrcFile(workspace string) error {
 
 	// 默认情况下我们只针对 idcos 命名空间下的 provider 禁用 terraform 官方 registry
 	// （如果不主动禁用，terraform cli 的默认行为总是会查询官方 registry 获取 provider 版本列表）
-	directExclude := "registry.terraform.io/idcos/*"
+	// opentofu 默认的 registry 为 registry.opentofu.org，同时会兼容读取 ~/.terraformrc 配置
+	registry := t.engine().Registry
+	directExclude := registry + "/idcos/*"
 	offline := configs.Get().Runner.OfflineMode
 	if offline || t.req.NetworkMirror != "" {
 		// 如果开启了 offline 或者 network mirror 则全局禁用 terraform 默认 registry
-		directExclude = "registry.terraform.io/*/*"
+		directExclude = registry + "/*/*"
 	}
 
 	return execTpl2File(terraformrcTpl, map[string]interface{}{
 		"NetworkMirrorUrl": t.req.NetworkMirror,
 		"DirectExclude":    directExclude,
+		"Registry":         registry,
 	}, path)
 }
 
@@ -495,6 +538,11 @@ func (t *Task) genStepScript() (string, error) {
 		err     error
 	)
 
+	// 合并 stack 各根目录的执行结果，供 plan 之后的合规扫描等步骤使用
+	if err = MergeStackOutputs(t.req.Env.Id, t.req.TaskId); err != nil {
+		return "", errors.Wrap(err, "merge stack outputs")
+	}
+
 	switch t.req.StepType {
 	case common.TaskStepCheckout:
 		command, err = t.stepCheckout()
@@ -512,6 +560,12 @@ func (t *Task) genStepScript() (string, error) {
 		command, err = t.stepCommand()
 	case common.TaskStepCollect:
 		command, err = t.collectCommand()
+	case common.TaskStepStateRestore:
+		command, err = t.stepStateRestore()
+	case common.TaskStepTfImport:
+		command, err = t.stepImport()
+	case common.TaskStepStateOperation:
+		command, err = t.stepStateOperation()
 	case common.TaskStepScanInit:
 		command, err = t.stepScanInit()
 	case common.TaskStepOpaScan:
@@ -617,9 +671,9 @@ var initCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
 {{if .Before}}{{.Before}} && \{{- end}}
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
-tfenv install $TFENV_TERRAFORM_VERSION && \
-tfenv use $TFENV_TERRAFORM_VERSION  && \
-terraform init -input=false {{- range $arg := .Req.StepArgs }} {{$arg}}{{ end }} {{- if .After}} && \
+{{.Engine.VersionTool}} install ${{.Engine.VersionEnv}} && \
+{{.Engine.VersionTool}} use ${{.Engine.VersionEnv}}  && \
+{{.Engine.Bin}} init -input=false {{- range $arg := .Req.StepArgs }} {{$arg}}{{ end }} {{- if .After}} && \
 {{.After}}{{- end}}
 `))
 
@@ -635,10 +689,40 @@ func (t *Task) up2Workspace(name string) string {
 	return filepath.Join(append(ups, name)...)
 }
 
+// outputFile 步骤输出到 workspace 根目录的文件在脚本中的访问路径。
+// stack 根目录的输出保存在 stack/<root> 目录下，并使用绝对路径(terragrunt 会在缓存目录中执行 terraform)
+func (t *Task) outputFile(name string) string {
+	if t.stackRoot != nil {
+		return filepath.Join(ContainerWorkspace, StackDir, t.stackRoot.Name, name)
+	}
+	return t.up2Workspace(name)
+}
+
+// planFile plan 步骤生成的 plan 文件在脚本中的访问路径。
+// stack 根目录使用绝对路径，terragrunt 在缓存目录中执行 terraform，相对路径的 plan 文件不会生成在根目录下
+func (t *Task) planFile() string {
+	if t.stackRoot != nil {
+		return filepath.Join(ContainerWorkspace, StackDir, t.stackRoot.Name, "_cloudiac.tfplan")
+	}
+	return "_cloudiac.tfplan"
+}
+
+// inputFile workspace 根目录下的输入文件在脚本中的访问路径
+func (t *Task) inputFile(name string) string {
+	if t.stackRoot != nil {
+		return filepath.Join(ContainerWorkspace, name)
+	}
+	return t.up2Workspace(name)
+}
+
 func (t *Task) stepInit() (command string, err error) {
+	if t.isStack() {
+		return t.stackStepScript((*Task).stepInit)
+	}
 	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
 	return t.executeTpl(initCommandTpl, map[string]interface{}{
 		"Req":                t.req,
+		"Engine":             t.engine(),
 		"PluginCachePath":    ContainerPluginCachePath,
 		"Before":             beforeCmds,
 		"After":              afterCmds,
@@ -650,12 +734,15 @@ var planCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
 {{if .Before}}{{.Before}} && \{{- end}}
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
-terraform plan -detailed-exitcode -input=false -out=_cloudiac.tfplan \
+{{.Engine.Bin}} plan -detailed-exitcode -input=false -out={{.PlanFile}} \
 {{if .TfVars}}-var-file={{.TfVars}} {{end}}-var-file={{.IacTfVars}} \
 {{ range $arg := .Req.StepArgs }}{{$arg}} {{ end }}
 status=$?
-terraform show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}}
+{{.Engine.Bin}} show -no-color -json {{.PlanFile}} >{{.TFPlanJsonFilePath}}
 cat {{.TFPlanJsonFilePath}}
+# 保存 plan 文件及 plan 时的 state，用于后续直接基于该 plan 文件部署
+cp {{.PlanFile}} {{.TFPlanFilePath}}
+{{.Engine.Bin}} state pull >{{.TFStateFilePath}} 2>/dev/null
 if [[ "$status" == "0" ]]; then
   echo "+--------+--------------------------------------------+"
   echo "| CHANGE |                    NAME                    |"
@@ -673,13 +760,20 @@ fi
 `))
 
 func (t *Task) stepPlan() (command string, err error) {
+	if t.isStack() {
+		return t.stackStepScript((*Task).stepPlan)
+	}
 	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
 	return t.executeTpl(planCommandTpl, map[string]interface{}{
 		"Req":                t.req,
+		"Engine":             t.engine(),
 		"TfVars":             t.req.Env.TfVarsFile,
 		"TFNeedSummarize":    t.req.Env.EnvironmentVars["TFNeedSummarize"],
-		"IacTfVars":          t.up2Workspace(CloudIacTfvarsJson),
-		"TFPlanJsonFilePath": t.up2Workspace(TFPlanJsonFile),
+		"PlanFile":           t.planFile(),
+		"IacTfVars":          t.inputFile(CloudIacTfvarsJson),
+		"TFPlanJsonFilePath": t.outputFile(TFPlanJsonFile),
+		"TFPlanFilePath":     t.outputFile(TFPlanFile),
+		"TFStateFilePath":    t.outputFile(TFStateFile),
 		"Before":             beforeCmds,
 		"After":              afterCmds,
 		"ContainerWorkspace": ContainerWorkspace,
@@ -691,25 +785,41 @@ var applyCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
 {{if .Before}}{{.Before}} && \{{- end}}
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
-terraform apply -input=false -auto-approve \
-{{ range $arg := .Req.StepArgs}}{{$arg}} {{ end }}_cloudiac.tfplan {{- if .After}} && \
+{{.Engine.Bin}} apply -input=false -auto-approve \
+{{ range $arg := .Req.StepArgs}}{{$arg}} {{ end }}{{.PlanFilePath}} {{- if .After}} && \
 {{.After}}{{- end}}
 
 result=$?
 
 # state collect command
 cd '{{.ContainerWorkspace}}/code/{{.Req.Env.Workdir}}' && \
-terraform show -no-color -json >{{.TFStateJsonFilePath}} && \
-terraform providers schema -json > {{.TFProviderSchema}}
+{{.Engine.Bin}} show -no-color -json >{{.TFStateJsonFilePath}} && \
+{{.Engine.Bin}} state pull >{{.TFStateFilePath}} && \
+{{.Engine.Bin}} providers schema -json > {{.TFProviderSchema}}
 exit $result
 `))
 
 func (t *Task) stepApply() (command string, err error) {
+	if t.isStack() {
+		return t.stackStepScript((*Task).stepApply)
+	}
 	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
+	planFilePath := t.planFile()
+	if len(t.req.PlanFile) > 0 {
+		// 基于已完成的 plan 任务部署，直接执行该任务生成的 plan 文件
+		path := filepath.Join(GetTaskWorkspace(t.req.Env.Id, t.req.TaskId), TFPlanFile)
+		if err := os.WriteFile(path, t.req.PlanFile, 0600); err != nil {
+			return "", errors.Wrap(err, "write plan file")
+		}
+		planFilePath = t.up2Workspace(TFPlanFile)
+	}
 	return t.executeTpl(applyCommandTpl, map[string]interface{}{
 		"Req":                 t.req,
-		"TFStateJsonFilePath": t.up2Workspace(TFStateJsonFile),
-		"TFProviderSchema":    t.up2Workspace(TFProviderSchema),
+		"Engine":              t.engine(),
+		"PlanFilePath":        planFilePath,
+		"TFStateJsonFilePath": t.outputFile(TFStateJsonFile),
+		"TFStateFilePath":     t.outputFile(TFStateFile),
+		"TFProviderSchema":    t.outputFile(TFProviderSchema),
 		"Before":              beforeCmds,
 		"After":               afterCmds,
 		"ContainerWorkspace":  ContainerWorkspace,
@@ -717,13 +827,19 @@ func (t *Task) stepApply() (command string, err error) {
 }
 
 func (t *Task) stepDestroy() (command string, err error) {
+	if t.isStack() {
+		return t.stackStepScript((*Task).stepDestroy)
+	}
 	// destroy 任务通过会先执行 plan(传入 --destroy 参数)，然后再 apply plan 文件实现。
 	// 这样可以保证 destroy 时执行的是用户审批时看到的 plan 内容
 	beforeCmds, afterCmds := getBeforeAfterCmds(t.req.StepBeforeCmds, t.req.StepAfterCmds)
 	return t.executeTpl(applyCommandTpl, map[string]interface{}{
 		"Req":                 t.req,
-		"TFStateJsonFilePath": t.up2Workspace(TFStateJsonFile),
-		"TFProviderSchema":    t.up2Workspace(TFProviderSchema),
+		"Engine":              t.engine(),
+		"PlanFilePath":        t.planFile(),
+		"TFStateJsonFilePath": t.outputFile(TFStateJsonFile),
+		"TFStateFilePath":     t.outputFile(TFStateFile),
+		"TFProviderSchema":    t.outputFile(TFProviderSchema),
 		"Before":              beforeCmds,
 		"After":               afterCmds,
 		"ContainerWorkspace":  ContainerWorkspace,
@@ -777,15 +893,127 @@ func (t *Task) stepCommand() (command string, err error) {
 // collect command 失败不影响任务状态
 var collectCommandTpl = template.Must(template.New("").Parse(`# state collect command
 cd 'code/{{.Req.Env.Workdir}}' && \
-terraform show -no-color -json >{{.TFStateJsonFilePath}} && \
-terraform providers schema -json > {{.TFProviderSchema}}
+{{.Engine.Bin}} show -no-color -json >{{.TFStateJsonFilePath}} && \
+{{.Engine.Bin}} state pull >{{.TFStateFilePath}} && \
+{{.Engine.Bin}} providers schema -json > {{.TFProviderSchema}}
 `))
 
 func (t *Task) collectCommand() (string, error) {
+	if t.isStack() {
+		return t.stackStepScript((*Task).collectCommand)
+	}
 	return t.executeTpl(collectCommandTpl, map[string]interface{}{
 		"Req":                 t.req,
-		"TFStateJsonFilePath": t.up2Workspace(TFStateJsonFile),
-		"TFProviderSchema":    t.up2Workspace(TFProviderSchema),
+		"Engine":              t.engine(),
+		"TFStateJsonFilePath": t.outputFile(TFStateJsonFile),
+		"TFStateFilePath":     t.outputFile(TFStateFile),
+		"TFProviderSchema":    t.outputFile(TFProviderSchema),
+	})
+}
+
+// 历史版本 state 的 serial 通常小于当前 state，所以需要使用 -force 参数强制推送
+var stateRestoreCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+{{.Engine.Bin}} state push -force {{.TFRestoreFilePath}}
+`))
+
+func (t *Task) stepStateRestore() (string, error) {
+	if len(t.req.RestoreState) == 0 {
+		return "", fmt.Errorf("restore state is empty")
+	}
+	if t.req.Env.StackType != "" {
+		return "", fmt.Errorf("stack template does not support state restore")
+	}
+	path := filepath.Join(GetTaskWorkspace(t.req.Env.Id, t.req.TaskId), TFRestoreFile)
+	if err := os.WriteFile(path, t.req.RestoreState, 0600); err != nil {
+		return "", errors.Wrap(err, "write restore state")
+	}
+	return t.executeTpl(stateRestoreCommandTpl, map[string]interface{}{
+		"Req":               t.req,
+		"Engine":            t.engine(),
+		"TFRestoreFilePath": t.up2Workspace(TFRestoreFile),
+	})
+}
+
+// 使用 terraform import 命令逐个导入资源(import 块需要 apply 才会执行导入，会同时变更资源)，
+// 已在 state 中的资源跳过导入，保证任务重试时不会因资源已存在而失败
+var importCommandTpl = template.Must(template.New("").Funcs(template.FuncMap{
+	"quote": shellescape.Quote,
+}).Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+{{- range $i := .Req.Imports}}
+if {{$.Engine.Bin}} state list {{quote $i.Address}} 2>/dev/null | grep -q .; then \
+  echo 'Resource already managed, skipped:' {{quote $i.Address}}; \
+else \
+  {{$.Engine.Bin}} import -input=false {{if $.TfVars}}-var-file={{$.TfVars}} {{end}}-var-file={{$.IacTfVars}} {{quote $i.Address}} {{quote $i.Id}}; \
+fi && \
+{{- end}}
+true
+`))
+
+func (t *Task) stepImport() (string, error) {
+	if len(t.req.Imports) == 0 {
+		return "", fmt.Errorf("import resources is empty")
+	}
+	if t.req.Env.StackType != "" {
+		return "", fmt.Errorf("stack template does not support import")
+	}
+	return t.executeTpl(importCommandTpl, map[string]interface{}{
+		"Req":       t.req,
+		"Engine":    t.engine(),
+		"TfVars":    t.req.Env.TfVarsFile,
+		"IacTfVars": t.inputFile(CloudIacTfvarsJson),
+	})
+}
+
+// 每个操作执行前输出执行的命令，便于在步骤日志中审计
+var stateOperationCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+{{- range $cmd := .Commands}}
+echo '$' {{$cmd}} && {{$cmd}} && \
+{{- end}}
+true
+`))
+
+func (t *Task) stateOperationCommands() ([]string, error) {
+	bin := t.engine().Bin
+	cmds := make([]string, 0, len(t.req.StateOps))
+	for _, op := range t.req.StateOps {
+		if op.Address == "" {
+			return nil, fmt.Errorf("state operation '%s' address is empty", op.Type)
+		}
+		addr := shellescape.Quote(op.Address)
+		switch op.Type {
+		case "mv":
+			if op.Destination == "" {
+				return nil, fmt.Errorf("state mv destination is empty")
+			}
+			cmds = append(cmds, fmt.Sprintf("%s state mv %s %s", bin, addr, shellescape.Quote(op.Destination)))
+		case "rm":
+			cmds = append(cmds, fmt.Sprintf("%s state rm %s", bin, addr))
+		case "taint", "untaint":
+			cmds = append(cmds, fmt.Sprintf("%s %s %s", bin, op.Type, addr))
+		default:
+			return nil, fmt.Errorf("unknown state operation '%s'", op.Type)
+		}
+	}
+	return cmds, nil
+}
+
+func (t *Task) stepStateOperation() (string, error) {
+	if len(t.req.StateOps) == 0 {
+		return "", fmt.Errorf("state operations is empty")
+	}
+	if t.req.Env.StackType != "" {
+		return "", fmt.Errorf("stack template does not support state operation")
+	}
+	cmds, err := t.stateOperationCommands()
+	if err != nil {
+		return "", err
+	}
+	return t.executeTpl(stateOperationCommandTpl, map[string]interface{}{
+		"Req":      t.req,
+		"Commands": cmds,
 	})
 }
 
@@ -861,7 +1089,7 @@ mkdir -p {{.PoliciesDir}} && \
 mkdir -p ~/.terrascan/pkg/policies/opa/rego/aws && \
 terrascan scan --config-only -o json --iac-type terraform > {{.ScanInputMapFile}} 2>/dev/null && \
 /usr/yunji/cloudiac/iac-tool scan --parse-plan --plan {{.TerraformPlanFile}} > {{.ScanInputFile}} && \
-/usr/yunji/cloudiac/iac-tool scan --internal -p {{.PoliciesDir}} -i {{.ScanInputFile}} -m {{.ScanInputMapFile}} -o {{.ScanResultFile}}
+/usr/yunji/cloudiac/iac-tool scan --internal -p {{.PoliciesDir}} -i {{.ScanInputFile}} -m {{.ScanInputMapFile}} --plan {{.TerraformPlanFile}} -o {{.ScanResultFile}}
 `))
 
 func (t *Task) stepEnvScan() (command string, err error) {
@@ -1,6 +1,7 @@
 package runner
 
 import (
+	"cloudiac/common"
 	"cloudiac/configs"
 	"cloudiac/utils/logs"
 	"os"
@@ -152,3 +153,161 @@ func removeSpace(s string) string {
 	s = strings.ReplaceAll(s, "\n", "")
 	return s
 }
+
+func TestGenIacTfFile(t *testing.T) {
+	configs.Set(&configs.Config{})
+
+	dir, err := os.MkdirTemp("", "cloudiac-runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	task := Task{
+		req: RunTaskReq{
+			StateStore: StateStore{
+				Backend:  "http",
+				Address:  "http://portal.example.org/api/v1/tfstate/env-xxx",
+				Path:     "org-xxx/p-xxx/env-xxx/terraform.tfstate",
+				Username: "run-xxx",
+				Password: "token",
+			},
+		},
+		logger: logs.Get(),
+	}
+	if err := task.genIacTfFile(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, CloudIacTfFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, removeSpace(string(content)), removeSpace(`backend "http" {
+    address        = "http://portal.example.org/api/v1/tfstate/env-xxx"
+    lock_address   = "http://portal.example.org/api/v1/tfstate/env-xxx"
+    unlock_address = "http://portal.example.org/api/v1/tfstate/env-xxx"
+    username       = "run-xxx"
+  }`))
+	assert.NotContains(t, string(content), "scheme")
+	assert.NotContains(t, string(content), "token")
+}
+
+func TestStepApplyWithPlanFile(t *testing.T) {
+	configs.Set(&configs.Config{Runner: configs.RunnerConfig{StoragePath: t.TempDir()}})
+
+	task := Task{
+		req: RunTaskReq{
+			Env:    TaskEnv{Id: "env-xxx", Workdir: "sub"},
+			TaskId: "run-xxx",
+		},
+		logger: logs.Get(),
+	}
+	assert.NoError(t, os.MkdirAll(GetTaskWorkspace("env-xxx", "run-xxx"), 0755))
+
+	command, err := task.stepApply()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "_cloudiac.tfplan")
+
+	task.req.PlanFile = []byte("plan-content")
+	command, err = task.stepApply()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "../../"+TFPlanFile)
+	assert.NotContains(t, command, "_cloudiac.tfplan")
+
+	content, err := os.ReadFile(filepath.Join(GetTaskWorkspace("env-xxx", "run-xxx"), TFPlanFile))
+	assert.NoError(t, err)
+	assert.Equal(t, "plan-content", string(content))
+}
+
+func TestStepCommandWithIacEngine(t *testing.T) {
+	configs.Set(&configs.Config{Runner: configs.RunnerConfig{StoragePath: t.TempDir()}})
+
+	task := Task{
+		req: RunTaskReq{
+			Env:    TaskEnv{Id: "env-xxx", Workdir: "sub"},
+			TaskId: "run-xxx",
+		},
+		logger: logs.Get(),
+	}
+
+	command, err := task.stepInit()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "tfenv install $TFENV_TERRAFORM_VERSION")
+	assert.Contains(t, command, "terraform init -input=false")
+
+	task.req.Env.IacEngine = common.IacEngineOpenTofu
+	command, err = task.stepInit()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "tofuenv install $TOFUENV_TOFU_VERSION")
+	assert.Contains(t, command, "tofu init -input=false")
+	assert.NotContains(t, command, "terraform")
+
+	command, err = task.stepApply()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "tofu apply -input=false")
+	assert.Contains(t, command, "tofu state pull")
+	assert.NotContains(t, command, "terraform ")
+}
+
+func TestStepImport(t *testing.T) {
+	task := Task{
+		req: RunTaskReq{
+			Env:    TaskEnv{Id: "env-xxx", Workdir: "sub", TfVarsFile: "prod.tfvars"},
+			TaskId: "run-xxx",
+		},
+		logger: logs.Get(),
+	}
+
+	_, err := task.stepImport()
+	assert.Error(t, err)
+
+	task.req.Imports = []TaskImport{
+		{Address: "aws_instance.web", Id: "i-123"},
+		{Address: `aws_s3_bucket.b["logs"]`, Id: "my bucket"},
+	}
+	command, err := task.stepImport()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "terraform import -input=false -var-file=prod.tfvars -var-file=../../"+
+		CloudIacTfvarsJson+" aws_instance.web i-123;")
+	assert.Contains(t, command, `'aws_s3_bucket.b["logs"]' 'my bucket';`)
+	assert.Contains(t, command, "terraform state list aws_instance.web")
+
+	task.req.Env.StackType = "terragrunt"
+	_, err = task.stepImport()
+	assert.Error(t, err)
+}
+
+func TestStepStateOperation(t *testing.T) {
+	task := Task{
+		req: RunTaskReq{
+			Env:    TaskEnv{Id: "env-xxx", Workdir: "sub"},
+			TaskId: "run-xxx",
+		},
+		logger: logs.Get(),
+	}
+
+	_, err := task.stepStateOperation()
+	assert.Error(t, err)
+
+	task.req.StateOps = []TaskStateOp{
+		{Type: "mv", Address: "aws_instance.web", Destination: "module.app.aws_instance.web"},
+		{Type: "rm", Address: `aws_s3_bucket.b["logs"]`},
+		{Type: "taint", Address: "aws_instance.db"},
+		{Type: "untaint", Address: "aws_instance.db"},
+	}
+	command, err := task.stepStateOperation()
+	assert.NoError(t, err)
+	assert.Contains(t, command, "terraform state mv aws_instance.web module.app.aws_instance.web &&")
+	assert.Contains(t, command, `terraform state rm 'aws_s3_bucket.b["logs"]' &&`)
+	assert.Contains(t, command, "terraform taint aws_instance.db &&")
+	assert.Contains(t, command, "terraform untaint aws_instance.db &&")
+
+	task.req.StateOps = []TaskStateOp{{Type: "mv", Address: "aws_instance.web"}}
+	_, err = task.stepStateOperation()
+	assert.Error(t, err)
+
+	task.req.StateOps = []TaskStateOp{{Type: "import", Address: "aws_instance.web"}}
+	_, err = task.stepStateOperation()
+	assert.Error(t, err)
+}
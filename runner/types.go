@@ -22,6 +22,10 @@ type TaskEnv struct {
 	Playbook     string `json:"playbook"`
 	PlayVarsFile string `json:"playVarsFile"`
 	TfVersion    string `json:"tfVersion"`
+	IacEngine    string `json:"iacEngine"` // terraform 或 opentofu，为空时为 terraform
+
+	StackType  string   `json:"stackType"`  // 多工作目录模板类型(multi/terragrunt)，为空表示单个工作目录
+	StackRoots []string `json:"stackRoots"` // 多工作目录模板指定的根目录列表，为空时自动发现
 
 	EnvironmentVars map[string]string `json:"environment"`
 	TerraformVars   map[string]string `json:"terraform"`
@@ -38,7 +42,12 @@ type StateStore struct {
 	CaPath      string `json:"ca_path" binding:""`
 	CakeyPath   string `json:"cakey_path" binding:""`
 	CapemPath   string `json:"capem_path" binding:""`
-	Address     string `json:"address" binding:""` // consul 地址 runner 会自动设置
+	Address     string `json:"address" binding:""` // consul 地址 runner 会自动设置; http backend 时为 state 接口地址
+
+	// http backend 认证信息，password 每个步骤执行前都会重新生成，
+	// 所以不写入 backend 配置，而是通过 TF_HTTP_PASSWORD 环境变量传入
+	Username string `json:"username" binding:""`
+	Password string `json:"password" binding:""`
 }
 
 type RunTaskReq struct {
@@ -50,6 +59,7 @@ type RunTaskReq struct {
 	StepArgs       []string   `json:"stepArgs"`
 	StepBeforeCmds []string   `json:"stepBeforeCmds"`
 	StepAfterCmds  []string   `json:"stepAfterCmds"`
+	StepArtifacts  []string   `json:"stepArtifacts"` // 步骤结束后需要收集的文件(相对 workdir)
 	DockerImage    string     `json:"dockerImage"`
 	StateStore     StateStore `json:"stateStore" binding:""`
 	RepoAddress    string     `json:"repoAddress" binding:""` // 带 token 的完整路径
@@ -72,6 +82,14 @@ type RunTaskReq struct {
 	PauseTask   bool   `json:"pauseTask"` // 本次执行结束后暂停任务
 
 	CreatorId string `json:"creatorId"`
+
+	RestoreState []byte `json:"restoreState"` // state 恢复任务要推送的 state 内容
+	PlanFile     []byte `json:"planFile"`     // 部署步骤直接执行的 plan 文件(基于已完成的 plan 任务部署时传入)
+
+	Imports  []TaskImport  `json:"imports"`  // 导入任务要导入的资源
+	StateOps []TaskStateOp `json:"stateOps"` // state 操作任务要执行的操作
+
+	InputArtifacts []byte `json:"inputArtifacts"` // 任务启动时恢复到 artifacts 目录的文件(zip 格式)，只在第一个步骤传递
 }
 
 func (r RunTaskReq) Validate() error {
@@ -84,6 +102,8 @@ func (r RunTaskReq) Validate() error {
 		{"playbook", r.Env.Playbook},
 		{"tfVarsFile", r.Env.TfVarsFile},
 		{"tfVersion", r.Env.TfVersion},
+		{"iacEngine", r.Env.IacEngine},
+		{"stackType", r.Env.StackType},
 	}
 
 	for _, v := range vs {
@@ -95,6 +115,17 @@ func (r RunTaskReq) Validate() error {
 	return nil
 }
 
+type TaskImport struct {
+	Address string `json:"address"` // 资源地址，如 aws_instance.web
+	Id      string `json:"id"`      // 资源在云平台上的 id
+}
+
+type TaskStateOp struct {
+	Type        string `json:"type"`                  // 操作类型: mv, rm, taint, untaint
+	Address     string `json:"address"`               // 资源地址
+	Destination string `json:"destination,omitempty"` // mv 操作的目标地址
+}
+
 type Repository struct {
 	RepoAddress  string `json:"repoAddress" binding:""` // 带 token 的完整路径
 	RepoRevision string `json:"repoRevision" binding:""`
@@ -138,6 +169,7 @@ type Meta struct {
 	Version       int    `json:"version"`
 	FixSuggestion string `json:"fix_suggestion"`
 	Description   string `json:"description"`
+	InputType     string `json:"input_type"`
 }
 
 type TaskLogReq TaskStatusReq
@@ -153,10 +185,21 @@ type TaskStatusMessage struct {
 
 	LogContent           []byte `json:"logContent"`
 	TfStateJson          []byte `json:"tfStateJson"`
+	TfState              []byte `json:"tfState"`
 	TfPlanJson           []byte `json:"tfPlanJson"`
 	TfScanJson           []byte `json:"tfScanJson"`
 	TfResultJson         []byte `json:"tfResultJson"`
 	TFProviderSchemaJson []byte `json:"tfProviderSchemaJson"`
+	TfPlan               []byte `json:"tfPlan"`    // plan 步骤生成的 plan 文件
+	Artifacts            []byte `json:"artifacts"` // 步骤收集的 artifacts(zip 格式)
+
+	StackLogs []StackLog `json:"stackLogs"` // stack 模板步骤在各根目录的执行日志
+}
+
+type StackLog struct {
+	Root    string `json:"root"` // 根目录名称
+	Path    string `json:"path"` // 根目录路径
+	Content []byte `json:"content"`
 }
 
 type ErrorMessage struct {